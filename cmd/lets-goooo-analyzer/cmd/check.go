@@ -0,0 +1,53 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package cmd
+
+import (
+	"fmt"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
+)
+
+// Check lists the anomalies of the given journals, grouped by their category.
+func Check(source JournalSource, locationsPath string) error {
+	if err := readLocations(locationsPath); err != nil {
+		return err
+	}
+	files, err := resolveJournalFiles(source)
+	if err != nil {
+		return err
+	}
+	key, err := loadEncryptionKey(source)
+	if err != nil {
+		return err
+	}
+
+	anomalies := make(map[journal.AnomalyKind][]journal.Anomaly, len(journal.AnomalyKinds))
+	found := 0
+	for _, file := range files {
+		fileAnomalies, err := journal.CheckJournal(file, key)
+		if err != nil {
+			return NewError(500, fmt.Sprintf("failed to check journal \"%s\"", file), err)
+		}
+		for _, anomaly := range fileAnomalies {
+			anomalies[anomaly.Kind] = append(anomalies[anomaly.Kind], anomaly)
+		}
+		found += len(fileAnomalies)
+	}
+
+	if found == 0 {
+		fmt.Printf("No anomalies found in %d journals\n", len(files))
+		return nil
+	}
+	for _, kind := range journal.AnomalyKinds {
+		if len(anomalies[kind]) == 0 {
+			continue
+		}
+		fmt.Printf("%s (%d):\n", kind, len(anomalies[kind]))
+		for _, anomaly := range anomalies[kind] {
+			fmt.Printf("  %s\n", anomaly.String())
+		}
+	}
+	return NewError(422, fmt.Sprintf("found %d anomalies in %d journals", found, len(files)), nil)
+}
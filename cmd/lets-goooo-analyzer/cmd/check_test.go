@@ -0,0 +1,47 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func ExampleCheck() {
+	err := Check(testSource("testdata/journal_anomalies.txt", "testdata/journal.txt"), "testdata/locations.xml")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// unknown location (1):
+	//   testdata/journal_anomalies.txt:6: couldn't resolve loc code "XXX": unknown location
+	// logout without login (1):
+	//   testdata/journal_anomalies.txt:3: Tester logged out at Teststadt without a login there
+	// double login (1):
+	//   testdata/journal_anomalies.txt:5: Tester logged in at Hauptstadt while still logged in at Teststadt
+	// timestamp going backwards (1):
+	//   testdata/journal_anomalies.txt:7: Login of Klaus happened 8m20s before the previous event
+	// Error: error 422: found 4 anomalies in 2 journals
+}
+
+func ExampleCheck_clean() {
+	err := Check(testSource("testdata/journal.txt"), "testdata/locations.xml")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// No anomalies found in 1 journals
+}
+
+func TestCheck(t *testing.T) {
+	assert.Error(t, Check(testSource("testdata/missingno"), "testdata/locations.xml"))
+	assert.Error(t, Check(testSource("testdata/journal_encrypted.txt"), "testdata/locations.xml"), "encrypted journals need a key")
+	source := testSource("testdata/journal_encrypted.txt")
+	source.EncryptionKey = "thisis32bitlongpassphraseimusing"
+	assert.NoError(t, Check(source, "testdata/locations.xml"))
+}
@@ -0,0 +1,42 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package cmd
+
+import (
+	"fmt"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
+)
+
+// Compare compares the journals of a primary server with the replicas of its follower and reports the differences.
+// Replicas that only lag behind are reported, but only diverged replicas fail the comparison.
+func Compare(directory string, replicaDirectory string) error {
+	comparisons, err := journal.CompareReplica(directory, replicaDirectory)
+	if err != nil {
+		return NewError(500, "failed to compare the journals with their replicas", err)
+	}
+
+	inSync, diverged := 0, 0
+	for _, comparison := range comparisons {
+		switch comparison.Status {
+		case journal.INSYNC:
+			fmt.Printf("%s: %s, %d bytes\n", comparison.Name, comparison.Status, comparison.JournalSize)
+			inSync++
+		case journal.MISSING, journal.EXTRA:
+			fmt.Printf("%s: %s\n", comparison.Name, comparison.Status)
+		default:
+			fmt.Printf("%s: %s from line %d, the replica has %d of %d bytes\n",
+				comparison.Name, comparison.Status, comparison.Line, comparison.ReplicaSize, comparison.JournalSize)
+		}
+		if comparison.Diverged() {
+			diverged++
+		}
+	}
+
+	if diverged > 0 {
+		return NewError(422, fmt.Sprintf("%d of %d replicas diverged from their journals", diverged, len(comparisons)), nil)
+	}
+	fmt.Printf("%d of %d journals in sync, no replica diverged\n", inSync, len(comparisons))
+	return nil
+}
@@ -0,0 +1,43 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func ExampleCompare() {
+	err := Compare("testdata/journals", "testdata/replica")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// 20211020.txt: in sync, 153 bytes
+	// 20211021.txt: behind from line 5, the replica has 153 of 261 bytes
+	// 20211022.txt: diverged from line 3, the replica has 108 of 108 bytes
+	// Error: error 422: 1 of 3 replicas diverged from their journals
+}
+
+func ExampleCompare_lagging() {
+	err := Compare("testdata/journals", "testdata/campus")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// 20211020.txt: missing on replica
+	// 20211021.txt: missing on replica
+	// 20211022.txt: missing on replica
+	// 0 of 3 journals in sync, no replica diverged
+}
+
+func TestCompare(t *testing.T) {
+	assert.NoError(t, Compare("testdata/journals", "testdata/journals"))
+	assert.Error(t, Compare("testdata/replica", "testdata/journals"), "a replica with other lines should diverge")
+	assert.Error(t, Compare("testdata/journals", "testdata/missingno"))
+}
@@ -0,0 +1,47 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package cmd
+
+import (
+	"fmt"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
+)
+
+// Duplicates lists the groups of users across the given journals that are likely the same person,
+// allowing names and addresses to differ by maxDistance typos (see journal.FindDuplicates).
+func Duplicates(source JournalSource, locationsPath string, maxDistance int) error {
+	if maxDistance < 0 {
+		return NewError(400, "the maximum number of typos must not be negative", nil)
+	}
+	if err := readLocations(locationsPath); err != nil {
+		return err
+	}
+	iterator, err := openJournal(source)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = iterator.Close() }()
+	for iterator.Next() { // the users are collected while reading the events
+	}
+	if err := journalReadError(iterator.Err()); err != nil {
+		return err
+	}
+	reportSkippedLines(iterator.Diagnostics())
+
+	users := iterator.Users()
+	groups := journal.FindDuplicates(users, maxDistance)
+	if len(groups) == 0 {
+		fmt.Printf("No likely duplicates found among %d users\n", len(users))
+		return nil
+	}
+	for i, group := range groups {
+		fmt.Printf("Group %d:\n", i+1)
+		for _, user := range group {
+			fmt.Printf("  %s (%s)\n", user.Name, describeContact(user))
+		}
+	}
+	fmt.Printf("Found %d groups of likely duplicates among %d users\n", len(groups), len(users))
+	return nil
+}
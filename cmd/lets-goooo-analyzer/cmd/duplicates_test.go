@@ -0,0 +1,51 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func ExampleDuplicates() {
+	err := Duplicates(testSource("testdata/journal_duplicates.txt"), "testdata/locations.xml", 2)
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// Group 1:
+	//   Klaus Müller (Musterdorf)
+	//   Klaus Mueller (Musterdorf)
+	// Group 2:
+	//   Tester (Teststadt)
+	//   Test (Teststadt)
+	// Found 2 groups of likely duplicates among 5 users
+}
+
+func ExampleDuplicates_none() {
+	err := Duplicates(testSource("testdata/journal_duplicates.txt"), "testdata/locations.xml", 0)
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+	err = Duplicates(testSource("testdata/journal.txt"), "testdata/locations.xml", 2)
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// Group 1:
+	//   Klaus Müller (Musterdorf)
+	//   Klaus Mueller (Musterdorf)
+	// Found 1 groups of likely duplicates among 5 users
+	// No likely duplicates found among 2 users
+}
+
+func TestDuplicates_errors(t *testing.T) {
+	assert.Error(t, Duplicates(testSource("testdata/journal.txt"), "testdata/locations.xml", -1))
+	assert.Error(t, Duplicates(testSource("testdata/missingno"), "testdata/locations.xml", 2))
+	assert.Error(t, Duplicates(testSource("testdata/journal.txt"), "testdata/missingno", 2))
+}
@@ -5,42 +5,38 @@
 package cmd
 
 import (
+	"encoding/csv"
 	"fmt"
 	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
-	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"strconv"
 	"strings"
 )
 
-func Export(journalPath string, locationsPath string, csvHeaders bool, outputPath string, outputPerms uint, locationFilterName string) error {
+// exportColumns are the columns of the CSV files written by Export and read by Import
+var exportColumns = []string{"Event type", "Location", "Timestamp", "Name", "Address", "Phone", "Email", "Street", "Postal code", "City"}
+
+// legacyExportColumns is the number of columns of CSV files exported before the contact details were added
+const legacyExportColumns = 5
+
+func Export(source JournalSource, locationsPath string, csvHeaders bool, outputPath string, outputPerms uint, locationFilterName string) error {
 	err := readLocations(locationsPath)
 	if err != nil {
 		return err
 	}
 	var locationFilter *journal.Location = nil
 	if locationFilterName != "" {
-		location, exists := journal.Locations[locationFilterName]
-		if exists {
-			locationFilter = location
-		} else {
-			for _, loc := range journal.Locations {
-				if strings.ToLower(loc.Name) == strings.ToLower(locationFilterName) {
-					locationFilter = loc
-					break
-				}
-			}
-
-			if locationFilter == nil {
-				return NewError(404, fmt.Sprintf("failed to resolve location \"%s\"\n", locationFilterName), nil)
-			}
+		if locationFilter, err = resolveLocation(locationFilterName); err != nil {
+			return err
 		}
 	}
 
-	j, err := readJournal(journalPath)
+	iterator, err := openJournal(source)
 	if err != nil {
 		return err
 	}
-	if outputPath == "" { // set a default output file name
-		outputPath = journalPath + "-export.csv"
+	defer func() { _ = iterator.Close() }()
+	if outputPath == "" { // set a default output file name based on the first journal
+		outputPath = strings.TrimSuffix(source.Paths[0], "/") + "-export.csv"
 	}
 	writer, err := openOutput(outputPath, outputPerms)
 	if err != nil {
@@ -53,29 +49,43 @@ func Export(journalPath string, locationsPath string, csvHeaders bool, outputPat
 		}
 	}()
 
+	// The CSV writer quotes names and addresses with commas, so that they can be imported again
+	csvWriter := csv.NewWriter(writer)
 	if csvHeaders { // Print the CSV headers, if applicable
-		err := util.WriteString(writer, "Event type,Location,Timestamp,Name,Address\n")
-		if err != nil {
+		if err := csvWriter.Write(exportColumns); err != nil {
 			return NewError(500, "failed to write to output", err)
 		}
 	}
-	for _, event := range j.GetEvents() {
+	for iterator.Next() {
+		event := iterator.Event()
 		if locationFilter != nil {
 			if event.Location != locationFilter {
 				continue
 			}
 		}
-		err := util.WriteString(writer, fmt.Sprintf(
-			"%s,%s,%d,%s,%s\n",
-			event.EventType.Name(),
+		err := csvWriter.Write([]string{
+			event.Name(),
 			event.Location.Name,
-			event.Timestamp,
+			strconv.FormatInt(event.OccurredAt(), 10), // automatic logouts are exported at the end of the stay
 			event.User.Name,
 			event.User.Address,
-		))
+			event.User.Phone,
+			event.User.Email,
+			event.User.Street,
+			event.User.PostalCode,
+			event.User.City,
+		})
 		if err != nil {
 			fmt.Printf("Failed to write event to output: %v\n", err)
 		}
 	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return NewError(500, "failed to write to output", err)
+	}
+	if err := journalReadError(iterator.Err()); err != nil {
+		return err
+	}
+	reportSkippedLines(iterator.Diagnostics())
 	return nil
 }
@@ -13,63 +13,153 @@ import (
 )
 
 func ExampleExport_stdoutHeaders() {
-	err := Export("testdata/journal.txt", "testdata/locations.xml", true, "-", 0777, "")
+	err := Export(testSource("testdata/journal.txt"), "testdata/locations.xml", true, "-", 0777, "")
 	if err != nil {
 		fmt.Printf("Error: %v", err)
 	}
 
 	// Output:
-	// Event type,Location,Timestamp,Name,Address
-	// Login,Teststadt,1634700000,Tester,Teststadt
-	// Logout,Teststadt,1634701000,Tester,Teststadt
-	// Login,Hauptstadt,1634703000,Tester,Teststadt
-	// Login,Hauptstadt,1634710000,Klaus,Musterdorf
-	// Logout,Hauptstadt,1634712000,Klaus,Musterdorf
-	// Login,Teststadt,1634720000,Klaus,Musterdorf
-	// Logout,Hauptstadt,1634724000,Tester,Teststadt
-	// Logout,Teststadt,1634726000,Klaus,Musterdorf
+	// Event type,Location,Timestamp,Name,Address,Phone,Email,Street,Postal code,City
+	// Login,Teststadt,1634700000,Tester,Teststadt,,,,,
+	// Logout,Teststadt,1634701000,Tester,Teststadt,,,,,
+	// Login,Hauptstadt,1634703000,Tester,Teststadt,,,,,
+	// Login,Hauptstadt,1634710000,Klaus,Musterdorf,,,,,
+	// Logout,Hauptstadt,1634712000,Klaus,Musterdorf,,,,,
+	// Login,Teststadt,1634720000,Klaus,Musterdorf,,,,,
+	// Logout,Hauptstadt,1634724000,Tester,Teststadt,,,,,
+	// Logout,Teststadt,1634726000,Klaus,Musterdorf,,,,,
 }
 
 func ExampleExport_stdoutFilterLong() {
-	err := Export("testdata/journal.txt", "testdata/locations.xml", false, "-", 0777, "Teststadt")
+	err := Export(testSource("testdata/journal.txt"), "testdata/locations.xml", false, "-", 0777, "Teststadt")
 	if err != nil {
 		fmt.Printf("Error: %v", err)
 	}
 
 	// Output:
-	// Login,Teststadt,1634700000,Tester,Teststadt
-	// Logout,Teststadt,1634701000,Tester,Teststadt
-	// Login,Teststadt,1634720000,Klaus,Musterdorf
-	// Logout,Teststadt,1634726000,Klaus,Musterdorf
+	// Login,Teststadt,1634700000,Tester,Teststadt,,,,,
+	// Logout,Teststadt,1634701000,Tester,Teststadt,,,,,
+	// Login,Teststadt,1634720000,Klaus,Musterdorf,,,,,
+	// Logout,Teststadt,1634726000,Klaus,Musterdorf,,,,,
 }
 
 func ExampleExport_stdoutFilterShort() {
-	err := Export("testdata/journal.txt", "testdata/locations.xml", false, "-", 0777, "HST")
+	err := Export(testSource("testdata/journal.txt"), "testdata/locations.xml", false, "-", 0777, "HST")
 	if err != nil {
 		fmt.Printf("Error: %v", err)
 	}
 
 	// Output:
-	// Login,Hauptstadt,1634703000,Tester,Teststadt
-	// Login,Hauptstadt,1634710000,Klaus,Musterdorf
-	// Logout,Hauptstadt,1634712000,Klaus,Musterdorf
-	// Logout,Hauptstadt,1634724000,Tester,Teststadt
+	// Login,Hauptstadt,1634703000,Tester,Teststadt,,,,,
+	// Login,Hauptstadt,1634710000,Klaus,Musterdorf,,,,,
+	// Logout,Hauptstadt,1634712000,Klaus,Musterdorf,,,,,
+	// Logout,Hauptstadt,1634724000,Tester,Teststadt,,,,,
+}
+
+func ExampleExport_journalsDirectory() {
+	err := Export(
+		JournalSource{Paths: []string{"testdata/journals"}, From: "2021-10-20", To: "2021-10-21"},
+		"testdata/locations.xml", false, "-", 0777, "",
+	)
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// Login,Teststadt,1634700000,Tester,Teststadt,,,,,
+	// Logout,Teststadt,1634701000,Tester,Teststadt,,,,,
+	// Login,Hauptstadt,1634703000,Tester,Teststadt,,,,,
+	// Login,Hauptstadt,1634710000,Klaus,Musterdorf,,,,,
+	// Logout,Hauptstadt,1634712000,Klaus,Musterdorf,,,,,
+	// Login,Teststadt,1634720000,Klaus,Musterdorf,,,,,
+	// Logout,Hauptstadt,1634724000,Tester,Teststadt,,,,,
+	// Logout,Teststadt,1634726000,Klaus,Musterdorf,,,,,
+}
+
+func ExampleExport_rotatedJournals() {
+	err := Export(
+		JournalSource{Paths: []string{"testdata/rotated"}, From: "2021-10-20", To: "2021-10-21"},
+		"testdata/locations.xml", false, "-", 0777, "",
+	)
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// Login,Teststadt,1634700000,Tester,Teststadt,,,,,
+	// Logout,Teststadt,1634701000,Tester,Teststadt,,,,,
+	// Login,Hauptstadt,1634703000,Tester,Teststadt,,,,,
+	// Login,Hauptstadt,1634710000,Klaus,Musterdorf,,,,,
+	// Logout,Hauptstadt,1634712000,Klaus,Musterdorf,,,,,
+	// Login,Teststadt,1634720000,Klaus,Musterdorf,,,,,
+	// Logout,Hauptstadt,1634724000,Tester,Teststadt,,,,,
+	// Logout,Teststadt,1634726000,Klaus,Musterdorf,,,,,
+}
+
+func ExampleExport_automatic() {
+	err := Export(testSource("testdata/journal_auto.txt"), "testdata/locations.xml", false, "-", 0777, "HST")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// Login,Hauptstadt,1634703000,Tester,Teststadt,,,,,
+	// Automatic logout,Hauptstadt,1634731800,Tester,Teststadt,,,,,
+}
+
+func ExampleExport_chained() {
+	err := Export(testSource("testdata/journal_chained.txt"), "testdata/locations.xml", false, "-", 0777, "")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// Login,Teststadt,1634700000,Tester,Teststadt,,,,,
+	// Logout,Teststadt,1634701000,Tester,Teststadt,,,,,
+}
+
+func ExampleExport_encrypted() {
+	source := testSource("testdata/journal_encrypted.txt")
+	source.EncryptionKey = "thisis32bitlongpassphraseimusing"
+	err := Export(source, "testdata/locations.xml", false, "-", 0777, "TST")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// Login,Teststadt,1634700000,Tester,Teststadt,,,,,
+	// Logout,Teststadt,1634701000,Tester,Teststadt,,,,,
+	// Login,Teststadt,1634720000,Klaus,Musterdorf,,,,,
+	// Logout,Teststadt,1634726000,Klaus,Musterdorf,,,,,
+}
+
+func ExampleExport_compressed() {
+	err := Export(testSource("testdata/journal_compressed.txt.gz"), "testdata/locations.xml", false, "-", 0777, "HST")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// Login,Hauptstadt,1634703000,Tester,Teststadt,,,,,
+	// Login,Hauptstadt,1634710000,Klaus,Musterdorf,,,,,
+	// Logout,Hauptstadt,1634712000,Klaus,Musterdorf,,,,,
+	// Logout,Hauptstadt,1634724000,Tester,Teststadt,,,,,
 }
 
 func TestExport_fileOutput(t *testing.T) {
 	dir := t.TempDir()
 	outFile := path.Join(dir, "out.csv")
-	err := Export("testdata/journal.txt", "testdata/locations.xml", false, outFile, 0777, "TST")
+	err := Export(testSource("testdata/journal.txt"), "testdata/locations.xml", false, outFile, 0777, "TST")
 	if assert.NoError(t, err) {
 		if assert.FileExists(t, outFile) {
 			content, err := ioutil.ReadFile(outFile)
 			if assert.NoError(t, err) {
 				assert.Equal(
 					t,
-					"Login,Teststadt,1634700000,Tester,Teststadt\n"+
-						"Logout,Teststadt,1634701000,Tester,Teststadt\n"+
-						"Login,Teststadt,1634720000,Klaus,Musterdorf\n"+
-						"Logout,Teststadt,1634726000,Klaus,Musterdorf\n",
+					"Login,Teststadt,1634700000,Tester,Teststadt,,,,,\n"+
+						"Logout,Teststadt,1634701000,Tester,Teststadt,,,,,\n"+
+						"Login,Teststadt,1634720000,Klaus,Musterdorf,,,,,\n"+
+						"Logout,Teststadt,1634726000,Klaus,Musterdorf,,,,,\n",
 					string(content),
 				)
 			}
@@ -79,8 +169,22 @@ func TestExport_fileOutput(t *testing.T) {
 
 func TestExport_errors(t *testing.T) {
 	tempDir := t.TempDir()
-	assert.Error(t, Export("testdata/journal.txt", "testdata/missingno", true, "-", 0777, "TST"))
-	assert.Error(t, Export("testdata/journal.txt", "testdata/locations.xml", true, "-", 0777, "???"))
-	assert.Error(t, Export("testdata/missingno", "testdata/locations.xml", true, "-", 0777, "TST"))
-	assert.Error(t, Export("testdata/journal.txt", "testdata/locations.xml", true, tempDir, 07000, "TST"))
+	assert.Error(t, Export(testSource("testdata/journal.txt"), "testdata/missingno", true, "-", 0777, "TST"))
+	assert.Error(t, Export(testSource("testdata/journal.txt"), "testdata/locations.xml", true, "-", 0777, "???"))
+	assert.Error(t, Export(testSource("testdata/missingno"), "testdata/locations.xml", true, "-", 0777, "TST"))
+	assert.Error(t, Export(testSource("testdata/journal.txt"), "testdata/locations.xml", true, tempDir, 07000, "TST"))
+}
+
+func ExampleExport_contactDetails() {
+	err := Export(testSource("testdata/journal_details.txt"), "testdata/locations.xml", true, "-", 0777, "")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// Event type,Location,Timestamp,Name,Address,Phone,Email,Street,Postal code,City
+	// Login,Teststadt,1634700000,Erika,,+49 6261 123456,erika@example.com,Beispielweg 1,74821,Mosbach
+	// Login,Teststadt,1634700600,Klaus,Musterdorf,,klaus@example.com,,,
+	// Logout,Teststadt,1634701000,Klaus,Musterdorf,,klaus@example.com,,,
+	// Logout,Teststadt,1634702000,Erika,,+49 6261 123456,erika@example.com,Beispielweg 1,74821,Mosbach
 }
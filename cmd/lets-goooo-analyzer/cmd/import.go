@@ -0,0 +1,153 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package cmd
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// importTimeFormats are the formats of local times that are accepted as timestamps besides unix seconds
+var importTimeFormats = []string{"2006-01-02 15:04:05", "2006-01-02 15:04"}
+
+// Import reads events from a CSV file with the columns written by Export, e.g. typed up paper lists, into a new journal.
+// Locations are given by code or name and timestamps either as unix seconds or as local time like "2006-01-02 15:04".
+// Nothing is written if any row is invalid, the invalid rows are listed instead.
+func Import(
+	csvPath string, locationsPath string, outputPath string, chainKey string,
+	encryptionKey string, encryptionKeyFile string, userIDKey string, userIDKeyFile string) error {
+
+	if err := readLocations(locationsPath); err != nil {
+		return err
+	}
+	key, err := util.LoadKey(encryptionKey, encryptionKeyFile, journal.EncryptionKeySize)
+	if err != nil {
+		return NewError(400, "invalid journal encryption key", err)
+	}
+	idKey, err := loadUserIDKey(userIDKey, userIDKeyFile)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return NewError(404, fmt.Sprintf("failed to open CSV file \"%s\"", csvPath), err)
+	}
+	defer func() { _ = file.Close() }()
+
+	events, invalidRows, err := readImportCSV(file, time.Now())
+	if err != nil {
+		return NewError(500, fmt.Sprintf("failed to read CSV file \"%s\"", csvPath), err)
+	}
+	for _, row := range invalidRows {
+		fmt.Printf("%s:%s\n", csvPath, row)
+	}
+	if len(invalidRows) > 0 {
+		return NewError(422, fmt.Sprintf("found %d invalid rows, nothing was imported", len(invalidRows)), nil)
+	}
+	if len(events) == 0 {
+		return NewError(400, fmt.Sprintf("no events to import in \"%s\"", csvPath), nil)
+	}
+
+	imported := journal.NewJournalFromEvents(events)
+	if err := imported.WriteFile(outputPath, journal.WriterConfig{
+		ChainKey:      []byte(chainKey),
+		EncryptionKey: key,
+		UserIDKey:     idKey,
+	}); err != nil {
+		return NewError(500, fmt.Sprintf("failed to write the imported journal to \"%s\"", outputPath), err)
+	}
+	fmt.Printf("Imported %d events into %s\n", len(events), outputPath)
+	return nil
+}
+
+// readImportCSV reads the events of the CSV rows, an optional header row is skipped.
+// Invalid rows are described by their line number and the problem.
+func readImportCSV(reader io.Reader, now time.Time) ([]journal.Event, []string, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1 // either the legacy or the current columns, see parseImportRecord
+	csvReader.TrimLeadingSpace = true
+
+	events := make([]journal.Event, 0, 100)
+	invalidRows := make([]string, 0, 10)
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		parseErr := (*csv.ParseError)(nil)
+		if errors.As(err, &parseErr) {
+			invalidRows = append(invalidRows, fmt.Sprintf("%d: %v", parseErr.StartLine, parseErr.Err))
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+		line, _ := csvReader.FieldPos(0)
+		if line == 1 && strings.EqualFold(record[0], exportColumns[0]) { // header row
+			continue
+		}
+		event, err := parseImportRecord(record, now)
+		if err != nil {
+			invalidRows = append(invalidRows, fmt.Sprintf("%d: %v", line, err))
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, invalidRows, nil
+}
+
+// parseImportRecord parses and validates the event of a CSV row
+func parseImportRecord(record []string, now time.Time) (journal.Event, error) {
+	if len(record) != legacyExportColumns && len(record) != len(exportColumns) {
+		return journal.Event{}, fmt.Errorf("expected %d or %d fields, got %d", legacyExportColumns, len(exportColumns), len(record))
+	}
+	eventType, flag, err := journal.ParseEventName(record[0])
+	if err != nil {
+		return journal.Event{}, err
+	}
+	location, err := resolveLocation(strings.TrimSpace(record[1]))
+	if err != nil {
+		return journal.Event{}, fmt.Errorf("unknown location \"%s\"", record[1])
+	}
+	timestamp, err := parseImportTime(strings.TrimSpace(record[2]))
+	if err != nil {
+		return journal.Event{}, err
+	}
+	if timestamp <= 0 || timestamp > now.Unix() {
+		return journal.Event{}, fmt.Errorf("timestamp \"%s\" is not between 1970 and now", record[2])
+	}
+	fields := make([]string, len(exportColumns))
+	for i := range record {
+		fields[i] = strings.TrimSpace(record[i])
+	}
+	user := journal.User{
+		Name: fields[3], Address: fields[4],
+		Phone: fields[5], Email: fields[6], Street: fields[7], PostalCode: fields[8], City: fields[9],
+	}
+	if err := user.Validate(); err != nil { // the same rules as for the login form, the user lines must stay parsable
+		return journal.Event{}, err
+	}
+	return journal.Event{EventType: eventType, User: &user, Location: location, Timestamp: timestamp, Flag: flag}, nil
+}
+
+// parseImportTime parses a timestamp given as unix seconds or local time in one of the importTimeFormats
+func parseImportTime(text string) (int64, error) {
+	if timestamp, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return timestamp, nil
+	}
+	for _, format := range importTimeFormats {
+		if parsed, err := time.ParseInLocation(format, text, time.Local); err == nil {
+			return parsed.Unix(), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid timestamp \"%s\", expected unix seconds or the format YYYY-MM-DD HH:MM", text)
+}
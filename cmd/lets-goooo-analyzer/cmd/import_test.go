@@ -0,0 +1,96 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func ExampleImport() {
+	tz := time.Local
+	time.Local = time.UTC
+	defer func() {
+		time.Local = tz
+	}()
+	outputPath := "example-imported.txt"
+	defer func() { _ = os.Remove(outputPath) }()
+	err := Import("testdata/import.csv", "testdata/locations.xml", outputPath, "", "", "", "", "")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+	err = Export(testSource(outputPath), "testdata/locations.xml", true, "-", 0, "")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// Imported 4 events into example-imported.txt
+	// Event type,Location,Timestamp,Name,Address,Phone,Email,Street,Postal code,City
+	// Login,Teststadt,1634700000,Tester,Teststadt,,,,,
+	// Login,Hauptstadt,1634700600,Erika,"Beispielweg 1, Musterdorf",,,,,
+	// Logout,Teststadt,1634701000,Tester,Teststadt,,,,,
+	// Automatic logout,Hauptstadt,1634702430,Erika,"Beispielweg 1, Musterdorf",,,,,
+}
+
+func ExampleImport_contactDetails() {
+	outputPath := "example-imported-details.txt"
+	defer func() { _ = os.Remove(outputPath) }()
+	err := Import("testdata/import_details.csv", "testdata/locations.xml", outputPath, "", "", "", "", "")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+	err = Export(testSource(outputPath), "testdata/locations.xml", false, "-", 0, "")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// Imported 3 events into example-imported-details.txt
+	// Login,Teststadt,1634700000,Erika,,+49 6261 123456,erika@example.com,Beispielweg 1,74821,Mosbach
+	// Login,Teststadt,1634700600,Klaus,,,klaus@example.com,,,
+	// Logout,Teststadt,1634701000,Klaus,,,klaus@example.com,,,
+}
+
+func ExampleImport_invalid() {
+	err := Import("testdata/import_invalid.csv", "testdata/locations.xml", "example-invalid.txt", "", "", "", "", "")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// testdata/import_invalid.csv:2: unknown event "checkout"
+	// testdata/import_invalid.csv:3: unknown location "Nowhere"
+	// testdata/import_invalid.csv:4: invalid timestamp "yesterday", expected unix seconds or the format YYYY-MM-DD HH:MM
+	// testdata/import_invalid.csv:5: timestamp "4102444800" is not between 1970 and now
+	// testdata/import_invalid.csv:6: the name is required
+	// testdata/import_invalid.csv:7: expected 5 or 10 fields, got 4
+	// testdata/import_invalid.csv:8: the name must not contain control characters
+	// testdata/import_invalid.csv:10: the email address is invalid
+	// Error: error 422: found 8 invalid rows, nothing was imported
+}
+
+func TestImport(t *testing.T) {
+	outputPath := path.Join(t.TempDir(), "imported.txt")
+	key := "thisis32bitlongpassphraseimusing"
+	if assert.NoError(t, Import("testdata/import.csv", "testdata/locations.xml", outputPath, "secret", key, "", "", "")) {
+		_, err := journal.VerifyChain([]byte("secret"), outputPath)
+		assert.NoError(t, err, "the imported journal should be chained")
+		imported, err := journal.ReadJournalsWithConfig([]string{outputPath}, journal.ReaderConfig{EncryptionKey: []byte(key), Strict: true})
+		if assert.NoError(t, err, "the imported journal should be encrypted") {
+			assert.Len(t, imported.GetEvents(), 4)
+		}
+	}
+
+	assert.NoFileExists(t, "example-invalid.txt", "nothing should be written for invalid rows")
+	assert.Error(t, Import("testdata/missingno.csv", "testdata/locations.xml", outputPath, "", "", "", "", ""))
+	assert.Error(t, Import("testdata/locations.xml", "testdata/locations.xml", outputPath, "", "", "", "", ""))
+	assert.Error(t, Import("testdata/import.csv", "testdata/locations.xml", outputPath, "", "too short", "", "", ""))
+}
@@ -0,0 +1,93 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package cmd
+
+import (
+	"fmt"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
+	"path"
+	"strings"
+)
+
+// instanceSeparator separates the journals of a server instance from its locations file on the command line
+const instanceSeparator = "="
+
+// Merge combines the journals of several server instances into a single journal file.
+// Every path of the source is an instance, given as "<journals>" or "<journals>=<locations file>".
+// Instances without their own locations file use the default locations file.
+// Location codes that refer to different locations in the instances are reported and nothing is written.
+// The locations of all instances are written next to the merged journal, see mergedLocationsPath.
+// The merged journal gets the user IDs of the user ID key, the unkeyed hashes of the user identities if none is given.
+// All instances are decrypted with the encryption key of the source, which also encrypts the merged journal,
+// so instances with different encryption keys can't be merged.
+func Merge(source JournalSource, locationsPath string, outputPath string, chainKey string, userIDKey string, userIDKeyFile string) error {
+	key, err := loadEncryptionKey(source)
+	if err != nil {
+		return err
+	}
+	idKey, err := loadUserIDKey(userIDKey, userIDKeyFile)
+	if err != nil {
+		return err
+	}
+
+	journals := make([]journal.Journal, 0, len(source.Paths))
+	locationSets := make([]map[string]*journal.Location, 0, len(source.Paths))
+	for _, instance := range source.Paths {
+		journalsPath, instanceLocationsPath := instance, locationsPath
+		if parts := strings.SplitN(instance, instanceSeparator, 2); len(parts) == 2 {
+			journalsPath, instanceLocationsPath = parts[0], parts[1]
+		}
+		// The locations are replaced for every instance, the events keep referring to the locations of their instance
+		if err := readLocations(instanceLocationsPath); err != nil {
+			return err
+		}
+		locationSets = append(locationSets, journal.Locations)
+		instanceSource := source
+		instanceSource.Paths = []string{journalsPath}
+		files, err := resolveJournalFiles(instanceSource)
+		if err != nil {
+			return err
+		}
+		instanceJournal, err := journal.ReadJournalsWithConfig(files, journal.ReaderConfig{EncryptionKey: key, Strict: source.Strict})
+		if err != nil {
+			return journalReadError(err)
+		}
+		journals = append(journals, instanceJournal)
+	}
+
+	merged := journal.MergeJournals(journals...)
+	reportSkippedLines(merged.Diagnostics())
+	locations, conflicts := journal.MergeLocations(locationSets...)
+	if len(conflicts) > 0 {
+		for _, conflict := range conflicts {
+			fmt.Println(conflict.String())
+		}
+		return NewError(422, fmt.Sprintf("found %d location code conflicts, make the codes unique in the locations files", len(conflicts)), nil)
+	}
+	if err := merged.WriteFile(outputPath, journal.WriterConfig{
+		ChainKey:      []byte(chainKey),
+		EncryptionKey: key,
+		UserIDKey:     idKey,
+	}); err != nil {
+		return NewError(500, fmt.Sprintf("failed to write the merged journal to \"%s\"", outputPath), err)
+	}
+	locationsOutputPath := mergedLocationsPath(outputPath)
+	if err := journal.WriteLocations(locationsOutputPath, locations); err != nil {
+		return NewError(500, fmt.Sprintf("failed to write the merged locations to \"%s\"", locationsOutputPath), err)
+	}
+	fmt.Printf("Merged %d events of %d instances into %s with the locations in %s\n",
+		len(merged.GetEvents()), len(journals), outputPath, locationsOutputPath)
+	return nil
+}
+
+// mergedLocationsPath returns the path of the locations file of a merged journal:
+// the path of the journal without its extension and with "-locations.xml" instead, e.g. "merged-locations.xml".
+func mergedLocationsPath(outputPath string) string {
+	base := outputPath
+	if journal.IsCompressedJournal(base) { // e.g. "merged.txt.gz"
+		base = strings.TrimSuffix(base, path.Ext(base))
+	}
+	return strings.TrimSuffix(base, path.Ext(base)) + "-locations.xml"
+}
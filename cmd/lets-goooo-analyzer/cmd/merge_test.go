@@ -0,0 +1,99 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
+	"os"
+	"path"
+	"testing"
+)
+
+func ExampleMerge() {
+	outputPath := "example-merged.txt"
+	defer func() { _ = os.Remove(outputPath) }()
+	defer func() { _ = os.Remove("example-merged-locations.xml") }()
+	source := testSource("testdata/journals", "testdata/campus/journal.txt=testdata/campus/locations.xml")
+	source.To = "2021-10-20"
+	err := Merge(source, "testdata/locations.xml", outputPath, "", "", "")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+	// the campus location only exists in the locations of the second instance
+	err = Export(testSource(outputPath), "example-merged-locations.xml", false, "-", 0, "")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// Merged 9 events of 2 instances into example-merged.txt with the locations in example-merged-locations.xml
+	// Login,Teststadt,1634700000,Tester,Teststadt,,,,,
+	// Logout,Teststadt,1634701000,Tester,Teststadt,,,,,
+	// Login,Musterdorf,1634702000,Tester,Teststadt,,,,,
+	// Logout,Musterdorf,1634702500,Tester,Teststadt,,,,,
+	// Login,Hauptstadt,1634703000,Tester,Teststadt,,,,,
+	// Login,Teststadt,1634710500,Erika,Beispielweg 1,,,,,
+	// Logout,Teststadt,1634711000,Erika,Beispielweg 1,,,,,
+	// Login,Campus,1634712000,Erika,Beispielweg 1,,,,,
+	// Logout,Campus,1634713000,Erika,Beispielweg 1,,,,,
+}
+
+func ExampleMerge_conflict() {
+	outputPath := path.Join(os.TempDir(), "lets-goooo-example-conflict.txt")
+	err := Merge(testSource("testdata/journal.txt", "testdata/campus/journal.txt=testdata/campus/locations_conflict.xml"),
+		"testdata/locations.xml", outputPath, "", "", "")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// location code "TST" refers to different locations: ["Teststadt" "Testdorf"]
+	// Error: error 422: found 1 location code conflicts, make the codes unique in the locations files
+}
+
+func TestMerge(t *testing.T) {
+	outputPath := path.Join(t.TempDir(), "merged.txt")
+	source := testSource("testdata/journal_chained.txt", "testdata/journal_encrypted.txt")
+	source.EncryptionKey = "thisis32bitlongpassphraseimusing"
+	if assert.NoError(t, Merge(source, "testdata/locations.xml", outputPath, "secret", "", "")) {
+		_, err := journal.VerifyChain([]byte("secret"), outputPath)
+		assert.NoError(t, err, "the merged journal should be chained")
+		merged, err := journal.ReadJournalsWithConfig([]string{outputPath}, journal.ReaderConfig{EncryptionKey: []byte(source.EncryptionKey)})
+		if assert.NoError(t, err, "the merged journal should be encrypted with the same key") {
+			assert.NotEmpty(t, merged.GetEvents())
+		}
+	}
+
+	assert.Error(t, Merge(testSource("testdata/journal_encrypted.txt"), "testdata/locations.xml", outputPath, "", "", ""))
+	assert.Error(t, Merge(testSource("testdata/journal.txt=testdata/missingno.xml"), "testdata/locations.xml", outputPath, "", "", ""))
+	assert.Error(t, Merge(testSource("testdata/missingno"), "testdata/locations.xml", outputPath, "", "", ""))
+	assert.NoFileExists(t, path.Join(os.TempDir(), "lets-goooo-example-conflict.txt"), "nothing should be written on conflicts")
+	assert.NoFileExists(t, path.Join(os.TempDir(), "lets-goooo-example-conflict-locations.xml"))
+}
+
+func TestMerge_locations(t *testing.T) {
+	outputPath := path.Join(t.TempDir(), "merged.txt")
+	source := testSource("testdata/journal.txt", "testdata/campus/journal.txt=testdata/campus/locations.xml")
+	if !assert.NoError(t, Merge(source, "testdata/locations.xml", outputPath, "", "", "")) {
+		return
+	}
+	content, err := os.ReadFile(path.Join(path.Dir(outputPath), "merged-locations.xml"))
+	if assert.NoError(t, err, "the merged locations should be written next to the journal") {
+		assert.Equal(t, "<locations>\n"+
+			"    <location name=\"Campus\" code=\"CMP\"></location>\n"+
+			"    <location name=\"Hauptstadt\" code=\"HST\"></location>\n"+
+			"    <location name=\"Musterdorf\" code=\"MSD\"></location>\n"+
+			"    <location name=\"Teststadt\" code=\"TST\"></location>\n"+
+			"</locations>\n", string(content))
+	}
+}
+
+func TestMergedLocationsPath(t *testing.T) {
+	assert.Equal(t, "merged-locations.xml", mergedLocationsPath("merged.txt"))
+	assert.Equal(t, "out/merged-locations.xml", mergedLocationsPath("out/merged.txt.gz"))
+	assert.Equal(t, "merged-locations.xml", mergedLocationsPath("merged"))
+}
@@ -0,0 +1,46 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package cmd
+
+import (
+	"fmt"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
+)
+
+// Migrate upgrades journals to the current format version with the user IDs of the user ID key of the server.
+// Without key, the users get the unkeyed hashes of their identities, but keyed user IDs are never replaced by them.
+// Journals that already have the current format and user IDs are left as they are.
+// The migrated journals are encrypted with the encryption key of the source and sealed in a new hash chain.
+func Migrate(source JournalSource, chainKey string, userIDKey string, userIDKeyFile string) error {
+	idKey, err := loadUserIDKey(userIDKey, userIDKeyFile)
+	if err != nil {
+		return err
+	}
+	key, err := loadEncryptionKey(source)
+	if err != nil {
+		return err
+	}
+	files, err := resolveJournalFiles(source)
+	if err != nil {
+		return err
+	}
+
+	config := journal.WriterConfig{ChainKey: []byte(chainKey), EncryptionKey: key, UserIDKey: idKey}
+	migrated := 0
+	for _, file := range files {
+		changed, err := journal.MigrateJournal(file, config)
+		if err != nil {
+			return NewError(500, fmt.Sprintf("failed to migrate journal \"%s\"", file), err)
+		}
+		if changed {
+			fmt.Printf("%s: migrated\n", file)
+			migrated++
+		} else {
+			fmt.Printf("%s: up to date\n", file)
+		}
+	}
+	fmt.Printf("Migrated %d of %d journals\n", migrated, len(files))
+	return nil
+}
@@ -0,0 +1,66 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
+	"os"
+	"path"
+	"testing"
+)
+
+const testUserIDKey = "thisisthe32bytekeyofthetestusers"
+
+func ExampleMigrate() {
+	journalPath := "example-migrated.txt"
+	defer func() { _ = os.Remove(journalPath) }()
+	content, _ := os.ReadFile("testdata/journal.txt")
+	_ = os.WriteFile(journalPath, content, 0660)
+
+	err := Migrate(testSource(journalPath), "", testUserIDKey, "")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+	err = Migrate(testSource(journalPath), "", testUserIDKey, "")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// example-migrated.txt: migrated
+	// Migrated 1 of 1 journals
+	// example-migrated.txt: up to date
+	// Migrated 0 of 1 journals
+}
+
+func TestMigrate(t *testing.T) {
+	require.NoError(t, readLocations("testdata/locations.xml"))
+	journalPath := path.Join(t.TempDir(), "journal.txt")
+	content, err := os.ReadFile("testdata/journal.txt")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(journalPath, content, 0660))
+	original, err := journal.ReadJournal(journalPath)
+	require.NoError(t, err)
+
+	if assert.NoError(t, Migrate(testSource(journalPath), "secret", testUserIDKey, "")) {
+		_, err := journal.VerifyChain([]byte("secret"), journalPath)
+		assert.NoError(t, err, "the migrated journal should be chained")
+		migrated, err := journal.ReadJournal(journalPath)
+		if assert.NoError(t, err, "the migrated journal should be readable without the user ID key") {
+			assert.Equal(t, original.GetEvents(), migrated.GetEvents())
+		}
+	}
+
+	assert.Error(t, Migrate(testSource(journalPath), "", "", ""), "keyed IDs must not be replaced by unkeyed IDs")
+	unkeyedPath := path.Join(t.TempDir(), "unkeyed.txt")
+	require.NoError(t, os.WriteFile(unkeyedPath, content, 0660))
+	assert.NoError(t, Migrate(testSource(unkeyedPath), "", "", ""), "old journals should be upgraded without key")
+	assert.Error(t, Migrate(testSource(journalPath), "", "too short", ""))
+	assert.Error(t, Migrate(testSource("testdata/missingno"), "", testUserIDKey, ""))
+	assert.Error(t, Migrate(testSource("testdata/journal_encrypted.txt"), "", testUserIDKey, ""))
+}
@@ -0,0 +1,40 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package cmd
+
+import (
+	"fmt"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"strings"
+)
+
+// Repair writes a corrected copy of the journal and lists the anomalies that were corrected.
+// The keys are required to read encrypted journals and to secure the copy like the server does.
+func Repair(journalPath string, locationsPath string, outputPath string, chainKey string, encryptionKey string, encryptionKeyFile string) error {
+	if err := readLocations(locationsPath); err != nil {
+		return err
+	}
+	if isFile, err := util.FileExists(journalPath); err != nil || !isFile {
+		return NewError(404, fmt.Sprintf("journal \"%s\" not found", journalPath), err)
+	}
+	key, err := util.LoadKey(encryptionKey, encryptionKeyFile, journal.EncryptionKeySize)
+	if err != nil {
+		return NewError(400, "invalid journal encryption key", err)
+	}
+	if outputPath == "" { // set a default output file name next to the journal
+		outputPath = strings.TrimSuffix(strings.TrimSuffix(journalPath, ".gz"), ".txt") + "-repaired.txt"
+	}
+
+	anomalies, err := journal.RepairJournal(journalPath, outputPath, []byte(chainKey), key)
+	if err != nil {
+		return NewError(500, fmt.Sprintf("failed to repair journal \"%s\"", journalPath), err)
+	}
+	for _, anomaly := range anomalies {
+		fmt.Printf("%s (%s)\n", anomaly.String(), anomaly.Kind)
+	}
+	fmt.Printf("Corrected %d anomalies, the repaired journal was written to %s\n", len(anomalies), outputPath)
+	return nil
+}
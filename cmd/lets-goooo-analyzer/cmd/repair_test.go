@@ -0,0 +1,27 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package cmd
+
+import (
+	"github.com/stretchr/testify/assert"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
+	"path"
+	"testing"
+)
+
+func TestRepair(t *testing.T) {
+	outputPath := path.Join(t.TempDir(), "repaired.txt")
+	if assert.NoError(t, Repair("testdata/journal_anomalies.txt", "testdata/locations.xml", outputPath, "secret", "", "")) {
+		lines, err := journal.VerifyChain([]byte("secret"), outputPath)
+		if assert.NoError(t, err, "the repaired journal should be chained") {
+			assert.Equal(t, 10, lines)
+		}
+		assert.NoError(t, Check(testSource(outputPath), "testdata/locations.xml"), "the repaired journal should have no anomalies")
+	}
+
+	assert.Error(t, Repair("testdata/missingno", "testdata/locations.xml", outputPath, "", "", ""))
+	assert.Error(t, Repair("testdata/journal_encrypted.txt", "testdata/locations.xml", outputPath, "", "", ""))
+	assert.Error(t, Repair("testdata/journal_anomalies.txt", "testdata/locations.xml", outputPath, "", "too short", ""))
+}
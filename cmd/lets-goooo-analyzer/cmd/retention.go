@@ -0,0 +1,46 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package cmd
+
+import (
+	"fmt"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"time"
+)
+
+// Retention purges or anonymises the journals in the directory that are older than the given number of days.
+// The keys are required to rewrite chained or encrypted journals when anonymising them.
+func Retention(directory string, days int, mode string, auditFile string, chainKey string, encryptionKey string, encryptionKeyFile string) error {
+	retentionMode, err := journal.ParseRetentionMode(mode)
+	if err != nil {
+		return NewError(400, "invalid retention mode", err)
+	}
+	if days <= 0 {
+		return NewError(400, fmt.Sprintf("the retention period must be at least one day, got %d", days), nil)
+	}
+	key, err := util.LoadKey(encryptionKey, encryptionKeyFile, journal.EncryptionKeySize)
+	if err != nil {
+		return NewError(400, "invalid journal encryption key", err)
+	}
+
+	records, err := journal.ApplyRetention(directory, journal.RetentionPolicy{
+		Days:          days,
+		Mode:          retentionMode,
+		AuditFile:     auditFile,
+		ChainKey:      []byte(chainKey),
+		EncryptionKey: key,
+	}, time.Now())
+	for _, record := range records {
+		fmt.Printf("%s: %s (%d users)\n", record.File, record.Mode, record.Users)
+	}
+	if err != nil {
+		return NewError(500, fmt.Sprintf("failed to apply the retention policy to \"%s\"", directory), err)
+	}
+	if len(records) == 0 {
+		fmt.Printf("No journals older than %d days to %s\n", days, retentionMode)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package cmd
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestRetention(t *testing.T) {
+	journal.Locations = map[string]*journal.Location{
+		"TST": {Code: "TST", Name: "Teststadt"},
+		"HST": {Code: "HST", Name: "Hauptstadt"},
+	}
+	content, err := ioutil.ReadFile("testdata/journal.txt")
+	require.NoError(t, err)
+	dir := t.TempDir()
+	oldJournal := path.Join(dir, util.GetDateFilename(time.Now().AddDate(0, 0, -40))+".txt")
+	newJournal := path.Join(dir, util.GetDateFilename(time.Now().AddDate(0, 0, -2))+".txt")
+	require.NoError(t, ioutil.WriteFile(oldJournal, content, 0660))
+	require.NoError(t, ioutil.WriteFile(newJournal, content, 0660))
+
+	err = Retention(dir, 28, "anonymise", "", "", "", "")
+	if assert.NoError(t, err) {
+		j, err := journal.ReadJournal(oldJournal)
+		if assert.NoError(t, err) && assert.Len(t, j.GetEvents(), 8) {
+			assert.NotEqual(t, "Tester", j.GetEvents()[0].User.Name, "the old journal should be anonymised")
+		}
+		kept, err := ioutil.ReadFile(newJournal)
+		if assert.NoError(t, err) {
+			assert.Equal(t, content, kept, "journals within the retention period should be kept")
+		}
+		assert.FileExists(t, path.Join(dir, journal.DefaultAuditFileName))
+	}
+
+	err = Retention(dir, 1, "purge", "", "", "", "")
+	if assert.NoError(t, err) {
+		assert.NoFileExists(t, oldJournal)
+		assert.NoFileExists(t, newJournal)
+	}
+
+	err = Retention(dir, 28, "delete", "", "", "", "")
+	if assert.Error(t, err) {
+		assert.Equal(t, 400, err.(*Error).Code())
+	}
+	err = Retention(dir, 0, "purge", "", "", "", "")
+	if assert.Error(t, err) {
+		assert.Equal(t, 400, err.(*Error).Code())
+	}
+	err = Retention(dir, 28, "purge", "", "", "too short", "")
+	if assert.Error(t, err) {
+		assert.Equal(t, 400, err.(*Error).Code())
+	}
+	err = Retention(path.Join(dir, "missing"), 28, "purge", "", "", "", "")
+	if assert.Error(t, err) {
+		assert.Equal(t, 500, err.(*Error).Code())
+	}
+}
@@ -10,30 +10,25 @@ import (
 	"time"
 )
 
-func ShowPerson(journalPath string, locationsPath string, name string, address string) error {
+func ShowPerson(source JournalSource, locationsPath string, name string, address string) error {
 	if err := readLocations(locationsPath); err != nil {
 		return err
 	}
-	j, err := readJournal(journalPath)
-	if err != nil {
-		return err
-	}
-	user, err := findUser(j, name, address)
-	if err != nil {
-		return err
-	}
-
 	lastLoc := (*journal.Location)(nil) // The last location so that there can be header lines for each location
-	for _, event := range j.GetEvents() {
-		if event.User == user {
+	_, err := forEachEventFindingUser(source, name, address, func(user *journal.User, event *journal.Event) (bool, error) {
+		if user != nil && event.User == user {
 			if event.Location != lastLoc { // Different location
 				fmt.Printf("%s:\n", event.Location.Name)
 			}
-			eventTime := time.Unix(event.Timestamp, 0).In(time.Local) // Important because of daylight saving time or similar happenings
-			fmt.Printf("%10s: %2d:%02d:%02d\n", event.EventType.Name(), eventTime.Hour(), eventTime.Minute(), eventTime.Second())
+			eventTime := time.Unix(event.OccurredAt(), 0).In(time.Local) // Important because of daylight saving time or similar happenings
+			fmt.Printf("%10s: %s", event.EventType.Name(), eventTime.Format(TimeFormat))
+			if event.Flag == journal.AUTOMATIC { // Automatic checkouts don't reflect when the person actually left
+				fmt.Print(" (automatic)")
+			}
+			fmt.Println()
 			lastLoc = event.Location
 		}
-	}
-
-	return nil
+		return true, nil
+	})
+	return err
 }
@@ -17,18 +17,18 @@ func ExampleShowPerson() {
 	defer func() {
 		time.Local = tz
 	}()
-	err := ShowPerson("testdata/journal.txt", "testdata/locations.xml", "Tester", "")
+	err := ShowPerson(testSource("testdata/journal.txt"), "testdata/locations.xml", "Tester", "")
 	if err != nil {
 		fmt.Printf("Error: %v", err)
 	}
 
 	// Output:
 	// Teststadt:
-	//      Login:  3:20:00
-	//     Logout:  3:36:40
+	//      Login: 2021-10-20 03:20:00
+	//     Logout: 2021-10-20 03:36:40
 	// Hauptstadt:
-	//      Login:  4:10:00
-	//     Logout: 10:00:00
+	//      Login: 2021-10-20 04:10:00
+	//     Logout: 2021-10-20 10:00:00
 }
 
 func ExampleShowPerson_address() {
@@ -37,25 +37,68 @@ func ExampleShowPerson_address() {
 	defer func() {
 		time.Local = tz
 	}()
-	err := ShowPerson("testdata/journal.txt", "testdata/locations.xml", "", "Musterdorf")
+	err := ShowPerson(testSource("testdata/journal.txt"), "testdata/locations.xml", "", "Musterdorf")
 	if err != nil {
 		fmt.Printf("Error %v", err)
 	}
 
 	// Output:
 	// Hauptstadt:
-	//      Login:  6:06:40
-	//     Logout:  6:40:00
+	//      Login: 2021-10-20 06:06:40
+	//     Logout: 2021-10-20 06:40:00
 	// Teststadt:
-	//      Login:  8:53:20
-	//     Logout: 10:33:20
+	//      Login: 2021-10-20 08:53:20
+	//     Logout: 2021-10-20 10:33:20
+}
+
+func ExampleShowPerson_automatic() {
+	tz := time.Local
+	time.Local = time.UTC
+	defer func() {
+		time.Local = tz
+	}()
+	err := ShowPerson(testSource("testdata/journal_auto.txt"), "testdata/locations.xml", "Tester", "")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// Teststadt:
+	//      Login: 2021-10-20 03:20:00
+	//     Logout: 2021-10-20 03:36:40
+	// Hauptstadt:
+	//      Login: 2021-10-20 04:10:00
+	//     Logout: 2021-10-20 12:10:00 (automatic)
+}
+
+func ExampleShowPerson_severalDays() {
+	tz := time.Local
+	time.Local = time.UTC
+	defer func() {
+		time.Local = tz
+	}()
+	err := ShowPerson(testSource("testdata/journals"), "testdata/locations.xml", "Tester", "")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// Teststadt:
+	//      Login: 2021-10-20 03:20:00
+	//     Logout: 2021-10-20 03:36:40
+	// Hauptstadt:
+	//      Login: 2021-10-20 04:10:00
+	//     Logout: 2021-10-20 10:00:00
+	// Teststadt:
+	//      Login: 2021-10-21 07:06:40
+	//     Logout: 2021-10-21 07:23:20
 }
 
 func TestShowPerson(t *testing.T) {
-	assert.Error(t, ShowPerson("testdata/missingno", "testdata/locations.xml", "Tester", ""))
-	assert.Error(t, ShowPerson("testdata/journal.txt", "testdata/missingno", "Tester", ""))
-	assert.Error(t, ShowPerson("testdata/journal.txt", "testdata/locations.xml", "Muad'Dib", ""))
-	assert.Error(t, ShowPerson("testdata/journal.txt", "testdata/locations.xml", "", ""))
-	assert.Error(t, ShowPerson("testdata/journal.txt", "testdata/locations.xml", "", "???"))
-	assert.Error(t, ShowPerson("testdata/journal.txt", "testdata/locations.xml", "Tester", "Musterdorf"))
+	assert.Error(t, ShowPerson(testSource("testdata/missingno"), "testdata/locations.xml", "Tester", ""))
+	assert.Error(t, ShowPerson(testSource("testdata/journal.txt"), "testdata/missingno", "Tester", ""))
+	assert.Error(t, ShowPerson(testSource("testdata/journal.txt"), "testdata/locations.xml", "Muad'Dib", ""))
+	assert.Error(t, ShowPerson(testSource("testdata/journal.txt"), "testdata/locations.xml", "", ""))
+	assert.Error(t, ShowPerson(testSource("testdata/journal.txt"), "testdata/locations.xml", "", "???"))
+	assert.Error(t, ShowPerson(testSource("testdata/journal.txt"), "testdata/locations.xml", "Tester", "Musterdorf"))
 }
@@ -0,0 +1,187 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
+	"strings"
+	"time"
+)
+
+// SnapshotFormat is the output format of the Snapshot command
+type SnapshotFormat string
+
+const (
+	// SNAPSHOTTEXT lists the present users grouped by location in a human readable format
+	SNAPSHOTTEXT SnapshotFormat = "text"
+	// SNAPSHOTCSV writes a CSV row for each present user
+	SNAPSHOTCSV SnapshotFormat = "csv"
+	// SNAPSHOTJSON writes a JSON object with the present users
+	SNAPSHOTJSON SnapshotFormat = "json"
+)
+
+// snapshotColumns are the columns of the CSV output of Snapshot
+var snapshotColumns = []string{"Location", "Location code", "Since", "Name", "Address", "Phone", "Email"}
+
+// snapshotUserResponse is the JSON representation of a user that was checked in at the time of the snapshot
+type snapshotUserResponse struct {
+	Name     string    `json:"name"`
+	Address  string    `json:"address"`
+	Phone    string    `json:"phone,omitempty"`
+	Email    string    `json:"email,omitempty"`
+	Location string    `json:"location"`
+	Since    time.Time `json:"since"`
+}
+
+// snapshotResponse is the JSON output of Snapshot
+type snapshotResponse struct {
+	At       time.Time              `json:"at"`
+	Location string                 `json:"location,omitempty"`
+	Count    int                    `json:"count"`
+	Users    []snapshotUserResponse `json:"users"`
+}
+
+// Snapshot lists the users that were checked in at the given time, optionally limited to a location.
+// Events after the time are ignored, but limiting the journals by date saves reading them.
+func Snapshot(
+	source JournalSource, locationsPath string, at string, locationFilterName string,
+	format string, csvHeaders bool, outputPath string, outputPerms uint) error {
+
+	if err := readLocations(locationsPath); err != nil {
+		return err
+	}
+	snapshotTime, err := parseTimeArg(at)
+	if err != nil {
+		return err
+	}
+	var locationFilter *journal.Location = nil
+	if locationFilterName != "" {
+		if locationFilter, err = resolveLocation(locationFilterName); err != nil {
+			return err
+		}
+	}
+	switch SnapshotFormat(format) {
+	case SNAPSHOTTEXT, SNAPSHOTCSV, SNAPSHOTJSON:
+	default:
+		return NewError(400, fmt.Sprintf("unknown output format \"%s\", expected \"%s\", \"%s\" or \"%s\"",
+			format, SNAPSHOTTEXT, SNAPSHOTCSV, SNAPSHOTJSON), nil)
+	}
+
+	iterator, err := openJournal(source)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = iterator.Close() }()
+	users := journal.Snapshot(iterator, snapshotTime)
+	if err := journalReadError(iterator.Err()); err != nil {
+		return err
+	}
+	reportSkippedLines(iterator.Diagnostics())
+	if locationFilter != nil {
+		filtered := make([]journal.PresentUser, 0, len(users))
+		for _, user := range users {
+			if user.Location == locationFilter {
+				filtered = append(filtered, user)
+			}
+		}
+		users = filtered
+	}
+
+	writer, err := openOutput(outputPath, outputPerms)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := writer.Close()
+		if err != nil {
+			println("Failed to close output")
+		}
+	}()
+
+	switch SnapshotFormat(format) {
+	case SNAPSHOTCSV:
+		return writeSnapshotCSV(writer, users, csvHeaders)
+	case SNAPSHOTJSON:
+		return writeSnapshotJSON(writer, users, snapshotTime, locationFilter)
+	default:
+		return writeSnapshotText(writer, users, snapshotTime)
+	}
+}
+
+// writeSnapshotText writes the present users grouped by location in a human readable format
+func writeSnapshotText(writer io.Writer, users []journal.PresentUser, at time.Time) error {
+	if len(users) == 0 {
+		return writeString(writer, fmt.Sprintf("Nobody was checked in at %s\n", at.In(time.Local).Format(TimeFormat)))
+	}
+	text := strings.Builder{}
+	text.WriteString(fmt.Sprintf("%d user(s) checked in at %s:\n", len(users), at.In(time.Local).Format(TimeFormat)))
+	lastLocation := (*journal.Location)(nil) // the users are ordered by location, so each location gets one heading
+	for _, user := range users {
+		if user.Location != lastLocation {
+			text.WriteString(user.Location.Name + ":\n")
+			lastLocation = user.Location
+		}
+		text.WriteString(fmt.Sprintf("  since %s - %s - %s\n",
+			user.Since.In(time.Local).Format(TimeFormat), user.User.Name, describeContact(user.User)))
+	}
+	return writeString(writer, text.String())
+}
+
+// writeSnapshotCSV writes a CSV row for each present user
+func writeSnapshotCSV(writer io.Writer, users []journal.PresentUser, csvHeaders bool) error {
+	csvWriter := csv.NewWriter(writer)
+	if csvHeaders {
+		if err := csvWriter.Write(snapshotColumns); err != nil {
+			return NewError(500, "failed to write to output", err)
+		}
+	}
+	for _, user := range users {
+		err := csvWriter.Write([]string{
+			user.Location.Name,
+			user.Location.Code,
+			user.Since.In(time.Local).Format(TimeFormat),
+			user.User.Name,
+			user.User.FullAddress(),
+			user.User.Phone,
+			user.User.Email,
+		})
+		if err != nil {
+			return NewError(500, "failed to write to output", err)
+		}
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return NewError(500, "failed to write to output", err)
+	}
+	return nil
+}
+
+// writeSnapshotJSON writes a JSON object with the present users
+func writeSnapshotJSON(writer io.Writer, users []journal.PresentUser, at time.Time, location *journal.Location) error {
+	response := snapshotResponse{At: at, Count: len(users), Users: make([]snapshotUserResponse, len(users))}
+	if location != nil {
+		response.Location = location.Code
+	}
+	for i, user := range users {
+		response.Users[i] = snapshotUserResponse{
+			Name:     user.User.Name,
+			Address:  user.User.FullAddress(),
+			Phone:    user.User.Phone,
+			Email:    user.User.Email,
+			Location: user.Location.Code,
+			Since:    user.Since,
+		}
+	}
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(response); err != nil {
+		return NewError(500, "failed to write to output", err)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func ExampleSnapshot() {
+	tz := time.Local
+	time.Local = time.UTC
+	defer func() {
+		time.Local = tz
+	}()
+	err := Snapshot(testSource("testdata/journals"), "testdata/locations.xml", "2021-10-20 09:00", "", "text", false, "-", 0660)
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// 2 user(s) checked in at 2021-10-20 09:00:00:
+	// Hauptstadt:
+	//   since 2021-10-20 04:10:00 - Tester - Teststadt
+	// Teststadt:
+	//   since 2021-10-20 08:53:20 - Klaus - Musterdorf
+}
+
+func ExampleSnapshot_nobody() {
+	tz := time.Local
+	time.Local = time.UTC
+	defer func() {
+		time.Local = tz
+	}()
+	err := Snapshot(testSource("testdata/journals"), "testdata/locations.xml", "2021-10-20 03:00:00", "", "text", false, "-", 0660)
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// Nobody was checked in at 2021-10-20 03:00:00
+}
+
+func ExampleSnapshot_csv() {
+	tz := time.Local
+	time.Local = time.UTC
+	defer func() {
+		time.Local = tz
+	}()
+	err := Snapshot(testSource("testdata/journals"), "testdata/locations.xml", "2021-10-20T09:00:00+00:00", "", "csv", true, "-", 0660)
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// Location,Location code,Since,Name,Address,Phone,Email
+	// Hauptstadt,HST,2021-10-20 04:10:00,Tester,Teststadt,,
+	// Teststadt,TST,2021-10-20 08:53:20,Klaus,Musterdorf,,
+}
+
+func ExampleSnapshot_json() {
+	tz := time.Local
+	time.Local = time.UTC
+	defer func() {
+		time.Local = tz
+	}()
+	err := Snapshot(testSource("testdata/journals"), "testdata/locations.xml", "2021-10-20 09:00", "Teststadt", "json", false, "-", 0660)
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// {
+	//   "at": "2021-10-20T09:00:00Z",
+	//   "location": "TST",
+	//   "count": 1,
+	//   "users": [
+	//     {
+	//       "name": "Klaus",
+	//       "address": "Musterdorf",
+	//       "location": "TST",
+	//       "since": "2021-10-20T08:53:20Z"
+	//     }
+	//   ]
+	// }
+}
+
+func TestSnapshot(t *testing.T) {
+	values := [...]struct {
+		at       string
+		location string
+		format   string
+		code     int
+	}{
+		{"", "", "text", 400},
+		{"20.10.2021 09:00", "", "text", 400},
+		{"2021-10-20 09:00", "", "xml", 400},
+		{"2021-10-20 09:00", "XXX", "text", 404},
+	}
+	for _, value := range values {
+		err := Snapshot(testSource("testdata/journals"), "testdata/locations.xml", value.at, value.location, value.format, false, "-", 0660)
+		if assert.Error(t, err) {
+			assert.Equal(t, value.code, err.(*Error).Code(), "%s %s %s", value.at, value.location, value.format)
+		}
+	}
+}
+
+func TestParseTimeArg(t *testing.T) {
+	expected := time.Date(2021, time.October, 20, 9, 15, 0, 0, time.Local)
+	for _, text := range []string{"2021-10-20 09:15", "2021-10-20 09:15:00", "2021-10-20T09:15", "2021-10-20T09:15:00"} {
+		parsed, err := parseTimeArg(text)
+		if assert.NoError(t, err, text) {
+			assert.True(t, expected.Equal(parsed), text)
+		}
+	}
+	parsed, err := parseTimeArg("2021-10-20T09:15:00+02:00")
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1634714100), parsed.Unix())
+	}
+	_, err = parseTimeArg("2021-10-20")
+	assert.Error(t, err)
+}
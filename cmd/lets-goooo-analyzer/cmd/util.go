@@ -5,21 +5,226 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
 	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
 	"os"
 	"strings"
+	"time"
 )
 
-// readJournal reads the journal at the given path
-func readJournal(path string) (*journal.Journal, error) {
-	readJournal, err := journal.ReadJournal(path)
+// JournalSource describes the journal files that a command should read.
+type JournalSource struct {
+	// Paths are journal files or directories containing journal files
+	Paths []string
+	// From is the first date (YYYY-MM-DD) of journals to read from directories, empty for no limit
+	From string
+	// To is the last date (YYYY-MM-DD) of journals to read from directories, empty for no limit
+	To string
+	// EncryptionKey is the key to decrypt encrypted journals, raw or base64 encoded
+	EncryptionKey string
+	// EncryptionKeyFile is a file containing the key to decrypt encrypted journals, it overrides EncryptionKey
+	EncryptionKeyFile string
+	// Context cancels reading the journals, nil if reading can't be cancelled
+	Context context.Context
+	// Strict fails on the first invalid journal line, otherwise invalid lines are skipped and summarised
+	Strict bool
+}
+
+// DateFormat is the format in which dates are given on the command line
+const DateFormat = "2006-01-02"
+
+// TimeFormat is the format in which times are given on the command line, the seconds may be left out
+const TimeFormat = "2006-01-02 15:04:05"
+
+// maxListedSkippedLines limits how many skipped lines are listed in the summary
+const maxListedSkippedLines = 10
+
+// diagnosticsOutput receives the summary of skipped journal lines, separate from the command output
+var diagnosticsOutput io.Writer = os.Stderr
+
+// openJournal opens an iterator over the events of all journals of the given source.
+// The journals of each path are read one after the other, the events of several paths are merged chronologically.
+func openJournal(source JournalSource) (*journal.EventIterator, error) {
+	sources, err := resolveJournalSources(source)
+	if err != nil {
+		return nil, err
+	}
+	for _, files := range sources { // fail before any output is written
+		for _, file := range files {
+			if isFile, err := util.FileExists(file); err != nil || !isFile {
+				return nil, NewError(500, fmt.Sprintf("failed to read journal \"%s\"", file), err)
+			}
+		}
+	}
+	key, err := loadEncryptionKey(source)
+	if err != nil {
+		return nil, err
+	}
+	ctx := source.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	iterator, err := journal.NewMergedEventIterator(ctx, sources, journal.ReaderConfig{EncryptionKey: key, Strict: source.Strict})
+	if err != nil {
+		return nil, NewError(400, "invalid journal encryption key", err)
+	}
+	return iterator, nil
+}
+
+// loadEncryptionKey loads the key to decrypt the journals of the given source, nil if none is given
+func loadEncryptionKey(source JournalSource) ([]byte, error) {
+	key, err := util.LoadKey(source.EncryptionKey, source.EncryptionKeyFile, journal.EncryptionKeySize)
+	if err != nil {
+		return nil, NewError(400, "invalid journal encryption key", err)
+	}
+	return key, nil
+}
+
+// loadUserIDKey loads the key of the keyed user IDs, see journal.WriterConfig.
+func loadUserIDKey(userIDKey string, userIDKeyFile string) ([]byte, error) {
+	key, err := util.LoadKey(userIDKey, userIDKeyFile, journal.UserIDKeySize)
+	if err != nil {
+		return nil, NewError(400, "invalid user ID key", err)
+	}
+	return key, nil
+}
+
+// forEachEvent streams the events of all journals of the given source to the handler, one at a time.
+// Returning false from the handler stops the iteration early.
+func forEachEvent(source JournalSource, handler func(event *journal.Event) (bool, error)) error {
+	iterator, err := openJournal(source)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = iterator.Close() }()
+	return iterateEvents(iterator, handler)
+}
+
+// iterateEvents passes the events of the iterator to the handler like forEachEvent
+func iterateEvents(iterator *journal.EventIterator, handler func(event *journal.Event) (bool, error)) error {
+	for iterator.Next() {
+		event := iterator.Event()
+		resume, err := handler(&event)
+		if err != nil {
+			return err
+		}
+		if !resume {
+			return nil
+		}
+	}
+	if err := journalReadError(iterator.Err()); err != nil {
+		return err
+	}
+	reportSkippedLines(iterator.Diagnostics())
+	return nil
+}
+
+// reportSkippedLines prints a summary of the invalid journal lines that were skipped while reading
+func reportSkippedLines(diagnostics []journal.LineError) {
+	if len(diagnostics) == 0 {
+		return
+	}
+	summary := fmt.Sprintf("Skipped %d invalid journal line(s):\n", len(diagnostics))
+	for i, diagnostic := range diagnostics {
+		if i == maxListedSkippedLines {
+			summary += fmt.Sprintf("  ... and %d more\n", len(diagnostics)-i)
+			break
+		}
+		summary += fmt.Sprintf("  %s:%d: %v\n", diagnostic.File, diagnostic.Line, diagnostic.Reason)
+	}
+	_ = util.WriteString(diagnosticsOutput, summary) // the summary is only informational
+}
+
+// journalReadError converts an error from reading journals into a command error
+func journalReadError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.Canceled) {
+		return NewError(130, "reading the journals was cancelled", err)
+	}
+	var lineError *journal.LineError
+	if errors.As(err, &lineError) {
+		return NewError(422, "invalid journal line", err)
+	}
+	return NewError(500, "failed to read journals", err)
+}
+
+// resolveJournalFiles determines the journal files for the given source, expanding directories by the date range
+func resolveJournalFiles(source JournalSource) ([]string, error) {
+	sources, err := resolveJournalSources(source)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(sources))
+	for _, sourceFiles := range sources {
+		files = append(files, sourceFiles...)
+	}
+	return files, nil
+}
+
+// resolveJournalSources determines the journal files for each path of the given source, see resolveJournalFiles.
+// The files of a directory are ordered by time, like journal.ListJournalFiles orders them.
+func resolveJournalSources(source JournalSource) ([][]string, error) {
+	from, err := parseDateArg(source.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseDateArg(source.To)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([][]string, 0, len(source.Paths))
+	found := false
+	for _, journalPath := range source.Paths {
+		stat, err := os.Stat(journalPath)
+		if err != nil || !stat.IsDir() { // files (or missing files) are passed on as is, they're checked when reading
+			sources = append(sources, []string{journalPath})
+			found = true
+			continue
+		}
+		dirFiles, err := journal.ListJournalFiles(journalPath, from, to)
+		if err != nil {
+			return nil, NewError(500, fmt.Sprintf("failed to list journals in \"%s\"", journalPath), err)
+		}
+		sources = append(sources, dirFiles)
+		found = found || len(dirFiles) > 0
+	}
+	if !found {
+		return nil, NewError(404, "no journal files found", nil)
+	}
+	return sources, nil
+}
+
+// parseDateArg parses a date given on the command line, an empty text results in a zero time
+func parseDateArg(text string) (time.Time, error) {
+	if text == "" {
+		return time.Time{}, nil
+	}
+	date, err := time.ParseInLocation(DateFormat, text, time.Local)
+	if err != nil {
+		return time.Time{}, NewError(400, fmt.Sprintf("invalid date \"%s\", expected the format YYYY-MM-DD", text), err)
+	}
+	return date, nil
+}
+
+// parseTimeArg parses a local time given on the command line, alternatively in RFC 3339 format with a time zone
+func parseTimeArg(text string) (time.Time, error) {
+	for _, layout := range []string{TimeFormat, "2006-01-02 15:04", "2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, text, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	t, err := time.Parse(time.RFC3339, text)
 	if err != nil {
-		return nil, NewError(500, fmt.Sprintf("failed to read journal \"%s\"", path), err)
+		return time.Time{}, NewError(400, fmt.Sprintf("invalid time \"%s\", expected the format YYYY-MM-DD HH:MM[:SS]", text), err)
 	}
-	return &readJournal, nil
+	return t, nil
 }
 
 // readLocations reads the locations file at the given path
@@ -32,6 +237,19 @@ func readLocations(arg string) error {
 	return nil
 }
 
+// resolveLocation finds a location either by its code or case-insensitively by its name
+func resolveLocation(name string) (*journal.Location, error) {
+	if location, exists := journal.Locations[name]; exists {
+		return location, nil
+	}
+	for _, location := range journal.Locations {
+		if strings.ToLower(location.Name) == strings.ToLower(name) {
+			return location, nil
+		}
+	}
+	return nil, NewError(404, fmt.Sprintf("failed to resolve location \"%s\"", name), nil)
+}
+
 // openOutput returns an output stream, either to a new file or to stdout
 func openOutput(outputArg string, outputPermsArg uint) (io.WriteCloser, error) {
 	if outputArg == "" || outputArg == "-" { // If no output file is specified, then use stdout
@@ -53,48 +271,67 @@ func writeString(writer io.Writer, text string) error {
 	return nil
 }
 
-// findUser tries to find a user with the given filters in the journal
-func findUser(j *journal.Journal, nameFilter string, addressFilter string) (*journal.User, error) {
-	filters := 0 // The count of filters required to match on a user
-	if nameFilter != "" {
-		nameFilter = strings.ToLower(nameFilter)
-		filters++
+// userFilter matches users by parts of their name and address, either the free text or the structured one
+type userFilter struct {
+	name    string
+	address string
+}
+
+// newUserFilter creates a filter that ignores case, whitespace and Unicode normalisation (see journal.NormalizeIdentity),
+// at least one of name and address must be given
+func newUserFilter(name string, address string) (userFilter, error) {
+	name, address = journal.NormalizeIdentity(name), journal.NormalizeIdentity(address)
+	if name == "" && address == "" { // no filters set
+		return userFilter{}, NewError(400, "either a filter by name or by address must be specified", nil)
 	}
-	if addressFilter != "" {
-		addressFilter = strings.ToLower(addressFilter)
-		filters++
+	return userFilter{name: name, address: address}, nil
+}
+
+// matches checks if the user matches all parts of the filter
+func (filter *userFilter) matches(user *journal.User) bool {
+	if user == nil {
+		return false
 	}
-	if filters <= 0 { // no filters set
-		return nil, NewError(400, "either a filter by name or by address must be specified", nil)
+	if filter.name != "" && !strings.Contains(journal.NormalizeIdentity(user.Name), filter.name) {
+		return false
 	}
+	return filter.address == "" || strings.Contains(journal.NormalizeIdentity(user.FullAddress()), filter.address)
+}
 
-	user := (*journal.User)(nil) // The potentially found user
-	for iterUser := range j.GetUsers() {
-		matching := 0 // The number of matched filters
-		if nameFilter != "" {
-			if strings.Contains(strings.ToLower(iterUser.Name), nameFilter) {
-				matching++
-			}
-		}
-		if addressFilter != "" {
-			if strings.Contains(strings.ToLower(iterUser.Address), addressFilter) {
-				matching++
-			}
-		}
-		if matching >= filters { // If the enough filters matched, use the current user
-			user = iterUser
-			break
-		}
+// forEachEventFindingUser streams the events like forEachEvent and finds the first user with the given filters on the way,
+// so the journals are read only once. The handler gets the found user from its first event on, nil before.
+// Users without any events are only found at the end of the journals.
+// It returns the found user, or an error listing the known users if there's no such user.
+func forEachEventFindingUser(
+	source JournalSource, nameFilter string, addressFilter string,
+	handler func(user *journal.User, event *journal.Event) (bool, error),
+) (*journal.User, error) {
+	filter, err := newUserFilter(nameFilter, addressFilter)
+	if err != nil {
+		return nil, err
+	}
+	iterator, err := openJournal(source)
+	if err != nil {
+		return nil, err
 	}
-	if user == nil { // no user found
-		users := ""
-		for iterUser := range j.GetUsers() {
-			users += iterUser.Name + ", "
+	defer func() { _ = iterator.Close() }()
+
+	user := (*journal.User)(nil)
+	err = iterateEvents(iterator, func(event *journal.Event) (bool, error) {
+		if user == nil && filter.matches(event.User) {
+			user = event.User
 		}
-		if users != "" {
-			users = users[:len(users)-2]
+		return handler(user, event)
+	})
+	if err != nil || user != nil {
+		return user, err
+	}
+	names := make([]string, 0, len(iterator.Users()))
+	for _, user := range iterator.Users() {
+		if filter.matches(user) { // users without any events
+			return user, nil
 		}
-		return nil, NewError(404, "Could not find such a user, known users are: "+users, nil)
+		names = append(names, user.Name)
 	}
-	return user, nil
+	return nil, NewError(404, "Could not find such a user, known users are: "+strings.Join(names, ", "), nil)
 }
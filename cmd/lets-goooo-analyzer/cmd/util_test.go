@@ -5,20 +5,30 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/require"
 	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
+	"os"
+	"strings"
 	"testing"
 )
 
-func TestFindUser(t *testing.T) {
+// findUser finds a user like the commands do while streaming the journals
+func findUser(source JournalSource, name string, address string) (*journal.User, error) {
+	return forEachEventFindingUser(source, name, address, func(*journal.User, *journal.Event) (bool, error) {
+		return true, nil
+	})
+}
+
+func TestForEachEventFindingUser(t *testing.T) {
 	journal.Locations = map[string]*journal.Location{
 		"TST": {Code: "TST", Name: "Teststadt"},
 		"HST": {Code: "HST", Name: "Hauptstadt"},
 	}
 
-	j, err := journal.ReadJournal("testdata/journal.txt")
-	require.NoError(t, err, "Failed to load journal from test data!")
+	j := testSource("testdata/journal.txt")
 
 	tester := journal.User{
 		Name:    "Tester",
@@ -29,39 +39,225 @@ func TestFindUser(t *testing.T) {
 		Address: "Musterdorf",
 	}
 
-	if user, err := findUser(&j, "Tester", ""); assert.NoError(t, err) {
+	if user, err := findUser(j, "Tester", ""); assert.NoError(t, err) {
 		assert.Equal(t, tester, *user)
 	}
-	if user, err := findUser(&j, "Klaus", ""); assert.NoError(t, err) {
+	if user, err := findUser(j, "Klaus", ""); assert.NoError(t, err) {
 		assert.Equal(t, klaus, *user)
 	}
-	if user, err := findUser(&j, "", "Teststadt"); assert.NoError(t, err) {
+	if user, err := findUser(j, "", "Teststadt"); assert.NoError(t, err) {
 		assert.Equal(t, tester, *user)
 	}
-	if user, err := findUser(&j, "", "Musterdorf"); assert.NoError(t, err) {
+	if user, err := findUser(j, "", "Musterdorf"); assert.NoError(t, err) {
 		assert.Equal(t, klaus, *user)
 	}
-	if user, err := findUser(&j, "Tester", "Teststadt"); assert.NoError(t, err) {
+	if user, err := findUser(j, "Tester", "Teststadt"); assert.NoError(t, err) {
 		assert.Equal(t, tester, *user)
 	}
-	if user, err := findUser(&j, "Klaus", "Musterdorf"); assert.NoError(t, err) {
+	if user, err := findUser(j, "Klaus", "Musterdorf"); assert.NoError(t, err) {
+		assert.Equal(t, klaus, *user)
+	}
+	if user, err := findUser(j, " KLAUS ", "MUSTERDORF\u00a0"); assert.NoError(t, err, "the filters should ignore case and whitespace") {
 		assert.Equal(t, klaus, *user)
 	}
+	if user, err := findUser(testSource("testdata/journal_duplicates.txt"), "klaus müller", ""); assert.NoError(t, err) {
+		assert.Equal(t, journal.User{Name: "Klaus Müller", Address: "Musterdorf"}, *user, "spellings of the same person should be one user")
+	}
+
+	handled := make([]*journal.User, 0, 10)
+	user, err := forEachEventFindingUser(j, "Klaus", "", func(user *journal.User, event *journal.Event) (bool, error) {
+		handled = append(handled, user)
+		return true, nil
+	})
+	if assert.NoError(t, err) && assert.Len(t, handled, 8) {
+		assert.Nil(t, handled[0], "the user should only be passed from its first event on")
+		assert.Nil(t, handled[2])
+		assert.Same(t, user, handled[3])
+		assert.Same(t, user, handled[7])
+	}
 
-	_, err = findUser(&j, "???", "")
+	_, err = findUser(j, "???", "")
 	assert.Error(t, err)
 	assert.Equal(t, 404, err.(*Error).Code())
-	_, err = findUser(&j, "", "???")
+	_, err = findUser(j, "", "???")
 	assert.Error(t, err)
 	assert.Equal(t, 404, err.(*Error).Code())
 
-	_, err = findUser(&j, "Tester", "Musterdorf")
+	_, err = findUser(j, "Tester", "Musterdorf")
 	assert.Error(t, err)
 	assert.Equal(t, 404, err.(*Error).Code())
-	_, err = findUser(&j, "Klaus", "Teststadt")
+	_, err = findUser(j, "Klaus", "Teststadt")
 	assert.Error(t, err)
 	assert.Equal(t, 404, err.(*Error).Code())
 
-	_, err = findUser(&j, "", "")
+	_, err = findUser(j, "", "")
 	assert.Error(t, err)
 }
+
+func TestResolveJournalFiles(t *testing.T) {
+	files, err := resolveJournalFiles(testSource("testdata/journal.txt", "testdata/journals"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{
+			"testdata/journal.txt",
+			"testdata/journals/20211020.txt",
+			"testdata/journals/20211021.txt",
+			"testdata/journals/20211022.txt",
+		}, files)
+	}
+
+	files, err = resolveJournalFiles(JournalSource{Paths: []string{"testdata/journals"}, From: "2021-10-21", To: "2021-10-21"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"testdata/journals/20211021.txt"}, files)
+	}
+
+	files, err = resolveJournalFiles(JournalSource{Paths: []string{"testdata/rotated"}, From: "2021-10-21"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{
+			"testdata/rotated/20211021-06.txt",
+			"testdata/rotated/20211021-06_002.txt",
+			"testdata/rotated/2021-W43.txt",
+		}, files, "journals of any rotation should be resolved")
+	}
+
+	_, err = resolveJournalFiles(JournalSource{Paths: []string{"testdata/journals"}, From: "21.10.2021"})
+	if assert.Error(t, err) {
+		assert.Equal(t, 400, err.(*Error).Code())
+	}
+	_, err = resolveJournalFiles(JournalSource{Paths: []string{"testdata/journals"}, To: "2021-13-01"})
+	assert.Error(t, err)
+	_, err = resolveJournalFiles(JournalSource{Paths: []string{"testdata/journals"}, From: "2030-01-01"})
+	if assert.Error(t, err) {
+		assert.Equal(t, 404, err.(*Error).Code())
+	}
+	_, err = resolveJournalFiles(testSource())
+	assert.Error(t, err)
+}
+
+func TestForEachEvent_encrypted(t *testing.T) {
+	source := testSource("testdata/journal_encrypted.txt")
+	countEvents := func() ([]journal.Event, error) {
+		events := make([]journal.Event, 0, 8)
+		err := forEachEvent(source, func(event *journal.Event) (bool, error) {
+			events = append(events, *event)
+			return true, nil
+		})
+		return events, err
+	}
+	_, err := countEvents()
+	assert.Error(t, err, "encrypted journals can't be read without a key")
+
+	source.EncryptionKey = "thisis32bitlongpassphraseimusing"
+	if events, err := countEvents(); assert.NoError(t, err) {
+		if assert.Len(t, events, 8) {
+			assert.Equal(t, journal.User{Name: "Tester", Address: "Teststadt"}, *events[0].User)
+		}
+	}
+
+	source.EncryptionKey = "too short"
+	_, err = countEvents()
+	if assert.Error(t, err) {
+		assert.Equal(t, 400, err.(*Error).Code())
+	}
+}
+
+func TestForEachEvent(t *testing.T) {
+	journal.Locations = map[string]*journal.Location{
+		"TST": {Code: "TST", Name: "Teststadt"},
+		"HST": {Code: "HST", Name: "Hauptstadt"},
+	}
+	source := testSource("testdata/journal.txt")
+
+	read := 0
+	err := forEachEvent(source, func(event *journal.Event) (bool, error) {
+		read++
+		return read < 3, nil
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, read, "returning false should stop the iteration")
+	}
+
+	err = forEachEvent(source, func(event *journal.Event) (bool, error) {
+		return true, NewError(418, "test error", nil)
+	})
+	if assert.Error(t, err, "handler errors should stop the iteration") {
+		assert.Equal(t, 418, err.(*Error).Code())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	source.Context = ctx
+	err = forEachEvent(source, func(event *journal.Event) (bool, error) {
+		t.Error("no events should be read after the cancellation")
+		return true, nil
+	})
+	if assert.Error(t, err) {
+		assert.Equal(t, 130, err.(*Error).Code())
+	}
+
+	err = forEachEvent(testSource("testdata/missing.txt"), func(event *journal.Event) (bool, error) {
+		return true, nil
+	})
+	if assert.Error(t, err) {
+		assert.Equal(t, 500, err.(*Error).Code())
+	}
+}
+
+func TestForEachEvent_invalidLines(t *testing.T) {
+	journal.Locations = map[string]*journal.Location{
+		"TST": {Code: "TST", Name: "Teststadt"},
+	}
+	output := bytes.Buffer{}
+	diagnosticsOutput = &output
+	defer func() { diagnosticsOutput = os.Stderr }()
+	source := testSource("testdata/journal_invalid.txt")
+
+	events := make([]journal.Event, 0, 2)
+	err := forEachEvent(source, func(event *journal.Event) (bool, error) {
+		events = append(events, *event)
+		return true, nil
+	})
+	if assert.NoError(t, err, "invalid lines should be skipped by default") {
+		assert.Len(t, events, 2)
+		assert.Equal(t, "Skipped 2 invalid journal line(s):\n"+
+			"  testdata/journal_invalid.txt:3: couldn't resolve User hash \"O+Dig24BxOFwjJEN1oBbk/VW/tA=\" in event data: unknown user\n"+
+			"  testdata/journal_invalid.txt:4: failed to parse event timestamp \"noon\": strconv.ParseInt: parsing \"noon\": invalid syntax\n",
+			output.String())
+	}
+
+	output.Reset()
+	source.Strict = true
+	err = forEachEvent(source, func(event *journal.Event) (bool, error) {
+		return true, nil
+	})
+	if assert.Error(t, err, "invalid lines should fail in strict mode") {
+		assert.Equal(t, 422, err.(*Error).Code())
+		assert.Contains(t, err.Error(), "journal_invalid.txt:3")
+	}
+	assert.Empty(t, output.String())
+}
+
+func TestReportSkippedLines(t *testing.T) {
+	output := bytes.Buffer{}
+	diagnosticsOutput = &output
+	defer func() { diagnosticsOutput = os.Stderr }()
+
+	reportSkippedLines(nil)
+	assert.Empty(t, output.String(), "nothing should be reported without skipped lines")
+
+	diagnostics := make([]journal.LineError, maxListedSkippedLines+2)
+	for i := range diagnostics {
+		diagnostics[i] = journal.LineError{File: "journal.txt", Line: i + 1, Reason: errors.New("invalid")}
+	}
+	reportSkippedLines(diagnostics)
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if assert.Len(t, lines, maxListedSkippedLines+2) {
+		assert.Equal(t, "Skipped 12 invalid journal line(s):", lines[0])
+		assert.Equal(t, "  journal.txt:1: invalid", lines[1])
+		assert.Equal(t, "  ... and 2 more", lines[len(lines)-1])
+	}
+}
+
+// testSource creates a JournalSource for the given paths
+func testSource(paths ...string) JournalSource {
+	return JournalSource{Paths: paths}
+}
@@ -0,0 +1,53 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
+)
+
+// Verify checks the hash chains of the given journals and reports the first broken link of each journal.
+// Journals that link the chain of the previous journal are checked to continue it, too,
+// so that removed journals and lines removed from the end of a journal are detected.
+func Verify(source JournalSource, chainKey string) error {
+	if chainKey == "" {
+		return NewError(400, "the chain key of the server is required to verify journals", nil)
+	}
+	files, err := resolveJournalFiles(source)
+	if err != nil {
+		return err
+	}
+	encryptionKey, err := loadEncryptionKey(source)
+	if err != nil {
+		return err
+	}
+
+	broken := 0    // The number of journals with a broken chain
+	previous := "" // The last journal with an intact chain, whose end the next journal should link
+	for _, file := range files {
+		lines, err := journal.VerifyChain([]byte(chainKey), file)
+		chainErr := (*journal.ChainError)(nil)
+		if err == nil && previous != "" {
+			err = journal.VerifyChainLink(previous, file, encryptionKey)
+		}
+		previous = ""
+		if errors.As(err, &chainErr) {
+			fmt.Printf("%s:%d: %s\n", file, chainErr.Line, chainErr.Reason)
+			broken++
+		} else if err != nil {
+			return NewError(500, fmt.Sprintf("failed to verify journal \"%s\"", file), err)
+		} else {
+			fmt.Printf("%s: OK, %d lines verified\n", file, lines)
+			previous = file
+		}
+	}
+
+	if broken > 0 {
+		return NewError(422, fmt.Sprintf("%d of %d journals failed the verification", broken, len(files)), nil)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func ExampleVerify() {
+	err := Verify(testSource("testdata/journal_chained.txt", "testdata/journal_chained_tampered.txt"), "secret")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// testdata/journal_chained.txt: OK, 4 lines verified
+	// testdata/journal_chained_tampered.txt:3: MAC does not match, the line or one before it has been altered
+	// Error: error 422: 1 of 2 journals failed the verification
+}
+
+func ExampleVerify_linked() {
+	err := Verify(testSource("testdata/journals_linked"), "secret")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+	err = Verify(testSource("testdata/journals_linked/20261018-06.txt", "testdata/journals_linked/20261018-06_003.txt"), "secret")
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// testdata/journals_linked/20261018-06.txt: OK, 4 lines verified
+	// testdata/journals_linked/20261018-06_002.txt: OK, 3 lines verified
+	// testdata/journals_linked/20261018-06_003.txt: OK, 4 lines verified
+	// testdata/journals_linked/20261018-06.txt: OK, 4 lines verified
+	// testdata/journals_linked/20261018-06_003.txt:1: the journal doesn't continue the hash chain of testdata/journals_linked/20261018-06.txt, its end has been altered or a journal between them is missing
+	// Error: error 422: 1 of 2 journals failed the verification
+}
+
+func TestVerify(t *testing.T) {
+	assert.NoError(t, Verify(testSource("testdata/journal_chained.txt"), "secret"))
+	assert.Error(t, Verify(testSource("testdata/journal_chained.txt"), "wrong"))
+	assert.Error(t, Verify(testSource("testdata/journal.txt"), "secret"), "unchained journals should fail verification")
+	assert.Error(t, Verify(testSource("testdata/journal_chained.txt"), ""), "a key is required")
+	assert.Error(t, Verify(testSource("testdata/missingno"), "secret"))
+}
@@ -12,45 +12,34 @@ import (
 )
 
 func ViewContacts(
-	journalPath string, locationsPath string, name string, address string, csv bool,
+	source JournalSource, locationsPath string, name string, address string, csv bool,
 	csvHeaders bool, outputPath string, outputPerms uint) error {
 
 	if err := readLocations(locationsPath); err != nil {
 		return err
 	}
-	j, err := readJournal(journalPath)
-	if err != nil {
-		return err
-	}
-	user, err := findUser(j, name, address)
-	if err != nil {
-		return err
-	}
-
-	writer, err := openOutput(outputPath, outputPerms)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		err := writer.Close()
+	writer := io.WriteCloser(nil)    // The output is only opened once the user is found
+	selected := (*journal.User)(nil) // The user whose contacts are shown, as soon as the output is opened
+	begin := func(user *journal.User) error {
+		output, err := openOutput(outputPath, outputPerms)
 		if err != nil {
-			println("Failed to close output")
+			return err
 		}
-	}()
-
-	if csv {
-		if csvHeaders {
-			err = writeString(writer, "Duration in seconds,Location,Contact Name,Contact Address\n")
-			if err != nil {
-				return err
+		writer, selected = output, user
+		if csv {
+			if csvHeaders {
+				return writeString(writer, "Duration in seconds,Location,Contact Name,Contact Address,Contact Phone,Contact Email\n")
 			}
+			return nil
 		}
-	} else { // Print helper message with name and address of person
-		err = writeString(writer, fmt.Sprintf("Showing contacts for user %s (%s):\n", user.Name, user.Address))
-		if err != nil {
-			return err
-		}
+		// Print helper message with name and address of person
+		return writeString(writer, fmt.Sprintf("Showing contacts for user %s (%s):\n", user.Name, describeContact(user)))
 	}
+	defer func() {
+		if writer != nil && writer.Close() != nil {
+			println("Failed to close output")
+		}
+	}()
 
 	userLogin := (*journal.Event)(nil)         // The last read user login event
 	lastLocHeading := (*journal.Location)(nil) // The last written location heading, so locational contacts are grouped together
@@ -62,26 +51,33 @@ func ViewContacts(
 		allUserLocs[loc] = make(map[*journal.User]*journal.Event, 50)
 	}
 
-	events := j.GetEvents()
-	for i, event := range events {
+	user, err := forEachEventFindingUser(source, name, address, func(user *journal.User, event *journal.Event) (bool, error) {
+		if event.User == nil { // unresolved events can't be contacts
+			return true, nil
+		}
+		if user != nil && selected == nil { // the first event of the user
+			if err := begin(user); err != nil {
+				return false, err
+			}
+		}
 		// If an event concerning the selected user is encountered
 		if event.User == user {
 			switch event.EventType {
 			case journal.LOGIN: // on login just set the login event
-				userLogin = &events[i]
+				userLogin = event
 
 			case journal.LOGOUT: // on logout check all other persons that are currently checked in
 				if userLogin == nil { // handle unexpected logout
-					continue
+					return true, nil
 				}
 				for otherUser, otherLogin := range allUserLocs[userLogin.Location] {
-					err = printContact(
+					err := printContact(
 						writer,
-						otherUser, getLaterEvent(userLogin, otherLogin), &event,
+						otherUser, getLaterEvent(userLogin, otherLogin), event,
 						csv, &lastLocHeading,
 					)
 					if err != nil {
-						return err
+						return false, err
 					}
 				}
 				userLogin = nil
@@ -90,21 +86,21 @@ func ViewContacts(
 		} else { // If the event is about a different user
 			switch event.EventType {
 			case journal.LOGIN: // store the login event
-				allUserLocs[event.Location][event.User] = &events[i]
+				allUserLocs[event.Location][event.User] = event
 
 			case journal.LOGOUT: // check if the user is at the same location as the selected user, then print that contact
 				if userLogin != nil && event.Location == userLogin.Location {
 					login, exists := allUserLocs[event.Location][event.User]
 					if !exists { // handle unexpected logout
-						continue
+						return true, nil
 					}
-					err = printContact(
+					err := printContact(
 						writer,
-						event.User, getLaterEvent(login, userLogin), &event,
+						event.User, getLaterEvent(login, userLogin), event,
 						csv, &lastLocHeading,
 					)
 					if err != nil {
-						return err
+						return false, err
 					}
 				}
 
@@ -112,9 +108,12 @@ func ViewContacts(
 				delete(allUserLocs[event.Location], event.User)
 			}
 		}
+		return true, nil
+	})
+	if err == nil && selected == nil { // a user without any events has no contacts
+		err = begin(user)
 	}
-
-	return nil
+	return err
 }
 
 // getLaterEvent returns the event that happened earlier from the given arguments
@@ -137,12 +136,18 @@ func printContact(
 		}
 		*lastLocHeading = login.Location
 	}
-	// Calculate the duration between login and logout
-	duration := time.Unix(logout.Timestamp, 0).Sub(time.Unix(login.Timestamp, 0))
+	// Calculate the duration between login and logout, automatic logouts end the stay at its deadline
+	duration := time.Unix(logout.OccurredAt(), 0).Sub(time.Unix(login.Timestamp, 0))
+	if duration < 0 { // the stay ended before the other one began, they only overlap until the logout was written
+		return nil
+	}
 	secs := int(duration.Seconds())
 
 	if csv {
-		err := writeString(writer, fmt.Sprintf("%d,%s,\"%s\",\"%s\"\n", secs, login.Location.Name, otherUser.Name, otherUser.Address))
+		err := writeString(writer, fmt.Sprintf(
+			"%d,%s,\"%s\",\"%s\",\"%s\",\"%s\"\n",
+			secs, login.Location.Name, otherUser.Name, otherUser.FullAddress(), otherUser.Phone, otherUser.Email,
+		))
 		if err != nil {
 			return err
 		}
@@ -150,7 +155,7 @@ func printContact(
 		err := writeString(writer, fmt.Sprintf(
 			"  %2dh %2dm %2ds - %s - %s\n",
 			secs/3600, secs/60%60, secs%60,
-			otherUser.Name, otherUser.Address,
+			otherUser.Name, describeContact(otherUser),
 		))
 		if err != nil {
 			return err
@@ -159,3 +164,12 @@ func printContact(
 
 	return nil
 }
+
+// describeContact joins the address and the contact details of the user for the text output
+func describeContact(user *journal.User) string {
+	address, details := user.FullAddress(), user.ContactDetails()
+	if address == "" || details == "" {
+		return address + details
+	}
+	return address + ", " + details
+}
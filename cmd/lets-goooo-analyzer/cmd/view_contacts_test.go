@@ -12,7 +12,7 @@ import (
 )
 
 func ExampleViewContacts_filterA() {
-	err := ViewContacts("testdata/journal_contacts.txt", "testdata/locations.xml", "Tester", "", false, false, "-", 0777)
+	err := ViewContacts(testSource("testdata/journal_contacts.txt"), "testdata/locations.xml", "Tester", "", false, false, "-", 0777)
 	if err != nil {
 		fmt.Printf("Error: %v", err)
 	}
@@ -28,37 +28,87 @@ func ExampleViewContacts_filterA() {
 }
 
 func ExampleViewContacts_filterA_csv() {
-	err := ViewContacts("testdata/journal_contacts.txt", "testdata/locations.xml", "", "Teststadt", true, false, "-", 0777)
+	err := ViewContacts(testSource("testdata/journal_contacts.txt"), "testdata/locations.xml", "", "Teststadt", true, false, "-", 0777)
 	if err != nil {
 		fmt.Printf("Error: %v", err)
 	}
 
 	// Output:
-	// 1,Teststadt,"Klaus","Musterdorf"
-	// 1000,Teststadt,"Klaus","Musterdorf"
-	// 1000,Hauptstadt,"Klaus","Musterdorf"
-	// 3601,Hauptstadt,"Klaus","Musterdorf"
+	// 1,Teststadt,"Klaus","Musterdorf","",""
+	// 1000,Teststadt,"Klaus","Musterdorf","",""
+	// 1000,Hauptstadt,"Klaus","Musterdorf","",""
+	// 3601,Hauptstadt,"Klaus","Musterdorf","",""
 }
 
 func ExampleViewContacts_filterB_csv() {
-	err := ViewContacts("testdata/journal.txt", "testdata/locations.xml", "Klaus", "", true, true, "-", 0777)
+	err := ViewContacts(testSource("testdata/journal.txt"), "testdata/locations.xml", "Klaus", "", true, true, "-", 0777)
 	if err != nil {
 		fmt.Printf("Error: %v", err)
 	}
 
 	// Output:
-	// Duration in seconds,Location,Contact Name,Contact Address
-	// 2000,Hauptstadt,"Tester","Teststadt"
+	// Duration in seconds,Location,Contact Name,Contact Address,Contact Phone,Contact Email
+	// 2000,Hauptstadt,"Tester","Teststadt","",""
+}
+
+func ExampleViewContacts_journalsDirectory() {
+	err := ViewContacts(testSource("testdata/journals"), "testdata/locations.xml", "Klaus", "", true, false, "-", 0777)
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// 2000,Hauptstadt,"Tester","Teststadt","",""
+}
+
+func ExampleViewContacts_instances() {
+	// the journals of several servers are merged chronologically, whatever order they're given in
+	err := ViewContacts(testSource("testdata/instances/b", "testdata/instances/a"), "testdata/locations.xml", "Tester", "", false, false, "-", 0777)
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// Showing contacts for user Tester (Teststadt):
+	// Teststadt:
+	//    0h  0m  1s - Klaus - Musterdorf
+	//    0h 16m 40s - Klaus - Musterdorf
+	// Hauptstadt:
+	//    0h 16m 40s - Klaus - Musterdorf
+	//    1h  0m  1s - Klaus - Musterdorf
+}
+
+func ExampleViewContacts_contactDetails() {
+	err := ViewContacts(testSource("testdata/journal_details.txt"), "testdata/locations.xml", "", "Mosbach", false, false, "-", 0777)
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// Showing contacts for user Erika (Beispielweg 1, 74821 Mosbach, +49 6261 123456, erika@example.com):
+	// Teststadt:
+	//    0h  6m 40s - Klaus - Musterdorf, klaus@example.com
+}
+
+func ExampleViewContacts_contactDetails_csv() {
+	err := ViewContacts(testSource("testdata/journal_details.txt"), "testdata/locations.xml", "Klaus", "", true, true, "-", 0777)
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+	}
+
+	// Output:
+	// Duration in seconds,Location,Contact Name,Contact Address,Contact Phone,Contact Email
+	// 400,Teststadt,"Erika","Beispielweg 1, 74821 Mosbach","+49 6261 123456","erika@example.com"
 }
 
 func TestViewContacts_errors(t *testing.T) {
 	tempDir := t.TempDir()
-	assert.Error(t, ViewContacts("testdata/missingno", "testdata/locations.xml", "Klaus", "", false, false, "", 0777))
-	assert.Error(t, ViewContacts("testdata/journal.txt", "testdata/missingno", "Klaus", "", false, false, "", 0777))
-	assert.Error(t, ViewContacts("testdata/journal.txt", "testdata/locations.xml", "Unknown user", "", false, false, "", 0777))
-	assert.Error(t, ViewContacts("testdata/journal.txt", "testdata/locations.xml", "", "Unknown address", false, false, "", 0777))
-	assert.Error(t, ViewContacts("testdata/journal.txt", "testdata/locations.xml", "Klaus", "Teststadt", false, false, "", 0777))
-	assert.Error(t, ViewContacts("testdata/journal.txt", "testdata/locations.xml", "Klaus", "", false, false, tempDir, 0777))
+	assert.Error(t, ViewContacts(testSource("testdata/missingno"), "testdata/locations.xml", "Klaus", "", false, false, "", 0777))
+	assert.Error(t, ViewContacts(testSource("testdata/journal.txt"), "testdata/missingno", "Klaus", "", false, false, "", 0777))
+	assert.Error(t, ViewContacts(testSource("testdata/journal.txt"), "testdata/locations.xml", "Unknown user", "", false, false, "", 0777))
+	assert.Error(t, ViewContacts(testSource("testdata/journal.txt"), "testdata/locations.xml", "", "Unknown address", false, false, "", 0777))
+	assert.Error(t, ViewContacts(testSource("testdata/journal.txt"), "testdata/locations.xml", "Klaus", "Teststadt", false, false, "", 0777))
+	assert.Error(t, ViewContacts(testSource("testdata/journal.txt"), "testdata/locations.xml", "Klaus", "", false, false, tempDir, 0777))
 }
 
 func TestGetLaterEvent(t *testing.T) {
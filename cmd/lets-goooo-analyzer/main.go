@@ -5,9 +5,12 @@
 package main
 
 import (
+	"context"
 	"lehre.mosbach.dhbw.de/lets-goooo/v2/cmd/lets-goooo-analyzer/cmd"
 	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/argp"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
 	"os"
+	"os/signal"
 )
 
 func main() {
@@ -18,10 +21,6 @@ func main() {
 		Names: []string{"locations", "l"},
 		Usage: "A location XML file to load the location data from",
 	}
-	journalProtoArg := argp.FlagBuildArgs{
-		Names: []string{"journal"},
-		Usage: "The journal input path",
-	}
 	personNameProtoArg := argp.FlagBuildArgs{
 		Names: []string{"name", "n"},
 		Usage: "Find the person by their name",
@@ -31,7 +30,7 @@ func main() {
 		Usage: "Find the person by their address",
 	}
 	// special override because the output is generated automatically by default
-	outputFileProtoArgDefault := "<journal>-export.csv"
+	outputFileProtoArgDefault := "<journals>-export.csv"
 	outputFileProtoArg := argp.FlagBuildArgs{
 		Names:       []string{"output-file", "output", "o"},
 		Usage:       "The CSV output file",
@@ -54,14 +53,14 @@ func main() {
 
 	// SHOW-PERSON command
 	showPersonCmd := commandGroup.AddSubcommand(argp.CreateSubcommand("show-person", "Show the person with the given name"))
-	showPersonJournal := showPersonCmd.PositionalString(journalProtoArg, "")
+	showPersonSource := addJournalSourceArgs(showPersonCmd)
 	showPersonLocations := showPersonCmd.String(locationsProtoArg, "locations.xml")
 	showPersonName := showPersonCmd.String(personNameProtoArg, "")
 	showPersonAddress := showPersonCmd.String(personAddressProtoArg, "")
 
 	// VIEW-CONTACTS command
 	viewContactsCmd := commandGroup.AddSubcommand(argp.CreateSubcommand("view-contacts", "Creates a personal contact list with a journal"))
-	viewContactsJournal := viewContactsCmd.PositionalString(journalProtoArg, "")
+	viewContactsSource := addJournalSourceArgs(viewContactsCmd)
 	viewContactsLocations := viewContactsCmd.String(locationsProtoArg, "locations.xml")
 	viewContactsName := viewContactsCmd.String(personNameProtoArg, "")
 	viewContactsAddress := viewContactsCmd.String(personAddressProtoArg, "")
@@ -75,7 +74,7 @@ func main() {
 
 	// EXPORT command
 	exportCmd := commandGroup.AddSubcommand(argp.CreateSubcommand("export", "Export the journal to CSV"))
-	exportJournal := exportCmd.PositionalString(journalProtoArg, "")
+	exportSource := addJournalSourceArgs(exportCmd)
 	exportLocations := exportCmd.String(locationsProtoArg, "locations.xml")
 	exportCSVHeaders := exportCmd.Bool(csvHeaderProtoArg, false)
 	exportOutput := exportCmd.String(outputFileProtoArg, "")
@@ -85,6 +84,175 @@ func main() {
 		Usage: "Filter the events by a location, given either as code (three letters) or by the full name",
 	}, "")
 
+	// SNAPSHOT command
+	snapshotCmd := commandGroup.AddSubcommand(argp.CreateSubcommand("snapshot", "List the users that were checked in at a given time"))
+	snapshotSource := addJournalSourceArgs(snapshotCmd)
+	snapshotLocations := snapshotCmd.String(locationsProtoArg, "locations.xml")
+	snapshotAt := snapshotCmd.String(argp.FlagBuildArgs{
+		Names: []string{"at", "t"},
+		Usage: "The local time of the snapshot as YYYY-MM-DD HH:MM[:SS], or in RFC 3339 format with a time zone",
+	}, "")
+	snapshotLocation := snapshotCmd.String(argp.FlagBuildArgs{
+		Names: []string{"location", "loc"},
+		Usage: "Only list the users at a location, given either as code (three letters) or by the full name",
+	}, "")
+	snapshotFormat := snapshotCmd.String(argp.FlagBuildArgs{
+		Names: []string{"format", "f"},
+		Usage: "The output format: \"text\", \"csv\" or \"json\"",
+	}, string(cmd.SNAPSHOTTEXT))
+	snapshotCSVHeaders := snapshotCmd.Bool(csvHeaderProtoArg, false)
+	snapshotOutput := snapshotCmd.String(argp.FlagBuildArgs{
+		Names: []string{"output-file", "output", "o"},
+		Usage: "The output file, \"-\" writes to stdout",
+	}, "-")
+	snapshotOutputPerms := snapshotCmd.Uint(outputFilePermsProtoArg, 0660)
+
+	// VERIFY command
+	verifyCmd := commandGroup.AddSubcommand(argp.CreateSubcommand("verify", "Verify the hash chains of journals to detect tampering"))
+	verifySource := addJournalSourceArgs(verifyCmd)
+	verifyChainKey := verifyCmd.String(argp.FlagBuildArgs{
+		Names: []string{"chain-key", "key"},
+		Usage: "The secret the server used to chain the journal lines",
+	}, "")
+
+	// CHECK command
+	checkCmd := commandGroup.AddSubcommand(argp.CreateSubcommand("check", "List anomalies in journals, like logouts without login"))
+	checkSource := addJournalSourceArgs(checkCmd)
+	checkLocations := checkCmd.String(locationsProtoArg, "locations.xml")
+
+	// DUPLICATES command
+	duplicatesCmd := commandGroup.AddSubcommand(argp.CreateSubcommand("duplicates", "List users that are likely the same person despite different spellings"))
+	duplicatesSource := addJournalSourceArgs(duplicatesCmd)
+	duplicatesLocations := duplicatesCmd.String(locationsProtoArg, "locations.xml")
+	duplicatesMaxDistance := duplicatesCmd.Int(argp.FlagBuildArgs{
+		Names: []string{"max-typos", "t"},
+		Usage: "The number of typos the names and addresses of likely-same users may differ by",
+	}, journal.DefaultMaxDuplicateDistance)
+
+	// COMPARE command
+	compareCmd := commandGroup.AddSubcommand(argp.CreateSubcommand("compare", "Compare the journals of a server with the replicas of its follower"))
+	compareDirectory := compareCmd.PositionalString(argp.FlagBuildArgs{
+		Names: []string{"journals-directory"},
+		Usage: "The journals directory of the primary server",
+	}, "journals")
+	compareReplicaDirectory := compareCmd.PositionalString(argp.FlagBuildArgs{
+		Names: []string{"replica-directory"},
+		Usage: "The journals directory of the follower",
+	}, "replica")
+
+	// REPAIR command
+	repairCmd := commandGroup.AddSubcommand(argp.CreateSubcommand("repair", "Write a corrected copy of a journal"))
+	repairJournal := repairCmd.PositionalString(argp.FlagBuildArgs{
+		Names: []string{"journal"},
+		Usage: "The journal file to repair",
+	}, "")
+	repairLocations := repairCmd.String(locationsProtoArg, "locations.xml")
+	repairOutputDefault := "<journal>-repaired.txt"
+	repairOutput := repairCmd.String(argp.FlagBuildArgs{
+		Names:       []string{"output-file", "output", "o"},
+		Usage:       "The file to write the repaired journal to",
+		DefaultText: &repairOutputDefault,
+	}, "")
+	repairChainKey := repairCmd.String(argp.FlagBuildArgs{
+		Names: []string{"chain-key"},
+		Usage: "The secret to seal the repaired journal in a hash chain, like the server does",
+	}, "")
+	repairEncryptionKey := repairCmd.String(argp.FlagBuildArgs{
+		Names: []string{"encryption-key"},
+		Usage: "The key to decrypt the journal and encrypt the repaired journal with, raw or base64 encoded",
+	}, "")
+	repairEncryptionKeyFile := repairCmd.String(argp.FlagBuildArgs{
+		Names: []string{"encryption-key-file", "key-file"},
+		Usage: "A file containing the key to decrypt and encrypt the journals with",
+	}, "")
+
+	// MERGE command
+	mergeCmd := commandGroup.AddSubcommand(argp.CreateSubcommand("merge", "Merge the journals of several server instances with the same encryption key into one journal"))
+	mergeSource := addJournalSourceArgs(mergeCmd)
+	mergeLocations := mergeCmd.String(argp.FlagBuildArgs{
+		Names: []string{"locations", "l"},
+		Usage: "The location XML file for instances without their own, which is given as \"<journals>=<locations file>\"",
+	}, "locations.xml")
+	mergeOutput := mergeCmd.String(argp.FlagBuildArgs{
+		Names: []string{"output-file", "output", "o"},
+		Usage: "The file to write the merged journal to, the merged locations are written next to it as <name>-locations.xml",
+	}, "merged.txt")
+	mergeChainKey := mergeCmd.String(argp.FlagBuildArgs{
+		Names: []string{"chain-key"},
+		Usage: "The secret to seal the merged journal in a hash chain, like the server does",
+	}, "")
+	mergeUserIDKey, mergeUserIDKeyFile := addUserIDKeyArgs(mergeCmd, "The key to derive the user IDs of the merged journal with, raw or base64 encoded.\n"+
+		"Without a key, the unkeyed hashes of the user identities are used.")
+
+	// IMPORT command
+	importCmd := commandGroup.AddSubcommand(argp.CreateSubcommand("import", "Import events from CSV, e.g. typed up paper lists, into a journal"))
+	importCSV := importCmd.PositionalString(argp.FlagBuildArgs{
+		Names: []string{"csv-file"},
+		Usage: "The CSV file with the columns of the export: event type, location, timestamp, name and address",
+	}, "")
+	importLocations := importCmd.String(locationsProtoArg, "locations.xml")
+	importOutput := importCmd.String(argp.FlagBuildArgs{
+		Names: []string{"output-file", "output", "o"},
+		Usage: "The journal file to write the imported events to",
+	}, "imported.txt")
+	importChainKey := importCmd.String(argp.FlagBuildArgs{
+		Names: []string{"chain-key"},
+		Usage: "The secret to seal the imported journal in a hash chain, like the server does",
+	}, "")
+	importEncryptionKey := importCmd.String(argp.FlagBuildArgs{
+		Names: []string{"encryption-key"},
+		Usage: "The key to encrypt the imported journal with, raw or base64 encoded",
+	}, "")
+	importEncryptionKeyFile := importCmd.String(argp.FlagBuildArgs{
+		Names: []string{"encryption-key-file", "key-file"},
+		Usage: "A file containing the key to encrypt the imported journal with",
+	}, "")
+	importUserIDKey, importUserIDKeyFile := addUserIDKeyArgs(importCmd, "The key to derive the user IDs of the imported journal with, raw or base64 encoded.\n"+
+		"Without a key, the unkeyed hashes of the user identities are used.")
+
+	// MIGRATE command
+	migrateCmd := commandGroup.AddSubcommand(argp.CreateSubcommand("migrate", "Upgrade journals to the current format, e.g. with keyed user IDs"))
+	migrateSource := addJournalSourceArgs(migrateCmd)
+	migrateChainKey := migrateCmd.String(argp.FlagBuildArgs{
+		Names: []string{"chain-key"},
+		Usage: "The secret to seal the migrated journals in a hash chain, like the server does",
+	}, "")
+	migrateUserIDKey, migrateUserIDKeyFile := addUserIDKeyArgs(migrateCmd, "The key the server derives the user IDs with, raw or base64 encoded.\n"+
+		"Without a key, the unkeyed hashes of the user identities are used.")
+
+	// RETENTION command
+	retentionCmd := commandGroup.AddSubcommand(argp.CreateSubcommand("retention", "Purge or anonymise journals after the retention period"))
+	retentionDirectory := retentionCmd.PositionalString(argp.FlagBuildArgs{
+		Names: []string{"journals-directory"},
+		Usage: "The directory of journal files",
+	}, "journals")
+	retentionDays := retentionCmd.Int(argp.FlagBuildArgs{
+		Names: []string{"days", "d"},
+		Usage: "The number of days to keep journals for after the day they were written",
+	}, 28)
+	retentionMode := retentionCmd.String(argp.FlagBuildArgs{
+		Names: []string{"mode", "m"},
+		Usage: "Either \"purge\" to delete old journals or \"anonymise\" to replace the user data in them",
+	}, string(journal.PURGE))
+	retentionAuditFileDefault := "<journals-directory>/" + journal.DefaultAuditFileName
+	retentionAuditFile := retentionCmd.String(argp.FlagBuildArgs{
+		Names:       []string{"audit-file"},
+		Usage:       "The file that every purged or anonymised journal is recorded in",
+		DefaultText: &retentionAuditFileDefault,
+	}, "")
+	retentionChainKey := retentionCmd.String(argp.FlagBuildArgs{
+		Names: []string{"chain-key"},
+		Usage: "The secret to seal anonymised journals in a hash chain, like the server does",
+	}, "")
+	retentionEncryptionKey := retentionCmd.String(argp.FlagBuildArgs{
+		Names: []string{"encryption-key"},
+		Usage: "The key to decrypt and encrypt the records of anonymised journals with, raw or base64 encoded",
+	}, "")
+	retentionEncryptionKeyFile := retentionCmd.String(argp.FlagBuildArgs{
+		Names: []string{"encryption-key-file", "key-file"},
+		Usage: "A file containing the key to decrypt and encrypt the journals with",
+	}, "")
+
 	// Parse the system arguments
 	subcommand, err := commandGroup.ParseSubcommand(os.Args[1:])
 	if err != nil { // Errors are already printed, no further error handling required
@@ -100,25 +268,132 @@ func main() {
 		os.Exit(0)
 
 	case showPersonCmd:
-		handleCmdError(cmd.ShowPerson(*showPersonJournal, *showPersonLocations, *showPersonName, *showPersonAddress))
+		handleCmdError(cmd.ShowPerson(
+			showPersonSource(),
+			*showPersonLocations, *showPersonName, *showPersonAddress,
+		))
 
 	case viewContactsCmd:
 		handleCmdError(cmd.ViewContacts(
-			*viewContactsJournal, *viewContactsLocations, *viewContactsName, *viewContactsAddress,
+			viewContactsSource(),
+			*viewContactsLocations, *viewContactsName, *viewContactsAddress,
 			*viewContactsCSV, *viewContactsCSVHeaders, *viewContactsOutput, *viewContactsOutputPerms,
 		))
 
 	case exportCmd:
 		handleCmdError(cmd.Export(
-			*exportJournal, *exportLocations, *exportCSVHeaders, *exportOutput, *exportOutputPerms,
+			exportSource(),
+			*exportLocations, *exportCSVHeaders, *exportOutput, *exportOutputPerms,
 			*exportLocation,
 		))
 
+	case snapshotCmd:
+		handleCmdError(cmd.Snapshot(
+			snapshotSource(),
+			*snapshotLocations, *snapshotAt, *snapshotLocation,
+			*snapshotFormat, *snapshotCSVHeaders, *snapshotOutput, *snapshotOutputPerms,
+		))
+
+	case verifyCmd:
+		handleCmdError(cmd.Verify(verifySource(), *verifyChainKey))
+
+	case checkCmd:
+		handleCmdError(cmd.Check(checkSource(), *checkLocations))
+
+	case duplicatesCmd:
+		handleCmdError(cmd.Duplicates(duplicatesSource(), *duplicatesLocations, *duplicatesMaxDistance))
+
+	case compareCmd:
+		handleCmdError(cmd.Compare(*compareDirectory, *compareReplicaDirectory))
+
+	case repairCmd:
+		handleCmdError(cmd.Repair(
+			*repairJournal, *repairLocations, *repairOutput,
+			*repairChainKey, *repairEncryptionKey, *repairEncryptionKeyFile,
+		))
+
+	case mergeCmd:
+		handleCmdError(cmd.Merge(
+			mergeSource(), *mergeLocations, *mergeOutput,
+			*mergeChainKey, *mergeUserIDKey, *mergeUserIDKeyFile,
+		))
+
+	case importCmd:
+		handleCmdError(cmd.Import(
+			*importCSV, *importLocations, *importOutput,
+			*importChainKey, *importEncryptionKey, *importEncryptionKeyFile, *importUserIDKey, *importUserIDKeyFile,
+		))
+
+	case migrateCmd:
+		handleCmdError(cmd.Migrate(migrateSource(), *migrateChainKey, *migrateUserIDKey, *migrateUserIDKeyFile))
+
+	case retentionCmd:
+		handleCmdError(cmd.Retention(
+			*retentionDirectory, *retentionDays, *retentionMode, *retentionAuditFile,
+			*retentionChainKey, *retentionEncryptionKey, *retentionEncryptionKeyFile,
+		))
+
 	default: // should™ be unreachable
 		println("Invalid subcommand!")
 	}
 }
 
+// addUserIDKeyArgs adds the arguments for the key of the keyed user IDs with the given usage to the subcommand.
+func addUserIDKeyArgs(subcommand *argp.Subcommand, usage string) (*string, *string) {
+	userIDKey := subcommand.String(argp.FlagBuildArgs{
+		Names: []string{"user-id-key"},
+		Usage: usage,
+	}, "")
+	userIDKeyFile := subcommand.String(argp.FlagBuildArgs{
+		Names: []string{"user-id-key-file"},
+		Usage: "A file containing the key to derive the user IDs with",
+	}, "")
+	return userIDKey, userIDKeyFile
+}
+
+// addJournalSourceArgs adds the arguments to select the input journals to the subcommand.
+// The returned function builds the journal source from the parsed arguments.
+func addJournalSourceArgs(subcommand *argp.Subcommand) func() cmd.JournalSource {
+	paths := subcommand.PositionalStrings(argp.FlagBuildArgs{
+		Names: []string{"journals"},
+		Usage: "The journal input files or directories of journal files",
+	}, nil)
+	from := subcommand.String(argp.FlagBuildArgs{
+		Names: []string{"from"},
+		Usage: "The first date (YYYY-MM-DD) of journals to read from directories",
+	}, "")
+	to := subcommand.String(argp.FlagBuildArgs{
+		Names: []string{"to"},
+		Usage: "The last date (YYYY-MM-DD) of journals to read from directories",
+	}, "")
+	encryptionKey := subcommand.String(argp.FlagBuildArgs{
+		Names: []string{"encryption-key"},
+		Usage: "The key to decrypt encrypted journals with, raw or base64 encoded",
+	}, "")
+	encryptionKeyFile := subcommand.String(argp.FlagBuildArgs{
+		Names: []string{"encryption-key-file", "key-file"},
+		Usage: "A file containing the key to decrypt encrypted journals with",
+	}, "")
+	strict := subcommand.Bool(argp.FlagBuildArgs{
+		Names: []string{"strict"},
+		Usage: "Fail on the first invalid journal line, instead of skipping invalid lines and summarising them",
+	}, false)
+
+	return func() cmd.JournalSource {
+		// Reading the journals stops on interrupts, so that long runs over large journals can be aborted cleanly
+		ctx, _ := signal.NotifyContext(context.Background(), os.Interrupt)
+		return cmd.JournalSource{
+			Context:           ctx,
+			Paths:             *paths,
+			From:              *from,
+			To:                *to,
+			EncryptionKey:     *encryptionKey,
+			EncryptionKeyFile: *encryptionKeyFile,
+			Strict:            *strict,
+		}
+	}
+}
+
 func handleCmdError(error error) {
 	if cmdError, success := error.(*cmd.Error); success {
 		println(cmdError.Error())
@@ -24,10 +24,10 @@ func Validate(string2 string) (journal.User, error) {
 
 	if util.Base64Encode(util.HashString(userData[0]+"\t"+cookieSecret)) == userData[1] {
 		userData0, _ := util.Base64Decode(userData[0])
-		userData = strings.Split(string(userData0), "\t")
-		user := journal.User{
-			Name:    userData[0],
-			Address: userData[1],
+		// the cookie holds the user data in the journal format, including the optional fields
+		user, err := journal.ParseUserJournalLine(string(userData0))
+		if err != nil {
+			return user, fmt.Errorf("user data in cookie is invalid: %w", err)
 		}
 
 		return user, nil
@@ -69,4 +69,17 @@ func TestValidate(t *testing.T) {
 	user, err := Validate(correctCookie)
 	assert.NoError(t, err)
 	assert.Equal(t, expectedUser, user)
+
+	//Contact details
+	data = util.Base64Encode([]byte("Tom\t\tphone=+49 123\tcity=Mosbach"))
+	hash = util.Base64Encode(util.HashString(data + "\t" + cookieSecret))
+	user, err = Validate(data + ":" + hash)
+	assert.NoError(t, err)
+	assert.Equal(t, journal.User{Name: "Tom", Phone: "+49 123", City: "Mosbach"}, user)
+
+	//Invalid user data
+	data = util.Base64Encode([]byte("Tom"))
+	hash = util.Base64Encode(util.HashString(data + "\t" + cookieSecret))
+	_, err = Validate(data + ":" + hash)
+	assert.Error(t, err)
 }
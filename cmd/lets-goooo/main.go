@@ -5,15 +5,22 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/argp"
 	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
 	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/token"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/webhook"
 	"math/rand"
 	"os"
+	"strings"
 	"time"
 )
 
+// defaultUserIDKeyFile is the file that keeps the user ID key, if no key is given
+const defaultUserIDKeyFile = "user-id.key"
+
 func main() {
 	println("Let's goooo!")
 
@@ -43,6 +50,11 @@ func main() {
 		Names: []string{"backend-port", "qr-port", "qp"},
 		Usage: "The port to use for the backend (QR) webserver",
 	}, 443)
+	backendAPIToken := flags.String(argp.FlagBuildArgs{
+		Names: []string{"backend-api-token", "api-token"},
+		Usage: "The bearer token that staff displays use to query the presence API of the backend webserver.\n" +
+			"The API is disabled if no token is given.",
+	}, "")
 	certFileArg := flags.String(argp.FlagBuildArgs{
 		Names: []string{"cert-file", "cert"},
 		Usage: "The cert file to use for the HTTPS servers.",
@@ -73,6 +85,109 @@ func main() {
 		Usage: "Sets the file permission mask for new journal files",
 	}, 0777)
 
+	journalChainKey := flags.String(argp.FlagBuildArgs{
+		Names: []string{"journal-chain-key"},
+		Usage: "The secret used to seal each journal line in a tamper-evident hash chain.\n" +
+			"The chain is disabled if no key is given.",
+	}, "")
+	journalEncryptionKey := flags.String(argp.FlagBuildArgs{
+		Names: []string{"journal-encryption-key"},
+		Usage: "The key to encrypt the journal records with, 32 bytes raw or base64 encoded.\n" +
+			"The journals are not encrypted if no key is given.",
+	}, "")
+	journalEncryptionKeyFile := flags.String(argp.FlagBuildArgs{
+		Names: []string{"journal-encryption-key-file"},
+		Usage: "A file containing the key to encrypt the journal records with, overrides --journal-encryption-key",
+	}, "")
+	journalUserIDKey := flags.String(argp.FlagBuildArgs{
+		Names: []string{"journal-user-id-key"},
+		Usage: "The key to derive the pseudonymous user IDs in the journals with, 32 bytes raw or base64 encoded.\n" +
+			"The current journal is migrated to the current format and key on startup.",
+	}, "")
+	journalUserIDKeyFileDefaultText := defaultUserIDKeyFile + ", created with a random key if missing"
+	journalUserIDKeyFile := flags.String(argp.FlagBuildArgs{
+		Names:       []string{"journal-user-id-key-file"},
+		Usage:       "A file containing the key to derive the user IDs with, overrides --journal-user-id-key",
+		DefaultText: &journalUserIDKeyFileDefaultText,
+	}, "")
+	journalCompress := flags.Bool(argp.FlagBuildArgs{
+		Names: []string{"journal-compress", "compress"},
+		Usage: "Whether journal files are compressed (gzip) after their rotation",
+	}, false)
+	journalRotationArg := flags.String(argp.FlagBuildArgs{
+		Names: []string{"journal-rotation", "rotation"},
+		Usage: "How often a new journal file is started: \"hourly\", \"daily\" or \"weekly\"",
+	}, string(journal.DAILY))
+	journalMaxSize := flags.Int(argp.FlagBuildArgs{
+		Names: []string{"journal-max-size"},
+		Usage: "The size in bytes after which another journal file of the same period is started, 0 for no limit",
+	}, 0)
+	journalSyncArg := flags.String(argp.FlagBuildArgs{
+		Names: []string{"journal-sync"},
+		Usage: "When journal lines are flushed to the disk: \"none\" leaves it to the system,\n" +
+			"\"event\" flushes every line and \"batch\" flushes in the --journal-sync-interval",
+	}, string(journal.SYNCNONE))
+	journalSyncInterval := flags.String(argp.FlagBuildArgs{
+		Names: []string{"journal-sync-interval"},
+		Usage: "The interval (e.g. \"1s\") to flush the journal in, if --journal-sync is \"batch\"",
+	}, "1s")
+	retentionDays := flags.Int(argp.FlagBuildArgs{
+		Names: []string{"retention-days"},
+		Usage: "The number of days after which old journals are purged or anonymised, 0 keeps them forever",
+	}, 0)
+	retentionModeArg := flags.String(argp.FlagBuildArgs{
+		Names: []string{"retention-mode"},
+		Usage: "What happens to journals after the retention period, either \"purge\" or \"anonymise\"",
+	}, string(journal.PURGE))
+	retentionAuditFileDefaultText := "<journals-directory>/" + journal.DefaultAuditFileName
+	retentionAuditFile := flags.String(argp.FlagBuildArgs{
+		Names:       []string{"retention-audit-file"},
+		Usage:       "The file that every purged or anonymised journal is recorded in",
+		DefaultText: &retentionAuditFileDefaultText,
+	}, "")
+	maxStayArg := flags.String(argp.FlagBuildArgs{
+		Names: []string{"max-stay"},
+		Usage: "The maximum stay (e.g. \"8h\") after which users get checked out automatically.\n" +
+			"Applies to all locations without their own max-stay attribute, empty for no limit.",
+	}, "")
+	webhookURLs := flags.String(argp.FlagBuildArgs{
+		Names: []string{"webhook-urls", "webhooks"},
+		Usage: "Comma separated HTTP(S) URLs that every check-in and check-out is POSTed to, empty for no webhooks",
+	}, "")
+	webhookSecret := flags.String(argp.FlagBuildArgs{
+		Names: []string{"webhook-secret"},
+		Usage: "The secret to sign the webhooks and derive their pseudonymous user IDs with,\n" +
+			"32 bytes raw or base64 encoded. Required for webhooks.",
+	}, "")
+	webhookSecretFile := flags.String(argp.FlagBuildArgs{
+		Names: []string{"webhook-secret-file"},
+		Usage: "A file containing the webhook secret, overrides --webhook-secret",
+	}, "")
+	webhookQueueDirectory := flags.String(argp.FlagBuildArgs{
+		Names: []string{"webhook-queue-directory"},
+		Usage: "The directory that keeps the pending webhooks, so that they are delivered after restarts",
+	}, "webhooks")
+	webhookMaxAttempts := flags.Int(argp.FlagBuildArgs{
+		Names: []string{"webhook-max-attempts"},
+		Usage: "The number of attempts after which a webhook is given up, 0 retries forever",
+	}, 10)
+	replicaURL := flags.String(argp.FlagBuildArgs{
+		Names: []string{"replica-url", "replica"},
+		Usage: "The HTTPS URL of a follower in --replica-receive mode that every journal line is shipped to",
+	}, "")
+	replicaCAFile := flags.String(argp.FlagBuildArgs{
+		Names: []string{"replica-ca-file"},
+		Usage: "A PEM file with additional certificates to trust for the follower, e.g. a self-signed one",
+	}, "")
+	replicaReceive := flags.Bool(argp.FlagBuildArgs{
+		Names: []string{"replica-receive"},
+		Usage: "Run as follower that only receives the journals of a primary server on the --backend-port",
+	}, false)
+	replicationToken := flags.String(argp.FlagBuildArgs{
+		Names: []string{"replication-token"},
+		Usage: "The secret token that authenticates the primary server at the follower, required for replication",
+	}, "")
+
 	err := flags.ParseFlags(os.Args[1:])
 	if err != nil {
 		os.Exit(1)
@@ -94,6 +209,7 @@ func main() {
 		*cookieSecretArg = randomString(32)
 	}
 	cookieSecret = *cookieSecretArg
+	apiToken = *backendAPIToken
 	certFile = *certFileArg
 	keyFile = *certKeyFileArg
 
@@ -106,12 +222,136 @@ func main() {
 	}
 	token.EncryptionKey = *tokenEncryptionKey
 
-	dataJournal, err = journal.NewWriter(*journalDirectory)
-	go dataJournal.TrackJournalRotation()
+	maxStay := time.Duration(0)
+	if *maxStayArg != "" {
+		maxStay, err = time.ParseDuration(*maxStayArg)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Invalid maximum stay: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	rotationPeriod, err := journal.ParseRotationPeriod(*journalRotationArg)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Invalid journal rotation: %v", err)
+		os.Exit(1)
+	}
+	if *journalMaxSize < 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "Invalid journal max size: %d", *journalMaxSize)
+		os.Exit(1)
+	}
+
+	syncMode, err := journal.ParseSyncMode(*journalSyncArg)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Invalid journal sync mode: %v", err)
+		os.Exit(1)
+	}
+	syncInterval, err := time.ParseDuration(*journalSyncInterval)
+	if err != nil || syncInterval <= 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "Invalid journal sync interval: %v", *journalSyncInterval)
+		os.Exit(1)
+	}
+
+	retentionMode, err := journal.ParseRetentionMode(*retentionModeArg)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Invalid retention mode: %v", err)
+		os.Exit(1)
+	}
+
+	encryptionKey, err := util.LoadKey(*journalEncryptionKey, *journalEncryptionKeyFile, journal.EncryptionKeySize)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Invalid journal encryption key: %v", err)
+		os.Exit(1)
+	}
+	var userIDKey []byte
+	if *journalUserIDKey == "" && *journalUserIDKeyFile == "" { // the IDs must stay the same across restarts
+		userIDKey, err = journal.LoadOrCreateUserIDKey(defaultUserIDKeyFile)
+	} else if userIDKey, err = util.LoadKey(*journalUserIDKey, *journalUserIDKeyFile, journal.UserIDKeySize); err == nil && userIDKey == nil {
+		err = fmt.Errorf("the key file \"%s\" is empty", *journalUserIDKeyFile)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Invalid journal user ID key: %v", err)
+		os.Exit(1)
+	}
+
+	retentionPolicy := journal.RetentionPolicy{
+		Days:      *retentionDays,
+		Mode:      retentionMode,
+		AuditFile: *retentionAuditFile,
+	}
+	if *replicaReceive {
+		journal.FileCreationPermissions = *journalFilePermissions
+		retentionPolicy.ChainKey = []byte(*journalChainKey)
+		retentionPolicy.EncryptionKey = encryptionKey
+		go TrackReplicaRetention(*journalDirectory, retentionPolicy)
+		if err := RunReplicaWebserver(*backendPort, *journalDirectory, *replicationToken); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Couldn't run the replica: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *replicaURL != "" && *replicationToken == "" {
+		_, _ = fmt.Fprintf(os.Stderr, "A replication token is required for the replica")
+		os.Exit(1)
+	}
+	replicaClient, err := newReplicaClient(*replicaCAFile)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v", err)
+		os.Exit(1)
+	}
+
+	webhookTargets := make([]string, 0, 5)
+	for _, webhookURL := range strings.Split(*webhookURLs, ",") {
+		if webhookURL = strings.TrimSpace(webhookURL); webhookURL != "" {
+			webhookTargets = append(webhookTargets, webhookURL)
+		}
+	}
+	webhookSecretKey, err := util.LoadKey(*webhookSecret, *webhookSecretFile, webhook.SecretSize)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Invalid webhook secret: %v", err)
+		os.Exit(1)
+	}
+
+	journalWriter, err := journal.NewWriterWithConfig(*journalDirectory, journal.WriterConfig{
+		ChainKey:         []byte(*journalChainKey),
+		EncryptionKey:    encryptionKey,
+		UserIDKey:        userIDKey,
+		CompressJournals: *journalCompress,
+		Sync:             syncMode,
+		Retention:        retentionPolicy,
+		Rotation: journal.RotationPolicy{
+			Period:  rotationPeriod,
+			MaxSize: int64(*journalMaxSize),
+		},
+		Replica: journal.ReplicaConfig{
+			URL:    *replicaURL,
+			Token:  *replicationToken,
+			Client: replicaClient,
+		},
+	})
+	go journalWriter.TrackJournalRotation()
 	if err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "Couldn't create journal: %v", err)
 		os.Exit(1)
 	}
+	go journalWriter.TrackJournalSync(syncInterval)
+	go journalWriter.TrackReplication()
+	go journalWriter.TrackAutoCheckout(maxStay, time.Minute)
+	if len(webhookTargets) > 0 {
+		dispatcher, err := webhook.NewDispatcher(webhook.Config{
+			Targets:        webhookTargets,
+			Secret:         webhookSecretKey,
+			QueueDirectory: *webhookQueueDirectory,
+			MaxAttempts:    *webhookMaxAttempts,
+		})
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Couldn't set up webhooks: %v", err)
+			os.Exit(1)
+		}
+		journalWriter.AddListener(dispatcher.Listener())
+		go dispatcher.Run(context.Background())
+	}
+	dataJournal = journalWriter
 	journal.FileCreationPermissions = *journalFilePermissions
 
 	err = RunWebservers(*frontendPort, *backendPort)
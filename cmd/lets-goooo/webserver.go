@@ -20,7 +20,7 @@ import (
 //setting default values for global variables
 //values get overwritten in main class by flags
 var logIOUrl = "https://localhost:4443/"
-var dataJournal = (*journal.Writer)(nil)
+var dataJournal = (journal.Store)(nil)
 var cookieSecret = ""
 var certFile = "certification/cert.pem"
 var keyFile = "certification/key.pem"
@@ -35,11 +35,13 @@ func RunWebservers(portLogin uint, portQr uint) error {
 	wait := new(sync.WaitGroup)
 	wait.Add(2)
 
-	//creating webserver for QrCode
+	//creating webserver for QrCode and the presence API
 	handlerQR := map[string]http.HandlerFunc{
-		"/":       homeHandler,
-		"/qr":     qrHandler,
-		"/qr.png": qrPngHandler,
+		"/":              homeHandler,
+		"/qr":            qrHandler,
+		"/qr.png":        qrPngHandler,
+		"/api/presence":  presenceHandler,
+		"/api/occupancy": occupancyHandler,
 	}
 	server, destroy := CreateWebserver(portQr, handlerQR)
 
@@ -5,11 +5,13 @@
 package main
 
 import (
+	"errors"
 	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
 	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/token"
 	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
 	"log"
 	"net/http"
+	"strings"
 )
 
 // cookieHandler decides where to redirect
@@ -33,7 +35,7 @@ func cookieHandler(w http.ResponseWriter, r *http.Request) {
 		redirectIO(w, "login.html", (*journal.User)(nil), r.URL.Query().Get("token"))
 		return
 	}
-	location, err := dataJournal.GetCurrentUserLocation(util.Base64Encode(userdata.Hash()))
+	location, err := dataJournal.GetCurrentUserLocation(dataJournal.UserID(&userdata))
 	if err != nil || location == nil {
 		// in no location -> login
 		redirectIO(w, "login.html", &userdata, r.URL.Query().Get("token"))
@@ -81,12 +83,19 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		writeError(w, 400, "invalid form")
 		return
 	}
-	user := r.Form.Get("name")
-	address := r.Form.Get("address")
-
 	userdata := journal.User{
-		Name:    user,
-		Address: address,
+		Name:       strings.TrimSpace(r.Form.Get("name")),
+		Address:    strings.TrimSpace(r.Form.Get("address")), // free text addresses of older login forms
+		Phone:      strings.TrimSpace(r.Form.Get("phone")),
+		Email:      strings.TrimSpace(r.Form.Get("email")),
+		Street:     strings.TrimSpace(r.Form.Get("street")),
+		PostalCode: strings.TrimSpace(r.Form.Get("postalcode")),
+		City:       strings.TrimSpace(r.Form.Get("city")),
+	}
+	if err := userdata.Validate(); err != nil {
+		log.Printf("invalid user data: %v\n", err)
+		writeError(w, 400, err.Error())
+		return
 	}
 
 	data := util.Base64Encode(([]byte)(userdata.ToJournalLine()))
@@ -104,16 +113,14 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		http.SetCookie(w, userdataCookie)
 	}
 
-	location, _ := dataJournal.GetCurrentUserLocation(util.Base64Encode(userdata.Hash()))
-	if location != (*journal.Location)(nil) {
+	//create entry in journal, unless the user is already logged in somewhere
+	err = dataJournal.LoginIfNotPresent(&userdata, tokenLocation)
+	if errors.Is(err, journal.ErrAlreadyPresent) {
 		//no Location to be logged in
 		log.Printf("user is already elsewhere: %v\n", err)
 		writeError(w, 400, "already logged in")
 		return
 	}
-
-	//create entry in journal
-	err = dataJournal.WriteEventUser(&userdata, tokenLocation, journal.LOGIN)
 	if err != nil {
 		log.Printf("couldn't write into journal: %v\n", err)
 		writeError(w, 500, "failed to log in")
@@ -153,7 +160,7 @@ func logoutHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	//check if user is at a location
-	location, err := dataJournal.GetCurrentUserLocation(util.Base64Encode(userdata.Hash()))
+	location, err := dataJournal.GetCurrentUserLocation(dataJournal.UserID(&userdata))
 	if err != nil {
 		log.Printf("user is at no location: %v\n", err)
 		writeError(w, 400, "you're not logged in anywhere")
@@ -167,8 +174,13 @@ func logoutHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	//log out user
-	err = dataJournal.WriteEventUser(&userdata, location, journal.LOGOUT)
+	//log out user, unless a concurrent request already did
+	err = dataJournal.LogoutIfPresent(&userdata, location)
+	if errors.Is(err, journal.ErrNotPresent) {
+		log.Printf("user is not at the location anymore: %v\n", err)
+		writeError(w, 400, "you're not logged in anywhere")
+		return
+	}
 	if err != nil {
 		log.Printf("couldn't write into journal: %v\n", err)
 		writeError(w, 500, "failed to log out")
@@ -0,0 +1,134 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// apiToken is the bearer token that authenticates the requests to the presence endpoints,
+// the endpoints are disabled if it's empty
+var apiToken = ""
+
+// presentUserResponse is the JSON representation of a user that is currently checked in
+type presentUserResponse struct {
+	Name     string    `json:"name"`
+	Location string    `json:"location"`
+	Since    time.Time `json:"since"`
+}
+
+// presenceResponse is the JSON response of the presenceHandler
+type presenceResponse struct {
+	Location string                `json:"location,omitempty"`
+	Count    int                   `json:"count"`
+	Users    []presentUserResponse `json:"users"`
+}
+
+// locationOccupancyResponse is the JSON representation of the number of users at a location
+type locationOccupancyResponse struct {
+	Code  string `json:"code"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// occupancyResponse is the JSON response of the occupancyHandler
+type occupancyResponse struct {
+	Total     int                         `json:"total"`
+	Locations []locationOccupancyResponse `json:"locations"`
+}
+
+// presenceHandler lists the users that are currently checked in, e.g. for evacuation roll-calls.
+// The users can be limited to a location with the location code in the "location" parameter.
+func presenceHandler(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAPIRequest(w, r) {
+		return
+	}
+	var location *journal.Location
+	code := strings.ToUpper(r.URL.Query().Get("location"))
+	if code != "" {
+		var exists bool
+		if location, exists = journal.Locations[code]; !exists {
+			writeJSONError(w, http.StatusBadRequest, "unknown location")
+			return
+		}
+	}
+
+	present := dataJournal.PresentUsers(location)
+	response := presenceResponse{Location: code, Count: len(present), Users: make([]presentUserResponse, len(present))}
+	for i, user := range present {
+		response.Users[i] = presentUserResponse{Location: user.Location.Code, Since: user.Since.UTC()}
+		if user.User != nil {
+			response.Users[i].Name = user.User.Name
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// occupancyHandler counts the users that are currently checked in per location, e.g. for staff displays.
+// All known locations are listed, ordered by their code.
+func occupancyHandler(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAPIRequest(w, r) {
+		return
+	}
+	occupancy := dataJournal.Occupancy()
+	response := occupancyResponse{Locations: make([]locationOccupancyResponse, 0, len(journal.Locations))}
+	for _, location := range journal.Locations {
+		response.Locations = append(response.Locations, locationOccupancyResponse{
+			Code:  location.Code,
+			Name:  location.Name,
+			Count: occupancy[location],
+		})
+		response.Total += occupancy[location]
+	}
+	sort.Slice(response.Locations, func(i, j int) bool {
+		return response.Locations[i].Code < response.Locations[j].Code
+	})
+	writeJSON(w, http.StatusOK, response)
+}
+
+// authorizeAPIRequest checks that the request is a GET request with the bearer token of the API.
+// Otherwise, it writes the error response and returns false.
+func authorizeAPIRequest(w http.ResponseWriter, r *http.Request) bool {
+	if apiToken == "" {
+		writeJSONError(w, http.StatusNotFound, "the presence API is disabled")
+		return false
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSONError(w, http.StatusMethodNotAllowed, "only GET requests are allowed")
+		return false
+	}
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(given), []byte(apiToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeJSONError(w, http.StatusUnauthorized, "invalid or missing API token")
+		return false
+	}
+	return true
+}
+
+// writeJSON writes the data as JSON response with the given status code
+func writeJSON(w http.ResponseWriter, code int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store") // the presence changes all the time and is personal data
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("failed to write JSON response: %v\n", err)
+	}
+}
+
+// writeJSONError writes an error message as JSON response with the given status code
+func writeJSONError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, struct {
+		Error string `json:"error"`
+	}{message})
+}
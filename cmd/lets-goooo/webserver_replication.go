@@ -0,0 +1,71 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// RunReplicaWebserver receives the journals of a primary server into the directory at the given port,
+// see journal.Writer.TrackReplication. Only requests with the token are accepted.
+func RunReplicaWebserver(port uint, directory string, token string) error {
+	handler, err := journal.NewReplicaHandler(directory, token)
+	if err != nil {
+		return err
+	}
+	server, destroy := CreateWebserver(port, map[string]http.HandlerFunc{
+		"/" + journal.ReplicationPath: handler.ServeHTTP,
+	})
+	defer destroy()
+	return RunWebserver(server)
+}
+
+// TrackReplicaRetention applies the retention policy to the replicated journals every hour,
+// so that the replica doesn't keep the data longer than the primary.
+// This method should be run as its own routine:
+func TrackReplicaRetention(directory string, policy journal.RetentionPolicy) {
+	if policy.Days <= 0 {
+		return
+	}
+	for {
+		records, err := journal.ApplyRetention(directory, policy, time.Now())
+		for _, record := range records {
+			log.Printf("Applied journal retention: %s", record.String())
+		}
+		if err != nil {
+			log.Printf("failed to apply journal retention: %#v", err)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// newReplicaClient creates the HTTP client for replicating the journals to a follower.
+// The certificates in the PEM file are trusted in addition to the system's, e.g. for self-signed certificates.
+func newReplicaClient(caFile string) (*http.Client, error) {
+	client := http.Client{Timeout: 30 * time.Second}
+	if caFile == "" {
+		return &client, nil
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read replica certificate file \"%s\": %w", caFile, err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in replica certificate file \"%s\"", caFile)
+	}
+	client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	return &client, nil
+}
@@ -7,13 +7,17 @@ package main
 import (
 	"bytes"
 	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"io/ioutil"
 	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
 	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/token"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"strings"
@@ -175,6 +179,10 @@ func TestHandlers(t *testing.T) {
 	toke, err := token.CreateToken("MOS")
 	assert.NoError(t, err)
 	validToken.Set("token", toke)
+	noUserdata := url.Values{}
+	noUserdata.Set("token", toke)
+	validToken.Set("name", "Tester")
+	validToken.Set("address", "Teststadt")
 
 	invalLocat := url.Values{}
 	invalLocat.Set("location", "this location does not exist")
@@ -193,6 +201,7 @@ func TestHandlers(t *testing.T) {
 	//loginHandler
 	assert.HTTPStatusCode(t, loginHandler, "GET", "https://localhost", nil, 400)        //no token -> 400
 	assert.HTTPStatusCode(t, loginHandler, "GET", "https://localhost", invalToken, 400) //wrong token -> 400
+	assert.HTTPStatusCode(t, loginHandler, "GET", "https://localhost", noUserdata, 400) //no user data -> 400
 	assert.HTTPStatusCode(t, loginHandler, "GET", "https://localhost", validToken, 302) //correct token + not logged in -> log in + redirect to home
 	assert.HTTPStatusCode(t, loginHandler, "GET", "https://localhost", validToken, 400) //correct token + already logged in -> already at location -> cant log in -> 400
 
@@ -214,6 +223,230 @@ func TestHandlers(t *testing.T) {
 	token.EncryptionKey = "thisis32bitlongpassphraseimusing"
 }
 
+func TestHandlers_memoryStore(t *testing.T) {
+	cookieSecret = "thisis32bitlongpassphrasetooyay"
+	token.ValidTime = 120
+	token.EncryptionKey = "thisis32bitlongpassphraseimusing"
+	journal.Locations = map[string]*journal.Location{
+		"MOS": {Name: "Mosbach", Code: "MOS"},
+	}
+	store := journal.NewMemoryStore()
+	dataJournal = store
+	defer func() { dataJournal = nil }()
+
+	validToken := url.Values{}
+	toke, err := token.CreateToken("MOS")
+	assert.NoError(t, err)
+	validToken.Set("token", toke)
+	validToken.Set("name", "Tester")
+	validToken.Set("address", "Teststadt")
+
+	assert.HTTPStatusCode(t, loginHandler, "GET", "https://localhost", validToken, 302) //not logged in -> log in + redirect to home
+	assert.HTTPStatusCode(t, loginHandler, "GET", "https://localhost", validToken, 400) //already logged in -> 400
+
+	events, err := store.ReadEvents(time.Time{}, time.Time{})
+	if assert.NoError(t, err) && assert.Len(t, events, 1) {
+		assert.Equal(t, journal.LOGIN, events[0].EventType)
+		assert.Equal(t, journal.User{Name: "Tester", Address: "Teststadt"}, *events[0].User)
+		assert.Equal(t, journal.Locations["MOS"], events[0].Location)
+	}
+}
+
+func TestLoginHandler_contactDetails(t *testing.T) {
+	cookieSecret = "thisis32bitlongpassphrasetooyay"
+	token.ValidTime = 120
+	token.EncryptionKey = "thisis32bitlongpassphraseimusing"
+	journal.Locations = map[string]*journal.Location{"MOS": {Name: "Mosbach", Code: "MOS"}}
+	store := journal.NewMemoryStore()
+	dataJournal = store
+	defer func() { dataJournal = nil }()
+
+	toke, err := token.CreateToken("MOS")
+	require.NoError(t, err)
+	form := url.Values{}
+	form.Set("name", " Erika ")
+	form.Set("street", "Beispielweg 1")
+	form.Set("postalcode", "74821")
+	form.Set("city", "Mosbach")
+	form.Set("phone", "+49 6261 12345")
+	form.Set("email", "erika@example.org")
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("POST", "https://localhost/login?token="+url.QueryEscape(toke), strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	loginHandler(recorder, request)
+	require.Equal(t, 302, recorder.Code)
+
+	expected := journal.User{
+		Name: "Erika", Street: "Beispielweg 1", PostalCode: "74821", City: "Mosbach", Phone: "+49 6261 12345", Email: "erika@example.org",
+	}
+	events, err := store.ReadEvents(time.Time{}, time.Time{})
+	if assert.NoError(t, err) && assert.Len(t, events, 1) {
+		assert.Equal(t, expected, *events[0].User)
+	}
+	cookies := recorder.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		user, err := Validate(cookies[0].Value)
+		if assert.NoError(t, err, "the cookie should hold the contact details") {
+			assert.Equal(t, expected, user)
+		}
+	}
+}
+
+func TestLoginHandler_concurrent(t *testing.T) {
+	cookieSecret = "thisis32bitlongpassphrasetooyay"
+	token.ValidTime = 120
+	token.EncryptionKey = "thisis32bitlongpassphraseimusing"
+	journal.Locations = map[string]*journal.Location{
+		"MOS": {Name: "Mosbach", Code: "MOS"},
+	}
+	writer, err := journal.NewWriter(t.TempDir())
+	assert.NoError(t, err)
+	dataJournal = writer
+	defer func() {
+		assert.NoError(t, writer.Close())
+		dataJournal = nil
+	}()
+
+	toke, err := token.CreateToken("MOS")
+	assert.NoError(t, err)
+	target := "https://localhost/?token=" + url.QueryEscape(toke) + "&name=Tester&address=Teststadt"
+
+	codes := make(chan int, 20)
+	for i := 0; i < cap(codes); i++ {
+		go func() {
+			recorder := httptest.NewRecorder()
+			loginHandler(recorder, httptest.NewRequest("GET", target, nil))
+			codes <- recorder.Code
+		}()
+	}
+	loggedIn := 0
+	for i := 0; i < cap(codes); i++ {
+		if <-codes == 302 {
+			loggedIn++
+		}
+	}
+	assert.Equal(t, 1, loggedIn, "only one of the simultaneous logins should succeed")
+}
+
+// apiRequest sends a request with the given bearer token to the handler and decodes the JSON response into result.
+func apiRequest(t *testing.T, handler http.HandlerFunc, method string, target string, bearer string, result interface{}) int {
+	request := httptest.NewRequest(method, target, nil)
+	if bearer != "" {
+		request.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	recorder := httptest.NewRecorder()
+	handler(recorder, request)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(result))
+	return recorder.Code
+}
+
+func TestPresenceAPI(t *testing.T) {
+	journal.Locations = map[string]*journal.Location{
+		"MOS": {Name: "Mosbach", Code: "MOS"},
+		"TST": {Name: "Teststadt", Code: "TST"},
+		"HST": {Name: "Hauptstadt", Code: "HST"},
+	}
+	store := journal.NewMemoryStore()
+	dataJournal = store
+	apiToken = "staff-display-token"
+	defer func() {
+		dataJournal = nil
+		apiToken = ""
+	}()
+	require.NoError(t, store.LoginIfNotPresent(&journal.User{Name: "Tester", Address: "Teststadt"}, journal.Locations["MOS"]))
+	require.NoError(t, store.LoginIfNotPresent(&journal.User{Name: "Klaus", Address: "Musterdorf"}, journal.Locations["TST"]))
+	require.NoError(t, store.LoginIfNotPresent(&journal.User{Name: "Erika", Address: "Musterdorf"}, journal.Locations["TST"]))
+
+	presence := presenceResponse{}
+	if assert.Equal(t, 200, apiRequest(t, presenceHandler, "GET", "https://localhost/api/presence", apiToken, &presence)) {
+		assert.Equal(t, 3, presence.Count)
+		if assert.Len(t, presence.Users, 3) {
+			assert.Equal(t, "Tester", presence.Users[0].Name)
+			assert.Equal(t, "MOS", presence.Users[0].Location)
+			assert.False(t, presence.Users[0].Since.IsZero(), "the check-in time should be reported")
+			assert.Equal(t, "TST", presence.Users[2].Location)
+		}
+	}
+	presence = presenceResponse{}
+	if assert.Equal(t, 200, apiRequest(t, presenceHandler, "GET", "https://localhost/api/presence?location=tst", apiToken, &presence)) {
+		assert.Equal(t, "TST", presence.Location)
+		assert.Equal(t, 2, presence.Count)
+		assert.Len(t, presence.Users, 2)
+	}
+	presence = presenceResponse{}
+	if assert.Equal(t, 200, apiRequest(t, presenceHandler, "GET", "https://localhost/api/presence?location=HST", apiToken, &presence)) {
+		assert.Equal(t, 0, presence.Count)
+		assert.NotNil(t, presence.Users, "empty locations should have an empty list of users")
+	}
+
+	occupancy := occupancyResponse{}
+	if assert.Equal(t, 200, apiRequest(t, occupancyHandler, "GET", "https://localhost/api/occupancy", apiToken, &occupancy)) {
+		assert.Equal(t, occupancyResponse{Total: 3, Locations: []locationOccupancyResponse{
+			{Code: "HST", Name: "Hauptstadt", Count: 0},
+			{Code: "MOS", Name: "Mosbach", Count: 1},
+			{Code: "TST", Name: "Teststadt", Count: 2},
+		}}, occupancy)
+	}
+}
+
+func TestPresenceAPI_errors(t *testing.T) {
+	journal.Locations = map[string]*journal.Location{"MOS": {Name: "Mosbach", Code: "MOS"}}
+	dataJournal = journal.NewMemoryStore()
+	defer func() {
+		dataJournal = nil
+		apiToken = ""
+	}()
+	failure := struct {
+		Error string `json:"error"`
+	}{}
+
+	apiToken = ""
+	assert.Equal(t, 404, apiRequest(t, occupancyHandler, "GET", "https://localhost/api/occupancy", "", &failure), "the API should be disabled without token")
+	assert.NotEmpty(t, failure.Error)
+
+	apiToken = "staff-display-token"
+	for _, handler := range []http.HandlerFunc{presenceHandler, occupancyHandler} {
+		assert.Equal(t, 401, apiRequest(t, handler, "GET", "https://localhost/api", "", &failure), "requests without token should be rejected")
+		assert.Equal(t, 401, apiRequest(t, handler, "GET", "https://localhost/api", "wrong-token", &failure))
+		assert.Equal(t, 405, apiRequest(t, handler, "POST", "https://localhost/api", apiToken, &failure))
+	}
+	assert.Equal(t, 400, apiRequest(t, presenceHandler, "GET", "https://localhost/api/presence?location=XXX", apiToken, &failure))
+	assert.Equal(t, "unknown location", failure.Error)
+
+	recorder := httptest.NewRecorder()
+	occupancyHandler(recorder, httptest.NewRequest("GET", "https://localhost/api/occupancy", nil))
+	assert.Equal(t, "Bearer", recorder.Header().Get("WWW-Authenticate"))
+}
+
+func TestNewReplicaClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	caFile := t.TempDir() + "/ca.pem"
+	require.NoError(t, ioutil.WriteFile(caFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+
+	client, err := newReplicaClient(caFile)
+	require.NoError(t, err)
+	response, err := client.Get(server.URL)
+	if assert.NoError(t, err, "the certificate of the file should be trusted") {
+		assert.Equal(t, http.StatusNoContent, response.StatusCode)
+		_ = response.Body.Close()
+	}
+
+	client, err = newReplicaClient("")
+	require.NoError(t, err)
+	_, err = client.Get(server.URL)
+	assert.Error(t, err, "self-signed certificates should not be trusted without the file")
+
+	_, err = newReplicaClient(t.TempDir() + "/missing.pem")
+	assert.Error(t, err)
+	_, err = newReplicaClient("testdata/test.html")
+	assert.Error(t, err, "files without certificates should be rejected")
+}
+
 func TestRunWebservers(t *testing.T) {
 	if os.Getenv("webitesti") == "" {
 		return
@@ -5,6 +5,7 @@ go 1.17
 require (
 	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/stretchr/testify v1.7.0
+	golang.org/x/text v0.13.0
 )
 
 require (
@@ -77,6 +77,12 @@ func (flagSet *FlagSet) ParseFlags(args []string) error {
 			return flagSet.handleError("encountered additional positional argument \"%s\"", arg)
 		}
 
+		// Variadic arguments consume all remaining positional values
+		if flagSet.positional[pos].TakesMultipleValues() {
+			_ = flagSet.positional[pos].Value.FromString(arg) // appending can't fail
+			continue
+		}
+
 		// Try to parse as the next positional argument
 		err := flagSet.positional[pos].Value.FromString(arg)
 		pos++
@@ -89,6 +95,13 @@ func (flagSet *FlagSet) ParseFlags(args []string) error {
 		return flagSet.handleError("trailing value is missing for argument \"%s\"", currentFlag.Name())
 	}
 
+	// Variadic arguments start out empty, so fall back to their defaults if no values were given
+	for _, flag := range flagSet.positional {
+		if values, isStrings := flag.Value.(*stringsValue); isStrings && len(*values) == 0 {
+			*values = append(*values, *flag.Default.(*stringsValue)...)
+		}
+	}
+
 	return nil
 }
 
@@ -197,6 +210,12 @@ func (flag *Flag) TakesValue() bool {
 	return !isBool || bool(*boolDefault)
 }
 
+// TakesMultipleValues returns, whether the flag collects all values that are passed to it
+func (flag *Flag) TakesMultipleValues() bool {
+	_, isStrings := flag.Value.(*stringsValue)
+	return isStrings
+}
+
 // FlagValue can be used in a Flag to parse/serialize values.
 type FlagValue interface {
 	// String brings the value into string representation
@@ -272,6 +291,15 @@ func (flagSet *FlagSet) PositionalString(flagArgs FlagBuildArgs, defaultValue st
 	return (*string)(&value)
 }
 
+// PositionalStrings creates a positional argument that collects all remaining positional values.
+// It must be the last positional argument of the FlagSet.
+func (flagSet *FlagSet) PositionalStrings(flagArgs FlagBuildArgs, defaultValue []string) *[]string {
+	value := stringsValue(nil)
+	_defaultValue := stringsValue(append([]string(nil), defaultValue...))
+	flagSet.addPositional(&Flag{flagArgs, &_defaultValue, &value})
+	return (*[]string)(&value)
+}
+
 // addFlag adds a new flag to the FlagSet.
 func (flagSet *FlagSet) addFlag(flag *Flag) {
 	if flag.DefaultText == nil {
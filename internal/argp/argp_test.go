@@ -112,6 +112,33 @@ func TestFlagSet_ParseFlags(t *testing.T) {
 	assert.EqualError(t, fs.ParseFlags([]string{"--alpha"}), "trailing value is missing for argument \"alpha\"")
 }
 
+func TestFlagSet_ParseFlags_variadic(t *testing.T) {
+	fs := CreateFlagSet()
+	first := fs.PositionalString(FlagBuildArgs{
+		Names: []string{"first"},
+	}, "")
+	rest := fs.PositionalStrings(FlagBuildArgs{
+		Names: []string{"rest"},
+	}, []string{"default"})
+	flagAlpha := fs.Int(FlagBuildArgs{
+		Names: []string{"alpha", "a"},
+	}, 123)
+
+	if assert.NoError(t, fs.ParseFlags([]string{"a", "b", "-a", "1", "c"})) {
+		assert.Equal(t, "a", *first)
+		assert.Equal(t, []string{"b", "c"}, *rest)
+		assert.Equal(t, 1, *flagAlpha)
+	}
+
+	fs = CreateFlagSet()
+	rest = fs.PositionalStrings(FlagBuildArgs{
+		Names: []string{"rest"},
+	}, []string{"default"})
+	if assert.NoError(t, fs.ParseFlags([]string{})) {
+		assert.Equal(t, []string{"default"}, *rest)
+	}
+}
+
 //  _____ _             ____       _
 // |  ___| | __ _  __ _/ ___|  ___| |_   _   _ ___  __ _  __ _  ___
 // | |_  | |/ _` |/ _` \___ \ / _ \ __| | | | / __|/ _` |/ _` |/ _ \
@@ -4,7 +4,10 @@
 
 package argp
 
-import "strconv"
+import (
+	"strconv"
+	"strings"
+)
 
 type boolValue bool
 
@@ -61,3 +64,15 @@ func (value *stringValue) FromString(text string) error {
 	*value = stringValue(text)
 	return nil
 }
+
+type stringsValue []string
+
+func (value *stringsValue) String() string {
+	return strings.Join(*value, ", ")
+}
+
+// FromString appends the text to the values, so this type can be used for repeated arguments.
+func (value *stringsValue) FromString(text string) error {
+	*value = append(*value, text)
+	return nil
+}
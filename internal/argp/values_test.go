@@ -141,3 +141,24 @@ func TestStringValue_FromString(t *testing.T) {
 	assert.NoError(t, val.FromString("\"advanced\""))
 	assert.Equal(t, advanced, val)
 }
+
+//      _        _                 __     __    _
+//  ___| |_ _ __(_)_ __   __ _ ___ \ \   / /_ _| |_   _  ___
+// / __| __| '__| | '_ \ / _` / __| \ \ / / _` | | | | |/ _ \
+// \__ \ |_| |  | | | | | (_| \__ \  \ V / (_| | | |_| |  __/
+// |___/\__|_|  |_|_| |_|\__, |___/   \_/ \__,_|_|\__,_|\___|
+//                       |___/
+
+func TestStringsValue_String(t *testing.T) {
+	val := stringsValue{"a", "b"}
+	assert.Equal(t, "a, b", val.String())
+	val = stringsValue{}
+	assert.Equal(t, "", val.String())
+}
+
+func TestStringsValue_FromString(t *testing.T) {
+	val := stringsValue(nil)
+	assert.NoError(t, val.FromString("first"))
+	assert.NoError(t, val.FromString("second"))
+	assert.Equal(t, stringsValue{"first", "second"}, val)
+}
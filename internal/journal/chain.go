@@ -0,0 +1,220 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"os"
+	"strings"
+)
+
+// chainSeparator separates the chain MAC from the content of a journal line.
+const chainSeparator = "\t#"
+
+// chainMACLength is the length of a base64 encoded chain MAC.
+const chainMACLength = 44
+
+// Chain computes the hash chain over the lines of a journal file.
+// Each line is sealed with an HMAC of its content and the MAC of the previous line,
+// so that editing, inserting or removing lines breaks the chain from that line on.
+type Chain struct {
+	// key is the server secret used for the HMACs
+	key []byte
+	// last is the MAC of the last sealed line, or nil at the start of a file
+	last []byte
+}
+
+// ChainError describes the first broken link in a journal's hash chain.
+type ChainError struct {
+	// Line is the 1-based number of the first line that failed the verification
+	Line int
+	// Reason describes why the verification failed
+	Reason string
+}
+
+func (err *ChainError) Error() string {
+	return fmt.Sprintf("broken hash chain in line %d: %s", err.Line, err.Reason)
+}
+
+// NewChain creates a new Chain for the start of a journal file.
+func NewChain(key []byte) *Chain {
+	return &Chain{key: key}
+}
+
+// ResumeChain creates a Chain that continues after the last line of the given journal file.
+// Missing or empty files result in a fresh Chain.
+func ResumeChain(key []byte, filePath string) (*Chain, error) {
+	chain := NewChain(key)
+	last, err := lastChainMAC(filePath)
+	if err != nil {
+		return nil, err
+	}
+	chain.last = last
+	return chain, nil
+}
+
+// lastChainMAC reads the chain MAC of the last line of the given journal file.
+// It returns nil for missing or empty files and an error if the last line is not chained.
+func lastChainMAC(filePath string) ([]byte, error) {
+	file, err := OpenJournalFile(filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open journal to resume hash chain: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	lastLine := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			lastLine = line
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal to resume hash chain: %w", err)
+	}
+	if lastLine == "" {
+		return nil, nil
+	}
+	_, mac, chained := SplitChainedLine(lastLine)
+	if !chained {
+		return nil, fmt.Errorf("can't resume hash chain of journal \"%s\", its last line is not chained", filePath)
+	}
+	return util.Base64Decode(mac)
+}
+
+// keepChainEnd records the chain MAC of the last line of the journal file in the header of the decoded lines,
+// which replace the journal or a copy of it in a new hash chain, see Header.ReplacedMAC.
+// So the link of the next journal file stays intact. Unchained journals and lines without header are kept as they are.
+func keepChainEnd(filePath string, lines []string) ([]string, error) {
+	if len(lines) == 0 || lines[0][0] != headerRecord {
+		return lines, nil
+	}
+	last, err := lastChainMAC(filePath)
+	if err != nil || last == nil { // there's no end that could have been linked
+		return lines, nil
+	}
+	header, err := ParseHeaderLine(lines[0][1:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the header of journal file %s: %w", filePath, err)
+	}
+	if header.ReplacedMAC == "" { // journals rewritten before keep their original end, which the link refers to
+		header.ReplacedMAC = util.Base64Encode(last)
+	}
+	kept := make([]string, len(lines))
+	copy(kept, lines)
+	kept[0] = string(headerRecord) + header.ToJournalLine()
+	return kept, nil
+}
+
+// next computes the MAC for the given line content following the previous line.
+func (chain *Chain) next(content string) []byte {
+	mac := hmac.New(sha256.New, chain.key)
+	mac.Write(chain.last)
+	mac.Write([]byte(content))
+	return mac.Sum(nil)
+}
+
+// Seal appends the chained MAC to the line content and advances the chain.
+func (chain *Chain) Seal(content string) string {
+	chain.last = chain.next(content)
+	return content + chainSeparator + util.Base64Encode(chain.last)
+}
+
+// Verify checks that the line is the correctly sealed successor of the previous line and advances the chain.
+func (chain *Chain) Verify(line string) error {
+	content, mac, chained := SplitChainedLine(line)
+	if !chained {
+		return fmt.Errorf("line is not chained")
+	}
+	expected := chain.next(content)
+	actual, _ := util.Base64Decode(mac)
+	if !hmac.Equal(expected, actual) {
+		return fmt.Errorf("MAC does not match, the line or one before it has been altered")
+	}
+	chain.last = actual
+	return nil
+}
+
+// SplitChainedLine splits the chain MAC from a journal line.
+// If the line is not chained, it is returned as content and chained is false.
+func SplitChainedLine(line string) (content string, mac string, chained bool) {
+	index := len(line) - chainMACLength - len(chainSeparator)
+	if index < 0 || !strings.HasPrefix(line[index:], chainSeparator) {
+		return line, "", false
+	}
+	mac = line[index+len(chainSeparator):]
+	if decoded, err := util.Base64Decode(mac); err != nil || len(decoded) != sha256.Size {
+		return line, "", false
+	}
+	return line[:index], mac, true
+}
+
+// VerifyChain verifies the hash chain of the given journal file.
+// It returns the number of verified lines, and a *ChainError for the first broken link.
+func VerifyChain(key []byte, filePath string) (int, error) {
+	file, err := OpenJournalFile(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = file.Close() }()
+
+	chain := NewChain(key)
+	lineNumber := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineNumber++
+		if err := chain.Verify(scanner.Text()); err != nil {
+			return lineNumber - 1, &ChainError{Line: lineNumber, Reason: err.Error()}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return lineNumber, fmt.Errorf("failed to read journal file %s: %w", filePath, err)
+	}
+	return lineNumber, nil
+}
+
+// VerifyChainLink checks that a journal file continues the hash chain of the previous journal file,
+// i.e. that the link in its header is the chain MAC of the last line of the previous file, see Header.PreviousMAC.
+// Unlike VerifyChain, this detects removed journal files and lines removed from the end of the previous file.
+// Journals that were rewritten, e.g. anonymised by the retention, keep the end they had before in their header,
+// see Header.ReplacedMAC, which the link may refer to as well. Journals without link pass the check. It returns a *ChainError if the link is broken,
+// the encryption key is required for encrypted journals.
+func VerifyChainLink(previousPath string, filePath string, encryptionKey []byte) error {
+	var cipher *Cipher
+	if len(encryptionKey) > 0 {
+		var err error
+		if cipher, err = NewCipher(encryptionKey); err != nil {
+			return fmt.Errorf("failed to set up journal decryption: %w", err)
+		}
+	}
+	header, _, err := readJournalHeader(filePath, cipher)
+	if err != nil {
+		return fmt.Errorf("failed to read the header of journal file %s: %w", filePath, err)
+	}
+	if header.PreviousMAC == "" {
+		return nil
+	}
+	last, err := lastChainMAC(previousPath)
+	if err != nil {
+		return err
+	}
+	if util.Base64Encode(last) == header.PreviousMAC {
+		return nil
+	}
+	previousHeader, _, err := readJournalHeader(previousPath, cipher)
+	if err == nil && previousHeader.ReplacedMAC != "" && previousHeader.ReplacedMAC == header.PreviousMAC {
+		return nil // the previous journal was rewritten after the link was written
+	}
+	return &ChainError{Line: 1, Reason: fmt.Sprintf("the journal doesn't continue the hash chain of %s, "+
+		"its end has been altered or a journal between them is missing", previousPath)}
+}
@@ -0,0 +1,210 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChain_SealVerify(t *testing.T) {
+	lines := []string{"*Tester\tTeststadt", "+HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1634700000", "*\t#not a mac"}
+	sealer := NewChain([]byte("secret"))
+	sealed := make([]string, len(lines))
+	for i, line := range lines {
+		sealed[i] = sealer.Seal(line)
+		content, _, chained := SplitChainedLine(sealed[i])
+		if assert.True(t, chained, "sealed lines should be chained") {
+			assert.Equal(t, line, content, "the content of sealed lines should be retained")
+		}
+	}
+
+	verifier := NewChain([]byte("secret"))
+	for _, line := range sealed {
+		assert.NoError(t, verifier.Verify(line))
+	}
+
+	assert.Error(t, NewChain([]byte("wrong")).Verify(sealed[0]), "verification with a wrong key should fail")
+	assert.Error(t, NewChain([]byte("secret")).Verify(sealed[1]), "verification of reordered lines should fail")
+	assert.Error(t, NewChain([]byte("secret")).Verify(lines[0]), "verification of unchained lines should fail")
+	tampered := strings.Replace(sealed[0], "Tester", "Faker", 1)
+	assert.Error(t, NewChain([]byte("secret")).Verify(tampered), "verification of altered lines should fail")
+}
+
+func TestSplitChainedLine(t *testing.T) {
+	for _, line := range []string{"", "*Tester\tTeststadt", "*Tester\t#Teststadt", "*Tester\t#" + strings.Repeat("A", 42) + "=="} {
+		content, mac, chained := SplitChainedLine(line)
+		assert.False(t, chained, "\"%s\" should not be detected as chained", line)
+		assert.Equal(t, line, content)
+		assert.Equal(t, "", mac)
+	}
+
+	mac := strings.Repeat("A", 43) + "="
+	content, splitMAC, chained := SplitChainedLine("-hash\tTST\t0\t#" + mac)
+	if assert.True(t, chained) {
+		assert.Equal(t, "-hash\tTST\t0", content)
+		assert.Equal(t, mac, splitMAC)
+	}
+}
+
+func TestVerifyChain(t *testing.T) {
+	tempDir := t.TempDir()
+	chain := NewChain([]byte("secret"))
+	lines := []string{
+		chain.Seal("*Tester\tTeststadt"),
+		chain.Seal("+HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1634700000"),
+		chain.Seal("-HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1634701000"),
+	}
+	filePath := path.Join(tempDir, "journal.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte(strings.Join(lines, "\n")+"\n"), 0777))
+
+	count, err := VerifyChain([]byte("secret"), filePath)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, count)
+	}
+
+	removed := path.Join(tempDir, "removed.txt")
+	require.NoError(t, os.WriteFile(removed, []byte(lines[0]+"\n"+lines[2]+"\n"), 0777))
+	count, err = VerifyChain([]byte("secret"), removed)
+	chainErr := (*ChainError)(nil)
+	if assert.True(t, errors.As(err, &chainErr), "removed lines should break the chain") {
+		assert.Equal(t, 2, chainErr.Line)
+		assert.Equal(t, 1, count)
+	}
+
+	_, err = VerifyChain([]byte("secret"), path.Join(tempDir, "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestResumeChain(t *testing.T) {
+	tempDir := t.TempDir()
+	chain, err := ResumeChain([]byte("secret"), path.Join(tempDir, "missing.txt"))
+	if assert.NoError(t, err, "resuming the chain of a missing file should start a new chain") {
+		assert.Nil(t, chain.last)
+	}
+
+	original := NewChain([]byte("secret"))
+	filePath := path.Join(tempDir, "journal.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte(original.Seal("*Tester\tTeststadt")+"\n"), 0777))
+	chain, err = ResumeChain([]byte("secret"), filePath)
+	if assert.NoError(t, err) {
+		assert.Equal(t, original.last, chain.last, "the resumed chain should continue after the last line")
+	}
+
+	require.NoError(t, os.WriteFile(filePath, []byte("*Tester\tTeststadt\n"), 0777))
+	_, err = ResumeChain([]byte("secret"), filePath)
+	assert.Error(t, err, "unchained journals can't be resumed")
+}
+
+func TestWriter_chained(t *testing.T) {
+	tempDir := t.TempDir()
+	config := WriterConfig{ChainKey: []byte("secret")}
+	location := &Location{Name: "Teststadt", Code: "TST"}
+	user := User{Name: "Tester", Address: "Teststadt"}
+
+	writer, err := NewWriterWithConfig(tempDir, config)
+	require.NoError(t, err, "failed to create chained writer")
+	require.NoError(t, writer.WriteEventUser(&user, location, LOGIN))
+	require.NoError(t, writer.Close())
+
+	Locations = map[string]*Location{"TST": location}
+	writer, err = NewWriterWithConfig(tempDir, config)
+	require.NoError(t, err, "failed to reopen chained journal")
+	loc, err := writer.GetCurrentUserLocation(util.Base64Encode(user.Hash()))
+	if assert.NoError(t, err, "the chained journal should be loaded") {
+		assert.Equal(t, location, loc)
+	}
+	require.NoError(t, writer.WriteEventUser(&user, location, LOGOUT))
+	require.NoError(t, writer.Close())
+
+	count, err := VerifyChain(config.ChainKey, GetCurrentJournalPath(tempDir))
+	if assert.NoError(t, err, "the chain should continue across writer restarts") {
+		assert.Equal(t, 4, count, "the header, user and event lines should be chained")
+	}
+}
+
+func TestVerifyChainLink(t *testing.T) {
+	tempDir := t.TempDir()
+	location := &Location{Name: "Teststadt", Code: "TST"}
+	Locations = map[string]*Location{"TST": location}
+	config := WriterConfig{ChainKey: []byte("secret"), Rotation: RotationPolicy{Period: HOURLY, MaxSize: 300}}
+	writer, err := NewWriterWithConfig(tempDir, config)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		user := User{Name: "Tester", Address: "Teststadt"}
+		require.NoError(t, writer.WriteEventUser(&user, location, LOGIN))
+		require.NoError(t, writer.WriteEventUser(&user, location, LOGOUT))
+	}
+	require.NoError(t, writer.Close())
+
+	files, err := ListJournalFiles(tempDir, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Greater(t, len(files), 2, "the journal should have been rotated by size")
+	header, _, err := readJournalHeader(files[0], nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "", header.PreviousMAC, "the first file has no previous file to link")
+	}
+	for i := 1; i < len(files); i++ {
+		header, _, err := readJournalHeader(files[i], nil)
+		if assert.NoError(t, err) {
+			assert.NotEqual(t, "", header.PreviousMAC, "%s should link the previous file", files[i])
+		}
+		assert.NoError(t, VerifyChainLink(files[i-1], files[i], nil))
+	}
+
+	chainErr := (*ChainError)(nil)
+	err = VerifyChainLink(files[0], files[2], nil)
+	if assert.True(t, errors.As(err, &chainErr), "a missing file between them should break the link") {
+		assert.Equal(t, 1, chainErr.Line)
+	}
+
+	content, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	truncated := strings.Join(lines[:len(lines)-1], "\n") + "\n"
+	require.NoError(t, os.WriteFile(files[0], []byte(truncated), 0777))
+	_, err = VerifyChain(config.ChainKey, files[0])
+	assert.NoError(t, err, "lines removed from the end can't be detected within the file")
+	err = VerifyChainLink(files[0], files[1], nil)
+	assert.True(t, errors.As(err, &chainErr), "lines removed from the end should break the link of the next file")
+}
+
+func TestVerifyChainLink_rewritten(t *testing.T) {
+	tempDir := t.TempDir()
+	location := &Location{Name: "Teststadt", Code: "TST"}
+	Locations = map[string]*Location{"TST": location}
+	config := WriterConfig{ChainKey: []byte("secret"), Rotation: RotationPolicy{Period: HOURLY, MaxSize: 300}}
+	writer, err := NewWriterWithConfig(tempDir, config)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		user := User{Name: "Tester", Address: "Teststadt"}
+		require.NoError(t, writer.WriteEventUser(&user, location, LOGIN))
+		require.NoError(t, writer.WriteEventUser(&user, location, LOGOUT))
+	}
+	require.NoError(t, writer.Close())
+	files, err := ListJournalFiles(tempDir, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Greater(t, len(files), 2, "the journal should have been rotated by size")
+
+	for _, file := range files[:2] { // like the retention, the older journal is anonymised first
+		replaced, err := anonymiseJournal(file, config.ChainKey, nil)
+		require.NoError(t, err)
+		require.Greater(t, replaced, 0)
+	}
+	_, err = MigrateJournal(files[1], WriterConfig{ChainKey: config.ChainKey, UserIDKey: testUserIDKey})
+	require.NoError(t, err, "journals can be rewritten more than once")
+	for i := 1; i < len(files); i++ {
+		_, err := VerifyChain(config.ChainKey, files[i-1])
+		assert.NoError(t, err, "%s should be sealed in a new chain", files[i-1])
+		assert.NoError(t, VerifyChainLink(files[i-1], files[i], nil), "rewritten journals should keep their links")
+	}
+}
@@ -0,0 +1,246 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"time"
+)
+
+// AnomalyKind categorises the anomalies found by CheckJournal.
+type AnomalyKind string
+
+const (
+	// INVALIDLINE marks lines that can't be decoded or parsed.
+	INVALIDLINE AnomalyKind = "invalid line"
+	// UNKNOWNUSER marks events of user hashes without a user line.
+	UNKNOWNUSER AnomalyKind = "unknown user"
+	// UNKNOWNLOCATION marks events at location codes that aren't known.
+	UNKNOWNLOCATION AnomalyKind = "unknown location"
+	// ORPHANEDLOGOUT marks logouts without a login of the user at the same location.
+	ORPHANEDLOGOUT AnomalyKind = "logout without login"
+	// DOUBLELOGIN marks logins of users that are still logged in.
+	DOUBLELOGIN AnomalyKind = "double login"
+	// TIMEREVERSAL marks events that happened before the previous event of the journal.
+	TIMEREVERSAL AnomalyKind = "timestamp going backwards"
+)
+
+// AnomalyKinds lists all kinds of anomalies in the order they should be reported in.
+var AnomalyKinds = []AnomalyKind{INVALIDLINE, UNKNOWNUSER, UNKNOWNLOCATION, ORPHANEDLOGOUT, DOUBLELOGIN, TIMEREVERSAL}
+
+// Anomaly describes a problem in a line of a journal file.
+type Anomaly struct {
+	Kind AnomalyKind
+	// File is the path of the journal file
+	File string
+	// Line is the line number in the journal file, starting at 1
+	Line int
+	// Reason describes the problem
+	Reason string
+}
+
+func (anomaly *Anomaly) String() string {
+	return fmt.Sprintf("%s:%d: %s", anomaly.File, anomaly.Line, anomaly.Reason)
+}
+
+// CheckJournal checks a journal file for anomalies, like logouts without login or unknown location codes.
+// Sessions that are still open at the end of the journal aren't anomalies, see RepairJournal.
+// The encryption key is required for encrypted journals.
+func CheckJournal(filePath string, encryptionKey []byte) ([]Anomaly, error) {
+	check, err := checkJournal(filePath, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return check.anomalies, nil
+}
+
+// RepairJournal writes a corrected copy of a journal file to the output path and returns the corrected anomalies.
+// Invalid lines and events of unknown users or at unknown locations are dropped.
+// Logouts without login get a login and double logins a logout closing the previous session, both flagged REPAIRED.
+// Timestamps going backwards are raised to the timestamp of the previous event.
+// Sessions that are still open at the end of the journal are kept open, as they aren't anomalies:
+// the users are either still present or carried over into the next journal file by the rotation.
+// Closing them would split their sessions at every file boundary.
+// The copy is encrypted if an encryption key is given and sealed in a new hash chain if a chain key is given.
+func RepairJournal(filePath string, outputPath string, chainKey []byte, encryptionKey []byte) ([]Anomaly, error) {
+	check, err := checkJournal(filePath, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	repaired, err := keepChainEnd(filePath, check.repaired)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeJournalLines(outputPath, repaired, chainKey, check.cipher); err != nil {
+		return nil, fmt.Errorf("failed to write repaired journal: %w", err)
+	}
+	return check.anomalies, nil
+}
+
+// journalCheck holds the state of checking a journal file line by line.
+type journalCheck struct {
+	filePath string
+	cipher   *Cipher
+	// header is the header of the journal file, which defines the format of the user lines
+	header Header
+	// users maps the raw user IDs to the users read so far
+	users map[string]*User
+	// ids maps the users to their encoded IDs in the journal
+	ids map[*User]string
+	// sessions maps the logged-in users to their location
+	sessions map[*User]*Location
+	// lastTimestamp is the timestamp of the previous event
+	lastTimestamp int64
+	anomalies     []Anomaly
+	// repaired contains the decoded lines of the corrected journal
+	repaired []string
+	// err stops the check if the journal can't be read at all
+	err error
+}
+
+// checkJournal reads a journal file and checks every line for anomalies.
+func checkJournal(filePath string, encryptionKey []byte) (*journalCheck, error) {
+	check := journalCheck{
+		filePath:  filePath,
+		header:    LegacyHeader,
+		users:     make(map[string]*User, 100),
+		ids:       make(map[*User]string, 100),
+		sessions:  make(map[*User]*Location, 100),
+		anomalies: make([]Anomaly, 0, 10),
+		repaired:  make([]string, 0, 1000),
+	}
+	if len(encryptionKey) > 0 {
+		var err error
+		if check.cipher, err = NewCipher(encryptionKey); err != nil {
+			return nil, fmt.Errorf("failed to set up journal decryption: %w", err)
+		}
+	}
+	file, err := OpenJournalFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		raw := scanner.Text()
+		if check.cipher == nil && IsEncryptedLine(raw) {
+			return nil, fmt.Errorf("the journal \"%s\" is encrypted, but no encryption key was given", filePath)
+		}
+		line, err := DecodeLine(raw, check.cipher)
+		if err != nil {
+			check.addAnomaly(INVALIDLINE, lineNumber, "failed to decode line: %v", err)
+			continue
+		}
+		if line != "" {
+			check.checkLine(lineNumber, line)
+		}
+		if check.err != nil {
+			return nil, fmt.Errorf("failed to check journal file %s: %w", filePath, check.err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal file %s: %w", filePath, err)
+	}
+	return &check, nil
+}
+
+// checkLine checks a decoded journal line and adds its corrected version to the repaired lines.
+func (check *journalCheck) checkLine(lineNumber int, line string) {
+	switch line[0] {
+	case headerRecord:
+		header, err := ParseHeaderLine(line[1:])
+		if errors.Is(err, ErrUnsupportedVersion) {
+			check.err = err
+			return
+		}
+		if err == nil && lineNumber != 1 {
+			err = fmt.Errorf("the header must be the first line")
+		}
+		if err != nil {
+			check.addAnomaly(INVALIDLINE, lineNumber, "%v", err)
+			return
+		}
+		check.header = header
+		check.repaired = append(check.repaired, line)
+
+	case '*':
+		user, id, err := check.header.ParseUserLine(line[1:])
+		if err != nil {
+			check.addAnomaly(INVALIDLINE, lineNumber, "%v", err)
+			return
+		}
+		if _, exists := check.users[string(id)]; !exists { // repeated user lines aren't needed
+			check.users[string(id)] = &user
+			check.ids[&user] = util.Base64Encode(id)
+			check.repaired = append(check.repaired, line)
+		}
+
+	case uint8(LOGIN), uint8(LOGOUT):
+		event, err := ParseEventJournalEntry(EventType(line[0]), line[1:], &check.users)
+		if err != nil {
+			kind := INVALIDLINE
+			if errors.Is(err, ErrUnknownUser) {
+				kind = UNKNOWNUSER
+			} else if errors.Is(err, ErrUnknownLocation) {
+				kind = UNKNOWNLOCATION
+			}
+			check.addAnomaly(kind, lineNumber, "%v", err)
+			return
+		}
+		if event.Timestamp < check.lastTimestamp {
+			check.addAnomaly(TIMEREVERSAL, lineNumber, "%s of %s happened %s before the previous event",
+				event.Name(), event.User.Name, time.Duration(check.lastTimestamp-event.Timestamp)*time.Second)
+			event.Timestamp = check.lastTimestamp
+		}
+		check.lastTimestamp = event.Timestamp
+
+		location, present := check.sessions[event.User]
+		switch event.EventType {
+		case LOGIN:
+			if present {
+				check.addAnomaly(DOUBLELOGIN, lineNumber, "%s logged in at %s while still logged in at %s",
+					event.User.Name, event.Location.Name, location.Name)
+				if location == event.Location { // the session simply continues
+					return
+				}
+				check.addRepairedEvent(LOGOUT, event.User, location, event.Timestamp)
+			}
+			check.sessions[event.User] = event.Location
+		case LOGOUT:
+			if !present || location != event.Location {
+				check.addAnomaly(ORPHANEDLOGOUT, lineNumber, "%s logged out at %s without a login there", event.User.Name, event.Location.Name)
+				if present {
+					check.addRepairedEvent(LOGOUT, event.User, location, event.Timestamp)
+				}
+				check.addRepairedEvent(LOGIN, event.User, event.Location, event.Timestamp)
+			}
+			delete(check.sessions, event.User)
+		}
+		check.repaired = append(check.repaired, formatEventJournalLine(&event, check.ids[event.User]))
+
+	default:
+		check.addAnomaly(INVALIDLINE, lineNumber, "unknown record type '%c'", line[0])
+	}
+}
+
+// addAnomaly records an anomaly of the current journal file.
+func (check *journalCheck) addAnomaly(kind AnomalyKind, lineNumber int, format string, args ...interface{}) {
+	check.anomalies = append(check.anomalies, Anomaly{
+		Kind:   kind,
+		File:   check.filePath,
+		Line:   lineNumber,
+		Reason: fmt.Sprintf(format, args...),
+	})
+}
+
+// addRepairedEvent adds an event to the repaired lines that pairs an orphaned event.
+func (check *journalCheck) addRepairedEvent(eventType EventType, user *User, location *Location, timestamp int64) {
+	check.repaired = append(check.repaired, FormatEventJournalLine(
+		eventType, check.ids[user], location, timestamp, REPAIRED))
+}
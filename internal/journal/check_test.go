@@ -0,0 +1,198 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"path"
+	"strings"
+	"testing"
+)
+
+const checkTestJournal = "*Tester\tTeststadt\n" +
+	"*Klaus\tMusterdorf\n" +
+	"-HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1000\n" +
+	"+HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1100\n" +
+	"+HjLV+aPwKzq3szuae53Zv5n4puw=\tHST\t1200\n" +
+	"+HjLV+aPwKzq3szuae53Zv5n4puw=\tHST\t1300\n" +
+	"+O+Dig24BxOFwjJEN1oBbk/VW/tA=\tXXX\t1400\n" +
+	"+dW5rbm93bg==\tTST\t1400\n" +
+	"+O+Dig24BxOFwjJEN1oBbk/VW/tA=\tTST\t1250\n" +
+	"garbage\n" +
+	"-HjLV+aPwKzq3szuae53Zv5n4puw=\tHST\t1500\n" +
+	"-O+Dig24BxOFwjJEN1oBbk/VW/tA=\tTST\t1600\n"
+
+// setUpCheckTest writes the check test journal and the locations it uses.
+func setUpCheckTest(t *testing.T) string {
+	Locations = map[string]*Location{
+		"TST": {Name: "Teststadt", Code: "TST"},
+		"HST": {Name: "Hauptstadt", Code: "HST"},
+	}
+	filePath := path.Join(t.TempDir(), "20211020.txt")
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(checkTestJournal), 0660))
+	return filePath
+}
+
+func TestCheckJournal(t *testing.T) {
+	filePath := setUpCheckTest(t)
+
+	anomalies, err := CheckJournal(filePath, nil)
+	require.NoError(t, err)
+	kinds := make([]AnomalyKind, len(anomalies))
+	lines := make([]int, len(anomalies))
+	for i, anomaly := range anomalies {
+		kinds[i] = anomaly.Kind
+		lines[i] = anomaly.Line
+		assert.Equal(t, filePath, anomaly.File)
+	}
+	assert.Equal(t, []AnomalyKind{
+		ORPHANEDLOGOUT, DOUBLELOGIN, DOUBLELOGIN, UNKNOWNLOCATION, UNKNOWNUSER, TIMEREVERSAL, INVALIDLINE,
+	}, kinds)
+	assert.Equal(t, []int{3, 5, 6, 7, 8, 9, 10}, lines)
+	assert.Equal(t, "Tester logged out at Teststadt without a login there", anomalies[0].Reason)
+	assert.Equal(t, "Tester logged in at Hauptstadt while still logged in at Teststadt", anomalies[1].Reason)
+	assert.Equal(t, "Login of Klaus happened 50s before the previous event", anomalies[5].Reason)
+	assert.Equal(t, filePath+":10: unknown record type 'g'", anomalies[6].String())
+
+	_, err = CheckJournal(path.Join(t.TempDir(), "missing.txt"), nil)
+	assert.Error(t, err)
+	_, err = CheckJournal(filePath, []byte("short"))
+	assert.Error(t, err, "invalid keys should be rejected")
+}
+
+func TestCheckJournal_automaticLogout(t *testing.T) {
+	Locations = map[string]*Location{"TST": {Name: "Teststadt", Code: "TST", MaxStay: "1h"}}
+	filePath := path.Join(t.TempDir(), "20211020.txt")
+	require.NoError(t, ioutil.WriteFile(filePath, []byte("*Tester\tTeststadt\n*Klaus\tMusterdorf\n"+
+		"+HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1000\n"+
+		"+O+Dig24BxOFwjJEN1oBbk/VW/tA=\tTST\t5000\n"+
+		"-HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t5060\tauto\t4600\n"+
+		"-O+Dig24BxOFwjJEN1oBbk/VW/tA=\tTST\t5100\n"), 0660))
+
+	anomalies, err := CheckJournal(filePath, nil)
+	require.NoError(t, err)
+	assert.Empty(t, anomalies, "automatic logouts are written in order and keep their deadline")
+
+	outputPath := path.Join(t.TempDir(), "repaired.txt")
+	_, err = RepairJournal(filePath, outputPath, nil, nil)
+	require.NoError(t, err)
+	repaired, err := ioutil.ReadFile(outputPath)
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(repaired), "\tTST\t5060\tauto\t4600\n", "the deadline should be kept")
+	}
+}
+
+func TestRepairJournal(t *testing.T) {
+	filePath := setUpCheckTest(t)
+	outputPath := path.Join(t.TempDir(), "repaired.txt")
+
+	anomalies, err := RepairJournal(filePath, outputPath, nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, anomalies, 7)
+	repaired, err := ioutil.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.Equal(t, "*Tester\tTeststadt\n"+
+		"*Klaus\tMusterdorf\n"+
+		"+HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1000\trepaired\n"+
+		"-HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1000\n"+
+		"+HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1100\n"+
+		"-HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1200\trepaired\n"+
+		"+HjLV+aPwKzq3szuae53Zv5n4puw=\tHST\t1200\n"+
+		"+O+Dig24BxOFwjJEN1oBbk/VW/tA=\tTST\t1300\n"+
+		"-HjLV+aPwKzq3szuae53Zv5n4puw=\tHST\t1500\n"+
+		"-O+Dig24BxOFwjJEN1oBbk/VW/tA=\tTST\t1600\n", string(repaired))
+
+	original, err := ioutil.ReadFile(filePath)
+	if assert.NoError(t, err) {
+		assert.Equal(t, checkTestJournal, string(original), "the journal itself should be left untouched")
+	}
+	anomalies, err = CheckJournal(outputPath, nil)
+	if assert.NoError(t, err) {
+		assert.Empty(t, anomalies, "repaired journals should have no anomalies")
+	}
+	journal, err := ReadJournal(outputPath)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Login (repaired)", journal.GetEvents()[0].Name())
+	}
+}
+
+func TestRepairJournal_openSessions(t *testing.T) {
+	Locations = map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}}
+	content := "*Tester\tTeststadt\n*Klaus\tMusterdorf\n" +
+		"+HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1000\n" +
+		"+O+Dig24BxOFwjJEN1oBbk/VW/tA=\tTST\t1100\n" +
+		"-O+Dig24BxOFwjJEN1oBbk/VW/tA=\tTST\t1200\n"
+	filePath := path.Join(t.TempDir(), "20211020.txt")
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(content), 0660))
+	outputPath := path.Join(t.TempDir(), "repaired.txt")
+
+	anomalies, err := RepairJournal(filePath, outputPath, nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, anomalies, "sessions that are open at the end of the journal aren't anomalies")
+	repaired, err := ioutil.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(repaired), "open sessions should be left to the next journal file")
+}
+
+func TestRepairJournal_secured(t *testing.T) {
+	filePath := setUpCheckTest(t)
+	outputPath := path.Join(t.TempDir(), "repaired.txt")
+	chainKey := []byte("secret")
+
+	// encrypt the journal like the writer does
+	cipher, err := NewCipher(testEncryptionKey)
+	require.NoError(t, err)
+	content := ""
+	for _, line := range strings.Split(strings.TrimSpace(checkTestJournal), "\n") {
+		encrypted, err := cipher.Encrypt(line)
+		require.NoError(t, err)
+		content += encrypted + "\n"
+	}
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(content), 0660))
+
+	_, err = RepairJournal(filePath, outputPath, chainKey, nil)
+	assert.Error(t, err, "encrypted journals can't be repaired without the key")
+	assert.NoFileExists(t, outputPath)
+
+	anomalies, err := RepairJournal(filePath, outputPath, chainKey, testEncryptionKey)
+	require.NoError(t, err)
+	assert.Len(t, anomalies, 7)
+	lines, err := VerifyChain(chainKey, outputPath)
+	if assert.NoError(t, err, "repaired journals should be sealed in a new chain") {
+		assert.Equal(t, 10, lines)
+	}
+	anomalies, err = CheckJournal(outputPath, testEncryptionKey)
+	if assert.NoError(t, err, "repaired journals should be encrypted again") {
+		assert.Empty(t, anomalies)
+	}
+}
+
+func TestRepairJournal_keyed(t *testing.T) {
+	filePath := setUpCheckTest(t)
+	outputPath := path.Join(t.TempDir(), "repaired.txt")
+	ids, err := NewUserIDs(testUserIDKey)
+	require.NoError(t, err)
+	header := ids.Header()
+	user := User{Name: "Tester", Address: "Teststadt"}
+	id := util.Base64Encode(ids.ID(&user))
+	require.NoError(t, ioutil.WriteFile(filePath, []byte("@"+header.ToJournalLine()+"\n"+
+		"*"+header.FormatUserLine(&user, ids.ID(&user))+"\n"+
+		"-"+id+"\tTST\t1000\n"), 0660))
+
+	anomalies, err := RepairJournal(filePath, outputPath, nil, nil)
+	require.NoError(t, err)
+	if assert.Len(t, anomalies, 1) {
+		assert.Equal(t, ORPHANEDLOGOUT, anomalies[0].Kind)
+	}
+	repaired, err := ioutil.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.Equal(t, "@"+header.ToJournalLine()+"\n"+
+		"*"+header.FormatUserLine(&user, ids.ID(&user))+"\n"+
+		"+"+id+"\tTST\t1000\trepaired\n"+
+		"-"+id+"\tTST\t1000\n", string(repaired), "the keyed IDs should be kept")
+}
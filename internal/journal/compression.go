@@ -0,0 +1,139 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// compressedFileExtension is appended to the file extension of archived journal files.
+const compressedFileExtension = ".gz"
+
+// IsCompressedJournal checks whether the journal file is compressed, based on its file extension.
+func IsCompressedJournal(filePath string) bool {
+	return strings.HasSuffix(filePath, compressedFileExtension)
+}
+
+// compressedFile closes the decompressing reader as well as the underlying file.
+type compressedFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (file *compressedFile) Close() error {
+	err := file.Reader.Close()
+	if fileErr := file.file.Close(); err == nil {
+		err = fileErr
+	}
+	return err
+}
+
+// OpenJournalFile opens a journal file for reading.
+// Compressed journals are decompressed transparently, the codec is picked by the file extension.
+func OpenJournalFile(filePath string) (io.ReadCloser, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal file %s: %w", filePath, err)
+	}
+	if !IsCompressedJournal(filePath) {
+		return file, nil
+	}
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to decompress journal file %s: %w", filePath, err)
+	}
+	return &compressedFile{Reader: reader, file: file}, nil
+}
+
+// writeJournalFile replaces the content of a journal file, compressing it if the file extension requires it.
+// The content is written to a temporary file first, so that a failure never leaves a partially written journal.
+func writeJournalFile(filePath string, content io.Reader) error {
+	tempFile := filePath + ".tmp"
+	file, err := os.OpenFile(tempFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(FileCreationPermissions))
+	if err != nil {
+		return fmt.Errorf("failed to create journal file %s: %w", tempFile, err)
+	}
+	output := io.WriteCloser(nopWriteCloser{file})
+	if IsCompressedJournal(filePath) {
+		output = gzip.NewWriter(file)
+	}
+	_, err = io.Copy(output, content)
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile, filePath)
+	}
+	if err != nil {
+		_ = os.Remove(tempFile)
+		return fmt.Errorf("failed to write journal file %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// writeJournalLines replaces the content of a journal file with the given decoded lines, like writeJournalFile.
+// The lines are encrypted if a cipher is given and sealed in a new hash chain if a chain key is given.
+func writeJournalLines(filePath string, lines []string, chainKey []byte, cipher *Cipher) error {
+	var chain *Chain
+	if len(chainKey) > 0 {
+		chain = NewChain(chainKey)
+	}
+	content := strings.Builder{}
+	for _, line := range lines {
+		if cipher != nil {
+			var err error
+			if line, err = cipher.Encrypt(line); err != nil {
+				return err
+			}
+		}
+		if chain != nil {
+			line = chain.Seal(line)
+		}
+		content.WriteString(line + "\n")
+	}
+	return writeJournalFile(filePath, strings.NewReader(content.String()))
+}
+
+// nopWriteCloser adds a no-op Close method to a writer.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// CompressJournal archives a closed journal file by replacing it with a compressed copy.
+// It returns the path of the compressed journal.
+func CompressJournal(filePath string) (string, error) {
+	if IsCompressedJournal(filePath) {
+		return filePath, nil
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open journal file %s for compression: %w", filePath, err)
+	}
+	compressedPath := filePath + compressedFileExtension
+	err = writeJournalFile(compressedPath, file)
+	_ = file.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to compress journal file: %w", err)
+	}
+	if err := os.Remove(filePath); err != nil {
+		return compressedPath, fmt.Errorf("failed to remove compressed journal file %s: %w", filePath, err)
+	}
+	return compressedPath, nil
+}
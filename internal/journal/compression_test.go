@@ -0,0 +1,124 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompressJournal(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+	filePath := path.Join(tempDir, "20211020.txt")
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(retentionTestJournal), 0660))
+
+	compressedPath, err := CompressJournal(filePath)
+	if assert.NoError(t, err) {
+		assert.Equal(t, filePath+".gz", compressedPath)
+		assert.True(t, IsCompressedJournal(compressedPath))
+		assert.NoFileExists(t, filePath, "the uncompressed journal should be removed")
+	}
+	raw, err := ioutil.ReadFile(compressedPath)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "Tester", "the journal should be compressed")
+
+	file, err := OpenJournalFile(compressedPath)
+	if assert.NoError(t, err) {
+		content, err := ioutil.ReadAll(file)
+		if assert.NoError(t, err) {
+			assert.Equal(t, retentionTestJournal, string(content), "compressed journals should be decompressed transparently")
+		}
+		assert.NoError(t, file.Close())
+	}
+
+	again, err := CompressJournal(compressedPath)
+	if assert.NoError(t, err, "compressed journals should be left as they are") {
+		assert.Equal(t, compressedPath, again)
+	}
+	_, err = CompressJournal(path.Join(tempDir, "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestOpenJournalFile_invalid(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+	filePath := path.Join(tempDir, "20211020.txt.gz")
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(retentionTestJournal), 0660))
+	_, err := OpenJournalFile(filePath)
+	assert.Error(t, err, "journals with an invalid compression should fail")
+	_, err = OpenJournalFile(path.Join(tempDir, "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestReadJournal_compressed(t *testing.T) {
+	Locations = map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}}
+	tempDir := t.TempDir()
+	filePath := path.Join(tempDir, "20211020.txt")
+	chain := NewChain([]byte("secret"))
+	content := ""
+	for _, line := range strings.Split(strings.TrimSpace(retentionTestJournal), "\n") {
+		content += chain.Seal(line) + "\n"
+	}
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(content), 0660))
+	compressedPath, err := CompressJournal(filePath)
+	require.NoError(t, err)
+
+	journal, err := ReadJournal(compressedPath)
+	if assert.NoError(t, err) {
+		assert.Len(t, journal.GetEvents(), 4)
+	}
+	lines, err := VerifyChain([]byte("secret"), compressedPath)
+	if assert.NoError(t, err, "the chain of compressed journals should be verifiable") {
+		assert.Equal(t, 6, lines)
+	}
+}
+
+func TestWriter_archiveJournals(t *testing.T) {
+	tempDir := t.TempDir()
+	oldJournal := path.Join(tempDir, util.GetDateFilename(time.Now().AddDate(0, 0, -1))+journalFileExtension)
+	require.NoError(t, ioutil.WriteFile(oldJournal, []byte(retentionTestJournal), 0660))
+
+	writer, err := NewWriter(tempDir)
+	require.NoError(t, err)
+	writer.archiveJournals()
+	assert.FileExists(t, oldJournal, "journals should only be compressed if enabled")
+	require.NoError(t, writer.Close())
+
+	writer, err = NewWriterWithConfig(tempDir, WriterConfig{CompressJournals: true})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, writer.Close()) }()
+	writer.archiveJournals()
+	assert.NoFileExists(t, oldJournal)
+	assert.FileExists(t, oldJournal+compressedFileExtension, "closed journals should be compressed")
+	assert.FileExists(t, GetCurrentJournalPath(tempDir), "the current journal should not be compressed")
+	_, err = os.Stat(GetCurrentJournalPath(tempDir) + compressedFileExtension)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestApplyRetention_compressed(t *testing.T) {
+	Locations = map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}}
+	tempDir := t.TempDir()
+	now := time.Now()
+	files := createRetentionTestJournals(t, tempDir, now, 10)
+	compressedPath, err := CompressJournal(files[0])
+	require.NoError(t, err)
+
+	records, err := ApplyRetention(tempDir, RetentionPolicy{Days: 7, Mode: ANONYMISE}, now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []RetentionRecord{{File: compressedPath, Mode: ANONYMISE, Users: 2}}, records)
+	}
+	journal, err := ReadJournal(compressedPath)
+	if assert.NoError(t, err, "anonymised journals should stay compressed") && assert.Len(t, journal.GetEvents(), 4) {
+		assert.Equal(t, "Anonymous 1", journal.GetEvents()[0].User.Name)
+	}
+}
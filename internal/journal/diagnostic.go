@@ -0,0 +1,28 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import "fmt"
+
+// LineError describes a journal line that couldn't be read.
+// In strict mode it stops reading, otherwise the line is skipped and the LineError is kept as a diagnostic.
+type LineError struct {
+	// File is the path of the journal file
+	File string
+	// Line is the line number in the journal file, starting at 1
+	Line int
+	// Raw is the line as it was read from the file
+	Raw string
+	// Reason is the error that occurred while reading the line
+	Reason error
+}
+
+func (err *LineError) Error() string {
+	return fmt.Sprintf("%s:%d: %v (line \"%s\")", err.File, err.Line, err.Reason, err.Raw)
+}
+
+func (err *LineError) Unwrap() error {
+	return err.Reason
+}
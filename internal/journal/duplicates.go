@@ -0,0 +1,154 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"strings"
+	"unicode"
+)
+
+// DefaultMaxDuplicateDistance is the default number of typos (see FindDuplicates) between likely-same users.
+const DefaultMaxDuplicateDistance = 2
+
+// transliterations spell out the umlauts, so that "Müller" and "Mueller" have the same fuzzy form.
+// The ß is already spelled out by the case folding of NormalizeIdentity.
+var transliterations = strings.NewReplacer("ä", "ae", "ö", "oe", "ü", "ue")
+
+// fuzzyForm reduces text to the letters and digits that matter when comparing spellings:
+// the identity (see NormalizeIdentity) with transliterated umlauts, without diacritics and punctuation.
+func fuzzyForm(text string) []rune {
+	text = transliterations.Replace(NormalizeIdentity(text))
+	fuzzy := make([]rune, 0, len(text))
+	for _, char := range norm.NFD.String(text) {
+		switch {
+		case unicode.IsLetter(char) || unicode.IsDigit(char):
+			fuzzy = append(fuzzy, char)
+		case unicode.IsSpace(char) && len(fuzzy) > 0 && fuzzy[len(fuzzy)-1] != ' ':
+			fuzzy = append(fuzzy, ' ')
+		}
+	}
+	return []rune(strings.TrimSpace(string(fuzzy)))
+}
+
+// editDistance computes the Levenshtein distance of the texts, it stops counting above maxDistance.
+func editDistance(a []rune, b []rune, maxDistance int) int {
+	if len(a)-len(b) > maxDistance || len(b)-len(a) > maxDistance {
+		return maxDistance + 1
+	}
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		rowMin := current[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+			rowMin = minInt(rowMin, current[j])
+		}
+		if rowMin > maxDistance { // the distance can't get smaller anymore
+			return maxDistance + 1
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// fuzzyUser holds the fuzzy forms of the data that is compared to find duplicates.
+type fuzzyUser struct {
+	name    []rune
+	address []rune
+	email   string
+	phone   string
+}
+
+// newFuzzyUser creates the fuzzy forms of the user data.
+func newFuzzyUser(user *User) fuzzyUser {
+	phone := strings.Builder{}
+	for _, char := range user.Phone {
+		if unicode.IsDigit(char) {
+			phone.WriteRune(char)
+		}
+	}
+	return fuzzyUser{
+		name:    fuzzyForm(user.Name),
+		address: fuzzyForm(user.FullAddress()),
+		email:   NormalizeIdentity(user.Email),
+		phone:   phone.String(),
+	}
+}
+
+// likelySame checks whether two users are likely the same person:
+// their names differ by at most maxDistance typos and they share an address with at most as many typos,
+// an email address or a phone number.
+func (user *fuzzyUser) likelySame(other *fuzzyUser, maxDistance int) bool {
+	if len(user.name) == 0 || editDistance(user.name, other.name, maxDistance) > maxDistance {
+		return false
+	}
+	return (len(user.address) > 0 && editDistance(user.address, other.address, maxDistance) <= maxDistance) ||
+		(user.email != "" && user.email == other.email) ||
+		(user.phone != "" && user.phone == other.phone)
+}
+
+// FindDuplicates groups the users that are likely the same person despite different spellings, like
+// "Klaus Müller" and "Klaus Mueller" with the same address.
+// Typos are counted as edit distance of the names and addresses, after ignoring the differences that don't
+// change the identity (see NormalizeIdentity), umlauts spelled out, diacritics and punctuation.
+// Users are grouped transitively and keep their order within the groups, users without duplicates are left out.
+func FindDuplicates(users []*User, maxDistance int) [][]*User {
+	fuzzyUsers := make([]fuzzyUser, len(users))
+	for i, user := range users {
+		fuzzyUsers[i] = newFuzzyUser(user)
+	}
+
+	// groupOf links the users to another user of their group, the first user of a group links to itself
+	groupOf := make([]int, len(users))
+	for i := range groupOf {
+		groupOf[i] = i
+	}
+	root := func(i int) int {
+		for groupOf[i] != i {
+			groupOf[i] = groupOf[groupOf[i]]
+			i = groupOf[i]
+		}
+		return i
+	}
+	for i := range fuzzyUsers {
+		for j := i + 1; j < len(fuzzyUsers); j++ {
+			if root(i) != root(j) && fuzzyUsers[i].likelySame(&fuzzyUsers[j], maxDistance) {
+				first, second := root(i), root(j)
+				if second < first {
+					first, second = second, first
+				}
+				groupOf[second] = first
+			}
+		}
+	}
+
+	members := make(map[int][]*User, len(users))
+	for i, user := range users {
+		members[root(i)] = append(members[root(i)], user)
+	}
+	groups := make([][]*User, 0, 10)
+	for i := range users {
+		if group := members[i]; len(group) > 1 { // only the first users of groups have members
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
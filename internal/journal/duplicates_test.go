@@ -0,0 +1,60 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, 0, editDistance([]rune("klaus"), []rune("klaus"), 2))
+	assert.Equal(t, 1, editDistance([]rune("klaus"), []rune("klaas"), 2))
+	assert.Equal(t, 2, editDistance([]rune("müller"), []rune("muler"), 2))
+	assert.Equal(t, 3, editDistance([]rune("klaus"), []rune("k"), 2), "the distance should stop counting above the maximum")
+	assert.Equal(t, 3, editDistance([]rune("abcdef"), []rune("uvwxyz"), 2))
+	assert.Equal(t, 3, editDistance([]rune(""), []rune("abc"), 5))
+}
+
+func TestFuzzyForm(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "klaus mueller", string(fuzzyForm(" Klaus  Müller")))
+	assert.Equal(t, "klaus mueller", string(fuzzyForm("Klaus Mu\u0308ller")), "decomposed umlauts should be transliterated as well")
+	assert.Equal(t, "strasse 1", string(fuzzyForm("Straße 1.")))
+	assert.Equal(t, "rene", string(fuzzyForm("René")))
+	assert.Equal(t, "", string(fuzzyForm(" - ")))
+}
+
+func TestFindDuplicates(t *testing.T) {
+	t.Parallel()
+	users := []*User{
+		{Name: "Klaus Müller", Address: "Musterdorf"},
+		{Name: "Erika Mustermann", Email: "erika@example.com"},
+		{Name: "Tester", Address: "Teststadt"},
+		{Name: "Klaus Mueller", Address: "Musterdorf"},
+		{Name: "Klaus Müller", Address: "Hauptstadt"},
+		{Name: "Erika Musterman", Email: "Erika@Example.com"},
+		{Name: "Klaus Mueler", Address: "Musterdorff"},
+		{Name: "Max Mustermann", Email: "erika@example.com"},
+		{Name: "Erika Mustermann", Phone: "+49 6261 123456"},
+	}
+
+	groups := FindDuplicates(users, DefaultMaxDuplicateDistance)
+	assert.Equal(t, [][]*User{
+		{users[0], users[3], users[6]},
+		{users[1], users[5]},
+	}, groups, "users with similar names and the same contact should be grouped, even transitively")
+
+	assert.Equal(t, [][]*User{{users[0], users[3]}}, FindDuplicates(users, 0), "without typos, only the spelling should be ignored")
+	assert.Empty(t, FindDuplicates(users[:3], DefaultMaxDuplicateDistance))
+	assert.Empty(t, FindDuplicates(nil, DefaultMaxDuplicateDistance))
+
+	byPhone := []*User{
+		{Name: "Erika Mustermann", Phone: "+49 6261 123456"},
+		{Name: "erika mustermann", Phone: "+49 (6261) 12 34 56"},
+	}
+	assert.Equal(t, [][]*User{byPhone}, FindDuplicates(byPhone, DefaultMaxDuplicateDistance))
+}
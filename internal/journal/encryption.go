@@ -0,0 +1,87 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"strings"
+)
+
+// EncryptionKeySize is the required size of journal encryption keys (AES-256).
+const EncryptionKeySize = 32
+
+// encryptedLinePrefix marks journal lines that contain an encrypted record.
+const encryptedLinePrefix = "!"
+
+// Cipher encrypts and decrypts the records of journal files with authenticated encryption (AES-GCM).
+// Each line is encrypted on its own, so that journals can still be appended to and read line by line.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher creates a new Cipher with the given key of EncryptionKeySize bytes.
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes long, got %d", EncryptionKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create journal cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create journal cipher: %w", err)
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// Encrypt encrypts a journal line into an encrypted journal line.
+func (c *Cipher) Encrypt(line string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(line), nil)
+	return encryptedLinePrefix + util.Base64Encode(sealed), nil
+}
+
+// Decrypt decrypts an encrypted journal line.
+func (c *Cipher) Decrypt(line string) (string, error) {
+	sealed, err := util.Base64Decode(strings.TrimPrefix(line, encryptedLinePrefix))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode encrypted line: %w", err)
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return "", fmt.Errorf("encrypted line is too short")
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt line, the key is wrong or the line has been altered: %w", err)
+	}
+	return string(plain), nil
+}
+
+// IsEncryptedLine checks whether the given journal line contains an encrypted record.
+func IsEncryptedLine(line string) bool {
+	return strings.HasPrefix(line, encryptedLinePrefix)
+}
+
+// DecodeLine extracts the plain journal line from a raw line of a journal file.
+// It strips the hash chain MAC and decrypts encrypted records with the given Cipher, which may be nil.
+func DecodeLine(raw string, c *Cipher) (string, error) {
+	line, _, _ := SplitChainedLine(raw)
+	if !IsEncryptedLine(line) {
+		return line, nil
+	}
+	if c == nil {
+		return "", fmt.Errorf("the journal is encrypted, but no encryption key was given")
+	}
+	return c.Decrypt(line)
+}
@@ -0,0 +1,112 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"strings"
+	"testing"
+)
+
+var testEncryptionKey = []byte("thisis32bitlongpassphraseimusing")
+
+func TestNewCipher(t *testing.T) {
+	_, err := NewCipher(testEncryptionKey)
+	assert.NoError(t, err)
+	_, err = NewCipher([]byte("short"))
+	assert.Error(t, err, "keys with the wrong size should be rejected")
+}
+
+func TestCipher_EncryptDecrypt(t *testing.T) {
+	c, err := NewCipher(testEncryptionKey)
+	require.NoError(t, err)
+
+	line := "*Tester\tTeststadt"
+	encrypted, err := c.Encrypt(line)
+	require.NoError(t, err)
+	assert.True(t, IsEncryptedLine(encrypted))
+	assert.NotContains(t, encrypted, "Tester", "encrypted lines should not contain the clear text")
+	other, err := c.Encrypt(line)
+	require.NoError(t, err)
+	assert.NotEqual(t, encrypted, other, "each encryption should use a new nonce")
+
+	decrypted, err := c.Decrypt(encrypted)
+	if assert.NoError(t, err) {
+		assert.Equal(t, line, decrypted)
+	}
+
+	wrong, err := NewCipher([]byte(strings.Repeat("x", EncryptionKeySize)))
+	require.NoError(t, err)
+	_, err = wrong.Decrypt(encrypted)
+	assert.Error(t, err, "decryption with a wrong key should fail")
+	_, err = c.Decrypt(encrypted[:len(encrypted)-4] + "AAA=")
+	assert.Error(t, err, "decryption of altered lines should fail")
+	_, err = c.Decrypt("!AAAA")
+	assert.Error(t, err, "decryption of too short lines should fail")
+	_, err = c.Decrypt("!.")
+	assert.Error(t, err, "decryption of invalid base64 should fail")
+}
+
+func TestDecodeLine(t *testing.T) {
+	c, err := NewCipher(testEncryptionKey)
+	require.NoError(t, err)
+	encrypted, err := c.Encrypt("*Tester\tTeststadt")
+	require.NoError(t, err)
+	chain := NewChain([]byte("secret"))
+
+	for _, raw := range []string{encrypted, chain.Seal(encrypted)} {
+		line, err := DecodeLine(raw, c)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "*Tester\tTeststadt", line)
+		}
+	}
+	line, err := DecodeLine("*Tester\tTeststadt", c)
+	if assert.NoError(t, err, "plain lines should be accepted in encrypted journals") {
+		assert.Equal(t, "*Tester\tTeststadt", line)
+	}
+	_, err = DecodeLine(encrypted, nil)
+	assert.Error(t, err, "encrypted lines require a key")
+}
+
+func TestWriter_encrypted(t *testing.T) {
+	tempDir := t.TempDir()
+	config := WriterConfig{EncryptionKey: testEncryptionKey, ChainKey: []byte("secret")}
+	Locations = map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}}
+	user := User{Name: "Tester", Address: "Teststadt"}
+
+	_, err := NewWriterWithConfig(tempDir, WriterConfig{EncryptionKey: []byte("short")})
+	assert.Error(t, err, "invalid encryption keys should fail the writer creation")
+
+	writer, err := NewWriterWithConfig(tempDir, config)
+	require.NoError(t, err, "failed to create encrypted writer")
+	require.NoError(t, writer.WriteEventUser(&user, Locations["TST"], LOGIN))
+	require.NoError(t, writer.Close())
+
+	content, err := ioutil.ReadFile(GetCurrentJournalPath(tempDir))
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "Tester", "journal records should be encrypted at rest")
+
+	writer, err = NewWriterWithConfig(tempDir, config)
+	require.NoError(t, err, "failed to reopen encrypted journal")
+	loc, err := writer.GetCurrentUserLocation(util.Base64Encode(user.Hash()))
+	if assert.NoError(t, err, "the encrypted journal should be loaded") {
+		assert.Equal(t, Locations["TST"], loc)
+	}
+	require.NoError(t, writer.Close())
+
+	journal, err := ReadJournalsWithConfig([]string{GetCurrentJournalPath(tempDir)}, ReaderConfig{EncryptionKey: testEncryptionKey})
+	if assert.NoError(t, err) {
+		if assert.Len(t, journal.GetEvents(), 1) {
+			assert.Equal(t, user, *journal.GetEvents()[0].User)
+		}
+	}
+	_, err = ReadJournals([]string{GetCurrentJournalPath(tempDir)})
+	assert.Error(t, err, "reading encrypted journals without a key should fail")
+	_, err = ReadJournalsWithConfig([]string{GetCurrentJournalPath(tempDir)}, ReaderConfig{EncryptionKey: []byte("short")})
+	assert.Error(t, err, "reading with an invalid key should fail")
+}
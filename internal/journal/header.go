@@ -0,0 +1,178 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// headerRecord is the record type of the header line, which is the first line of journal files.
+const headerRecord = '@'
+
+const (
+	// LegacyFormatVersion is the format version of journals without header line.
+	// Their user lines contain only the user data and the users are identified by SHA1IDS.
+	LegacyFormatVersion = 1
+	// idsFormatVersion added the user ID in front of the user lines, so that the IDs don't have to be derivable
+	// from the user data.
+	idsFormatVersion = 2
+	// CurrentFormatVersion is the format version written by the Writer.
+	// It added the optional user fields, like the phone number, to the user lines.
+	CurrentFormatVersion = 3
+)
+
+// ErrUnsupportedVersion is returned for journals written in a newer format than this version can read.
+var ErrUnsupportedVersion = errors.New("unsupported journal format version")
+
+// Header describes the format of a journal file.
+// It's written as tab separated "name=value" fields, journals without header line have the LegacyHeader.
+type Header struct {
+	// Version is the format version of the journal, which defines the format of its lines
+	Version int
+	// IDs is the scheme of the user IDs in the journal
+	IDs IDScheme
+	// KeyID identifies the key of keyed user IDs without revealing it, empty for unkeyed IDs
+	KeyID string
+	// PreviousMAC is the base64 encoded chain MAC of the last line of the previous journal file,
+	// which links the hash chains of the files, see VerifyChainLink. It's empty for journals without link.
+	PreviousMAC string
+	// ReplacedMAC is the base64 encoded chain MAC of the last line the journal had before it was rewritten,
+	// e.g. anonymised by the retention. The link of the next journal file refers to it. It's empty for original journals.
+	ReplacedMAC string
+}
+
+// LegacyHeader is the format of journals without header line.
+var LegacyHeader = Header{Version: LegacyFormatVersion, IDs: SHA1IDS}
+
+// ParseHeaderLine parses the journal format of a Header.
+// Headers without version are from the first journals with header, which had the format version 2.
+func ParseHeaderLine(line string) (Header, error) {
+	header := Header{Version: idsFormatVersion}
+	for _, field := range strings.Split(line, "\t") {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return Header{}, fmt.Errorf("header field \"%s\" should have the form name=value", field)
+		}
+		switch parts[0] {
+		case "version":
+			version, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return Header{}, fmt.Errorf("invalid format version \"%s\": %w", parts[1], err)
+			}
+			header.Version = version
+		case "ids":
+			header.IDs = IDScheme(parts[1])
+		case "key":
+			header.KeyID = parts[1]
+		case "chain":
+			header.PreviousMAC = parts[1]
+		case "replaced":
+			header.ReplacedMAC = parts[1]
+		default:
+			return Header{}, fmt.Errorf("unknown header field \"%s\"", parts[0])
+		}
+	}
+	if header.Version > CurrentFormatVersion {
+		return Header{}, fmt.Errorf("%w %d, the latest supported version is %d",
+			ErrUnsupportedVersion, header.Version, CurrentFormatVersion)
+	} else if header.Version <= LegacyFormatVersion { // the legacy format has no header
+		return Header{}, fmt.Errorf("invalid format version %d", header.Version)
+	}
+	switch header.IDs {
+	case SHA1IDS:
+	case HMACIDS:
+		if header.KeyID == "" {
+			return Header{}, fmt.Errorf("the header of keyed user IDs must identify the key")
+		}
+	default:
+		return Header{}, fmt.Errorf("unknown user ID scheme \"%s\"", header.IDs)
+	}
+	return header, nil
+}
+
+// ToJournalLine converts the Header to the journal format.
+func (header *Header) ToJournalLine() string {
+	line := fmt.Sprintf("version=%d\tids=%s", header.Version, header.IDs)
+	if header.KeyID != "" {
+		line += "\tkey=" + header.KeyID
+	}
+	if header.PreviousMAC != "" {
+		line += "\tchain=" + header.PreviousMAC
+	}
+	if header.ReplacedMAC != "" {
+		line += "\treplaced=" + header.ReplacedMAC
+	}
+	return line
+}
+
+// sameFormat checks whether journals with the headers have the same format and user IDs, regardless of their links.
+func (header *Header) sameFormat(other Header) bool {
+	unlinked := *header
+	unlinked.PreviousMAC, unlinked.ReplacedMAC = other.PreviousMAC, other.ReplacedMAC
+	return unlinked == other
+}
+
+// ParseUserLine parses a user line in the format version of the header and returns the User with its raw ID.
+func (header *Header) ParseUserLine(line string) (User, []byte, error) {
+	id := []byte(nil)
+	if header.Version >= idsFormatVersion {
+		parts := strings.SplitN(line, "\t", 2)
+		if len(parts) != 2 {
+			return User{}, nil, fmt.Errorf("user line should start with the user ID")
+		}
+		var err error
+		if id, err = util.Base64Decode(parts[0]); err != nil {
+			return User{}, nil, fmt.Errorf("failed to decode user ID: %w", err)
+		}
+		line = parts[1]
+	}
+	if header.Version < CurrentFormatVersion && strings.Count(line, "\t") != 1 { // no optional fields yet
+		return User{}, nil, fmt.Errorf("user line should contain exactly two fields")
+	}
+	user, err := ParseUserJournalLine(line)
+	if id == nil {
+		id = user.lineHash()
+	}
+	return user, id, err
+}
+
+// FormatUserLine creates the user line of the User with the given raw ID in the format version of the header.
+func (header *Header) FormatUserLine(user *User, id []byte) string {
+	if header.Version < idsFormatVersion {
+		return user.ToJournalLine()
+	}
+	return util.Base64Encode(id) + "\t" + user.ToJournalLine()
+}
+
+// readJournalHeader reads the header of a journal file, it returns false if the file is missing or empty.
+func readJournalHeader(filePath string, cipher *Cipher) (Header, bool, error) {
+	file, err := OpenJournalFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return LegacyHeader, false, nil
+	} else if err != nil {
+		return LegacyHeader, false, err
+	}
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return LegacyHeader, false, scanner.Err()
+	}
+	line, err := DecodeLine(scanner.Text(), cipher)
+	if err != nil {
+		return LegacyHeader, true, fmt.Errorf("failed to decode the first line of journal file %s: %w", filePath, err)
+	}
+	if line == "" || line[0] != headerRecord {
+		return LegacyHeader, true, nil
+	}
+	header, err := ParseHeaderLine(line[1:])
+	return header, true, err
+}
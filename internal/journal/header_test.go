@@ -0,0 +1,89 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"testing"
+)
+
+func TestParseHeaderLine(t *testing.T) {
+	t.Parallel()
+	header, err := ParseHeaderLine("version=2\tids=hmac-sha256\tkey=abc")
+	if assert.NoError(t, err) {
+		assert.Equal(t, Header{Version: 2, IDs: HMACIDS, KeyID: "abc"}, header)
+		assert.Equal(t, "version=2\tids=hmac-sha256\tkey=abc", header.ToJournalLine())
+	}
+	header, err = ParseHeaderLine("version=2\tids=sha1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, Header{Version: 2, IDs: SHA1IDS}, header)
+		assert.Equal(t, "version=2\tids=sha1", header.ToJournalLine())
+	}
+	header, err = ParseHeaderLine("version=3\tids=sha1\tchain=abc")
+	if assert.NoError(t, err) {
+		assert.Equal(t, Header{Version: 3, IDs: SHA1IDS, PreviousMAC: "abc"}, header)
+		assert.Equal(t, "version=3\tids=sha1\tchain=abc", header.ToJournalLine())
+		assert.True(t, header.sameFormat(Header{Version: 3, IDs: SHA1IDS}), "the link shouldn't change the format")
+		assert.False(t, header.sameFormat(Header{Version: 3, IDs: HMACIDS, KeyID: "abc", PreviousMAC: "abc"}))
+	}
+	header, err = ParseHeaderLine("version=3\tids=sha1\tchain=abc\treplaced=def")
+	if assert.NoError(t, err) {
+		assert.Equal(t, Header{Version: 3, IDs: SHA1IDS, PreviousMAC: "abc", ReplacedMAC: "def"}, header)
+		assert.Equal(t, "version=3\tids=sha1\tchain=abc\treplaced=def", header.ToJournalLine())
+		assert.True(t, header.sameFormat(Header{Version: 3, IDs: SHA1IDS}), "the links shouldn't change the format")
+	}
+	header, err = ParseHeaderLine("ids=hmac-sha256\tkey=abc")
+	if assert.NoError(t, err, "the first headers had no version") {
+		assert.Equal(t, Header{Version: 2, IDs: HMACIDS, KeyID: "abc"}, header)
+	}
+
+	_, err = ParseHeaderLine("version=4\tids=sha1")
+	assert.ErrorIs(t, err, ErrUnsupportedVersion, "newer versions can't be read")
+	for _, line := range []string{
+		"", "ids", "ids=md5", "ids=hmac-sha256", "ids=sha1\tsalt=abc", "version=1\tids=sha1", "version=two\tids=sha1",
+	} {
+		_, err = ParseHeaderLine(line)
+		assert.Error(t, err, "header line \"%s\" should be invalid", line)
+	}
+}
+
+func TestHeader_userLines(t *testing.T) {
+	t.Parallel()
+	user := User{Name: "Tester", Address: "Teststadt"}
+
+	line := LegacyHeader.FormatUserLine(&user, user.lineHash())
+	assert.Equal(t, "Tester\tTeststadt", line)
+	parsed, id, err := LegacyHeader.ParseUserLine(line)
+	if assert.NoError(t, err) {
+		assert.Equal(t, user, parsed)
+		assert.Equal(t, user.lineHash(), id)
+	}
+
+	keyed := Header{Version: CurrentFormatVersion, IDs: HMACIDS, KeyID: "abc"}
+	line = keyed.FormatUserLine(&user, []byte("id"))
+	assert.Equal(t, util.Base64Encode([]byte("id"))+"\tTester\tTeststadt", line)
+	parsed, id, err = keyed.ParseUserLine(line)
+	if assert.NoError(t, err) {
+		assert.Equal(t, user, parsed)
+		assert.Equal(t, []byte("id"), id)
+	}
+
+	for _, line := range []string{"Tester", "Tester\tTeststadt", "not base64!\tTester\tTeststadt"} {
+		_, _, err = keyed.ParseUserLine(line)
+		assert.Error(t, err, "user line \"%s\" should be invalid", line)
+	}
+
+	erika := User{Name: "Erika", Phone: "+49 123"}
+	line = keyed.FormatUserLine(&erika, []byte("id"))
+	parsed, _, err = keyed.ParseUserLine(line)
+	if assert.NoError(t, err) {
+		assert.Equal(t, erika, parsed, "the optional fields should be read in the current version")
+	}
+	_, _, err = (&Header{Version: 2, IDs: SHA1IDS}).ParseUserLine(line)
+	assert.Error(t, err, "older versions have no optional fields")
+	_, _, err = LegacyHeader.ParseUserLine("Erika\t\tphone=+49 123")
+	assert.Error(t, err, "older versions have no optional fields")
+}
@@ -0,0 +1,317 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+)
+
+// EventIterator streams the events of journal files one at a time, resolving the users as it goes.
+// Only the users and open sessions are kept in memory, so journals of any size can be processed.
+// The journal files are read in sources, see NewMergedEventIterator: the files of a source are read one after the other,
+// the events of several sources are merged by their timestamps, so they are yielded in chronological order
+// as long as each source is.
+// Invalid lines are skipped and collected as diagnostics, unless the strict mode is configured.
+//
+// Usage:
+//
+//	iterator, err := NewEventIterator(ctx, files, ReaderConfig{})
+//	defer iterator.Close()
+//	for iterator.Next() {
+//	    event := iterator.Event()
+//	}
+//	err = iterator.Err()
+type EventIterator struct {
+	// ctx cancels the iteration
+	ctx context.Context
+	// sources are the sources of journal files that still have events
+	sources []*journalSource
+	// started is true once every source was advanced to its first event
+	started bool
+	// cipher decrypts encrypted records, nil if no encryption key was given
+	cipher *Cipher
+	// strict stops the iteration at the first invalid line
+	strict bool
+	// users maps the raw user IDs to the users read so far
+	users map[string]*User
+	// userList contains the users read so far in the order of their appearance
+	userList []*User
+	// identities maps the identities (see User.Identity) to the users read so far, to identify users across journals with different IDs
+	identities map[User]*User
+	// sessions tracks the current location of users, to stitch together carried over logins
+	sessions map[*User]*Location
+	// diagnostics are the invalid lines skipped so far
+	diagnostics []LineError
+	// event is the current event
+	event Event
+	// err is the error that stopped the iteration
+	err error
+}
+
+// journalSource reads the journal files of a source one after the other, one event ahead of the iteration.
+type journalSource struct {
+	// files are the journal files that are not opened yet
+	files []string
+	// file is the currently read journal file, nil if no file is open
+	file io.ReadCloser
+	// scanner reads the lines of the current file
+	scanner *bufio.Scanner
+	// filePath is the path of the current file
+	filePath string
+	// header is the header of the current file
+	header Header
+	// lineNumber is the number of the last read line in the current file
+	lineNumber int
+	// next is the next event of the source
+	next Event
+}
+
+// NewEventIterator creates an EventIterator over the given journal files, which are read one after the other.
+// The context can be used to cancel the iteration, which Next reports by returning false.
+func NewEventIterator(ctx context.Context, filepaths []string, config ReaderConfig) (*EventIterator, error) {
+	return NewMergedEventIterator(ctx, [][]string{filepaths}, config)
+}
+
+// NewMergedEventIterator creates an EventIterator that merges the events of several sources of journal files,
+// like the journal directories of several servers, by their timestamps.
+// The files of each source are read one after the other, so they should be ordered by time.
+// Events of the same second are yielded in the order of the sources.
+// The context can be used to cancel the iteration, which Next reports by returning false.
+func NewMergedEventIterator(ctx context.Context, sources [][]string, config ReaderConfig) (*EventIterator, error) {
+	iterator := EventIterator{
+		ctx:        ctx,
+		sources:    make([]*journalSource, 0, len(sources)),
+		users:      make(map[string]*User, 100),
+		userList:   make([]*User, 0, 100),
+		identities: make(map[User]*User, 100),
+		sessions:   make(map[*User]*Location, 100),
+		strict:     config.Strict,
+	}
+	for _, files := range sources {
+		if len(files) > 0 {
+			iterator.sources = append(iterator.sources, &journalSource{files: files})
+		}
+	}
+	if len(config.EncryptionKey) > 0 {
+		var err error
+		if iterator.cipher, err = NewCipher(config.EncryptionKey); err != nil {
+			return nil, fmt.Errorf("failed to set up journal decryption: %w", err)
+		}
+	}
+	return &iterator, nil
+}
+
+// Next advances the iterator to the next event.
+// It returns false at the end of the journals, on errors and on cancellation, see Err.
+func (iterator *EventIterator) Next() bool {
+	if !iterator.started {
+		iterator.started = true
+		for i := 0; i < len(iterator.sources) && iterator.err == nil; {
+			if iterator.advance(iterator.sources[i]) {
+				i++
+			} else {
+				iterator.removeSource(i)
+			}
+		}
+	}
+	for iterator.err == nil && len(iterator.sources) > 0 {
+		if err := iterator.ctx.Err(); err != nil {
+			iterator.err = err
+			break
+		}
+		earliest := 0
+		for i, source := range iterator.sources {
+			if source.next.Timestamp < iterator.sources[earliest].next.Timestamp {
+				earliest = i
+			}
+		}
+		source := iterator.sources[earliest]
+		event := source.next
+		if !iterator.advance(source) {
+			iterator.removeSource(earliest)
+		}
+		if iterator.trackSession(&event) { // errors of the next event are reported by the next call
+			iterator.event = event
+			return true
+		}
+	}
+	iterator.Close()
+	return false
+}
+
+// Event returns the current event.
+func (iterator *EventIterator) Event() Event {
+	return iterator.event
+}
+
+// Err returns the error that stopped the iteration, or nil if all journals were read.
+func (iterator *EventIterator) Err() error {
+	return iterator.err
+}
+
+// Diagnostics returns the invalid lines that were skipped so far.
+func (iterator *EventIterator) Diagnostics() []LineError {
+	return iterator.diagnostics
+}
+
+// Users returns the users read so far in the order of their appearance.
+func (iterator *EventIterator) Users() []*User {
+	return iterator.userList
+}
+
+// Close releases the opened journal files, it's safe to call it multiple times.
+func (iterator *EventIterator) Close() error {
+	for _, source := range iterator.sources {
+		source.closeFile()
+	}
+	return nil
+}
+
+// removeSource closes and removes the source at the given index.
+func (iterator *EventIterator) removeSource(index int) {
+	iterator.sources[index].closeFile()
+	iterator.sources = append(iterator.sources[:index], iterator.sources[index+1:]...)
+}
+
+// advance reads the source up to its next event and returns false at its end, on errors and on cancellation.
+func (iterator *EventIterator) advance(source *journalSource) bool {
+	for iterator.err == nil {
+		if err := iterator.ctx.Err(); err != nil {
+			iterator.err = err
+			break
+		}
+		if source.scanner == nil {
+			if len(source.files) == 0 {
+				return false
+			}
+			iterator.err = source.openFile(source.files[0])
+			source.files = source.files[1:]
+			continue
+		}
+		if !source.scanner.Scan() {
+			iterator.err = source.scanner.Err()
+			source.closeFile()
+			continue
+		}
+		source.lineNumber++
+		if iterator.readLine(source, source.scanner.Text()) {
+			return true
+		}
+	}
+	return false
+}
+
+// openFile opens the given journal file for reading.
+func (source *journalSource) openFile(filepath string) error {
+	if isFile, err := util.FileExists(filepath); err != nil || !isFile {
+		return fmt.Errorf("\"%s\" is not a valid file (%w)", filepath, err)
+	}
+	file, err := OpenJournalFile(filepath)
+	if err != nil {
+		return err
+	}
+	source.file = file
+	source.scanner = bufio.NewScanner(file)
+	source.filePath = filepath
+	source.lineNumber = 0
+	source.header = LegacyHeader
+	return nil
+}
+
+// closeFile closes the current journal file, if any.
+func (source *journalSource) closeFile() {
+	if source.file != nil {
+		_ = source.file.Close()
+	}
+	source.file = nil
+	source.scanner = nil
+}
+
+// readLine processes a raw journal line of the source and returns true if it resulted in the next event of the source.
+func (iterator *EventIterator) readLine(source *journalSource, raw string) bool {
+	if iterator.cipher == nil && IsEncryptedLine(raw) { // not a problem of the line, so it's never skipped
+		iterator.err = fmt.Errorf("the journal \"%s\" is encrypted, but no encryption key was given", source.filePath)
+		return false
+	}
+	line, err := DecodeLine(raw, iterator.cipher)
+	if err != nil {
+		iterator.invalidLine(source, raw, fmt.Errorf("failed to decode line: %w", err))
+		return false
+	}
+	if line == "" {
+		return false
+	}
+	switch line[0] {
+	case headerRecord:
+		header, err := ParseHeaderLine(line[1:])
+		if errors.Is(err, ErrUnsupportedVersion) { // the lines can't be read at all
+			iterator.err = fmt.Errorf("failed to read journal \"%s\": %w", source.filePath, err)
+			return false
+		}
+		if err == nil && source.lineNumber != 1 {
+			err = fmt.Errorf("the header must be the first line")
+		}
+		if err != nil {
+			iterator.invalidLine(source, raw, err)
+			return false
+		}
+		source.header = header
+	case '*':
+		user, id, err := source.header.ParseUserLine(line[1:])
+		if err != nil {
+			iterator.invalidLine(source, raw, err)
+			return false
+		}
+		identity := user.Identity()
+		known, exists := iterator.identities[identity]
+		if !exists { // users may reappear in other journal files, possibly with other IDs or spellings
+			known = &user
+			iterator.identities[identity] = known
+			iterator.userList = append(iterator.userList, known)
+		}
+		iterator.users[string(id)] = known
+	case uint8(LOGIN), uint8(LOGOUT):
+		entry, err := ParseEventJournalEntry(EventType(line[0]), line[1:], &iterator.users)
+		if err != nil {
+			iterator.invalidLine(source, raw, err)
+			return false
+		}
+		source.next = entry
+		return true
+	default:
+		iterator.invalidLine(source, raw, fmt.Errorf("unknown record type '%c'", line[0]))
+	}
+	return false
+}
+
+// invalidLine stops the iteration in strict mode, otherwise the line is skipped and kept as diagnostic.
+func (iterator *EventIterator) invalidLine(source *journalSource, raw string, reason error) {
+	lineError := LineError{File: source.filePath, Line: source.lineNumber, Raw: raw, Reason: reason}
+	if iterator.strict {
+		iterator.err = &lineError
+		return
+	}
+	iterator.diagnostics = append(iterator.diagnostics, lineError)
+}
+
+// trackSession updates the known sessions with the given event.
+// It returns false for carried over logins that continue a session from a previously read journal file.
+func (iterator *EventIterator) trackSession(event *Event) bool {
+	switch event.EventType {
+	case LOGIN:
+		if event.Flag == CARRIED && iterator.sessions[event.User] == event.Location {
+			return false
+		}
+		iterator.sessions[event.User] = event.Location
+	case LOGOUT:
+		delete(iterator.sessions, event.User)
+	}
+	return true
+}
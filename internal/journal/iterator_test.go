@@ -0,0 +1,214 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"path"
+	"testing"
+)
+
+func TestEventIterator(t *testing.T) {
+	Locations = map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}}
+	tempDir := t.TempDir()
+	first := path.Join(tempDir, "20211020.txt")
+	second := path.Join(tempDir, "20211021.txt")
+	require.NoError(t, ioutil.WriteFile(first, []byte(retentionTestJournal), 0660))
+	require.NoError(t, ioutil.WriteFile(second, []byte("*Klaus\tMusterdorf\n\n+O+Dig24BxOFwjJEN1oBbk/VW/tA=\tTST\t1634800000\n"), 0660))
+
+	iterator, err := NewEventIterator(context.Background(), []string{first, second}, ReaderConfig{})
+	require.NoError(t, err)
+	events := make([]Event, 0, 5)
+	for iterator.Next() {
+		events = append(events, iterator.Event())
+	}
+	assert.NoError(t, iterator.Err())
+	assert.NoError(t, iterator.Close())
+	users := iterator.Users()
+	if assert.Len(t, users, 2, "users should be deduplicated") {
+		assert.Equal(t, User{Name: "Tester", Address: "Teststadt"}, *users[0])
+		assert.Equal(t, User{Name: "Klaus", Address: "Musterdorf"}, *users[1])
+	}
+	if assert.Len(t, events, 5) {
+		assert.Same(t, users[0], events[0].User)
+		assert.Same(t, users[1], events[4].User, "users should be resolved across files")
+		assert.Equal(t, int64(1634800000), events[4].Timestamp)
+	}
+	assert.False(t, iterator.Next(), "finished iterators should stay finished")
+}
+
+func TestEventIterator_merged(t *testing.T) {
+	Locations = map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}, "MOS": {Name: "Mosbach", Code: "MOS"}}
+	tempDir := t.TempDir()
+	tester := "*Tester\tTeststadt\n"
+	first := path.Join(tempDir, "first-20211020.txt")
+	second := path.Join(tempDir, "first-20211021.txt")
+	other := path.Join(tempDir, "other-20211020.txt")
+	require.NoError(t, ioutil.WriteFile(first, []byte(tester+"+HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1634700000\n"), 0660))
+	require.NoError(t, ioutil.WriteFile(second, []byte(tester+
+		"+HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1634800000\tcarried\t1634700000\n"+
+		"-HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1634800100\n"), 0660))
+	require.NoError(t, ioutil.WriteFile(other, []byte("*Klaus\tMusterdorf\n"+
+		"+O+Dig24BxOFwjJEN1oBbk/VW/tA=\tMOS\t1634600000\n"+
+		"-O+Dig24BxOFwjJEN1oBbk/VW/tA=\tMOS\t1634750000\n"+
+		"+O+Dig24BxOFwjJEN1oBbk/VW/tA=\tTST\t1634800000\n"), 0660))
+
+	iterator, err := NewMergedEventIterator(context.Background(), [][]string{{first, second}, {other}}, ReaderConfig{})
+	require.NoError(t, err)
+	timestamps := make([]int64, 0, 5)
+	names := make([]string, 0, 5)
+	for iterator.Next() {
+		timestamps = append(timestamps, iterator.Event().Timestamp)
+		names = append(names, iterator.Event().User.Name)
+	}
+	assert.NoError(t, iterator.Err())
+	assert.Equal(t, []int64{1634600000, 1634700000, 1634750000, 1634800000, 1634800100}, timestamps,
+		"the sources should be merged chronologically and carried logins should still be stitched together")
+	assert.Equal(t, []string{"Klaus", "Tester", "Klaus", "Klaus", "Tester"}, names)
+	assert.Len(t, iterator.Users(), 2)
+}
+
+func TestEventIterator_identities(t *testing.T) {
+	Locations = map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}}
+	tempDir := t.TempDir()
+	first := path.Join(tempDir, "20211020.txt")
+	second := path.Join(tempDir, "20211021.txt")
+	require.NoError(t, ioutil.WriteFile(first, []byte(retentionTestJournal), 0660))
+	variant := User{Name: " tester", Address: "TESTSTADT"}
+	require.NoError(t, ioutil.WriteFile(second, []byte(
+		"*"+variant.ToJournalLine()+"\n-"+util.Base64Encode(variant.lineHash())+"\tTST\t1634800000\n",
+	), 0660))
+
+	iterator, err := NewEventIterator(context.Background(), []string{first, second}, ReaderConfig{})
+	require.NoError(t, err)
+	var last Event
+	for iterator.Next() {
+		last = iterator.Event()
+	}
+	assert.NoError(t, iterator.Err())
+	if assert.Len(t, iterator.Users(), 2, "spellings of the same person should be deduplicated") {
+		assert.Same(t, iterator.Users()[0], last.User)
+		assert.Equal(t, "Tester", last.User.Name, "the first spelling should be kept")
+	}
+}
+
+func TestEventIterator_cancel(t *testing.T) {
+	Locations = map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}}
+	filePath := path.Join(t.TempDir(), "20211020.txt")
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(retentionTestJournal), 0660))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	iterator, err := NewEventIterator(ctx, []string{filePath}, ReaderConfig{})
+	require.NoError(t, err)
+	require.True(t, iterator.Next())
+	cancel()
+	assert.False(t, iterator.Next(), "cancelled iterators should stop")
+	assert.ErrorIs(t, iterator.Err(), context.Canceled)
+	for _, source := range iterator.sources {
+		assert.Nil(t, source.file, "the file should be closed after the cancellation")
+	}
+
+	iterator, err = NewEventIterator(context.Background(), []string{filePath, filePath}, ReaderConfig{})
+	require.NoError(t, err)
+	require.True(t, iterator.Next())
+	assert.NoError(t, iterator.Close(), "iterators should be closable early")
+	assert.NoError(t, iterator.Close(), "closing twice should be safe")
+}
+
+func TestEventIterator_errors(t *testing.T) {
+	tempDir := t.TempDir()
+	_, err := NewEventIterator(context.Background(), nil, ReaderConfig{EncryptionKey: []byte("short")})
+	assert.Error(t, err, "invalid keys should be rejected")
+
+	iterator, err := NewEventIterator(context.Background(), []string{path.Join(tempDir, "missing.txt")}, ReaderConfig{})
+	require.NoError(t, err)
+	assert.False(t, iterator.Next())
+	assert.Error(t, iterator.Err(), "missing files should be reported")
+
+	filePath := path.Join(tempDir, "20211020.txt")
+	require.NoError(t, ioutil.WriteFile(filePath, []byte("!encrypted\n"), 0660))
+	iterator, err = NewEventIterator(context.Background(), []string{filePath}, ReaderConfig{})
+	require.NoError(t, err)
+	assert.False(t, iterator.Next())
+	assert.Error(t, iterator.Err(), "encrypted journals can't be read without a key")
+	assert.Empty(t, iterator.Diagnostics(), "missing keys aren't a problem of the lines")
+
+	require.NoError(t, ioutil.WriteFile(filePath, []byte("@version=4\tids=sha1\n*Tester\tTeststadt\n"), 0660))
+	iterator, err = NewEventIterator(context.Background(), []string{filePath}, ReaderConfig{})
+	require.NoError(t, err)
+	assert.False(t, iterator.Next())
+	assert.ErrorIs(t, iterator.Err(), ErrUnsupportedVersion, "newer format versions can't be read")
+}
+
+func TestEventIterator_formatVersions(t *testing.T) {
+	Locations = map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}}
+	tempDir := t.TempDir()
+	legacy := path.Join(tempDir, "20211020.txt")
+	require.NoError(t, ioutil.WriteFile(legacy, []byte(retentionTestJournal), 0660))
+	current := path.Join(tempDir, "20211021.txt")
+	require.NoError(t, ioutil.WriteFile(current, []byte("@version=2\tids=hmac-sha256\tkey=abc\n"+
+		"*aWQ=\tTester\tTeststadt\n"+
+		"+aWQ=\tTST\t1634800000\n"), 0660))
+
+	journal, err := ReadJournalsWithConfig([]string{legacy, current}, ReaderConfig{Strict: true})
+	if assert.NoError(t, err, "journals of all versions should be read") && assert.Len(t, journal.GetEvents(), 5) {
+		assert.Same(t, journal.GetEvents()[0].User, journal.GetEvents()[4].User, "users should be identified across versions")
+	}
+}
+
+func TestEventIterator_invalidLines(t *testing.T) {
+	Locations = map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}}
+	filePath := path.Join(t.TempDir(), "20211020.txt")
+	require.NoError(t, ioutil.WriteFile(filePath, []byte("*Tester\tTeststadt\n"+
+		"*invalid\n"+
+		"+HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1634700000\n"+
+		"+O+Dig24BxOFwjJEN1oBbk/VW/tA=\tTST\t1634710000\n"+
+		"?unknown\n"+
+		"-HjLV+aPwKzq3szuae53Zv5n4puw=\tXXX\t1634711000\n"+
+		"-HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1634711000\n"), 0660))
+
+	iterator, err := NewEventIterator(context.Background(), []string{filePath}, ReaderConfig{})
+	require.NoError(t, err)
+	events := make([]Event, 0, 2)
+	for iterator.Next() {
+		events = append(events, iterator.Event())
+	}
+	assert.NoError(t, iterator.Err(), "invalid lines should be skipped in lenient mode")
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, int64(1634700000), events[0].Timestamp)
+		assert.Equal(t, int64(1634711000), events[1].Timestamp)
+		assert.NotNil(t, events[1].Location, "no zero-value events should be yielded")
+	}
+	diagnostics := iterator.Diagnostics()
+	if assert.Len(t, diagnostics, 4) {
+		assert.Equal(t, []int{2, 4, 5, 6}, []int{diagnostics[0].Line, diagnostics[1].Line, diagnostics[2].Line, diagnostics[3].Line})
+		assert.Equal(t, filePath, diagnostics[1].File)
+		assert.Equal(t, "+O+Dig24BxOFwjJEN1oBbk/VW/tA=\tTST\t1634710000", diagnostics[1].Raw)
+		assert.Contains(t, diagnostics[1].Reason.Error(), "couldn't resolve User hash")
+		assert.Contains(t, diagnostics[3].Error(), filePath+":6: couldn't resolve loc code")
+	}
+
+	iterator, err = NewEventIterator(context.Background(), []string{filePath}, ReaderConfig{Strict: true})
+	require.NoError(t, err)
+	assert.False(t, iterator.Next(), "invalid lines should stop reading in strict mode")
+	var lineError *LineError
+	if assert.ErrorAs(t, iterator.Err(), &lineError) {
+		assert.Equal(t, 2, lineError.Line)
+		assert.Equal(t, "*invalid", lineError.Raw)
+	}
+	assert.Empty(t, iterator.Diagnostics())
+
+	journal, err := ReadJournal(filePath)
+	if assert.NoError(t, err) {
+		assert.Len(t, journal.GetEvents(), 2)
+		assert.Len(t, journal.Diagnostics(), 4)
+	}
+	_, err = ReadJournalsWithConfig([]string{filePath}, ReaderConfig{Strict: true})
+	assert.ErrorAs(t, err, &lineError)
+}
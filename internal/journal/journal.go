@@ -5,40 +5,200 @@
 package journal
 
 import (
+	"errors"
 	"fmt"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
 	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"net/mail"
+	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type User struct {
-	Name    string
+	Name string
+	// Address is the address as free text, users that gave a structured address may have none
 	Address string
+	// Phone, Email and the structured address are optional, so that the users can be reached
+	Phone      string
+	Email      string
+	Street     string
+	PostalCode string
+	City       string
+}
+
+// userField is an optional field of the User in the journal format.
+type userField struct {
+	name  string
+	value *string
+}
+
+// optionalFields returns the optional fields of the User in the order they're written to the journal.
+func (user *User) optionalFields() []userField {
+	return []userField{
+		{"phone", &user.Phone},
+		{"email", &user.Email},
+		{"street", &user.Street},
+		{"postalcode", &user.PostalCode},
+		{"city", &user.City},
+	}
 }
 
 // ParseUserJournalLine parses the journal format of User data into a User struct.
+// The name and the address are followed by the optional fields in the format "name=value".
 func ParseUserJournalLine(line string) (User, error) {
-	parts := strings.SplitN(line, "\t", 3)
-	if len(parts) != 2 {
-		return User{}, fmt.Errorf("user line should contain exactly two fields")
+	parts := strings.Split(line, "\t")
+	if len(parts) < 2 {
+		return User{}, fmt.Errorf("user line should contain at least two fields")
 	}
 
-	return User{
+	user := User{
 		Name:    parts[0],
 		Address: parts[1],
-	}, nil
+	}
+	fields := user.optionalFields()
+	for _, part := range parts[2:] {
+		nameValue := strings.SplitN(part, "=", 2)
+		if len(nameValue) != 2 {
+			return User{}, fmt.Errorf("optional user field \"%s\" should have the form name=value", part)
+		}
+		known := false
+		for _, field := range fields {
+			if field.name == nameValue[0] {
+				*field.value = nameValue[1]
+				known = true
+			}
+		}
+		if !known {
+			return User{}, fmt.Errorf("unknown user field \"%s\"", nameValue[0])
+		}
+	}
+	return user, nil
 }
 
 // ToJournalLine converts the User to the journal format.
+// Empty optional fields are left out, so users without them have the same line as in older journals.
 func (user *User) ToJournalLine() string {
-	return fmt.Sprintf(
+	line := fmt.Sprintf(
 		"%s\t%s",
 		strings.ReplaceAll(user.Name, "\t", "    "),
 		strings.ReplaceAll(user.Address, "\t", "    "))
+	for _, field := range user.optionalFields() {
+		if *field.value != "" {
+			line += "\t" + field.name + "=" + strings.ReplaceAll(*field.value, "\t", "    ")
+		}
+	}
+	return line
 }
 
-// Hash creates the hash value for the user, e.g. used in journal files.
+// FullAddress returns the address of the User in one line.
+// Without free text address, it's put together from the structured address.
+func (user *User) FullAddress() string {
+	if user.Address != "" || (user.Street == "" && user.PostalCode == "" && user.City == "") {
+		return user.Address
+	}
+	parts := make([]string, 0, 2)
+	if user.Street != "" {
+		parts = append(parts, user.Street)
+	}
+	if city := strings.TrimSpace(user.PostalCode + " " + user.City); city != "" {
+		parts = append(parts, city)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ContactDetails returns the phone number and email address of the User in one line, if any.
+func (user *User) ContactDetails() string {
+	details := make([]string, 0, 2)
+	if user.Phone != "" {
+		details = append(details, user.Phone)
+	}
+	if user.Email != "" {
+		details = append(details, user.Email)
+	}
+	return strings.Join(details, ", ")
+}
+
+// MaxUserFieldLength is the maximum number of characters of each user field
+const MaxUserFieldLength = 100
+
+var (
+	phonePattern      = regexp.MustCompile(`^\+?[0-9 ()/-]{5,30}$`)
+	postalCodePattern = regexp.MustCompile(`^[0-9A-Za-z][0-9A-Za-z -]{1,9}$`)
+)
+
+// Validate checks the fields of the User before they are written to a journal, e.g. from the login form or an import.
+// Besides the name, the user must give a way to be reached: a complete address, a phone number or an email address.
+// The errors are shown to the user, so they don't repeat the (unescaped) input.
+func (user *User) Validate() error {
+	fields := []struct{ name, value string }{
+		{"name", user.Name}, {"address", user.Address}, {"phone number", user.Phone}, {"email address", user.Email},
+		{"street", user.Street}, {"postal code", user.PostalCode}, {"city", user.City},
+	}
+	for _, field := range fields {
+		if utf8.RuneCountInString(field.value) > MaxUserFieldLength {
+			return fmt.Errorf("the %s must not be longer than %d characters", field.name, MaxUserFieldLength)
+		}
+		if strings.IndexFunc(field.value, unicode.IsControl) >= 0 {
+			return fmt.Errorf("the %s must not contain control characters", field.name)
+		}
+	}
+	if user.Name == "" {
+		return errors.New("the name is required")
+	}
+	if user.Phone != "" && !phonePattern.MatchString(user.Phone) {
+		return errors.New("the phone number may only contain digits, spaces and the characters +()/-")
+	}
+	if user.Email != "" {
+		if address, err := mail.ParseAddress(user.Email); err != nil || address.Address != user.Email {
+			return errors.New("the email address is invalid")
+		}
+	}
+	if user.PostalCode != "" && !postalCodePattern.MatchString(user.PostalCode) {
+		return errors.New("the postal code is invalid")
+	}
+	structured := user.Street != "" || user.PostalCode != "" || user.City != ""
+	if structured && (user.Street == "" || user.PostalCode == "" || user.City == "") {
+		return errors.New("the address needs a street, a postal code and a city")
+	}
+	if !structured && user.Address == "" && user.Phone == "" && user.Email == "" {
+		return errors.New("an address, a phone number or an email address is required")
+	}
+	return nil
+}
+
+// NormalizeIdentity brings text into the canonical form used to identify persons:
+// Unicode NFC, runs of whitespace folded into single spaces, no leading or trailing whitespace and case folding.
+func NormalizeIdentity(text string) string {
+	text = strings.Join(strings.Fields(norm.NFC.String(text)), " ")
+	return norm.NFC.String(cases.Fold().String(text)) // a Caser isn't safe for concurrent use, so it's not shared
+}
+
+// Identity returns the canonical form of the User, see NormalizeIdentity.
+// Users with the same identity are the same person, regardless of how they typed their data.
+func (user *User) Identity() User {
+	identity := *user
+	identity.Name = NormalizeIdentity(identity.Name)
+	identity.Address = NormalizeIdentity(identity.Address)
+	for _, field := range identity.optionalFields() {
+		*field.value = NormalizeIdentity(*field.value)
+	}
+	return identity
+}
+
+// Hash creates the unkeyed hash value of the identity of the user.
+// It identifies users in journals with SHA1IDS and a header and is used to compare users across journals.
 func (user *User) Hash() []byte {
+	identity := user.Identity()
+	return util.HashString(identity.ToJournalLine())
+}
+
+// lineHash creates the hash value of the user data as it is.
+// Journals without header identify their users with it, so it must never change.
+func (user *User) lineHash() []byte {
 	return util.HashString(user.ToJournalLine())
 }
 
@@ -65,41 +225,173 @@ func (et EventType) Name() string {
 	}
 }
 
+// EventFlag marks an event with additional information about how it came to be.
+type EventFlag string
+
+const (
+	// NOFLAG is used for regular events.
+	NOFLAG EventFlag = ""
+	// CARRIED marks logins that were carried over from a previous journal file for users that are still present.
+	CARRIED EventFlag = "carried"
+	// AUTOMATIC marks logouts that were written automatically, e.g. after the maximum stay at a location.
+	AUTOMATIC EventFlag = "auto"
+	// REPAIRED marks events that were inserted by a journal repair, to pair orphaned events.
+	REPAIRED EventFlag = "repaired"
+)
+
+// ParseEventFlag parses the textual representation of an EventFlag.
+func ParseEventFlag(text string) (EventFlag, error) {
+	switch flag := EventFlag(text); flag {
+	case NOFLAG, CARRIED, AUTOMATIC, REPAIRED:
+		return flag, nil
+	default:
+		return NOFLAG, fmt.Errorf("unknown event flag \"%s\"", text)
+	}
+}
+
+// ErrUnknownUser is returned for events of a user hash that has no user line.
+var ErrUnknownUser = errors.New("unknown user")
+
+// ErrUnknownLocation is returned for events at a location code that is not in the locations.
+var ErrUnknownLocation = errors.New("unknown location")
+
 // Event is the representation of a User related event.
 type Event struct {
 	EventType EventType
 	User      *User
 	Location  *Location
 	Timestamp int64
+	Flag      EventFlag
+	// Since is the time of the original check-in of CARRIED logins, 0 if it's unknown
+	Since int64
+	// Deadline is the end of the stay of AUTOMATIC logouts, which are written after it, 0 if it's unknown
+	Deadline int64
+}
+
+// OccurredAt returns when the event took effect: the deadline of AUTOMATIC logouts, as the stay ended then,
+// and the timestamp otherwise.
+func (event *Event) OccurredAt() int64 {
+	if event.Flag == AUTOMATIC && event.Deadline != 0 {
+		return event.Deadline
+	}
+	return event.Timestamp
+}
+
+// Name returns a human-readable name for the event, which distinguishes automatic logouts from manual ones.
+func (event *Event) Name() string {
+	if event.EventType == LOGOUT && event.Flag == AUTOMATIC {
+		return "Automatic logout"
+	}
+	if event.Flag == REPAIRED {
+		return event.EventType.Name() + " (repaired)"
+	}
+	return event.EventType.Name()
+}
+
+// ParseEventName parses a human-readable event name, as returned by Event.Name, into the event type and flag.
+// The name is matched case-insensitively.
+func ParseEventName(name string) (EventType, EventFlag, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	flag := NOFLAG
+	if strings.HasSuffix(name, " (repaired)") {
+		name, flag = strings.TrimSuffix(name, " (repaired)"), REPAIRED
+	}
+	switch {
+	case name == "login":
+		return LOGIN, flag, nil
+	case name == "logout":
+		return LOGOUT, flag, nil
+	case name == "automatic logout" && flag == NOFLAG:
+		return LOGOUT, AUTOMATIC, nil
+	default:
+		return LOGIN, NOFLAG, fmt.Errorf("unknown event \"%s\"", name)
+	}
+}
+
+// FormatEventJournalLine creates the journal line for an event of the given user hash.
+func FormatEventJournalLine(eventType EventType, userHash string, location *Location, timestamp int64, flag EventFlag) string {
+	line := fmt.Sprintf("%s%s\t%s\t%d", eventType.ToString(), userHash, location.Code, timestamp)
+	if flag != NOFLAG {
+		line += "\t" + string(flag)
+	}
+	return line
+}
+
+// FormatCarriedLoginJournalLine creates the journal line for a login that is carried over to a new journal file.
+// The time of the original check-in is kept in an additional field, so that it survives the rotation.
+func FormatCarriedLoginJournalLine(userHash string, location *Location, timestamp int64, since int64) string {
+	return FormatEventJournalLine(LOGIN, userHash, location, timestamp, CARRIED) + "\t" + strconv.FormatInt(since, 10)
+}
+
+// FormatAutomaticLogoutJournalLine creates the journal line for an automatic logout of a user whose stay ended.
+// The logout is written at the current time, so that the journal stays in order,
+// and the deadline of the stay is kept in an additional field.
+func FormatAutomaticLogoutJournalLine(userHash string, location *Location, timestamp int64, deadline int64) string {
+	return FormatEventJournalLine(LOGOUT, userHash, location, timestamp, AUTOMATIC) + "\t" + strconv.FormatInt(deadline, 10)
+}
+
+// formatEventJournalLine creates the journal line for the event of the given user hash,
+// keeping the check-in time of carried logins and the deadline of automatic logouts.
+func formatEventJournalLine(event *Event, userHash string) string {
+	if event.Flag == CARRIED && event.Since != 0 {
+		return FormatCarriedLoginJournalLine(userHash, event.Location, event.Timestamp, event.Since)
+	}
+	if event.Flag == AUTOMATIC && event.Deadline != 0 {
+		return FormatAutomaticLogoutJournalLine(userHash, event.Location, event.Timestamp, event.Deadline)
+	}
+	return FormatEventJournalLine(event.EventType, userHash, event.Location, event.Timestamp, event.Flag)
 }
 
 // ParseEventJournalEntry parses the event data in journal format into an Event.
 // The "users" argument is used to look up the user hash in the known users.
 func ParseEventJournalEntry(eventType EventType, data string, users *map[string]*User) (Event, error) {
-	parts := strings.SplitN(data, "\t", 3)
+	parts := strings.SplitN(data, "\t", 5)
 	if len(parts) < 3 {
 		return Event{}, fmt.Errorf("event data does not contain enough fields")
 	}
+	flag := NOFLAG
+	if len(parts) > 3 {
+		var err error
+		if flag, err = ParseEventFlag(parts[3]); err != nil {
+			return Event{}, fmt.Errorf("failed to parse event flag: %w", err)
+		}
+	}
+	since, deadline := int64(0), int64(0)
+	if len(parts) > 4 { // the check-in time of carried logins or the deadline of automatic logouts
+		value, err := strconv.ParseInt(parts[4], 10, 64)
+		switch {
+		case err == nil && flag == CARRIED && eventType == LOGIN:
+			since = value
+		case err == nil && flag == AUTOMATIC && eventType == LOGOUT:
+			deadline = value
+		default:
+			return Event{}, fmt.Errorf("invalid additional field \"%s\", "+
+				"only carried logins and automatic logouts have one", parts[4])
+		}
+	}
 	hash, err := util.Base64Decode(parts[0])
 	if err != nil {
 		return Event{}, fmt.Errorf("failed to decode user hash")
 	}
 	user, exists := (*users)[string(hash)]
 	if !exists {
-		return Event{}, fmt.Errorf("couldn't resolve User hash \"%s\" in event data", parts[0])
+		return Event{}, fmt.Errorf("couldn't resolve User hash \"%s\" in event data: %w", parts[0], ErrUnknownUser)
 	}
 	loc, exists := Locations[parts[1]]
 	if !exists {
-		return Event{}, fmt.Errorf("couldn't resolve loc code \"%s\"", parts[1])
+		return Event{}, fmt.Errorf("couldn't resolve loc code \"%s\": %w", parts[1], ErrUnknownLocation)
 	}
 	unixSeconds, err2 := strconv.ParseInt(parts[2], 10, 64)
 	if err2 != nil {
-		return Event{}, fmt.Errorf("failed to parse event timestamp \"%s\": %w", parts[1], err2)
+		return Event{}, fmt.Errorf("failed to parse event timestamp \"%s\": %w", parts[2], err2)
 	}
 	return Event{
 		EventType: eventType,
 		User:      user,
 		Location:  loc,
 		Timestamp: unixSeconds,
+		Flag:      flag,
+		Since:     since,
+		Deadline:  deadline,
 	}, nil
 }
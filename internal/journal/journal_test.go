@@ -5,9 +5,9 @@
 package journal
 
 import (
-	"fmt"
 	"github.com/stretchr/testify/assert"
 	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"strings"
 	"testing"
 )
 
@@ -19,6 +19,10 @@ func TestParseUserJournalLine(t *testing.T) {
 		{"Hello\tWorld", User{Name: "Hello", Address: "World"}},
 		{"  Spacey  \t  Address  ", User{Name: "  Spacey  ", Address: "  Address  "}},
 		{"\t", User{Name: "", Address: ""}},
+		{"Erika\t\tphone=+49 123\temail=erika@example.org\tstreet=Beispielweg 1\tpostalcode=12345\tcity=Teststadt", User{
+			Name: "Erika", Phone: "+49 123", Email: "erika@example.org", Street: "Beispielweg 1", PostalCode: "12345", City: "Teststadt",
+		}},
+		{"Hello\tWorld\tcity=a=b", User{Name: "Hello", Address: "World", City: "a=b"}},
 	}
 
 	for _, entry := range simpleData {
@@ -29,12 +33,12 @@ func TestParseUserJournalLine(t *testing.T) {
 	}
 
 	errorData := []string{
-		"Hello World", "Hello\tWorld\t!",
+		"Hello World", "Hello\tWorld\t!", "Hello\tWorld\tfax=123",
 	}
 
 	for _, entry := range errorData {
 		_, err := ParseUserJournalLine(entry)
-		assert.Errorf(t, err, "\"%s\" does not have the correct amount of tab separators and should fail", entry)
+		assert.Errorf(t, err, "\"%s\" should fail because of its fields", entry)
 	}
 }
 
@@ -46,6 +50,7 @@ func TestUser_ToJournalLine(t *testing.T) {
 		{User{Name: "Frank", Address: "Leipzig"}, "Frank\tLeipzig"},
 		{User{Name: "", Address: ""}, "\t"},
 		{User{Name: "\t", Address: "\t"}, "    \t    "},
+		{User{Name: "Erika", Email: "erika@example.org", City: "Test\tstadt"}, "Erika\t\temail=erika@example.org\tcity=Test    stadt"},
 	}
 
 	for _, entry := range data {
@@ -53,6 +58,67 @@ func TestUser_ToJournalLine(t *testing.T) {
 	}
 }
 
+func TestUser_FullAddress(t *testing.T) {
+	assert.Equal(t, "Leipzig", (&User{Address: "Leipzig", City: "Teststadt"}).FullAddress(), "free text addresses come first")
+	assert.Equal(t, "Beispielweg 1, 12345 Teststadt", (&User{Street: "Beispielweg 1", PostalCode: "12345", City: "Teststadt"}).FullAddress())
+	assert.Equal(t, "Teststadt", (&User{City: "Teststadt"}).FullAddress())
+	assert.Equal(t, "", (&User{Name: "Frank"}).FullAddress())
+}
+
+func TestUser_ContactDetails(t *testing.T) {
+	assert.Equal(t, "+49 123, erika@example.org", (&User{Phone: "+49 123", Email: "erika@example.org"}).ContactDetails())
+	assert.Equal(t, "erika@example.org", (&User{Email: "erika@example.org"}).ContactDetails())
+	assert.Equal(t, "", (&User{Name: "Frank"}).ContactDetails())
+}
+
+func TestUser_Validate(t *testing.T) {
+	valid := []User{
+		{Name: "Tester", Address: "Teststadt"},
+		{Name: "Erika", Street: "Beispielweg 1", PostalCode: "74821", City: "Mosbach"},
+		{Name: "Erika", Phone: "+49 (6261) 123-45"},
+		{Name: "Erika", Email: "erika@example.org"},
+	}
+	for _, user := range valid {
+		assert.NoError(t, user.Validate(), "%#v should be valid", user)
+	}
+
+	invalid := []User{
+		{Address: "Teststadt"},
+		{Name: "Tester"},
+		{Name: "Erika", Street: "Beispielweg 1"},
+		{Name: "Erika", Street: "Beispielweg 1", PostalCode: "#1", City: "Mosbach"},
+		{Name: "Erika", Phone: "call me"},
+		{Name: "Erika", Email: "erika"},
+		{Name: "Erika", Email: "Erika <erika@example.org>"},
+		{Name: "Erika\x00", Email: "erika@example.org"},
+		{Name: strings.Repeat("E", MaxUserFieldLength+1), Email: "erika@example.org"},
+	}
+	for _, user := range invalid {
+		assert.Error(t, user.Validate(), "%#v should be invalid", user)
+	}
+}
+
+func TestNormalizeIdentity(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "klaus müller", NormalizeIdentity("Klaus Müller"))
+	assert.Equal(t, "klaus müller", NormalizeIdentity(" klaus\t müller "), "whitespace should be folded")
+	assert.Equal(t, "klaus müller", NormalizeIdentity("KLAUS MU\u0308LLER"), "decomposed characters should be composed")
+	assert.Equal(t, "strasse 1", NormalizeIdentity("Straße\u00a01"))
+	assert.Equal(t, "", NormalizeIdentity("  "))
+}
+
+func TestUser_Identity(t *testing.T) {
+	t.Parallel()
+	user := User{Name: "Klaus Müller", Address: "Musterdorf", Email: "Klaus@Example.com"}
+	variant := User{Name: " klaus  mu\u0308ller", Address: "MUSTERDORF ", Email: "klaus@example.com"}
+	assert.Equal(t, User{Name: "klaus müller", Address: "musterdorf", Email: "klaus@example.com"}, user.Identity())
+	assert.Equal(t, user.Identity(), variant.Identity())
+	assert.Equal(t, user.Hash(), variant.Hash(), "the same person should always hash the same")
+	assert.NotEqual(t, user.lineHash(), variant.lineHash(), "the user data of legacy IDs must not be normalised")
+	assert.NotEqual(t, user.Hash(), (&User{Name: "Klaus Mueller", Address: "Musterdorf"}).Hash())
+	assert.Equal(t, "Klaus Müller", user.Name, "the user data should be kept as it is")
+}
+
 func TestParseEventJournalEntry(t *testing.T) {
 	users := make(map[string]*User, 10)
 	Locations = map[string]*Location{
@@ -77,10 +143,23 @@ func TestParseEventJournalEntry(t *testing.T) {
 			hash:  hash2,
 			event: Event{EventType: LOGIN, Location: Locations["TST"], User: user2, Timestamp: 0},
 		},
+		{
+			hash:  hash2,
+			event: Event{EventType: LOGIN, Location: Locations["TST"], User: user2, Timestamp: 10, Flag: CARRIED},
+		},
+		{
+			hash:  hash2,
+			event: Event{EventType: LOGIN, Location: Locations["TST"], User: user2, Timestamp: 10, Flag: CARRIED, Since: 5},
+		},
+		{
+			hash:  hash2,
+			event: Event{EventType: LOGOUT, Location: Locations["TST"], User: user2, Timestamp: 20, Flag: AUTOMATIC, Deadline: 15},
+		},
 	}
 
 	for _, entry := range validData {
-		data := fmt.Sprintf("%s\t%s\t%d", util.Base64Encode(entry.hash), entry.event.Location.Code, entry.event.Timestamp)
+		line := formatEventJournalLine(&entry.event, util.Base64Encode(entry.hash))
+		data := line[1:]
 		event, err := ParseEventJournalEntry(entry.event.EventType, data, &users)
 		if assert.NoErrorf(t, err, "failed to parse correct journal entry with %v and %s", entry.event.EventType, data) {
 			assert.Equal(t, entry.event, event, "failed to correctly parse journal entry")
@@ -98,6 +177,11 @@ func TestParseEventJournalEntry(t *testing.T) {
 		{LOGIN, util.Base64Encode(hash1) + "\tTST\te", "parsing an invalid timestamp should fail"},
 		{LOGIN, util.Base64Encode(hash1) + "\tTST\t0\ttest", "too many fields should fail"},
 		{LOGIN, util.Base64Encode(hash1) + "\tXYZ\t", "unknown location should fail"},
+		{LOGIN, util.Base64Encode(hash1) + "\tTST\t10\tcarried\tx", "an invalid check-in time should fail"},
+		{LOGIN, util.Base64Encode(hash1) + "\tTST\t10\trepaired\t5", "only carried logins should have a check-in time"},
+		{LOGOUT, util.Base64Encode(hash1) + "\tTST\t10\tcarried\t5", "only carried logins should have a check-in time"},
+		{LOGOUT, util.Base64Encode(hash1) + "\tTST\t10\tauto\tx", "an invalid deadline should fail"},
+		{LOGIN, util.Base64Encode(hash1) + "\tTST\t10\tauto\t5", "only automatic logouts should have a deadline"},
 		{LOGIN, util.Base64Encode(hash1) + "\tTST", "not enough fields should fail"},
 		{LOGIN, util.Base64Encode([]byte("12345678901234567890")) + "\tTST\t0", "parsing an unknown user hash should fail"},
 	}
@@ -113,3 +197,39 @@ func AddUserEntry(users map[string]*User, user *User) ([]byte, *User) {
 	users[string(hash)] = user
 	return hash, user
 }
+
+func TestEvent_OccurredAt(t *testing.T) {
+	logout := Event{EventType: LOGOUT, Timestamp: 20, Flag: AUTOMATIC, Deadline: 15}
+	assert.Equal(t, int64(15), logout.OccurredAt(), "automatic logouts take effect at the deadline")
+	logout.Deadline = 0
+	assert.Equal(t, int64(20), logout.OccurredAt(), "logouts without deadline take effect when they were written")
+	login := Event{EventType: LOGIN, Timestamp: 20, Flag: CARRIED, Since: 15}
+	assert.Equal(t, int64(20), login.OccurredAt())
+}
+
+func TestParseEventName(t *testing.T) {
+	t.Parallel()
+	events := []Event{
+		{EventType: LOGIN},
+		{EventType: LOGOUT},
+		{EventType: LOGOUT, Flag: AUTOMATIC},
+		{EventType: LOGIN, Flag: REPAIRED},
+		{EventType: LOGOUT, Flag: REPAIRED},
+	}
+	for _, event := range events {
+		eventType, flag, err := ParseEventName(event.Name())
+		if assert.NoError(t, err, "the names of events should be parsable") {
+			assert.Equal(t, event.EventType, eventType)
+			assert.Equal(t, event.Flag, flag)
+		}
+	}
+	eventType, flag, err := ParseEventName("  LOGOUT ")
+	if assert.NoError(t, err, "names should be parsed leniently") {
+		assert.Equal(t, EventType(LOGOUT), eventType)
+		assert.Equal(t, NOFLAG, flag)
+	}
+	_, _, err = ParseEventName("Checkout")
+	assert.Error(t, err)
+	_, _, err = ParseEventName("Automatic logout (repaired)")
+	assert.Error(t, err)
+}
@@ -0,0 +1,95 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// WriteNotification describes a user or an event that was written to the journal.
+type WriteNotification struct {
+	// UserID identifies the user in the journal, see Writer.UserID
+	UserID string
+	// User is the user's data, it may be nil for events of users whose data isn't known
+	User *User
+	// Event is the written event, nil if the notification is about newly written user data
+	Event *Event
+}
+
+// Listener is called for every user and event written to the journal, see Writer.AddListener.
+type Listener func(notification WriteNotification)
+
+// AddListener registers a listener that is called synchronously for every user and event written to the journal.
+// The listeners are called in the order of the journal lines while the journal is locked,
+// so they must return quickly and must not use the Writer. Slow listeners should use Subscribe instead.
+// Records that are carried over to a new journal file on rotation aren't delivered again.
+// The returned function removes the listener.
+func (writer *Writer) AddListener(listener Listener) func() {
+	writer.outputLock.Lock()
+	defer writer.outputLock.Unlock()
+	if writer.listeners == nil {
+		writer.listeners = make(map[int]Listener, 10)
+	}
+	id := writer.nextListenerID
+	writer.nextListenerID++
+	writer.listeners[id] = listener
+	return func() {
+		writer.outputLock.Lock()
+		defer writer.outputLock.Unlock()
+		delete(writer.listeners, id)
+	}
+}
+
+// notifyLocked delivers the notification to all listeners. The outputLock must be held by the caller.
+func (writer *Writer) notifyLocked(notification WriteNotification) {
+	for _, listener := range writer.listeners {
+		listener(notification)
+	}
+}
+
+// Subscription delivers the notifications of a Writer through a buffered channel, see Writer.Subscribe.
+type Subscription struct {
+	// C receives the notifications in the order of the journal lines, it's closed by Close
+	C <-chan WriteNotification
+	// channel is the sending side of C
+	channel chan WriteNotification
+	// dropped counts the notifications that didn't fit into the buffer
+	dropped uint64
+	// remove removes the listener of the subscription from the writer
+	remove func()
+	// closeOnce makes Close safe to call multiple times
+	closeOnce sync.Once
+}
+
+// Subscribe creates a Subscription that receives every user and event written to the journal through a channel
+// with the given buffer size.
+// Writing to the journal never waits for the subscriber: notifications that don't fit into the buffer are dropped,
+// see Subscription.Dropped.
+func (writer *Writer) Subscribe(buffer int) *Subscription {
+	channel := make(chan WriteNotification, buffer)
+	subscription := Subscription{C: channel, channel: channel}
+	subscription.remove = writer.AddListener(func(notification WriteNotification) {
+		select {
+		case channel <- notification:
+		default:
+			atomic.AddUint64(&subscription.dropped, 1)
+		}
+	})
+	return &subscription
+}
+
+// Dropped returns the number of notifications that were dropped because the buffer was full.
+func (subscription *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&subscription.dropped)
+}
+
+// Close ends the subscription and closes its channel, it's safe to call it multiple times.
+func (subscription *Subscription) Close() {
+	subscription.closeOnce.Do(func() {
+		subscription.remove() // no notification is sent after the listener is removed
+		close(subscription.channel)
+	})
+}
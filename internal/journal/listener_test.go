@@ -0,0 +1,107 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriter_AddListener(t *testing.T) {
+	location := &Location{Name: "Teststadt", Code: "TST"}
+	user := User{Name: "Tester", Address: "Teststadt"}
+	writer, err := NewWriter(t.TempDir())
+	require.NoError(t, err)
+	defer func() { _ = writer.Close() }()
+
+	notifications := make([]WriteNotification, 0, 5)
+	remove := writer.AddListener(func(notification WriteNotification) {
+		notifications = append(notifications, notification)
+	})
+	require.NoError(t, writer.WriteEventUser(&user, location, LOGIN))
+	require.NoError(t, writer.WriteEventUser(&user, location, LOGOUT))
+	if assert.Len(t, notifications, 3, "the user and both events should be delivered") {
+		hash := writer.UserID(&user)
+		assert.Equal(t, WriteNotification{UserID: hash, User: &user}, notifications[0])
+		assert.Equal(t, hash, notifications[1].UserID)
+		assert.Equal(t, user, *notifications[1].User)
+		if assert.NotNil(t, notifications[1].Event) {
+			assert.Equal(t, LOGIN, notifications[1].Event.EventType)
+			assert.Equal(t, location, notifications[1].Event.Location)
+			assert.Equal(t, NOFLAG, notifications[1].Event.Flag)
+			assert.InDelta(t, time.Now().Unix(), notifications[1].Event.Timestamp, 5)
+		}
+		if assert.NotNil(t, notifications[2].Event) {
+			assert.Equal(t, EventType(LOGOUT), notifications[2].Event.EventType)
+		}
+	}
+
+	remove()
+	require.NoError(t, writer.WriteEventUser(&user, location, LOGIN))
+	assert.Len(t, notifications, 3, "removed listeners should not be called anymore")
+}
+
+func TestWriter_Subscribe(t *testing.T) {
+	location := &Location{Name: "Teststadt", Code: "TST"}
+	writer, err := NewWriter(t.TempDir())
+	require.NoError(t, err)
+	defer func() { _ = writer.Close() }()
+
+	slow := writer.Subscribe(2)
+	fast := writer.Subscribe(100)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, writer.WriteEventUser(&User{Name: "Tester", Address: "Teststadt"}, location, LOGIN))
+			assert.NoError(t, writer.WriteEventUser(&User{Name: "Tester", Address: "Teststadt"}, location, LOGOUT))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a subscriber that doesn't read should never block the writer")
+	}
+
+	assert.Equal(t, uint64(19), slow.Dropped(), "notifications that don't fit into the buffer should be dropped")
+	assert.Equal(t, uint64(0), fast.Dropped())
+	slow.Close()
+	received := make([]WriteNotification, 0, 2)
+	for notification := range slow.C {
+		received = append(received, notification)
+	}
+	if assert.Len(t, received, 2, "the buffered notifications should be received before the channel is closed") {
+		assert.Nil(t, received[0].Event, "the oldest notifications should be kept")
+		assert.Equal(t, LOGIN, received[1].Event.EventType)
+	}
+	assert.Len(t, fast.C, 21)
+	slow.Close()
+	fast.Close()
+}
+
+func TestSubscription_concurrentClose(t *testing.T) {
+	location := &Location{Name: "Teststadt", Code: "TST"}
+	writer, err := NewWriter(t.TempDir())
+	require.NoError(t, err)
+	defer func() { _ = writer.Close() }()
+
+	wait := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		subscription := writer.Subscribe(1)
+		wait.Add(2)
+		go func() {
+			defer wait.Done()
+			_ = writer.WriteEventUser(&User{Name: "Tester", Address: "Teststadt"}, location, LOGIN)
+		}()
+		go func() {
+			defer wait.Done()
+			subscription.Close()
+		}()
+	}
+	wait.Wait()
+}
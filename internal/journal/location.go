@@ -9,6 +9,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
+	"time"
 )
 
 var Locations map[string]*Location
@@ -18,8 +20,15 @@ type Location struct {
 	XMLName xml.Name `xml:"location"`
 	Name    string   `xml:"name,attr"`
 	Code    string   `xml:"code,attr"`
+	// MaxStay optionally limits how long users may stay checked in, as duration like "8h30m"
+	MaxStay string `xml:"max-stay,attr,omitempty"`
+	// Closes is the optional local time of day ("15:04") at which all users get checked out
+	Closes string `xml:"closes,attr,omitempty"`
 }
 
+// closingTimeFormat is the format of the Location.Closes attribute.
+const closingTimeFormat = "15:04"
+
 type locationsXML struct {
 	XMLName   xml.Name   `xml:"locations"`
 	Locations []Location `xml:"location"`
@@ -48,14 +57,77 @@ func ReadLocations(path string) (eror error) {
 	Locations = map[string]*Location{}
 
 	for i, location := range l.Locations {
+		if err := location.validate(); err != nil {
+			return fmt.Errorf("invalid location \"%s\": %w", location.Code, err)
+		}
 		Locations[location.Code] = &l.Locations[i]
 	}
 	return nil
 }
 
+// WriteLocations writes the locations to an XML file that can be read with ReadLocations, ordered by their codes.
+func WriteLocations(path string, locations map[string]*Location) error {
+	codes := make([]string, 0, len(locations))
+	for code := range locations {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	l := locationsXML{Locations: make([]Location, len(codes))}
+	for i, code := range codes {
+		l.Locations[i] = *locations[code]
+	}
+	content, err := xml.MarshalIndent(l, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to encode locations: %w", err)
+	}
+	if err := ioutil.WriteFile(path, append(content, '\n'), os.FileMode(FileCreationPermissions)); err != nil {
+		return fmt.Errorf("failed to write Location XML file: %w", err)
+	}
+	return nil
+}
+
+// validate checks that the optional attributes of the location can be parsed.
+func (location *Location) validate() error {
+	if location.MaxStay != "" {
+		if _, err := time.ParseDuration(location.MaxStay); err != nil {
+			return fmt.Errorf("invalid maximum stay \"%s\": %w", location.MaxStay, err)
+		}
+	}
+	if location.Closes != "" {
+		if _, err := time.Parse(closingTimeFormat, location.Closes); err != nil {
+			return fmt.Errorf("invalid closing time \"%s\": %w", location.Closes, err)
+		}
+	}
+	return nil
+}
+
+// GetMaxStay returns the maximum duration users may stay at the location, or 0 if there is no limit.
+func (location *Location) GetMaxStay() time.Duration {
+	maxStay, err := time.ParseDuration(location.MaxStay)
+	if err != nil {
+		return 0
+	}
+	return maxStay
+}
+
+// GetNextClosingTime returns the first closing time of the location after the given time.
+// The second return value is false if the location has no closing time.
+func (location *Location) GetNextClosingTime(after time.Time) (time.Time, bool) {
+	closes, err := time.Parse(closingTimeFormat, location.Closes)
+	if err != nil {
+		return time.Time{}, false
+	}
+	after = after.In(time.Local)
+	closing := time.Date(after.Year(), after.Month(), after.Day(), closes.Hour(), closes.Minute(), 0, 0, time.Local)
+	if !closing.After(after) {
+		closing = time.Date(after.Year(), after.Month(), after.Day()+1, closes.Hour(), closes.Minute(), 0, 0, time.Local)
+	}
+	return closing, true
+}
+
 /*
 <locations>
 	<location name="Mosbach" code="MOS"></location>
-	<location name="Bad Mergentheim" code="MGH"></location>
+	<location name="Bad Mergentheim" code="MGH" max-stay="8h" closes="22:00"></location>
 </locations>
 */
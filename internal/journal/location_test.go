@@ -12,6 +12,7 @@ import (
 	"os"
 	"path"
 	"testing"
+	"time"
 )
 
 func TestReadLocations(t *testing.T) {
@@ -54,3 +55,50 @@ func TestReadLocations(t *testing.T) {
 	assert.Equal(t, expectedLocationMGH.Code, Locations["MGH"].Code)
 
 }
+
+func TestWriteLocations(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "locations.xml")
+	locations := map[string]*Location{
+		"TST": {Name: "Teststadt", Code: "TST", MaxStay: "1h"},
+		"HST": {Name: "Hauptstadt", Code: "HST", Closes: "22:00"},
+	}
+	require.NoError(t, WriteLocations(filePath, locations))
+	require.NoError(t, ReadLocations(filePath))
+	assert.Len(t, Locations, 2)
+	for code, location := range locations {
+		if assert.Contains(t, Locations, code) {
+			read := *Locations[code]
+			read.XMLName = location.XMLName
+			assert.Equal(t, *location, read, "the written locations should be read again")
+		}
+	}
+
+	assert.Error(t, WriteLocations(path.Join(filePath, "locations.xml"), locations))
+}
+
+func TestLocation_validate(t *testing.T) {
+	assert.NoError(t, (&Location{Code: "MOS"}).validate())
+	assert.NoError(t, (&Location{Code: "MOS", MaxStay: "8h30m", Closes: "22:00"}).validate())
+	assert.Error(t, (&Location{Code: "MOS", MaxStay: "8 hours"}).validate(), "invalid durations should fail")
+	assert.Error(t, (&Location{Code: "MOS", Closes: "10pm"}).validate(), "invalid closing times should fail")
+}
+
+func TestLocation_GetMaxStay(t *testing.T) {
+	assert.Equal(t, time.Duration(0), (&Location{}).GetMaxStay())
+	assert.Equal(t, 90*time.Minute, (&Location{MaxStay: "1h30m"}).GetMaxStay())
+}
+
+func TestLocation_GetNextClosingTime(t *testing.T) {
+	_, exists := (&Location{}).GetNextClosingTime(time.Now())
+	assert.False(t, exists, "locations without closing time should report so")
+
+	location := Location{Closes: "22:00"}
+	closing, exists := location.GetNextClosingTime(time.Date(2021, time.October, 20, 8, 0, 0, 0, time.Local))
+	if assert.True(t, exists) {
+		assert.Equal(t, time.Date(2021, time.October, 20, 22, 0, 0, 0, time.Local), closing)
+	}
+	closing, exists = location.GetNextClosingTime(time.Date(2021, time.October, 20, 22, 0, 0, 0, time.Local))
+	if assert.True(t, exists) {
+		assert.Equal(t, time.Date(2021, time.October, 21, 22, 0, 0, 0, time.Local), closing, "closing time should be in the future")
+	}
+}
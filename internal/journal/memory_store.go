@@ -0,0 +1,175 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"fmt"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps all data in memory, it's mainly intended for tests.
+type MemoryStore struct {
+	// lock is a mutex for using the store in a thread-safe way
+	lock sync.Mutex
+	// users maps the user hashes to the known users
+	users map[string]*User
+	// locations maps the user hashes to the current location of the users, if they are checked in
+	locations map[string]*Location
+	// checkIns maps the user hashes to the unix timestamp of the last check-in of the users
+	checkIns map[string]int64
+	// events are the stored events in chronological order
+	events []Event
+}
+
+// NewMemoryStore creates a new, empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:     make(map[string]*User, 100),
+		locations: make(map[string]*Location, 100),
+		checkIns:  make(map[string]int64, 100),
+		events:    make([]Event, 0, 1000),
+	}
+}
+
+// WriteUserIfUnknown stores the given User data if it's not already known.
+func (store *MemoryStore) WriteUserIfUnknown(user *User) (string, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.writeUserLocked(user), nil
+}
+
+// writeUserLocked stores the given User data if it's not already known and returns the user hash.
+// The lock must be held by the caller.
+func (store *MemoryStore) writeUserLocked(user *User) string {
+	hash := util.Base64Encode(user.Hash())
+	if _, exists := store.users[hash]; !exists {
+		userCopy := *user
+		store.users[hash] = &userCopy
+	}
+	return hash
+}
+
+// WriteEventUserHash stores an event with the given type for the known user with the given hash.
+func (store *MemoryStore) WriteEventUserHash(userHash string, location *Location, eventType EventType) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.writeEventLocked(userHash, location, eventType)
+}
+
+// writeEventLocked stores an event with the given type for the known user and updates the user's location.
+// The lock must be held by the caller.
+func (store *MemoryStore) writeEventLocked(userHash string, location *Location, eventType EventType) error {
+	user, exists := store.users[userHash]
+	if !exists {
+		return fmt.Errorf("writing a user hash for an unkown user is not allowed")
+	}
+	now := time.Now().UTC().Unix()
+	store.events = append(store.events, Event{
+		EventType: eventType,
+		User:      user,
+		Location:  location,
+		Timestamp: now,
+	})
+	switch eventType {
+	case LOGIN:
+		store.locations[userHash] = location
+		store.checkIns[userHash] = now
+	case LOGOUT:
+		delete(store.locations, userHash)
+	}
+	return nil
+}
+
+// WriteEventUser stores an event with the given type for the User, storing the User data first if it's unknown.
+func (store *MemoryStore) WriteEventUser(user *User, location *Location, eventType EventType) error {
+	hash, err := store.WriteUserIfUnknown(user)
+	if err != nil {
+		return err
+	}
+	return store.WriteEventUserHash(hash, location, eventType)
+}
+
+// LoginIfNotPresent atomically checks the User in at the location, unless the User is already checked in somewhere.
+func (store *MemoryStore) LoginIfNotPresent(user *User, location *Location) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	hash := store.writeUserLocked(user)
+	if current, present := store.locations[hash]; present {
+		return fmt.Errorf("%w at \"%s\"", ErrAlreadyPresent, current.Code)
+	}
+	return store.writeEventLocked(hash, location, LOGIN)
+}
+
+// LogoutIfPresent atomically checks the User out of the location, if the User is checked in there.
+func (store *MemoryStore) LogoutIfPresent(user *User, location *Location) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	hash := util.Base64Encode(user.Hash())
+	if current, present := store.locations[hash]; !present || current != location {
+		return ErrNotPresent
+	}
+	return store.writeEventLocked(hash, location, LOGOUT)
+}
+
+// UserID returns the ID that identifies the User in the store.
+func (store *MemoryStore) UserID(user *User) string {
+	return util.Base64Encode(user.Hash())
+}
+
+// GetCurrentUserLocation returns the location where the given user is currently checked in, if any.
+func (store *MemoryStore) GetCurrentUserLocation(hash string) (*Location, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if _, exists := store.users[hash]; !exists {
+		return nil, fmt.Errorf("unkown user hash \"%s\"", hash)
+	}
+	return store.locations[hash], nil
+}
+
+// PresentUsers lists the users that are currently checked in at the location, ordered by their check-in time.
+// A nil location lists the users of all locations, ordered by location code first.
+func (store *MemoryStore) PresentUsers(location *Location) []PresentUser {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	users := make([]PresentUser, 0, len(store.locations))
+	for hash, current := range store.locations {
+		if location != nil && current != location {
+			continue
+		}
+		users = append(users, PresentUser{
+			UserID:   hash,
+			User:     store.users[hash],
+			Location: current,
+			Since:    time.Unix(store.checkIns[hash], 0),
+		})
+	}
+	sortPresentUsers(users)
+	return users
+}
+
+// Occupancy counts the users that are currently checked in per location, locations without users are left out.
+func (store *MemoryStore) Occupancy() map[*Location]int {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	occupancy := make(map[*Location]int, len(Locations))
+	for _, current := range store.locations {
+		occupancy[current]++
+	}
+	return occupancy
+}
+
+// ReadEvents returns the stored events in the inclusive time range, zero times leave the range open.
+func (store *MemoryStore) ReadEvents(from time.Time, to time.Time) ([]Event, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return filterEvents(store.events, from, to), nil
+}
+
+// Close does nothing, the data of a MemoryStore is lost once it's no longer referenced.
+func (store *MemoryStore) Close() error {
+	return nil
+}
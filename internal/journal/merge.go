@@ -0,0 +1,140 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"fmt"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"sort"
+)
+
+// LocationConflict describes a location code that refers to different locations in merged journals.
+type LocationConflict struct {
+	Code string
+	// Names are the different names of the location, in the order of the merged journals
+	Names []string
+}
+
+func (conflict *LocationConflict) String() string {
+	return fmt.Sprintf("location code \"%s\" refers to different locations: %q", conflict.Code, conflict.Names)
+}
+
+// MergeJournals combines journals, e.g. of several server instances, into a single Journal.
+// Users are deduplicated by their hash and the events are ordered chronologically,
+// keeping the order of events that happened in the same second.
+// The events keep referring to the locations of their journals, see MergeLocations for conflicts of their codes.
+func MergeJournals(journals ...Journal) Journal {
+	merged := newJournal()
+	for _, journal := range journals {
+		for hash, user := range journal.users {
+			if _, exists := merged.users[hash]; !exists {
+				merged.users[hash] = user
+			}
+		}
+		for _, event := range journal.events {
+			event.User = merged.users[string(event.User.Hash())]
+			merged.events = append(merged.events, event)
+		}
+		merged.diagnostics = append(merged.diagnostics, journal.diagnostics...)
+	}
+	// The sort must be stable to retain the order of events that happened in the same second
+	sort.SliceStable(merged.events, func(i, j int) bool {
+		return merged.events[i].Timestamp < merged.events[j].Timestamp
+	})
+	return merged
+}
+
+// MergeLocations combines the locations of several server instances, e.g. for the locations file of merged journals.
+// Every code keeps its first location, codes that refer to locations with different names are reported as conflicts.
+func MergeLocations(locationSets ...map[string]*Location) (map[string]*Location, []LocationConflict) {
+	merged := make(map[string]*Location, 20)
+	conflicts := make(map[string]*LocationConflict, 5)
+	conflictCodes := make([]string, 0, 5)
+	for _, locations := range locationSets {
+		codes := make([]string, 0, len(locations))
+		for code := range locations {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes) // map iteration isn't deterministic, but the conflicts should be
+		for _, code := range codes {
+			location := locations[code]
+			known, exists := merged[code]
+			if !exists {
+				merged[code] = location
+				continue
+			}
+			if known.Name == location.Name {
+				continue
+			}
+			conflict, exists := conflicts[code]
+			if !exists {
+				conflict = &LocationConflict{Code: code, Names: []string{known.Name}}
+				conflicts[code] = conflict
+				conflictCodes = append(conflictCodes, code)
+			}
+			if !containsName(conflict.Names, location.Name) {
+				conflict.Names = append(conflict.Names, location.Name)
+			}
+		}
+	}
+
+	conflictList := make([]LocationConflict, len(conflictCodes))
+	for i, code := range conflictCodes {
+		conflictList[i] = *conflicts[code]
+	}
+	return merged, conflictList
+}
+
+// containsName checks whether the name is one of the given names.
+func containsName(names []string, name string) bool {
+	for _, existing := range names {
+		if existing == name {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteFile writes the journal to a journal file that can be read with ReadJournal.
+// Every user line is written right before the first event of the user, users without events are written last.
+// The user IDs, the encryption and the hash chain are set up like the Writer does with the config.
+func (journal *Journal) WriteFile(filePath string, config WriterConfig) error {
+	ids, err := NewUserIDs(config.UserIDKey)
+	if err != nil {
+		return fmt.Errorf("failed to set up user IDs: %w", err)
+	}
+	var cipher *Cipher
+	if len(config.EncryptionKey) > 0 {
+		if cipher, err = NewCipher(config.EncryptionKey); err != nil {
+			return fmt.Errorf("failed to set up journal encryption: %w", err)
+		}
+	}
+
+	header := ids.Header()
+	lines := make([]string, 0, len(journal.users)+len(journal.events)+1)
+	lines = append(lines, string(headerRecord)+header.ToJournalLine())
+	written := make(map[*User]bool, len(journal.users))
+	for _, event := range journal.events {
+		id := ids.ID(event.User)
+		if !written[event.User] {
+			lines = append(lines, "*"+header.FormatUserLine(event.User, id))
+			written[event.User] = true
+		}
+		lines = append(lines, formatEventJournalLine(&event, util.Base64Encode(id)))
+	}
+	remaining := make([]string, 0, len(journal.users)-len(written))
+	for _, user := range journal.users {
+		if !written[user] {
+			remaining = append(remaining, "*"+header.FormatUserLine(user, ids.ID(user)))
+		}
+	}
+	sort.Strings(remaining) // map iteration isn't deterministic
+	lines = append(lines, remaining...)
+
+	if err := writeJournalLines(filePath, lines, config.ChainKey, cipher); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+)
+
+// readMergeTestJournal reads a journal with the given content and locations, like those of a server instance.
+func readMergeTestJournal(t *testing.T, content string, locations map[string]*Location) Journal {
+	Locations = locations
+	filePath := path.Join(t.TempDir(), "20211020.txt")
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(content), 0660))
+	journal, err := ReadJournal(filePath)
+	require.NoError(t, err)
+	return journal
+}
+
+func TestMergeJournals(t *testing.T) {
+	first := readMergeTestJournal(t, "*Tester\tTeststadt\n"+
+		"+HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1000\n"+
+		"*Klaus\tMusterdorf\n"+
+		"+O+Dig24BxOFwjJEN1oBbk/VW/tA=\tHST\t1500\n"+
+		"-HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t2000\n",
+		map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}, "HST": {Name: "Hauptstadt", Code: "HST"}})
+	second := readMergeTestJournal(t, "*Tester\tTeststadt\n"+
+		"*Unused\tNowhere\n"+
+		"+HjLV+aPwKzq3szuae53Zv5n4puw=\tHST\t1500\n"+
+		"-HjLV+aPwKzq3szuae53Zv5n4puw=\tHST\t1800\n",
+		map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}, "HST": {Name: "Hafenstadt", Code: "HST"}})
+
+	merged := MergeJournals(first, second)
+	assert.Len(t, merged.users, 3, "users should be deduplicated by their hash")
+	events := merged.GetEvents()
+	if assert.Len(t, events, 5) {
+		timestamps := make([]int64, len(events))
+		for i, event := range events {
+			timestamps[i] = event.Timestamp
+		}
+		assert.Equal(t, []int64{1000, 1500, 1500, 1800, 2000}, timestamps)
+		assert.Equal(t, "Klaus", events[1].User.Name, "events of the same second should keep their order")
+		assert.Same(t, events[0].User, events[2].User, "events should refer to the merged users")
+	}
+	assert.Equal(t, "Hafenstadt", events[2].Location.Name, "events should keep the locations of their journals")
+}
+
+func TestJournal_WriteFile(t *testing.T) {
+	locations := map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}, "HST": {Name: "Hauptstadt", Code: "HST"}}
+	first := readMergeTestJournal(t, "*Tester\tTeststadt\n"+
+		"+HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1000\n"+
+		"-HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t2000\tauto\n", locations)
+	second := readMergeTestJournal(t, "*Unused\tNowhere\n"+
+		"*Klaus\tMusterdorf\n"+
+		"+O+Dig24BxOFwjJEN1oBbk/VW/tA=\tHST\t1500\n", locations)
+	merged := MergeJournals(first, second)
+
+	filePath := path.Join(t.TempDir(), "merged.txt")
+	require.NoError(t, merged.WriteFile(filePath, WriterConfig{}))
+	content, err := ioutil.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, "@version=3\tids=sha1\n"+
+		"*kAOyAjh9O9h8/CwwYfxACLXmpok=\tTester\tTeststadt\n"+
+		"+kAOyAjh9O9h8/CwwYfxACLXmpok=\tTST\t1000\n"+
+		"*KNC1gzqZjhz5jymW5PbTisSm8aw=\tKlaus\tMusterdorf\n"+
+		"+KNC1gzqZjhz5jymW5PbTisSm8aw=\tHST\t1500\n"+
+		"-kAOyAjh9O9h8/CwwYfxACLXmpok=\tTST\t2000\tauto\n"+
+		"*sIN3ZORzlUv1ruFUvFKEgW5f4oo=\tUnused\tNowhere\n", string(content))
+
+	journal, err := ReadJournal(filePath)
+	if assert.NoError(t, err, "written journals should be readable") {
+		assert.Equal(t, merged.GetEvents(), journal.GetEvents())
+		assert.Empty(t, journal.Diagnostics())
+	}
+
+	securedPath := path.Join(t.TempDir(), "secured.txt")
+	config := WriterConfig{ChainKey: []byte("secret"), EncryptionKey: testEncryptionKey, UserIDKey: testUserIDKey}
+	require.NoError(t, merged.WriteFile(securedPath, config))
+	lines, err := VerifyChain([]byte("secret"), securedPath)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 7, lines, "the header should be written")
+	}
+	secured, err := ioutil.ReadFile(securedPath)
+	if assert.NoError(t, err) {
+		assert.False(t, strings.Contains(string(secured), "Tester"), "the journal should be encrypted")
+	}
+	journal, err = ReadJournalsWithConfig([]string{securedPath}, ReaderConfig{EncryptionKey: testEncryptionKey})
+	if assert.NoError(t, err, "journals with keyed user IDs should be readable") {
+		assert.Equal(t, merged.GetEvents(), journal.GetEvents())
+	}
+	assert.Error(t, merged.WriteFile(securedPath, WriterConfig{EncryptionKey: []byte("short")}))
+	assert.Error(t, merged.WriteFile(securedPath, WriterConfig{UserIDKey: []byte("short")}))
+}
+
+func TestMergeLocations(t *testing.T) {
+	teststadt := &Location{Name: "Teststadt", Code: "TST"}
+	campus := &Location{Name: "Campus", Code: "CMP"}
+	merged, conflicts := MergeLocations(
+		map[string]*Location{"TST": teststadt, "HST": {Name: "Hauptstadt", Code: "HST"}},
+		map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}, "CMP": campus, "HST": {Name: "Hafenstadt", Code: "HST"}},
+	)
+	assert.Equal(t, []LocationConflict{{Code: "HST", Names: []string{"Hauptstadt", "Hafenstadt"}}}, conflicts)
+	assert.Equal(t, `location code "HST" refers to different locations: ["Hauptstadt" "Hafenstadt"]`, conflicts[0].String())
+	assert.Len(t, merged, 3)
+	assert.Same(t, teststadt, merged["TST"], "the first location of a code should be kept")
+	assert.Same(t, campus, merged["CMP"], "locations of only one instance should be kept")
+}
@@ -0,0 +1,86 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"fmt"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"strings"
+)
+
+// MigrateJournal upgrades a journal file to the CurrentFormatVersion with the user IDs of the UserIDKey of the config,
+// see WriterConfig. The IDs are derived again from the user data in the journal, which is kept like the events.
+// The lines are encrypted and sealed in a new hash chain with the keys of the config, like the Writer does.
+// It returns false if the journal already has the current format and the configured user IDs, the file isn't touched then.
+// Keyed user IDs are never replaced by unkeyed ones.
+func MigrateJournal(filePath string, config WriterConfig) (bool, error) {
+	ids, err := NewUserIDs(config.UserIDKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to set up user IDs: %w", err)
+	}
+	var cipher *Cipher
+	if len(config.EncryptionKey) > 0 {
+		if cipher, err = NewCipher(config.EncryptionKey); err != nil {
+			return false, fmt.Errorf("failed to set up journal encryption: %w", err)
+		}
+	}
+	lines, err := readDecodedLines(filePath, cipher)
+	if err != nil {
+		return false, err
+	}
+
+	header := LegacyHeader
+	wanted := ids.Header()
+	output := make([]string, 0, len(lines)+1)
+	output = append(output, string(headerRecord)+wanted.ToJournalLine())
+	migratedIDs := make(map[string]string, 100) // maps the encoded IDs in the journal to the encoded new IDs
+	for i, line := range lines {
+		switch line[0] {
+		case headerRecord:
+			if i != 0 {
+				return false, fmt.Errorf("the header of journal file %s isn't the first line", filePath)
+			}
+			if header, err = ParseHeaderLine(line[1:]); err != nil {
+				return false, fmt.Errorf("failed to parse the header of journal file %s: %w", filePath, err)
+			}
+			if header.sameFormat(wanted) {
+				return false, nil
+			}
+			// the links to the previous and the next journal stay with the journal
+			wanted.PreviousMAC, wanted.ReplacedMAC = header.PreviousMAC, header.ReplacedMAC
+			output[0] = string(headerRecord) + wanted.ToJournalLine()
+			if header.IDs == HMACIDS && wanted.IDs != HMACIDS { // unkeyed IDs would reveal the users again
+				return false, fmt.Errorf("journal file %s has keyed user IDs, but no user ID key is given", filePath)
+			}
+		case '*':
+			user, id, err := header.ParseUserLine(line[1:])
+			if err != nil {
+				return false, fmt.Errorf("failed to parse user line \"%s\": %w", line, err)
+			}
+			newID := ids.ID(&user)
+			migratedIDs[util.Base64Encode(id)] = util.Base64Encode(newID)
+			output = append(output, "*"+wanted.FormatUserLine(&user, newID))
+		case uint8(LOGIN), uint8(LOGOUT):
+			parts := strings.SplitN(line[1:], "\t", 2)
+			if len(parts) != 2 {
+				return false, fmt.Errorf("failed to parse event line \"%s\"", line)
+			}
+			newID, exists := migratedIDs[parts[0]]
+			if !exists { // without the user data, there's nothing to derive the new ID from
+				return false, fmt.Errorf("event line \"%s\" belongs to an unknown user, repair the journal first", line)
+			}
+			output = append(output, line[:1]+newID+"\t"+parts[1])
+		default:
+			return false, fmt.Errorf("unknown journal line \"%s\"", line)
+		}
+	}
+	if output, err = keepChainEnd(filePath, output); err != nil {
+		return false, err
+	}
+	if err := writeJournalLines(filePath, output, config.ChainKey, cipher); err != nil {
+		return false, fmt.Errorf("failed to replace journal with migrated journal: %w", err)
+	}
+	return true, nil
+}
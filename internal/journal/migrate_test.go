@@ -0,0 +1,102 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestMigrateJournal(t *testing.T) {
+	Locations = map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}}
+	filePath := path.Join(t.TempDir(), "journal.txt")
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(retentionTestJournal), 0660))
+	legacy, err := ReadJournal(filePath)
+	require.NoError(t, err)
+
+	config := WriterConfig{UserIDKey: testUserIDKey}
+	migrated, err := MigrateJournal(filePath, config)
+	if assert.NoError(t, err) {
+		assert.True(t, migrated)
+	}
+	content, err := ioutil.ReadFile(filePath)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if assert.Len(t, lines, 7, "a header should be added") {
+		assert.True(t, strings.HasPrefix(lines[0], "@version=3\tids=hmac-sha256\t"), "unexpected header \"%s\"", lines[0])
+		assert.True(t, strings.HasSuffix(lines[1], "\tTester\tTeststadt"), "the user data should be kept")
+	}
+	assert.NotContains(t, string(content), "HjLV+aPwKzq3szuae53Zv5n4puw=", "unkeyed IDs should be replaced")
+	journal, err := ReadJournal(filePath)
+	if assert.NoError(t, err, "migrated journals should be readable") {
+		assert.Equal(t, legacy.GetEvents(), journal.GetEvents())
+	}
+
+	migrated, err = MigrateJournal(filePath, config)
+	if assert.NoError(t, err) {
+		assert.False(t, migrated, "journals with the configured IDs should be skipped")
+	}
+	unchanged, err := ioutil.ReadFile(filePath)
+	if assert.NoError(t, err) {
+		assert.Equal(t, content, unchanged)
+	}
+
+	rekeyed := WriterConfig{UserIDKey: []byte("anotherkeyofthirtytwobyteslength"), ChainKey: []byte("secret"), EncryptionKey: testEncryptionKey}
+	migrated, err = MigrateJournal(filePath, rekeyed)
+	if assert.NoError(t, err) {
+		assert.True(t, migrated, "journals should be migrated to other keys")
+	}
+	chained, err := VerifyChain(rekeyed.ChainKey, filePath)
+	if assert.NoError(t, err, "migrated journals should be sealed in a new chain") {
+		assert.Equal(t, 7, chained)
+	}
+	journal, err = ReadJournalsWithConfig([]string{filePath}, ReaderConfig{EncryptionKey: testEncryptionKey})
+	if assert.NoError(t, err, "migrated journals should be encrypted") {
+		assert.Equal(t, legacy.GetEvents(), journal.GetEvents())
+	}
+}
+
+func TestMigrateJournal_invalid(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+	_, err := MigrateJournal(path.Join(tempDir, "missing.txt"), WriterConfig{UserIDKey: testUserIDKey})
+	assert.Error(t, err)
+
+	filePath := path.Join(tempDir, "journal.txt")
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(retentionTestJournal), 0660))
+	_, err = MigrateJournal(filePath, WriterConfig{UserIDKey: []byte("short")})
+	assert.Error(t, err, "the user ID key must be valid")
+	_, err = MigrateJournal(filePath, WriterConfig{UserIDKey: testUserIDKey})
+	require.NoError(t, err)
+	_, err = MigrateJournal(filePath, WriterConfig{})
+	assert.Error(t, err, "keyed IDs must not be replaced by unkeyed IDs")
+
+	require.NoError(t, ioutil.WriteFile(filePath, []byte("+HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1634700000\n"), 0660))
+	_, err = MigrateJournal(filePath, WriterConfig{UserIDKey: testUserIDKey})
+	assert.Error(t, err, "events of unknown users can't be migrated")
+}
+
+func TestMigrateJournal_unkeyed(t *testing.T) {
+	Locations = map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}}
+	filePath := path.Join(t.TempDir(), "journal.txt")
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(retentionTestJournal), 0660))
+
+	migrated, err := MigrateJournal(filePath, WriterConfig{})
+	if assert.NoError(t, err) {
+		assert.True(t, migrated, "old journals should be upgraded to the current format")
+	}
+	content, err := ioutil.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(content), "@version=3\tids=sha1\n*kAOyAjh9O9h8/CwwYfxACLXmpok=\tTester\tTeststadt\n"),
+		"the unkeyed IDs should be derived from the identities")
+	migrated, err = MigrateJournal(filePath, WriterConfig{})
+	if assert.NoError(t, err) {
+		assert.False(t, migrated)
+	}
+}
@@ -0,0 +1,69 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"sort"
+	"time"
+)
+
+// PresentUser is a user that is currently checked in at a location.
+type PresentUser struct {
+	// UserID identifies the user in the store, see Store.UserID
+	UserID string
+	// User is the user's data, it may be nil if only the user's ID is known
+	User *User
+	// Location is where the user is checked in
+	Location *Location
+	// Since is the time of the user's check-in
+	Since time.Time
+}
+
+// sortPresentUsers orders the present users by location code and check-in time.
+func sortPresentUsers(users []PresentUser) {
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Location.Code != users[j].Location.Code {
+			return users[i].Location.Code < users[j].Location.Code
+		}
+		if !users[i].Since.Equal(users[j].Since) {
+			return users[i].Since.Before(users[j].Since)
+		}
+		return users[i].UserID < users[j].UserID
+	})
+}
+
+// PresentUsers lists the users that are currently checked in at the location, ordered by their check-in time.
+// A nil location lists the users of all locations, ordered by location code first.
+func (writer *Writer) PresentUsers(location *Location) []PresentUser {
+	writer.outputLock.Lock()
+	defer writer.outputLock.Unlock()
+	users := make([]PresentUser, 0, 10)
+	for hash, userPresence := range writer.knownUsers {
+		if userPresence.location == nil || (location != nil && userPresence.location != location) {
+			continue
+		}
+		users = append(users, PresentUser{
+			UserID:   hash,
+			User:     userPresence.user,
+			Location: userPresence.location,
+			Since:    time.Unix(userPresence.since, 0),
+		})
+	}
+	sortPresentUsers(users)
+	return users
+}
+
+// Occupancy counts the users that are currently checked in per location, locations without users are left out.
+func (writer *Writer) Occupancy() map[*Location]int {
+	writer.outputLock.Lock()
+	defer writer.outputLock.Unlock()
+	occupancy := make(map[*Location]int, len(Locations))
+	for _, userPresence := range writer.knownUsers {
+		if userPresence.location != nil {
+			occupancy[userPresence.location]++
+		}
+	}
+	return occupancy
+}
@@ -5,64 +5,165 @@
 package journal
 
 import (
-	"bufio"
+	"context"
 	"fmt"
-	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
-	"log"
 	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
 )
 
 // Journal is a read-only representation of a journal file.
+// It keeps all events in memory, use an EventIterator to process large journals.
 type Journal struct {
-	users  map[string]*User
-	events []Event
+	// users maps the hashes of the user data (see User.Hash) to the users, regardless of their IDs in the journal files
+	users       map[string]*User
+	events      []Event
+	diagnostics []LineError
 }
 
 // ReadJournal reads in a Journal from a journal file.
+// Invalid lines are skipped, see Journal.Diagnostics.
 func ReadJournal(filepath string) (Journal, error) {
-	if isFile, err := util.FileExists(filepath); err != nil || !isFile {
-		return Journal{}, fmt.Errorf("\"%s\" is not a valid file (%w)", filepath, err)
+	journal := newJournal()
+	err := journal.readFiles([]string{filepath}, ReaderConfig{})
+	return journal, err
+}
+
+// NewJournalFromEvents creates a Journal from events that weren't read from a journal file, e.g. imported ones.
+// The events are ordered chronologically, keeping the order of events that happened in the same second.
+func NewJournalFromEvents(events []Event) Journal {
+	journal := newJournal()
+	for _, event := range events {
+		hash := string(event.User.Hash())
+		if user, exists := journal.users[hash]; exists {
+			event.User = user // equal users are deduplicated
+		} else {
+			journal.users[hash] = event.User
+		}
+		journal.events = append(journal.events, event)
 	}
-	file, err := os.OpenFile(filepath, os.O_RDONLY, 0777)
-	defer func() { _ = file.Close() }()
+	sort.SliceStable(journal.events, func(i, j int) bool {
+		return journal.events[i].Timestamp < journal.events[j].Timestamp
+	})
+	return journal
+}
+
+// ReaderConfig holds the optional settings for reading journals.
+type ReaderConfig struct {
+	// EncryptionKey is the key to decrypt encrypted journal records with
+	EncryptionKey []byte
+	// Strict stops reading at the first invalid line with a LineError, otherwise invalid lines are skipped
+	Strict bool
+}
+
+// ReadJournals reads in multiple journal files and merges them into a single Journal.
+// Users are deduplicated across all files and the events are ordered chronologically.
+func ReadJournals(filepaths []string) (Journal, error) {
+	return ReadJournalsWithConfig(filepaths, ReaderConfig{})
+}
+
+// ReadJournalsWithConfig reads in multiple journal files like ReadJournals, using the given optional settings.
+func ReadJournalsWithConfig(filepaths []string, config ReaderConfig) (Journal, error) {
+	journal := newJournal()
+	if err := journal.readFiles(filepaths, config); err != nil {
+		return journal, err
+	}
+	// The sort must be stable to retain the order of events that happened in the same second
+	sort.SliceStable(journal.events, func(i, j int) bool {
+		return journal.events[i].Timestamp < journal.events[j].Timestamp
+	})
+	return journal, nil
+}
+
+// ListJournalFiles lists the journal files of all rotation periods in the given directory in chronological order.
+// Compressed journals are listed instead of uncompressed journals of the same name.
+// Only journals that overlap the inclusive date range from "from" to "to" are listed, zero times leave the range open.
+func ListJournalFiles(directory string, from time.Time, to time.Time) ([]string, error) {
+	entries, err := os.ReadDir(directory)
 	if err != nil {
-		return Journal{}, fmt.Errorf("failed to open journal file %s: %w", filepath, err)
+		return nil, fmt.Errorf("failed to list journal directory \"%s\": %w", directory, err)
 	}
-	journal := Journal{
-		users:  make(map[string]*User, 100),
-		events: make([]Event, 0, 1000),
+	if !from.IsZero() {
+		from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.Local)
 	}
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		switch line[0] {
-		case '*':
-			user, err := ParseUserJournalLine(line[1:])
-			if err != nil {
-				return journal, fmt.Errorf("failed to read journal User line \"%s\": %w", line, err)
-			}
-			journal.users[string(user.Hash())] = &user
-		case uint8(LOGIN), uint8(LOGOUT):
-			entry, err := ParseEventJournalEntry(EventType(line[0]), line[1:], &journal.users)
-			if err != nil {
-				log.Printf("Failed to parse journal line \"%s\": %#v", line, err)
+	if !to.IsZero() { // the end of the day
+		to = time.Date(to.Year(), to.Month(), to.Day()+1, 0, 0, 0, 0, time.Local)
+	}
+
+	type journalFile struct {
+		name     JournalName
+		filePath string
+	}
+	journalFiles := make([]journalFile, 0, len(entries))
+	indices := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		name, err := ParseJournalName(entry.Name())
+		if entry.IsDir() || err != nil { // not a journal file
+			continue
+		}
+		if (!from.IsZero() && !name.End().After(from)) || (!to.IsZero() && !name.Start.Before(to)) {
+			continue
+		}
+		filePath := path.Join(directory, entry.Name())
+		uncompressed := strings.TrimSuffix(entry.Name(), compressedFileExtension)
+		if index, exists := indices[uncompressed]; exists {
+			if IsCompressedJournal(filePath) { // the compressed journal replaces its uncompressed leftover
+				journalFiles[index].filePath = filePath
 			}
-			journal.events = append(journal.events, entry)
+			continue
 		}
+		indices[uncompressed] = len(journalFiles)
+		journalFiles = append(journalFiles, journalFile{name: name, filePath: filePath})
 	}
-	return journal, nil
+	// the names of each period already sort chronologically, but directories may mix periods
+	sort.SliceStable(journalFiles, func(i, j int) bool {
+		if !journalFiles[i].name.Start.Equal(journalFiles[j].name.Start) {
+			return journalFiles[i].name.Start.Before(journalFiles[j].name.Start)
+		}
+		return journalFiles[i].name.Part < journalFiles[j].name.Part
+	})
+
+	files := make([]string, len(journalFiles))
+	for i, file := range journalFiles {
+		files[i] = file.filePath
+	}
+	return files, nil
+}
+
+// newJournal creates a new, empty Journal.
+func newJournal() Journal {
+	return Journal{
+		users:  make(map[string]*User, 100),
+		events: make([]Event, 0, 1000),
+	}
+}
+
+// readFiles reads the given journal files and adds their users and events to the Journal.
+func (journal *Journal) readFiles(filepaths []string, config ReaderConfig) error {
+	iterator, err := NewEventIterator(context.Background(), filepaths, config)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = iterator.Close() }()
+	for iterator.Next() {
+		journal.events = append(journal.events, iterator.Event())
+	}
+	for _, user := range iterator.Users() {
+		journal.users[string(user.Hash())] = user
+	}
+	journal.diagnostics = iterator.Diagnostics()
+	return iterator.Err()
 }
 
 // GetUsers provides a way to iterate over all known users.
 func (journal *Journal) GetUsers() <-chan *User {
-	out := make(chan *User)
-
-	go func() {
-		for _, user := range journal.users {
-			out <- user
-		}
-		close(out)
-	}()
+	out := make(chan *User, len(journal.users)) // buffered, so that no routine is needed to fill it
+	for _, user := range journal.users {
+		out <- user
+	}
+	close(out)
 	return out
 }
 
@@ -70,3 +171,8 @@ func (journal *Journal) GetUsers() <-chan *User {
 func (journal *Journal) GetEvents() []Event {
 	return journal.events
 }
+
+// Diagnostics returns the invalid lines that were skipped while reading the journal.
+func (journal *Journal) Diagnostics() []LineError {
+	return journal.diagnostics
+}
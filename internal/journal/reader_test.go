@@ -12,6 +12,7 @@ import (
 	"os"
 	"path"
 	"testing"
+	"time"
 )
 
 func TestReadJournal(t *testing.T) {
@@ -32,9 +33,9 @@ func TestReadJournal(t *testing.T) {
 	}
 
 	user1 := User{Name: "JLA", Address: "Mosbach"}
-	hash1 := util.Base64Encode(user1.Hash())
+	hash1 := util.Base64Encode(user1.lineHash())
 	user2 := User{Name: "Tester", Address: "Goland"}
-	hash2 := util.Base64Encode(user2.Hash())
+	hash2 := util.Base64Encode(user2.lineHash())
 
 	_ = util.WriteString(file, fmt.Sprintf("*%s\t%s\n", user1.Name, user1.Address))
 	_ = util.WriteString(file, fmt.Sprintf("+%s\tMOS\t0\n", hash1))
@@ -55,10 +56,10 @@ func TestReadJournal(t *testing.T) {
 		assert.Equal(t, user2, *readUser2, "readUser1 2 is read incorrectly")
 
 		assert.Equal(t, []Event{
-			{LOGIN, readUser1, Locations["MOS"], 0},
-			{LOGIN, readUser2, Locations["TST"], 20},
-			{LOGOUT, readUser1, Locations["MOS"], 10},
-			{LOGOUT, readUser2, Locations["TST"], 30},
+			{LOGIN, readUser1, Locations["MOS"], 0, NOFLAG, 0, 0},
+			{LOGIN, readUser2, Locations["TST"], 20, NOFLAG, 0, 0},
+			{LOGOUT, readUser1, Locations["MOS"], 10, NOFLAG, 0, 0},
+			{LOGOUT, readUser2, Locations["TST"], 30, NOFLAG, 0, 0},
 		}, journal.events, "events are read incorrectly")
 	}
 }
@@ -91,3 +92,179 @@ func TestJournal_GetUsers(t *testing.T) {
 		}
 	}
 }
+
+func TestReadJournals(t *testing.T) {
+	tempDir := t.TempDir()
+
+	Locations = map[string]*Location{
+		"MOS": {Name: "Mosbach", Code: "MOS"},
+		"TST": {Name: "Testbach", Code: "TST"},
+	}
+
+	user1 := User{Name: "JLA", Address: "Mosbach"}
+	hash1 := util.Base64Encode(user1.lineHash())
+	user2 := User{Name: "Tester", Address: "Goland"}
+	hash2 := util.Base64Encode(user2.lineHash())
+
+	day1 := path.Join(tempDir, "20211020.txt")
+	require.NoError(t, os.WriteFile(day1, []byte(fmt.Sprintf(
+		"*%s\t%s\n+%s\tMOS\t100\n-%s\tMOS\t200\n",
+		user1.Name, user1.Address, hash1, hash1,
+	)), 0777), "internal error: failed to write test journal")
+	day2 := path.Join(tempDir, "20211021.txt")
+	require.NoError(t, os.WriteFile(day2, []byte(fmt.Sprintf(
+		"*%s\t%s\n+%s\tTST\t300\n*%s\t%s\n+%s\tTST\t150\n",
+		user2.Name, user2.Address, hash2, user1.Name, user1.Address, hash1,
+	)), 0777), "internal error: failed to write test journal")
+
+	journal, err := ReadJournals([]string{day1, day2})
+	if assert.NoError(t, err, "valid journal files failed reading") {
+		require.Equal(t, 2, len(journal.users), "users should be deduplicated across files")
+		readUser1 := journal.users[string(user1.Hash())]
+		readUser2 := journal.users[string(user2.Hash())]
+		assert.Equal(t, []Event{
+			{LOGIN, readUser1, Locations["MOS"], 100, NOFLAG, 0, 0},
+			{LOGIN, readUser1, Locations["TST"], 150, NOFLAG, 0, 0},
+			{LOGOUT, readUser1, Locations["MOS"], 200, NOFLAG, 0, 0},
+			{LOGIN, readUser2, Locations["TST"], 300, NOFLAG, 0, 0},
+		}, journal.events, "events should be merged chronologically")
+	}
+
+	_, err = ReadJournals([]string{day1, path.Join(tempDir, "missing.txt")})
+	assert.Error(t, err, "missing journal files should fail the read in")
+}
+
+func TestReadJournals_carriedLogins(t *testing.T) {
+	tempDir := t.TempDir()
+
+	Locations = map[string]*Location{
+		"MOS": {Name: "Mosbach", Code: "MOS"},
+	}
+
+	user := User{Name: "JLA", Address: "Mosbach"}
+	hash := util.Base64Encode(user.lineHash())
+
+	day1 := path.Join(tempDir, "20211020.txt")
+	require.NoError(t, os.WriteFile(day1, []byte(fmt.Sprintf(
+		"*%s\t%s\n+%s\tMOS\t100\n", user.Name, user.Address, hash,
+	)), 0777), "internal error: failed to write test journal")
+	day2 := path.Join(tempDir, "20211021.txt")
+	require.NoError(t, os.WriteFile(day2, []byte(fmt.Sprintf(
+		"*%s\t%s\n+%s\tMOS\t200\tcarried\n-%s\tMOS\t300\n", user.Name, user.Address, hash, hash,
+	)), 0777), "internal error: failed to write test journal")
+
+	journal, err := ReadJournals([]string{day1, day2})
+	if assert.NoError(t, err, "valid journal files failed reading") {
+		readUser := journal.users[string(user.Hash())]
+		assert.Equal(t, []Event{
+			{LOGIN, readUser, Locations["MOS"], 100, NOFLAG, 0, 0},
+			{LOGOUT, readUser, Locations["MOS"], 300, NOFLAG, 0, 0},
+		}, journal.events, "carried logins should be stitched to the original session")
+	}
+
+	journal, err = ReadJournal(day2)
+	if assert.NoError(t, err, "valid journal file failed reading") {
+		readUser := journal.users[string(user.Hash())]
+		assert.Equal(t, []Event{
+			{LOGIN, readUser, Locations["MOS"], 200, CARRIED, 0, 0},
+			{LOGOUT, readUser, Locations["MOS"], 300, NOFLAG, 0, 0},
+		}, journal.events, "carried logins without a previous session should act as logins")
+	}
+}
+
+func TestListJournalFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"20211021.txt", "20211019.txt", "20211020.txt", "notes.txt", "20211022.csv"} {
+		require.NoError(t, os.WriteFile(path.Join(tempDir, name), []byte{}, 0777), "internal error: failed to create file")
+	}
+	require.NoError(t, os.Mkdir(path.Join(tempDir, "20211023.txt"), 0777), "internal error: failed to create directory")
+
+	files, err := ListJournalFiles(tempDir, time.Time{}, time.Time{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{
+			path.Join(tempDir, "20211019.txt"),
+			path.Join(tempDir, "20211020.txt"),
+			path.Join(tempDir, "20211021.txt"),
+		}, files)
+	}
+
+	from := time.Date(2021, time.October, 20, 15, 0, 0, 0, time.Local)
+	to := time.Date(2021, time.October, 21, 8, 0, 0, 0, time.Local)
+	files, err = ListJournalFiles(tempDir, from, to)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{path.Join(tempDir, "20211020.txt"), path.Join(tempDir, "20211021.txt")}, files)
+	}
+
+	files, err = ListJournalFiles(tempDir, to, time.Time{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{path.Join(tempDir, "20211021.txt")}, files)
+	}
+
+	_, err = ListJournalFiles(path.Join(tempDir, "missing"), time.Time{}, time.Time{})
+	assert.Error(t, err, "listing a missing directory should fail")
+
+	for _, name := range []string{"20211020.txt.gz", "20211024.txt.gz", "20211025.csv.gz"} {
+		require.NoError(t, os.WriteFile(path.Join(tempDir, name), []byte{}, 0777), "internal error: failed to create file")
+	}
+	files, err = ListJournalFiles(tempDir, from, time.Time{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{
+			path.Join(tempDir, "20211020.txt.gz"),
+			path.Join(tempDir, "20211021.txt"),
+			path.Join(tempDir, "20211024.txt.gz"),
+		}, files, "compressed journals should be listed instead of their uncompressed leftovers")
+	}
+}
+
+func TestListJournalFiles_rotation(t *testing.T) {
+	tempDir := t.TempDir()
+	names := []string{
+		"20211020_002.txt", "20211020.txt", "20211020_010.txt", "20211021-23.txt", "20211021-09_002.txt",
+		"20211021-09.txt", "2021-W43.txt", "2021-W42.txt", "20211024.txt", "20211020-24.txt", "2021-W54.txt",
+	}
+	for _, name := range names {
+		require.NoError(t, os.WriteFile(path.Join(tempDir, name), []byte{}, 0777), "internal error: failed to create file")
+	}
+
+	files, err := ListJournalFiles(tempDir, time.Time{}, time.Time{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{
+			path.Join(tempDir, "2021-W42.txt"),
+			path.Join(tempDir, "20211020.txt"),
+			path.Join(tempDir, "20211020_002.txt"),
+			path.Join(tempDir, "20211020_010.txt"),
+			path.Join(tempDir, "20211021-09.txt"),
+			path.Join(tempDir, "20211021-09_002.txt"),
+			path.Join(tempDir, "20211021-23.txt"),
+			path.Join(tempDir, "20211024.txt"),
+			path.Join(tempDir, "2021-W43.txt"),
+		}, files, "journals of all periods and parts should be listed chronologically")
+	}
+
+	day := time.Date(2021, time.October, 21, 0, 0, 0, 0, time.Local)
+	files, err = ListJournalFiles(tempDir, day, day)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{
+			path.Join(tempDir, "2021-W42.txt"),
+			path.Join(tempDir, "20211021-09.txt"),
+			path.Join(tempDir, "20211021-09_002.txt"),
+			path.Join(tempDir, "20211021-23.txt"),
+		}, files, "journals overlapping the range should be listed")
+	}
+}
+
+func TestNewJournalFromEvents(t *testing.T) {
+	location := &Location{Name: "Teststadt", Code: "TST"}
+	journal := NewJournalFromEvents([]Event{
+		{EventType: LOGOUT, User: &User{Name: "Tester", Address: "Teststadt"}, Location: location, Timestamp: 2000},
+		{EventType: LOGIN, User: &User{Name: "Klaus", Address: "Musterdorf"}, Location: location, Timestamp: 1000},
+		{EventType: LOGIN, User: &User{Name: "Tester", Address: "Teststadt"}, Location: location, Timestamp: 1000},
+	})
+	events := journal.GetEvents()
+	if assert.Len(t, events, 3) {
+		assert.Equal(t, "Klaus", events[0].User.Name, "the events should be ordered stably")
+		assert.Equal(t, EventType(LOGIN), events[1].EventType)
+		assert.Same(t, events[1].User, events[2].User, "equal users should be deduplicated")
+	}
+	assert.Len(t, journal.users, 2)
+}
@@ -0,0 +1,61 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// quarantineFileExtension is appended to the journal file name for the file that keeps torn tails.
+const quarantineFileExtension = ".torn"
+
+// GetQuarantinePath determines the path of the file that keeps the torn tails of the given journal file.
+func GetQuarantinePath(filePath string) string {
+	return strings.TrimSuffix(filePath, compressedFileExtension) + quarantineFileExtension
+}
+
+// RecoverJournal removes a torn tail, i.e. an incomplete last line, from the journal file before it is appended to.
+// A torn tail is left behind if the server crashed while writing a line.
+// The removed bytes are appended to the quarantine file (see GetQuarantinePath) instead of being discarded.
+// It returns the number of removed bytes, missing files need no recovery.
+func RecoverJournal(filePath string) (int, error) {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read journal file %s for recovery: %w", filePath, err)
+	}
+	complete := bytes.LastIndexByte(content, '\n') + 1
+	torn := content[complete:]
+	if len(torn) == 0 {
+		return 0, nil
+	}
+
+	quarantinePath := GetQuarantinePath(filePath)
+	quarantine, err := os.OpenFile(quarantinePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, privateFilePermissions)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open quarantine file %s: %w", quarantinePath, err)
+	}
+	_, err = quarantine.Write(append(torn, '\n'))
+	if err == nil {
+		err = quarantine.Sync()
+	}
+	if closeErr := quarantine.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to quarantine torn tail of journal file %s: %w", filePath, err)
+	}
+
+	if err := os.Truncate(filePath, int64(complete)); err != nil {
+		return 0, fmt.Errorf("failed to truncate torn tail of journal file %s: %w", filePath, err)
+	}
+	return len(torn), nil
+}
@@ -0,0 +1,109 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestRecoverJournal(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+	filePath := path.Join(tempDir, "20211020.txt")
+	assert.Equal(t, path.Join(tempDir, "20211020.txt.torn"), GetQuarantinePath(filePath))
+	assert.Equal(t, path.Join(tempDir, "20211020.txt.torn"), GetQuarantinePath(filePath+".gz"))
+
+	torn, err := RecoverJournal(filePath)
+	if assert.NoError(t, err, "missing journals need no recovery") {
+		assert.Equal(t, 0, torn)
+	}
+
+	complete := "*Tester\tTeststadt\n+HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1634700000\n"
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(complete), 0660))
+	torn, err = RecoverJournal(filePath)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, torn, "complete journals should be left as they are")
+		assert.NoFileExists(t, GetQuarantinePath(filePath))
+	}
+
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(complete+"-HjLV+aPwKzq3s"), 0660))
+	torn, err = RecoverJournal(filePath)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 14, torn)
+		content, err := ioutil.ReadFile(filePath)
+		if assert.NoError(t, err) {
+			assert.Equal(t, complete, string(content), "the torn tail should be truncated")
+		}
+		quarantine, err := ioutil.ReadFile(GetQuarantinePath(filePath))
+		if assert.NoError(t, err) {
+			assert.Equal(t, "-HjLV+aPwKzq3s\n", string(quarantine), "the torn tail should be quarantined")
+		}
+		info, err := os.Stat(GetQuarantinePath(filePath))
+		if assert.NoError(t, err) {
+			assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "only the owner should read the quarantine")
+		}
+	}
+
+	require.NoError(t, ioutil.WriteFile(filePath, []byte("*Tes"), 0660))
+	torn, err = RecoverJournal(filePath)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 4, torn, "a single torn line should be removed")
+		quarantine, err := ioutil.ReadFile(GetQuarantinePath(filePath))
+		if assert.NoError(t, err) {
+			assert.Equal(t, "-HjLV+aPwKzq3s\n*Tes\n", string(quarantine), "torn tails should be appended to the quarantine")
+		}
+	}
+}
+
+func TestNewWriter_tornTail(t *testing.T) {
+	Locations = map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}}
+	tempDir := t.TempDir()
+	config := WriterConfig{ChainKey: []byte("secret")}
+	user := User{Name: "Tester", Address: "Teststadt"}
+
+	writer, err := NewWriterWithConfig(tempDir, config)
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteEventUser(&user, Locations["TST"], LOGIN))
+	require.NoError(t, writer.Close())
+	// simulate a crash while writing the logout
+	file, err := os.OpenFile(GetCurrentJournalPath(tempDir), os.O_WRONLY|os.O_APPEND, 0777)
+	require.NoError(t, err)
+	require.NoError(t, util.WriteString(file, "-HjLV+aPwKzq3szuae53Z"))
+	require.NoError(t, file.Close())
+
+	writer, err = NewWriterWithConfig(tempDir, config)
+	require.NoError(t, err, "the writer should recover from a torn tail")
+	loc, err := writer.GetCurrentUserLocation(util.Base64Encode(user.Hash()))
+	if assert.NoError(t, err) {
+		assert.Equal(t, Locations["TST"], loc, "the torn logout should not count")
+	}
+	require.NoError(t, writer.WriteEventUser(&user, Locations["TST"], LOGOUT))
+	require.NoError(t, writer.Close())
+	assert.FileExists(t, GetQuarantinePath(GetCurrentJournalPath(tempDir)))
+
+	lines, err := VerifyChain(config.ChainKey, GetCurrentJournalPath(tempDir))
+	if assert.NoError(t, err, "the chain should continue after the recovery") {
+		assert.Equal(t, 4, lines)
+	}
+}
+
+func TestApplyRetention_quarantine(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+	file := createRetentionTestJournals(t, tempDir, time.Now(), 10)[0]
+	require.NoError(t, ioutil.WriteFile(GetQuarantinePath(file), []byte("*Tes\n"), 0660))
+
+	_, err := ApplyRetention(tempDir, RetentionPolicy{Days: 7, Mode: PURGE}, time.Now())
+	if assert.NoError(t, err) {
+		assert.NoFileExists(t, GetQuarantinePath(file), "torn tails should be removed with their journal")
+	}
+}
@@ -0,0 +1,660 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReplicationPath is the path of the replication API of a follower, relative to its base URL.
+// GET lists the journals of the follower with their sizes and tails, POST to ReplicationPath + journal name appends
+// to a journal. Appends give the offset and the tail the journal must have, see lastLineDigest.
+const ReplicationPath = "replication/journals/"
+
+// maxReplicationChunk is the maximum number of bytes shipped to the follower in one request.
+const maxReplicationChunk = 1024 * 1024
+
+// maxTailLength is the maximum length of the last line that lastLineDigest reads, which is the longest line
+// that the readers can scan.
+const maxTailLength = bufio.MaxScanTokenSize
+
+// errReplicaDiverged is returned if the content of a replica before the offset differs from the journal.
+var errReplicaDiverged = errors.New("the journal content before the offset doesn't match")
+
+// ReplicaConfig configures the follower that a Writer ships its journals to, see Writer.TrackReplication.
+type ReplicaConfig struct {
+	// URL is the base URL of the follower, an empty URL disables the replication
+	URL string
+	// Token authenticates the Writer at the follower as bearer token
+	Token string
+	// Client sends the requests, a client with a timeout of 30 seconds is used if it's nil
+	Client *http.Client
+	// RetryInterval is the time to wait after a failed replication, it defaults to 10 seconds
+	RetryInterval time.Duration
+}
+
+// replicaJournals is the response of a follower that lists its journals.
+type replicaJournals struct {
+	// Journals maps the journal names to the size of their content
+	Journals map[string]int64 `json:"journals"`
+	// Tails maps the journal names to the digest of their last line, see lastLineDigest
+	Tails map[string]string `json:"tails"`
+}
+
+// replicaAppend is the response of a follower to an append to a journal.
+type replicaAppend struct {
+	// Size is the size of the journal content after the append, or the current size if the offset didn't match
+	Size int64 `json:"size"`
+	// Diverged is true if the append failed because the content before the offset doesn't match
+	Diverged bool `json:"diverged,omitempty"`
+	// Error describes why the append failed
+	Error string `json:"error,omitempty"`
+}
+
+// replicationName returns the name of the journal file that is used in the replication.
+// Compressed journals have the name of their uncompressed content, so the compression doesn't change it.
+func replicationName(filePath string) string {
+	return strings.TrimSuffix(path.Base(filePath), compressedFileExtension)
+}
+
+// isReplicationName checks whether the name is an uncompressed journal file name, without any directories.
+func isReplicationName(name string) bool {
+	_, err := ParseJournalName(name)
+	return err == nil && !IsCompressedJournal(name)
+}
+
+// journalContentSize returns the size of the content of a journal file, after decompressing it if required.
+func journalContentSize(filePath string) (int64, error) {
+	if !IsCompressedJournal(filePath) {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return 0, fmt.Errorf("failed to determine the size of journal file \"%s\": %w", filePath, err)
+		}
+		return info.Size(), nil
+	}
+	file, err := OpenJournalFile(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = file.Close() }()
+	size, err := io.Copy(io.Discard, file)
+	if err != nil {
+		return 0, fmt.Errorf("failed to determine the size of journal file \"%s\": %w", filePath, err)
+	}
+	return size, nil
+}
+
+// readJournalLines reads the complete lines of the journal content starting at the offset, up to maxSize bytes.
+// A line that is still being written is left out.
+func readJournalLines(filePath string, offset int64, maxSize int) ([]byte, error) {
+	file, err := OpenJournalFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+	if seeker, ok := file.(io.Seeker); ok {
+		_, err = seeker.Seek(offset, io.SeekStart)
+	} else {
+		_, err = io.CopyN(io.Discard, file, offset)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to skip to offset %d of journal file \"%s\": %w", offset, filePath, err)
+	}
+	content := make([]byte, maxSize)
+	read, err := io.ReadFull(file, content)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("failed to read journal file \"%s\": %w", filePath, err)
+	}
+	return content[:bytes.LastIndexByte(content[:read], '\n')+1], nil
+}
+
+// lastLineDigest returns the base64 encoded SHA-256 digest of the last line of the journal content before the offset,
+// which must be at the end of a line. It's empty at the start of the journal.
+// Lines of journals with hash chain end with the MAC of all lines before, so the digest covers all of them.
+func lastLineDigest(filePath string, offset int64) (string, error) {
+	if offset == 0 {
+		return "", nil
+	}
+	start := offset - maxTailLength
+	if start < 0 {
+		start = 0
+	}
+	content, err := readJournalLines(filePath, start, int(offset-start))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(content)) != offset-start {
+		return "", fmt.Errorf("journal file \"%s\" has no line ending at offset %d", filePath, offset)
+	}
+	lineStart := bytes.LastIndexByte(content[:len(content)-1], '\n') + 1
+	if lineStart == 0 && start > 0 {
+		return "", fmt.Errorf("the line before offset %d of journal file \"%s\" is too long", offset, filePath)
+	}
+	digest := sha256.Sum256(content[lineStart:])
+	return util.Base64Encode(digest[:]), nil
+}
+
+// replicator ships the journals of a directory to a follower.
+type replicator struct {
+	// directory contains the journals to replicate
+	directory string
+	// config describes the follower
+	config ReplicaConfig
+	// offsets are the sizes of the journals on the follower, nil if they need to be requested
+	offsets map[string]int64
+	// tails are the digests of the last lines of the journals on the follower, which weren't compared yet
+	tails map[string]string
+	// compressedSizes caches the content sizes of the compressed journals, which never change
+	compressedSizes map[string]int64
+	// diverged contains the journals whose replica differs from them, so they were already reported
+	diverged map[string]bool
+}
+
+// newReplicator creates a replicator for the directory, filling in the defaults of the config.
+func newReplicator(directory string, config ReplicaConfig) *replicator {
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = 10 * time.Second
+	}
+	if !strings.HasSuffix(config.URL, "/") {
+		config.URL += "/"
+	}
+	return &replicator{
+		directory:       directory,
+		config:          config,
+		compressedSizes: make(map[string]int64, 10),
+		diverged:        make(map[string]bool, 10),
+	}
+}
+
+// replicate ships everything the follower is missing of the journals written since the given date.
+// The follower's offsets are requested again after a failure, e.g. after it was unreachable.
+// Replicas whose content differs from the journal, e.g. because the journal was rewritten, are reported once
+// and left as they are. This is noticed when the offsets are requested and before lines are appended.
+func (replicator *replicator) replicate(from time.Time) error {
+	if replicator.offsets == nil {
+		listing, err := replicator.fetchOffsets()
+		if err != nil {
+			return err
+		}
+		replicator.offsets, replicator.tails = listing.Journals, listing.Tails
+	}
+	files, err := ListJournalFiles(replicator.directory, from, time.Time{})
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := replicator.replicateFile(file); err != nil {
+			replicator.offsets = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// replicateFile ships the lines of the journal file that the follower is missing.
+func (replicator *replicator) replicateFile(filePath string) error {
+	name := replicationName(filePath)
+	size, cached := replicator.compressedSizes[filePath]
+	if !cached {
+		var err error
+		if size, err = journalContentSize(filePath); err != nil {
+			return err
+		}
+		if IsCompressedJournal(filePath) {
+			replicator.compressedSizes[filePath] = size
+		}
+	}
+
+	if replicator.diverged[name] {
+		return nil
+	}
+	if tail, listed := replicator.tails[name]; listed && replicator.offsets[name] <= size {
+		delete(replicator.tails, name) // unchanged journals only need to be compared once
+		if expected, err := lastLineDigest(filePath, replicator.offsets[name]); err != nil || expected != tail {
+			replicator.reportDiverged(name, "its first %d bytes differ from the journal", replicator.offsets[name])
+			return nil
+		}
+	}
+	for offset := replicator.offsets[name]; offset != size; offset = replicator.offsets[name] {
+		if offset > size { // the follower's content can't be a copy of the journal
+			replicator.reportDiverged(name, "it has %d bytes, the journal only %d", offset, size)
+			return nil
+		}
+		lines, err := readJournalLines(filePath, offset, maxReplicationChunk)
+		if err != nil {
+			return err
+		}
+		if len(lines) == 0 { // the last line isn't complete yet
+			return nil
+		}
+		tail, err := lastLineDigest(filePath, offset)
+		if err != nil {
+			return err
+		}
+		replicator.offsets[name], err = replicator.push(name, offset, tail, lines)
+		if errors.Is(err, errReplicaDiverged) {
+			replicator.reportDiverged(name, "its first %d bytes differ from the journal", offset)
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reportDiverged logs that the replica of the journal differs from the journal and stops replicating it.
+func (replicator *replicator) reportDiverged(name string, format string, args ...interface{}) {
+	log.Printf("Replica of journal \"%s\" diverged: %s", name, fmt.Sprintf(format, args...))
+	replicator.diverged[name] = true
+}
+
+// fetchOffsets requests the sizes and tails of the journals on the follower.
+func (replicator *replicator) fetchOffsets() (replicaJournals, error) {
+	request, err := http.NewRequest(http.MethodGet, replicator.config.URL+ReplicationPath, nil)
+	if err != nil {
+		return replicaJournals{}, fmt.Errorf("failed to create replication request: %w", err)
+	}
+	response := replicaJournals{}
+	if status, err := replicator.send(request, &response); err != nil {
+		return replicaJournals{}, err
+	} else if status != http.StatusOK {
+		return replicaJournals{}, fmt.Errorf("replica refused to list its journals with status %d", status)
+	}
+	if response.Journals == nil {
+		response.Journals = make(map[string]int64, 10)
+	}
+	if response.Tails == nil {
+		response.Tails = make(map[string]string, 10)
+	}
+	return response, nil
+}
+
+// push appends the lines to the journal on the follower at the offset and returns the follower's new size of it.
+// The tail is the digest of the last line before the offset, see lastLineDigest.
+// If the offset doesn't match, the follower's actual size is returned, so that the next push continues from there.
+// If the follower's last line before the offset doesn't match the tail, errReplicaDiverged is returned.
+func (replicator *replicator) push(name string, offset int64, tail string, lines []byte) (int64, error) {
+	query := url.Values{"offset": {strconv.FormatInt(offset, 10)}, "tail": {tail}}
+	request, err := http.NewRequest(http.MethodPost,
+		replicator.config.URL+ReplicationPath+url.PathEscape(name)+"?"+query.Encode(), bytes.NewReader(lines))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create replication request: %w", err)
+	}
+	request.Header.Set("Content-Type", "text/plain")
+	response := replicaAppend{}
+	status, err := replicator.send(request, &response)
+	if err != nil {
+		return 0, err
+	}
+	if status == http.StatusConflict && response.Diverged {
+		return response.Size, errReplicaDiverged
+	}
+	if status != http.StatusOK && (status != http.StatusConflict || response.Size == offset) {
+		return 0, fmt.Errorf("replica refused lines of journal \"%s\" with status %d: %s", name, status, response.Error)
+	}
+	return response.Size, nil
+}
+
+// send sends the authenticated request and decodes the JSON response into the given value.
+func (replicator *replicator) send(request *http.Request, value interface{}) (int, error) {
+	request.Header.Set("Authorization", "Bearer "+replicator.config.Token)
+	response, err := replicator.config.Client.Do(request)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reach replica: %w", err)
+	}
+	defer func() { _ = response.Body.Close() }()
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1024*1024)).Decode(value); err != nil &&
+		response.StatusCode == http.StatusOK {
+		return response.StatusCode, fmt.Errorf("failed to decode response of replica: %w", err)
+	}
+	return response.StatusCode, nil
+}
+
+// TrackReplication takes care of shipping every line written to the journals to the follower of the config.
+// After a disconnect it catches up from the follower's offsets, journals that the retention policy already
+// processed are left out. It does nothing if no follower is configured.
+// This method should be run as its own routine:
+func (writer *Writer) TrackReplication() {
+	if writer.config.Replica.URL == "" {
+		return
+	}
+	replicator := newReplicator(writer.directory, writer.config.Replica)
+	for {
+		from := time.Time{}
+		if days := writer.config.Retention.Days; days > 0 {
+			now := time.Now().In(time.Local)
+			from = time.Date(now.Year(), now.Month(), now.Day()-days, 0, 0, 0, 0, time.Local)
+		}
+		if err := replicator.replicate(from); err != nil {
+			log.Printf("failed to replicate journals: %v", err)
+			time.Sleep(replicator.config.RetryInterval)
+			continue
+		}
+		<-writer.replicationWake
+	}
+}
+
+// replicationWrittenLocked wakes up the replication after a line was written, if it's enabled.
+// The outputLock must be held by the caller.
+func (writer *Writer) replicationWrittenLocked() {
+	select { // sending to a nil channel never succeeds, so nothing happens without replication
+	case writer.replicationWake <- struct{}{}:
+	default: // the replication is already running or woken up
+	}
+}
+
+// ReplicaHandler receives the journals of a Writer on a follower, see Writer.TrackReplication.
+// It only ever appends to the journals, so a primary can't destroy the replica.
+// Appends to a journal whose last line differs from the primary's are refused, so the replica doesn't mix both.
+type ReplicaHandler struct {
+	// directory is where the replicated journals are stored
+	directory string
+	// token authenticates the primary
+	token string
+	// lock is a mutex to append to the journals one after the other
+	lock sync.Mutex
+}
+
+// NewReplicaHandler creates a ReplicaHandler storing the journals in the directory.
+// Only requests with the token as bearer token are accepted, so the token must not be empty.
+func NewReplicaHandler(directory string, token string) (*ReplicaHandler, error) {
+	if token == "" {
+		return nil, fmt.Errorf("a replication token is required to receive journals")
+	}
+	if err := os.MkdirAll(directory, DirectoryCreationPermissions); err != nil {
+		return nil, fmt.Errorf("failed to create replica directory \"%s\": %w", directory, err)
+	}
+	return &ReplicaHandler{directory: directory, token: token}, nil
+}
+
+// ServeHTTP handles the replication API, see ReplicationPath.
+func (handler *ReplicaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+handler.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeReplicaResponse(w, http.StatusUnauthorized, replicaAppend{Error: "invalid replication token"})
+		return
+	}
+	index := strings.Index(r.URL.Path, "/"+ReplicationPath)
+	if index < 0 {
+		writeReplicaResponse(w, http.StatusNotFound, replicaAppend{Error: "not found"})
+		return
+	}
+	name := r.URL.Path[index+len(ReplicationPath)+1:]
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		handler.serveJournals(w)
+	case name != "" && r.Method == http.MethodPost:
+		handler.serveAppend(w, r, name)
+	default:
+		writeReplicaResponse(w, http.StatusMethodNotAllowed, replicaAppend{Error: "method not allowed"})
+	}
+}
+
+// serveJournals lists the journals of the replica with their sizes and tails.
+func (handler *ReplicaHandler) serveJournals(w http.ResponseWriter) {
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	files, err := ListJournalFiles(handler.directory, time.Time{}, time.Time{})
+	if err != nil {
+		log.Printf("Failed to list replicated journals: %v", err)
+		writeReplicaResponse(w, http.StatusInternalServerError, replicaAppend{Error: "failed to list journals"})
+		return
+	}
+	response := replicaJournals{Journals: make(map[string]int64, len(files)), Tails: make(map[string]string, len(files))}
+	for _, file := range files {
+		name := replicationName(file)
+		if response.Journals[name], err = journalContentSize(file); err == nil {
+			response.Tails[name], err = lastLineDigest(file, response.Journals[name])
+		}
+		if err != nil {
+			log.Printf("Failed to list replicated journals: %v", err)
+			writeReplicaResponse(w, http.StatusInternalServerError, replicaAppend{Error: "failed to list journals"})
+			return
+		}
+	}
+	writeReplicaResponse(w, http.StatusOK, response)
+}
+
+// serveAppend appends the complete lines of the request body to the journal,
+// if the offset is its current size and the tail is the digest of its last line.
+func (handler *ReplicaHandler) serveAppend(w http.ResponseWriter, r *http.Request, name string) {
+	if !isReplicationName(name) {
+		writeReplicaResponse(w, http.StatusBadRequest, replicaAppend{Error: "invalid journal name"})
+		return
+	}
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		writeReplicaResponse(w, http.StatusBadRequest, replicaAppend{Error: "invalid offset"})
+		return
+	}
+	lines, err := io.ReadAll(io.LimitReader(r.Body, maxReplicationChunk+1))
+	if err != nil || len(lines) > maxReplicationChunk || len(lines) == 0 || lines[len(lines)-1] != '\n' {
+		writeReplicaResponse(w, http.StatusBadRequest, replicaAppend{Error: "expected complete journal lines"})
+		return
+	}
+
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	filePath := path.Join(handler.directory, name)
+	if exists, _ := util.FileExists(filePath + compressedFileExtension); exists { // closed journals don't change
+		size, err := journalContentSize(filePath + compressedFileExtension)
+		if err != nil {
+			log.Printf("Failed to append to replicated journal: %v", err)
+		}
+		writeReplicaResponse(w, http.StatusConflict, replicaAppend{Size: size, Error: "journal is compressed"})
+		return
+	}
+	size, appended, err := appendReplicaLines(filePath, offset, r.URL.Query().Get("tail"), lines)
+	if errors.Is(err, errReplicaDiverged) {
+		writeReplicaResponse(w, http.StatusConflict, replicaAppend{Size: size, Diverged: true, Error: err.Error()})
+		return
+	} else if err != nil {
+		log.Printf("Failed to append to replicated journal: %v", err)
+		writeReplicaResponse(w, http.StatusInternalServerError, replicaAppend{Error: "failed to append to journal"})
+		return
+	}
+	if !appended {
+		writeReplicaResponse(w, http.StatusConflict, replicaAppend{Size: size, Error: "offset doesn't match"})
+		return
+	}
+	writeReplicaResponse(w, http.StatusOK, replicaAppend{Size: size})
+}
+
+// appendReplicaLines appends the lines to the journal file if its size is the offset and returns its size afterwards.
+// The second return value is false if the size didn't match, so nothing was appended.
+// If the digest of the last line isn't the tail, errReplicaDiverged is returned and nothing is appended either.
+// The lines are flushed to the disk before the function returns.
+func appendReplicaLines(filePath string, offset int64, tail string, lines []byte) (int64, bool, error) {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, os.FileMode(FileCreationPermissions))
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to open journal file \"%s\": %w", filePath, err)
+	}
+	defer func() { _ = file.Close() }()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to determine the size of journal file \"%s\": %w", filePath, err)
+	}
+	if info.Size() != offset {
+		return info.Size(), false, nil
+	}
+	if actual, err := lastLineDigest(filePath, offset); err != nil || actual != tail {
+		return offset, false, errReplicaDiverged
+	}
+	if _, err := file.Write(lines); err != nil {
+		return 0, false, fmt.Errorf("failed to write journal file \"%s\": %w", filePath, err)
+	}
+	if err := file.Sync(); err != nil {
+		return 0, false, fmt.Errorf("failed to flush journal file \"%s\" to disk: %w", filePath, err)
+	}
+	return offset + int64(len(lines)), true, nil
+}
+
+// writeReplicaResponse writes the value as JSON response with the status.
+func writeReplicaResponse(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Printf("Failed to write replication response: %v", err)
+	}
+}
+
+// ReplicaStatus describes how the replica of a journal relates to the journal, see CompareReplica.
+type ReplicaStatus string
+
+const (
+	// INSYNC marks replicas with the same content as the journal.
+	INSYNC ReplicaStatus = "in sync"
+	// BEHIND marks replicas that miss lines at the end of the journal, e.g. while the follower catches up.
+	BEHIND ReplicaStatus = "behind"
+	// MISSING marks journals without replica.
+	MISSING ReplicaStatus = "missing on replica"
+	// EXTRA marks replicas without journal, e.g. after the journal was lost.
+	EXTRA ReplicaStatus = "only on replica"
+	// AHEAD marks replicas with lines after the end of the journal.
+	AHEAD ReplicaStatus = "ahead"
+	// DIVERGED marks replicas with lines that differ from the journal.
+	DIVERGED ReplicaStatus = "diverged"
+)
+
+// ReplicaComparison is the result of comparing a journal with its replica.
+type ReplicaComparison struct {
+	// Name is the file name of the uncompressed journal
+	Name string
+	// Status describes how the replica relates to the journal
+	Status ReplicaStatus
+	// JournalSize is the size of the content of the journal, 0 if it's missing
+	JournalSize int64
+	// ReplicaSize is the size of the content of the replica, 0 if it's missing
+	ReplicaSize int64
+	// Line is the number of the first line that differs, 0 if all lines are the same
+	Line int
+}
+
+// Diverged checks whether the replica contains anything that the journal doesn't, so it's not just lagging behind.
+func (comparison *ReplicaComparison) Diverged() bool {
+	return comparison.Status == AHEAD || comparison.Status == DIVERGED
+}
+
+// CompareReplica compares the journals of a primary directory with their replicas in the replica directory.
+// The contents are compared after decompressing, so the compression of either journal doesn't matter.
+// The comparisons are ordered by journal name.
+func CompareReplica(directory string, replicaDirectory string) ([]ReplicaComparison, error) {
+	files, err := ListJournalFiles(directory, time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	replicaFiles, err := ListJournalFiles(replicaDirectory, time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	replicas := make(map[string]string, len(replicaFiles))
+	for _, file := range replicaFiles {
+		replicas[replicationName(file)] = file
+	}
+
+	comparisons := make([]ReplicaComparison, 0, len(files)+len(replicaFiles))
+	for _, file := range files {
+		name := replicationName(file)
+		replica, exists := replicas[name]
+		delete(replicas, name)
+		comparison := ReplicaComparison{Name: name, Status: MISSING}
+		if exists {
+			comparison, err = compareJournalContent(file, replica)
+		} else {
+			comparison.JournalSize, err = journalContentSize(file)
+		}
+		if err != nil {
+			return nil, err
+		}
+		comparisons = append(comparisons, comparison)
+	}
+	for name, replica := range replicas {
+		size, err := journalContentSize(replica)
+		if err != nil {
+			return nil, err
+		}
+		comparisons = append(comparisons, ReplicaComparison{Name: name, Status: EXTRA, ReplicaSize: size})
+	}
+	sort.Slice(comparisons, func(i, j int) bool {
+		return comparisons[i].Name < comparisons[j].Name
+	})
+	return comparisons, nil
+}
+
+// compareJournalContent compares the content of the journal and its replica line by line.
+func compareJournalContent(filePath string, replicaPath string) (ReplicaComparison, error) {
+	comparison := ReplicaComparison{Name: replicationName(filePath), Status: INSYNC}
+	file, err := OpenJournalFile(filePath)
+	if err != nil {
+		return comparison, err
+	}
+	defer func() { _ = file.Close() }()
+	replica, err := OpenJournalFile(replicaPath)
+	if err != nil {
+		return comparison, err
+	}
+	defer func() { _ = replica.Close() }()
+
+	reader, replicaReader := bufio.NewReader(file), bufio.NewReader(replica)
+	for line := 1; ; line++ {
+		content, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return comparison, fmt.Errorf("failed to read journal file \"%s\": %w", filePath, err)
+		}
+		replicaContent, err := replicaReader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return comparison, fmt.Errorf("failed to read journal file \"%s\": %w", replicaPath, err)
+		}
+		comparison.JournalSize += int64(len(content))
+		comparison.ReplicaSize += int64(len(replicaContent))
+		if bytes.Equal(content, replicaContent) {
+			if len(content) == 0 { // both ended
+				return comparison, nil
+			}
+			continue
+		}
+
+		comparison.Line = line
+		switch {
+		case len(replicaContent) == 0:
+			comparison.Status = BEHIND
+		case len(content) == 0:
+			comparison.Status = AHEAD
+		default:
+			comparison.Status = DIVERGED
+		}
+		rest, err := io.Copy(io.Discard, reader)
+		if err != nil {
+			return comparison, fmt.Errorf("failed to read journal file \"%s\": %w", filePath, err)
+		}
+		comparison.JournalSize += rest
+		if rest, err = io.Copy(io.Discard, replicaReader); err != nil {
+			return comparison, fmt.Errorf("failed to read journal file \"%s\": %w", replicaPath, err)
+		}
+		comparison.ReplicaSize += rest
+		return comparison, nil
+	}
+}
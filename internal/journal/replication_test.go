@@ -0,0 +1,236 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"crypto/sha256"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestReplica starts a follower that receives journals into a new directory.
+func newTestReplica(t *testing.T) (*httptest.Server, string) {
+	directory := t.TempDir()
+	handler, err := NewReplicaHandler(directory, "token")
+	require.NoError(t, err)
+	server := httptest.NewTLSServer(handler)
+	t.Cleanup(server.Close)
+	return server, directory
+}
+
+// assertReplicated checks that the replica contains the same content as the journal.
+func assertReplicated(t *testing.T, journalPath string, replicaDirectory string) {
+	file, err := OpenJournalFile(journalPath)
+	require.NoError(t, err)
+	expected, err := ioutil.ReadAll(file)
+	_ = file.Close()
+	require.NoError(t, err)
+	replicated, err := ioutil.ReadFile(path.Join(replicaDirectory, replicationName(journalPath)))
+	if assert.NoError(t, err) {
+		assert.Equal(t, string(expected), string(replicated))
+	}
+}
+
+func TestReplicator_replicate(t *testing.T) {
+	server, replicaDirectory := newTestReplica(t)
+	config := ReplicaConfig{URL: server.URL, Token: "token", Client: server.Client()}
+	directory := t.TempDir()
+	oldJournal := path.Join(directory, "20211020.txt")
+	require.NoError(t, ioutil.WriteFile(oldJournal, []byte(retentionTestJournal), 0660))
+	_, err := CompressJournal(oldJournal)
+	require.NoError(t, err)
+	currentJournal := path.Join(directory, "20211021.txt")
+	require.NoError(t, ioutil.WriteFile(currentJournal, []byte("+first\tTST\t1\n+incomplete"), 0660))
+
+	replicator := newReplicator(directory, config)
+	require.NoError(t, replicator.replicate(time.Time{}))
+	assertReplicated(t, oldJournal+compressedFileExtension, replicaDirectory)
+	replicated, err := ioutil.ReadFile(path.Join(replicaDirectory, "20211021.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "+first\tTST\t1\n", string(replicated), "incomplete lines should not be replicated")
+
+	file, err := os.OpenFile(currentJournal, os.O_WRONLY|os.O_APPEND, 0660)
+	require.NoError(t, err)
+	_, err = file.WriteString(" line\t2\n-second\tTST\t3\n")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	require.NoError(t, replicator.replicate(time.Time{}))
+	assertReplicated(t, currentJournal, replicaDirectory)
+
+	// a restarted primary catches up from the offsets of the follower
+	require.NoError(t, ioutil.WriteFile(currentJournal, []byte(strings.Repeat("+user\tTST\t4\n", 1000)), 0660))
+	require.NoError(t, os.Truncate(path.Join(replicaDirectory, "20211021.txt"), 0))
+	require.NoError(t, newReplicator(directory, config).replicate(time.Time{}))
+	assertReplicated(t, currentJournal, replicaDirectory)
+
+	// journals before the given date are left out
+	require.NoError(t, os.Remove(path.Join(replicaDirectory, "20211020.txt")))
+	require.NoError(t, newReplicator(directory, config).replicate(time.Date(2021, 10, 21, 0, 0, 0, 0, time.Local)))
+	assert.NoFileExists(t, path.Join(replicaDirectory, "20211020.txt"))
+}
+
+func TestReplicator_diverged(t *testing.T) {
+	server, replicaDirectory := newTestReplica(t)
+	directory := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(path.Join(directory, "20211021.txt"), []byte("+first\tTST\t1\n"), 0660))
+	require.NoError(t, ioutil.WriteFile(path.Join(replicaDirectory, "20211021.txt"), []byte("+other\tTST\t1\n+more\tTST\t2\n"), 0660))
+
+	replicator := newReplicator(directory, ReplicaConfig{URL: server.URL, Token: "token", Client: server.Client()})
+	assert.NoError(t, replicator.replicate(time.Time{}))
+	assert.True(t, replicator.diverged["20211021.txt"])
+	replicated, err := ioutil.ReadFile(path.Join(replicaDirectory, "20211021.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "+other\tTST\t1\n+more\tTST\t2\n", string(replicated), "the replica should never be overwritten")
+
+	replicator = newReplicator(directory, ReplicaConfig{URL: server.URL, Token: "wrong", Client: server.Client()})
+	assert.Error(t, replicator.replicate(time.Time{}), "a wrong token should be refused")
+	replicator = newReplicator(directory, ReplicaConfig{URL: server.URL, Token: "token"})
+	assert.Error(t, replicator.replicate(time.Time{}), "the certificate of the test server should not be trusted")
+}
+
+func TestReplicator_rewritten(t *testing.T) {
+	server, replicaDirectory := newTestReplica(t)
+	config := ReplicaConfig{URL: server.URL, Token: "token", Client: server.Client()}
+	directory := t.TempDir()
+	journalPath := path.Join(directory, "20211021.txt")
+	require.NoError(t, ioutil.WriteFile(journalPath, []byte("+first\tTST\t1\n"), 0660))
+	replicator := newReplicator(directory, config)
+	require.NoError(t, replicator.replicate(time.Time{}))
+	assertReplicated(t, journalPath, replicaDirectory)
+
+	// the primary rewrites the journal with content of the same size and appends to it
+	require.NoError(t, ioutil.WriteFile(journalPath, []byte("+other\tTST\t1\n+more\tTST\t2\n"), 0660))
+	assert.NoError(t, replicator.replicate(time.Time{}))
+	assert.True(t, replicator.diverged["20211021.txt"], "the follower should refuse to append to a different journal")
+	replicated, err := ioutil.ReadFile(path.Join(replicaDirectory, "20211021.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "+first\tTST\t1\n", string(replicated), "the replica should not mix both journals")
+
+	// a restarted primary notices the rewrite without anything left to append
+	require.NoError(t, ioutil.WriteFile(journalPath, []byte("+other\tTST\t1\n"), 0660))
+	replicator = newReplicator(directory, config)
+	assert.NoError(t, replicator.replicate(time.Time{}))
+	assert.True(t, replicator.diverged["20211021.txt"], "the tails should be compared when the offsets are requested")
+}
+
+func TestWriter_TrackReplication(t *testing.T) {
+	server, replicaDirectory := newTestReplica(t)
+	location := &Location{Name: "Teststadt", Code: "TST"}
+	writer, err := NewWriterWithConfig(t.TempDir(), WriterConfig{
+		ChainKey: []byte("secret"),
+		Replica:  ReplicaConfig{URL: server.URL, Token: "token", Client: server.Client()},
+	})
+	require.NoError(t, err)
+	defer func() { _ = writer.Close() }()
+	go writer.TrackReplication()
+
+	require.NoError(t, writer.WriteEventUser(&User{Name: "Tester", Address: "Teststadt"}, location, LOGIN))
+	require.NoError(t, writer.WriteEventUser(&User{Name: "Tester", Address: "Teststadt"}, location, LOGOUT))
+	expected, err := ioutil.ReadFile(writer.outputPath)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		replicated, _ := ioutil.ReadFile(path.Join(replicaDirectory, replicationName(writer.outputPath)))
+		return string(replicated) == string(expected)
+	}, 5*time.Second, 10*time.Millisecond, "every written line should be replicated")
+}
+
+func TestReplicaHandler(t *testing.T) {
+	_, err := NewReplicaHandler(t.TempDir(), "")
+	assert.Error(t, err, "a token should be required")
+	directory := t.TempDir()
+	handler, err := NewReplicaHandler(directory, "token")
+	require.NoError(t, err)
+	digestA, digestB := sha256.Sum256([]byte("+a\tTST\t1\n")), sha256.Sum256([]byte("+b\tTST\t2\n"))
+	tailA, tailB := url.QueryEscape(util.Base64Encode(digestA[:])), util.Base64Encode(digestB[:])
+
+	values := [...]struct {
+		method   string
+		target   string
+		token    string
+		body     string
+		expected int
+	}{
+		{http.MethodGet, "/" + ReplicationPath, "wrong", "", http.StatusUnauthorized},
+		{http.MethodGet, "/" + ReplicationPath, "", "", http.StatusUnauthorized},
+		{http.MethodPost, "/" + ReplicationPath + "20211021.txt?offset=0", "token", "+a\tTST\t1\n", http.StatusOK},
+		{http.MethodPost, "/" + ReplicationPath + "20211021.txt?offset=0", "token", "+a\tTST\t1\n", http.StatusConflict},
+		{http.MethodPost, "/" + ReplicationPath + "20211021.txt?offset=9", "token", "+b\tTST", http.StatusBadRequest},
+		{http.MethodPost, "/" + ReplicationPath + "20211021.txt?offset=x", "token", "+b\tTST\t2\n", http.StatusBadRequest},
+		{http.MethodPost, "/" + ReplicationPath + "20211021.txt?offset=9", "token", "+b\tTST\t2\n", http.StatusConflict},
+		{http.MethodPost, "/" + ReplicationPath + "20211021.txt?offset=9&tail=" + tailB, "token", "+b\tTST\t2\n", http.StatusConflict},
+		{http.MethodPost, "/" + ReplicationPath + "20211021.txt?offset=9&tail=" + tailA, "token", "+b\tTST\t2\n", http.StatusOK},
+		{http.MethodPost, "/" + ReplicationPath + "..%2Fescape.txt?offset=0", "token", "+a\tTST\t1\n", http.StatusBadRequest},
+		{http.MethodPost, "/" + ReplicationPath + "notes.txt?offset=0", "token", "+a\tTST\t1\n", http.StatusBadRequest},
+		{http.MethodDelete, "/" + ReplicationPath + "20211021.txt", "token", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/other", "token", "", http.StatusNotFound},
+	}
+	for _, value := range values {
+		request := httptest.NewRequest(value.method, value.target, strings.NewReader(value.body))
+		request.Header.Set("Authorization", "Bearer "+value.token)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		assert.Equal(t, value.expected, recorder.Code, "%s %s", value.method, value.target)
+	}
+	replicated, err := ioutil.ReadFile(path.Join(directory, "20211021.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "+a\tTST\t1\n+b\tTST\t2\n", string(replicated))
+	assert.NoFileExists(t, path.Join(path.Dir(directory), "escape.txt"))
+
+	request := httptest.NewRequest(http.MethodGet, "/"+ReplicationPath, nil)
+	request.Header.Set("Authorization", "Bearer token")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, "{\"journals\":{\"20211021.txt\":18},\"tails\":{\"20211021.txt\":\""+tailB+"\"}}", recorder.Body.String())
+}
+
+func TestCompareReplica(t *testing.T) {
+	directory, replicaDirectory := t.TempDir(), t.TempDir()
+	journals := map[string][2]string{
+		"20211018.txt": {"+a\tTST\t1\n-a\tTST\t2\n", "+a\tTST\t1\n-a\tTST\t2\n"},
+		"20211019.txt": {"+a\tTST\t1\n-a\tTST\t2\n", "+a\tTST\t1\n"},
+		"20211020.txt": {"+a\tTST\t1\n", "+a\tTST\t1\n-a\tTST\t2\n"},
+		"20211021.txt": {"+a\tTST\t1\n-a\tTST\t2\n+b\tTST\t3\n", "+a\tTST\t1\n-b\tTST\t2\n+b\tTST\t3\n"},
+	}
+	for name, contents := range journals {
+		require.NoError(t, ioutil.WriteFile(path.Join(directory, name), []byte(contents[0]), 0660))
+		require.NoError(t, ioutil.WriteFile(path.Join(replicaDirectory, name), []byte(contents[1]), 0660))
+	}
+	_, err := CompressJournal(path.Join(replicaDirectory, "20211018.txt"))
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path.Join(directory, "20211022.txt"), []byte("+a\tTST\t1\n"), 0660))
+	require.NoError(t, ioutil.WriteFile(path.Join(replicaDirectory, "20211017.txt"), []byte("+a\tTST\t1\n"), 0660))
+
+	comparisons, err := CompareReplica(directory, replicaDirectory)
+	require.NoError(t, err)
+	assert.Equal(t, []ReplicaComparison{
+		{Name: "20211017.txt", Status: EXTRA, ReplicaSize: 9},
+		{Name: "20211018.txt", Status: INSYNC, JournalSize: 18, ReplicaSize: 18},
+		{Name: "20211019.txt", Status: BEHIND, JournalSize: 18, ReplicaSize: 9, Line: 2},
+		{Name: "20211020.txt", Status: AHEAD, JournalSize: 9, ReplicaSize: 18, Line: 2},
+		{Name: "20211021.txt", Status: DIVERGED, JournalSize: 27, ReplicaSize: 27, Line: 2},
+		{Name: "20211022.txt", Status: MISSING, JournalSize: 9},
+	}, comparisons)
+	diverged := 0
+	for _, comparison := range comparisons {
+		if comparison.Diverged() {
+			diverged++
+		}
+	}
+	assert.Equal(t, 2, diverged)
+
+	_, err = CompareReplica(directory, path.Join(replicaDirectory, "missing"))
+	assert.Error(t, err)
+}
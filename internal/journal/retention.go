@@ -0,0 +1,289 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// RetentionMode defines what happens to journals that exceed the retention period.
+type RetentionMode string
+
+const (
+	// PURGE deletes expired journals.
+	PURGE RetentionMode = "purge"
+	// ANONYMISE rewrites expired journals with anonymous placeholders instead of the user data.
+	ANONYMISE RetentionMode = "anonymise"
+)
+
+// ParseRetentionMode parses the textual representation of a RetentionMode.
+func ParseRetentionMode(text string) (RetentionMode, error) {
+	switch mode := RetentionMode(text); mode {
+	case PURGE, ANONYMISE:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown retention mode \"%s\", expected \"%s\" or \"%s\"", text, PURGE, ANONYMISE)
+	}
+}
+
+// DefaultAuditFileName is the name of the retention audit trail in the journal directory, if no other file is given.
+const DefaultAuditFileName = "retention-audit.log"
+
+// anonymousAddress starts the address of the placeholder users in anonymised journals.
+// It's followed by a part of the random ID of the placeholder, so that placeholders of different journals
+// are never taken for the same person, see User.Identity.
+const anonymousAddress = "anonymised"
+
+// RetentionPolicy describes how long journals are kept and what happens to them afterwards.
+type RetentionPolicy struct {
+	// Days is the number of full days journals are kept for after the day they were written, 0 disables the policy
+	Days int
+	// Mode defines whether expired journals are purged or anonymised
+	Mode RetentionMode
+	// AuditFile is the file every applied action is appended to, defaults to DefaultAuditFileName in the journal directory
+	AuditFile string
+	// ChainKey is the secret to re-seal anonymised journals in a hash chain, an empty key writes them without chain
+	ChainKey []byte
+	// EncryptionKey is the key to decrypt and re-encrypt the records of anonymised journals, may be empty
+	EncryptionKey []byte
+}
+
+// RetentionRecord describes an action applied to an expired journal.
+type RetentionRecord struct {
+	// File is the path of the journal file
+	File string
+	// Mode is the action that was applied to the file
+	Mode RetentionMode
+	// Users is the number of users that were removed from the file
+	Users int
+}
+
+// String formats the record for the audit trail.
+func (record *RetentionRecord) String() string {
+	return fmt.Sprintf("%s\t%s\t%d users", record.Mode, record.File, record.Users)
+}
+
+// ApplyRetention purges or anonymises all journals in the directory that are older than the policy allows at the given time.
+// Journals that were already anonymised are skipped. Each action is appended to the audit trail.
+func ApplyRetention(directory string, policy RetentionPolicy, now time.Time) ([]RetentionRecord, error) {
+	if policy.Days <= 0 {
+		return nil, fmt.Errorf("retention period must be at least one day, got %d", policy.Days)
+	}
+	if _, err := ParseRetentionMode(string(policy.Mode)); err != nil {
+		return nil, err
+	}
+	var cipher *Cipher
+	if len(policy.EncryptionKey) > 0 {
+		var err error
+		if cipher, err = NewCipher(policy.EncryptionKey); err != nil {
+			return nil, fmt.Errorf("failed to set up journal encryption: %w", err)
+		}
+	}
+	auditFile := policy.AuditFile
+	if auditFile == "" {
+		auditFile = path.Join(directory, DefaultAuditFileName)
+	}
+
+	now = now.In(time.Local)
+	lastExpired := time.Date(now.Year(), now.Month(), now.Day()-policy.Days-1, 0, 0, 0, 0, time.Local)
+	candidates, err := ListJournalFiles(directory, time.Time{}, lastExpired)
+	if err != nil {
+		return nil, err
+	}
+	// journals of longer periods only expire once their last day did, e.g. weekly journals
+	expiry := time.Date(now.Year(), now.Month(), now.Day()-policy.Days, 0, 0, 0, 0, time.Local)
+	files := make([]string, 0, len(candidates))
+	for _, file := range candidates {
+		if name, err := ParseJournalName(path.Base(file)); err == nil && !name.End().After(expiry) {
+			files = append(files, file)
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	// The audit trail is opened up front, so that no journal is touched if it can't be written
+	audit, err := os.OpenFile(auditFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, privateFilePermissions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open retention audit trail \"%s\": %w", auditFile, err)
+	}
+	defer func() { _ = audit.Close() }()
+
+	records := make([]RetentionRecord, 0, len(files))
+	for _, file := range files {
+		record := RetentionRecord{File: file, Mode: policy.Mode}
+		switch policy.Mode {
+		case PURGE:
+			record.Users, err = countUsers(file, cipher)
+			if err == nil {
+				err = os.Remove(file)
+			}
+		case ANONYMISE:
+			record.Users, err = anonymiseJournal(file, policy.ChainKey, cipher)
+		}
+		if err == nil { // torn tails can't be anonymised, they are always removed
+			if err = os.Remove(GetQuarantinePath(file)); os.IsNotExist(err) {
+				err = nil
+			}
+		}
+		if err != nil {
+			return records, fmt.Errorf("failed to %s journal \"%s\": %w", policy.Mode, file, err)
+		}
+		if record.Mode == ANONYMISE && record.Users == 0 { // already anonymised, nothing happened
+			continue
+		}
+		if err := util.WriteString(audit, now.Format(time.RFC3339)+"\t"+record.String()+"\n"); err != nil {
+			return records, fmt.Errorf("failed to write retention audit trail \"%s\": %w", auditFile, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// readDecodedLines reads all non-empty lines of a journal file, stripping the hash chain and decrypting them.
+func readDecodedLines(filePath string, cipher *Cipher) ([]string, error) {
+	file, err := OpenJournalFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	lines := make([]string, 0, 1000)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, err := DecodeLine(scanner.Text(), cipher)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode journal line \"%s\": %w", scanner.Text(), err)
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal file %s: %w", filePath, err)
+	}
+	return lines, nil
+}
+
+// countUsers counts the user lines of a journal file.
+func countUsers(filePath string, cipher *Cipher) (int, error) {
+	lines, err := readDecodedLines(filePath, cipher)
+	if err != nil {
+		return 0, err
+	}
+	users := 0
+	for _, line := range lines {
+		if line[0] == '*' {
+			users++
+		}
+	}
+	return users, nil
+}
+
+// isAnonymousUser checks whether the user is a placeholder of an anonymised journal.
+func isAnonymousUser(user *User) bool {
+	anonymous := user.Address == anonymousAddress || strings.HasPrefix(user.Address, anonymousAddress+" ")
+	return anonymous && strings.HasPrefix(user.Name, "Anonymous ")
+}
+
+// anonymiseJournal rewrites a journal file with every user replaced by a numbered placeholder.
+// The events keep their type, location, time and flag, so aggregate statistics can still be computed.
+// The placeholders get random IDs, which are part of their address, so that they can't be linked across journals.
+// Journals in the legacy format are upgraded to the current format for that, as their IDs are derived from the users.
+// It returns the number of replaced users, which is 0 for journals that were already anonymised.
+func anonymiseJournal(filePath string, chainKey []byte, cipher *Cipher) (int, error) {
+	lines, err := readDecodedLines(filePath, cipher)
+	if err != nil {
+		return 0, err
+	}
+
+	header := LegacyHeader
+	format := Header{Version: CurrentFormatVersion, IDs: SHA1IDS} // the header of the anonymised journal
+	placeholders := make(map[string]string, 100)                  // maps the original user IDs to the placeholder IDs
+	replaced := 0
+	output := make([]string, 0, len(lines)+1)
+	if len(lines) > 0 && lines[0][0] != headerRecord {
+		output = append(output, string(headerRecord)+format.ToJournalLine())
+	}
+	addPlaceholder := func(hash string) (string, error) {
+		id := make([]byte, sha256.Size)
+		if _, err := rand.Read(id); err != nil {
+			return "", fmt.Errorf("failed to generate placeholder ID: %w", err)
+		}
+		placeholder := User{
+			Name:    fmt.Sprintf("Anonymous %d", len(placeholders)+1),
+			Address: fmt.Sprintf("%s %x", anonymousAddress, id[:8]),
+		}
+		placeholders[hash] = util.Base64Encode(id)
+		output = append(output, "*"+format.FormatUserLine(&placeholder, id))
+		return placeholders[hash], nil
+	}
+	for i, line := range lines {
+		switch line[0] {
+		case headerRecord:
+			if i != 0 {
+				return 0, fmt.Errorf("the header isn't the first line")
+			}
+			if header, err = ParseHeaderLine(line[1:]); err != nil {
+				return 0, fmt.Errorf("failed to parse header line: %w", err)
+			}
+			format = header
+			output = append(output, line)
+		case '*':
+			user, id, err := header.ParseUserLine(line[1:])
+			if err != nil {
+				return 0, fmt.Errorf("failed to parse user line: %w", err)
+			}
+			hash := util.Base64Encode(id)
+			if _, exists := placeholders[hash]; exists {
+				break
+			}
+			if isAnonymousUser(&user) { // keep existing placeholders as they are
+				placeholders[hash] = hash
+				output = append(output, "*"+format.FormatUserLine(&user, id))
+				break
+			}
+			if _, err := addPlaceholder(hash); err != nil {
+				return 0, err
+			}
+			replaced++
+		case uint8(LOGIN), uint8(LOGOUT):
+			parts := strings.SplitN(line[1:], "\t", 2)
+			if len(parts) != 2 {
+				return 0, fmt.Errorf("failed to parse event line \"%s\"", line)
+			}
+			placeholder, exists := placeholders[parts[0]]
+			if !exists { // events of users without user line still reveal the ID
+				if placeholder, err = addPlaceholder(parts[0]); err != nil {
+					return 0, err
+				}
+				replaced++
+			}
+			output = append(output, line[:1]+placeholder+"\t"+parts[1])
+		default:
+			return 0, fmt.Errorf("unknown journal line \"%s\"", line)
+		}
+	}
+	if replaced == 0 {
+		return 0, nil
+	}
+
+	if output, err = keepChainEnd(filePath, output); err != nil {
+		return 0, err
+	}
+	if err := writeJournalLines(filePath, output, chainKey, cipher); err != nil {
+		return 0, fmt.Errorf("failed to replace journal with anonymised journal: %w", err)
+	}
+	return replaced, nil
+}
@@ -0,0 +1,269 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+const retentionTestJournal = "*Tester\tTeststadt\n" +
+	"+HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1634700000\n" +
+	"*Klaus\tMusterdorf\n" +
+	"+O+Dig24BxOFwjJEN1oBbk/VW/tA=\tTST\t1634710000\n" +
+	"-HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1634711000\n" +
+	"-O+Dig24BxOFwjJEN1oBbk/VW/tA=\tTST\t1634712000\tauto\n"
+
+// createRetentionTestJournals creates a journal for each of the given days before now in the directory.
+func createRetentionTestJournals(t *testing.T, directory string, now time.Time, daysAgo ...int) []string {
+	files := make([]string, len(daysAgo))
+	for i, days := range daysAgo {
+		files[i] = path.Join(directory, util.GetDateFilename(now.AddDate(0, 0, -days))+journalFileExtension)
+		require.NoError(t, ioutil.WriteFile(files[i], []byte(retentionTestJournal), 0660))
+	}
+	return files
+}
+
+func TestParseRetentionMode(t *testing.T) {
+	t.Parallel()
+	mode, err := ParseRetentionMode("purge")
+	if assert.NoError(t, err) {
+		assert.Equal(t, PURGE, mode)
+	}
+	mode, err = ParseRetentionMode("anonymise")
+	if assert.NoError(t, err) {
+		assert.Equal(t, ANONYMISE, mode)
+	}
+	_, err = ParseRetentionMode("delete")
+	assert.Error(t, err)
+}
+
+func TestApplyRetention_purge(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+	now := time.Now()
+	files := createRetentionTestJournals(t, tempDir, now, 30, 29, 28, 0)
+
+	records, err := ApplyRetention(tempDir, RetentionPolicy{Days: 28, Mode: PURGE}, now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []RetentionRecord{
+			{File: files[0], Mode: PURGE, Users: 2},
+			{File: files[1], Mode: PURGE, Users: 2},
+		}, records)
+	}
+	assert.NoFileExists(t, files[0])
+	assert.NoFileExists(t, files[1])
+	assert.FileExists(t, files[2], "journals within the retention period should be kept")
+	assert.FileExists(t, files[3], "journals within the retention period should be kept")
+
+	info, err := os.Stat(path.Join(tempDir, DefaultAuditFileName))
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "only the owner should read the audit trail")
+	}
+	audit, err := ioutil.ReadFile(path.Join(tempDir, DefaultAuditFileName))
+	if assert.NoError(t, err, "the audit trail should be written") {
+		auditLines := strings.Split(strings.TrimSpace(string(audit)), "\n")
+		if assert.Len(t, auditLines, 2) {
+			assert.True(t, strings.HasSuffix(auditLines[0], "\tpurge\t"+files[0]+"\t2 users"), "unexpected audit line \"%s\"", auditLines[0])
+		}
+	}
+
+	records, err = ApplyRetention(tempDir, RetentionPolicy{Days: 28, Mode: PURGE}, now)
+	if assert.NoError(t, err) {
+		assert.Empty(t, records, "nothing should be purged twice")
+	}
+}
+
+func TestApplyRetention_rotation(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+	now := time.Date(2021, time.November, 18, 12, 0, 0, 0, time.Local) // a thursday, 28 days after 2021-10-21
+	names := []string{"2021-W41.txt", "2021-W42.txt", "20211020-23.txt", "20211020-23_002.txt", "20211021-00.txt"}
+	for _, name := range names {
+		require.NoError(t, ioutil.WriteFile(path.Join(tempDir, name), []byte(retentionTestJournal), 0660))
+	}
+
+	records, err := ApplyRetention(tempDir, RetentionPolicy{Days: 28, Mode: PURGE}, now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []RetentionRecord{
+			{File: path.Join(tempDir, "2021-W41.txt"), Mode: PURGE, Users: 2},
+			{File: path.Join(tempDir, "20211020-23.txt"), Mode: PURGE, Users: 2},
+			{File: path.Join(tempDir, "20211020-23_002.txt"), Mode: PURGE, Users: 2},
+		}, records)
+	}
+	assert.FileExists(t, path.Join(tempDir, "2021-W42.txt"), "a week should be kept until all of its days expired")
+	assert.FileExists(t, path.Join(tempDir, "20211021-00.txt"))
+}
+
+func TestApplyRetention_anonymise(t *testing.T) {
+	Locations = map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}}
+	tempDir := t.TempDir()
+	auditFile := path.Join(t.TempDir(), "audit.log")
+	now := time.Now()
+	files := createRetentionTestJournals(t, tempDir, now, 10, 1)
+	policy := RetentionPolicy{Days: 7, Mode: ANONYMISE, AuditFile: auditFile}
+
+	records, err := ApplyRetention(tempDir, policy, now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []RetentionRecord{{File: files[0], Mode: ANONYMISE, Users: 2}}, records)
+	}
+	content, err := ioutil.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "Tester", "user data should be removed")
+	assert.NotContains(t, string(content), "HjLV+aPwKzq3szuae53Zv5n4puw=", "user hashes should be removed")
+
+	journal, err := ReadJournal(files[0])
+	if assert.NoError(t, err, "anonymised journals should stay readable") {
+		events := journal.GetEvents()
+		if assert.Len(t, events, 4, "all events should be kept") {
+			assert.Equal(t, "Anonymous 1", events[0].User.Name)
+			assert.Equal(t, "Anonymous 2", events[1].User.Name)
+			assert.True(t, isAnonymousUser(events[0].User) && isAnonymousUser(events[1].User))
+			assert.Same(t, events[0].User, events[2].User, "sessions should be retained")
+			assert.Equal(t, int64(1634710000), events[1].Timestamp)
+			assert.Equal(t, AUTOMATIC, events[3].Flag)
+		}
+	}
+	assert.FileExists(t, auditFile)
+
+	records, err = ApplyRetention(tempDir, policy, now)
+	if assert.NoError(t, err) {
+		assert.Empty(t, records, "already anonymised journals should be skipped")
+	}
+	unchanged, err := ioutil.ReadFile(files[0])
+	if assert.NoError(t, err) {
+		assert.Equal(t, content, unchanged)
+	}
+}
+
+func TestApplyRetention_anonymiseUnlinkable(t *testing.T) {
+	Locations = map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}}
+	tempDir := t.TempDir()
+	now := time.Now()
+	files := createRetentionTestJournals(t, tempDir, now, 10, 9)
+	_, err := MigrateJournal(files[1], WriterConfig{})
+	require.NoError(t, err)
+
+	records, err := ApplyRetention(tempDir, RetentionPolicy{Days: 7, Mode: ANONYMISE}, now)
+	if assert.NoError(t, err) {
+		assert.Len(t, records, 2)
+	}
+	ids := make([]string, len(files))
+	for i, file := range files {
+		content, err := ioutil.ReadFile(file)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(content), "@version=3\tids=sha1\n"),
+			"%s should have a header to carry the placeholder IDs", file)
+		ids[i] = strings.SplitN(strings.Split(string(content), "\n")[1], "\t", 2)[0]
+
+		journal, err := ReadJournal(file)
+		if assert.NoError(t, err, "anonymised journals should stay readable") && assert.Len(t, journal.GetEvents(), 4) {
+			assert.Equal(t, "Anonymous 1", journal.GetEvents()[0].User.Name)
+			assert.Same(t, journal.GetEvents()[0].User, journal.GetEvents()[2].User, "sessions should be retained")
+		}
+	}
+	assert.NotEqual(t, ids[0], ids[1], "the same placeholder should get another ID in each journal")
+
+	journal, err := ReadJournals(files)
+	if assert.NoError(t, err) && assert.Len(t, journal.GetEvents(), 8) {
+		users := make(map[*User]bool, 4)
+		for _, event := range journal.GetEvents() {
+			users[event.User] = true
+		}
+		assert.Len(t, users, 4, "placeholders of different journals are different persons")
+	}
+}
+
+func TestApplyRetention_anonymiseSecured(t *testing.T) {
+	Locations = map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}}
+	tempDir := t.TempDir()
+	now := time.Now()
+	config := WriterConfig{ChainKey: []byte("secret"), EncryptionKey: testEncryptionKey}
+	file := path.Join(tempDir, util.GetDateFilename(now.AddDate(0, 0, -3))+journalFileExtension)
+
+	// write an encrypted and chained journal like the writer does
+	cipher, err := NewCipher(config.EncryptionKey)
+	require.NoError(t, err)
+	chain := NewChain(config.ChainKey)
+	content := ""
+	for _, line := range strings.Split(strings.TrimSpace(retentionTestJournal), "\n") {
+		encrypted, err := cipher.Encrypt(line)
+		require.NoError(t, err)
+		content += chain.Seal(encrypted) + "\n"
+	}
+	require.NoError(t, ioutil.WriteFile(file, []byte(content), 0660))
+
+	_, err = ApplyRetention(tempDir, RetentionPolicy{Days: 1, Mode: ANONYMISE}, now)
+	assert.Error(t, err, "encrypted journals can't be anonymised without the key")
+
+	policy := RetentionPolicy{Days: 1, Mode: ANONYMISE, ChainKey: config.ChainKey, EncryptionKey: config.EncryptionKey}
+	records, err := ApplyRetention(tempDir, policy, now)
+	if assert.NoError(t, err) {
+		assert.Len(t, records, 1)
+	}
+	lines, err := VerifyChain(config.ChainKey, file)
+	if assert.NoError(t, err, "anonymised journals should be sealed in a new chain") {
+		assert.Equal(t, 7, lines, "the legacy journal should have been upgraded to a header")
+	}
+	journal, err := ReadJournalsWithConfig([]string{file}, ReaderConfig{EncryptionKey: config.EncryptionKey})
+	if assert.NoError(t, err, "anonymised journals should be encrypted again") {
+		assert.Len(t, journal.GetEvents(), 4)
+	}
+}
+
+func TestApplyRetention_anonymiseKeyed(t *testing.T) {
+	Locations = map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}}
+	tempDir := t.TempDir()
+	now := time.Now()
+	file := createRetentionTestJournals(t, tempDir, now, 3)[0]
+	_, err := MigrateJournal(file, WriterConfig{UserIDKey: testUserIDKey})
+	require.NoError(t, err)
+	keyed, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	ids := strings.SplitN(strings.Split(string(keyed), "\n")[1], "\t", 2)[0]
+
+	records, err := ApplyRetention(tempDir, RetentionPolicy{Days: 1, Mode: ANONYMISE}, now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []RetentionRecord{{File: file, Mode: ANONYMISE, Users: 2}}, records)
+	}
+	content, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(content), "@version=3\tids=hmac-sha256"), "the header should be kept")
+	assert.NotContains(t, string(content), "Tester", "user data should be removed")
+	assert.NotContains(t, string(content), ids, "keyed user IDs should be removed")
+
+	journal, err := ReadJournal(file)
+	if assert.NoError(t, err, "anonymised journals should stay readable") && assert.Len(t, journal.GetEvents(), 4) {
+		assert.Equal(t, "Anonymous 1", journal.GetEvents()[0].User.Name)
+		assert.True(t, isAnonymousUser(journal.GetEvents()[0].User))
+		assert.Same(t, journal.GetEvents()[0].User, journal.GetEvents()[2].User, "sessions should be retained")
+	}
+}
+
+func TestApplyRetention_invalid(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+	_, err := ApplyRetention(tempDir, RetentionPolicy{Days: 0, Mode: PURGE}, time.Now())
+	assert.Error(t, err, "the retention period must be positive")
+	_, err = ApplyRetention(tempDir, RetentionPolicy{Days: 1, Mode: "delete"}, time.Now())
+	assert.Error(t, err, "the mode must be valid")
+	_, err = ApplyRetention(tempDir, RetentionPolicy{Days: 1, Mode: PURGE, EncryptionKey: []byte("short")}, time.Now())
+	assert.Error(t, err, "the encryption key must be valid")
+	_, err = ApplyRetention(path.Join(tempDir, "missing"), RetentionPolicy{Days: 1, Mode: PURGE}, time.Now())
+	assert.Error(t, err, "the directory must exist")
+
+	file := createRetentionTestJournals(t, tempDir, time.Now(), 5)[0]
+	require.NoError(t, os.Mkdir(path.Join(tempDir, "audit"), 0777))
+	_, err = ApplyRetention(tempDir, RetentionPolicy{Days: 1, Mode: PURGE, AuditFile: path.Join(tempDir, "audit")}, time.Now())
+	assert.Error(t, err, "failing to open the audit trail should be reported")
+	assert.FileExists(t, file, "journals should only be purged if the audit trail can be written")
+}
@@ -0,0 +1,216 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"fmt"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RotationPeriod defines the time span that a journal file covers, before the Writer starts the next one.
+type RotationPeriod string
+
+const (
+	// HOURLY starts a new journal file every hour, the files are named like "20211020-14.txt".
+	HOURLY RotationPeriod = "hourly"
+	// DAILY starts a new journal file every day at midnight, the files are named like "20211020.txt".
+	DAILY RotationPeriod = "daily"
+	// WEEKLY starts a new journal file every monday at midnight, the files are named by the ISO week like "2021-W42.txt".
+	WEEKLY RotationPeriod = "weekly"
+)
+
+// ParseRotationPeriod parses the textual representation of a RotationPeriod.
+func ParseRotationPeriod(text string) (RotationPeriod, error) {
+	switch period := RotationPeriod(text); period {
+	case HOURLY, DAILY, WEEKLY:
+		return period, nil
+	default:
+		return "", fmt.Errorf("unknown rotation period \"%s\", expected \"%s\", \"%s\" or \"%s\"", text, HOURLY, DAILY, WEEKLY)
+	}
+}
+
+// Start returns the start of the period that contains the time, in local time.
+func (period RotationPeriod) Start(t time.Time) time.Time {
+	t = t.In(time.Local)
+	switch period {
+	case HOURLY:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, time.Local)
+	case WEEKLY:
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, time.Local)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	}
+}
+
+// Next returns the start of the period following the one that contains the time.
+func (period RotationPeriod) Next(t time.Time) time.Time {
+	start := period.Start(t)
+	switch period {
+	case HOURLY: // adding the duration keeps the hours distinct when the clocks change
+		return period.Start(start.Add(time.Hour))
+	case WEEKLY:
+		return time.Date(start.Year(), start.Month(), start.Day()+7, 0, 0, 0, 0, time.Local)
+	default:
+		return time.Date(start.Year(), start.Month(), start.Day()+1, 0, 0, 0, 0, time.Local)
+	}
+}
+
+// name returns the base name of the journal files of the period that contains the time.
+// The names of a period sort in chronological order.
+func (period RotationPeriod) name(t time.Time) string {
+	start := period.Start(t)
+	switch period {
+	case HOURLY:
+		return fmt.Sprintf("%s-%02d", util.GetDateFilename(start), start.Hour())
+	case WEEKLY:
+		year, week := start.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	default:
+		return util.GetDateFilename(start)
+	}
+}
+
+// RotationPolicy defines when the Writer starts a new journal file.
+type RotationPolicy struct {
+	// Period is the time span of a journal file, an empty period is the same as DAILY
+	Period RotationPeriod
+	// MaxSize is the size in bytes after which the next file of the same period is started, 0 disables the limit.
+	// The file of a period is named like "20211020.txt", the following ones like "20211020_002.txt".
+	MaxSize int64
+}
+
+// JournalName describes the time span and the part of a journal file, as given by its file name.
+type JournalName struct {
+	// Period is the time span of the journal file
+	Period RotationPeriod
+	// Start is the beginning of the time span of the journal file
+	Start time.Time
+	// Part is the number of the journal file within its period, starting at 1
+	Part int
+}
+
+// End returns the end of the time span of the journal file, exclusively.
+func (name JournalName) End() time.Time {
+	return name.Period.Next(name.Start)
+}
+
+// String returns the file name of the uncompressed journal file.
+func (name JournalName) String() string {
+	if name.Part > 1 {
+		return fmt.Sprintf("%s_%03d%s", name.Period.name(name.Start), name.Part, journalFileExtension)
+	}
+	return name.Period.name(name.Start) + journalFileExtension
+}
+
+// ParseJournalName parses the file name of a journal file of any RotationPeriod, it may be compressed.
+func ParseJournalName(fileName string) (JournalName, error) {
+	base := strings.TrimSuffix(fileName, compressedFileExtension)
+	if !strings.HasSuffix(base, journalFileExtension) {
+		return JournalName{}, fmt.Errorf("\"%s\" is not a journal file name", fileName)
+	}
+	base = strings.TrimSuffix(base, journalFileExtension)
+	name := JournalName{Part: 1}
+	if index := strings.LastIndexByte(base, '_'); index >= 0 {
+		part, err := strconv.Atoi(base[index+1:])
+		if err != nil || part < 2 || base[index+1:] != fmt.Sprintf("%03d", part) {
+			return JournalName{}, fmt.Errorf("\"%s\" is not a journal file name: invalid part", fileName)
+		}
+		name.Part = part
+		base = base[:index]
+	}
+
+	var err error
+	switch {
+	case len(base) == len("20060102-15"):
+		name.Period = HOURLY
+		name.Start, err = time.ParseInLocation("20060102-15", base, time.Local)
+	case len(base) == len("2006-W01") && base[4:6] == "-W":
+		name.Period = WEEKLY
+		name.Start, err = parseISOWeek(base)
+	default:
+		name.Period = DAILY
+		name.Start, err = util.ParseDateFilename(base)
+	}
+	if err != nil {
+		return JournalName{}, fmt.Errorf("\"%s\" is not a journal file name: %w", fileName, err)
+	}
+	if name.Period.name(name.Start) != base { // e.g. an hour that the clocks skipped
+		return JournalName{}, fmt.Errorf("\"%s\" is not a journal file name: invalid time", fileName)
+	}
+	return name, nil
+}
+
+// parseISOWeek parses an ISO week like "2021-W42" into the local time of its monday.
+func parseISOWeek(text string) (time.Time, error) {
+	year, err := strconv.Atoi(text[:4])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid year: %w", err)
+	}
+	week, err := strconv.Atoi(text[6:])
+	if err != nil || week < 1 || week > 53 {
+		return time.Time{}, fmt.Errorf("invalid week \"%s\"", text[6:])
+	}
+	// the 4th of january is always in the first week
+	firstMonday := WEEKLY.Start(time.Date(year, time.January, 4, 0, 0, 0, 0, time.Local))
+	return time.Date(firstMonday.Year(), firstMonday.Month(), firstMonday.Day()+7*(week-1), 0, 0, 0, 0, time.Local), nil
+}
+
+// GetJournalPath determines the path of the journal file for the time, based on the rotation policy.
+// It's the last existing file of the period, or the next one if the last one reached the MaxSize or is compressed.
+func GetJournalPath(directory string, policy RotationPolicy, t time.Time) (string, error) {
+	return getJournalPath(directory, policy, t, false)
+}
+
+// getJournalPath determines the path of the journal file for the time like GetJournalPath.
+// If nextPart is true, the path of the file following the last existing one of the period is returned.
+func getJournalPath(directory string, policy RotationPolicy, t time.Time, nextPart bool) (string, error) {
+	if policy.Period == "" {
+		policy.Period = DAILY
+	}
+	name := JournalName{Period: policy.Period, Start: policy.Period.Start(t), Part: 1}
+	for ; ; name.Part++ { // parts are only ever added after the last one, so they have no gaps
+		exists, err := journalFileExists(path.Join(directory, name.String()))
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			if name.Part > 1 {
+				name.Part--
+			}
+			break
+		}
+	}
+	filePath := path.Join(directory, name.String())
+	compressed, err := util.FileExists(filePath + compressedFileExtension)
+	if err != nil {
+		return "", fmt.Errorf("failed to check for journal file \"%s\": %w", filePath, err)
+	}
+	full := false
+	if info, err := os.Stat(filePath); err == nil && policy.MaxSize > 0 {
+		full = info.Size() >= policy.MaxSize
+	}
+	if nextPart || compressed || full { // compressed journals are closed
+		name.Part++
+	}
+	return path.Join(directory, name.String()), nil
+}
+
+// journalFileExists checks whether the journal file exists, either uncompressed or compressed.
+func journalFileExists(filePath string) (bool, error) {
+	for _, candidate := range []string{filePath, filePath + compressedFileExtension} {
+		if exists, err := util.FileExists(candidate); err != nil {
+			return false, fmt.Errorf("failed to check for journal file \"%s\": %w", candidate, err)
+		} else if exists {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,196 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRotationPeriod(t *testing.T) {
+	for _, period := range []RotationPeriod{HOURLY, DAILY, WEEKLY} {
+		parsed, err := ParseRotationPeriod(string(period))
+		if assert.NoError(t, err) {
+			assert.Equal(t, period, parsed)
+		}
+	}
+	_, err := ParseRotationPeriod("monthly")
+	assert.Error(t, err)
+	_, err = ParseRotationPeriod("")
+	assert.Error(t, err)
+}
+
+func TestRotationPeriod_Start(t *testing.T) {
+	now := time.Date(2021, time.October, 20, 14, 35, 10, 0, time.Local) // a wednesday
+	values := [...]struct {
+		period RotationPeriod
+		start  time.Time
+		next   time.Time
+		name   string
+	}{
+		{HOURLY, time.Date(2021, time.October, 20, 14, 0, 0, 0, time.Local),
+			time.Date(2021, time.October, 20, 15, 0, 0, 0, time.Local), "20211020-14"},
+		{DAILY, time.Date(2021, time.October, 20, 0, 0, 0, 0, time.Local),
+			time.Date(2021, time.October, 21, 0, 0, 0, 0, time.Local), "20211020"},
+		{WEEKLY, time.Date(2021, time.October, 18, 0, 0, 0, 0, time.Local),
+			time.Date(2021, time.October, 25, 0, 0, 0, 0, time.Local), "2021-W42"},
+	}
+	for _, value := range values {
+		assert.Equal(t, value.start, value.period.Start(now), "%s", value.period)
+		assert.Equal(t, value.next, value.period.Next(now), "%s", value.period)
+		assert.Equal(t, value.name, value.period.name(now), "%s", value.period)
+		assert.Equal(t, value.start, value.period.Start(value.start), "%s: the start is part of the period", value.period)
+		assert.Equal(t, value.next, value.period.Start(value.next), "%s: the next period starts at its start", value.period)
+	}
+
+	sunday := time.Date(2021, time.January, 3, 23, 0, 0, 0, time.Local)
+	assert.Equal(t, time.Date(2020, time.December, 28, 0, 0, 0, 0, time.Local), WEEKLY.Start(sunday))
+	assert.Equal(t, "2020-W53", WEEKLY.name(sunday), "weeks should be named by their ISO year")
+}
+
+func TestParseJournalName(t *testing.T) {
+	values := [...]struct {
+		fileName string
+		expected JournalName
+	}{
+		{"20211020.txt", JournalName{DAILY, time.Date(2021, time.October, 20, 0, 0, 0, 0, time.Local), 1}},
+		{"20211020.txt.gz", JournalName{DAILY, time.Date(2021, time.October, 20, 0, 0, 0, 0, time.Local), 1}},
+		{"20211020_002.txt", JournalName{DAILY, time.Date(2021, time.October, 20, 0, 0, 0, 0, time.Local), 2}},
+		{"20211020-14.txt", JournalName{HOURLY, time.Date(2021, time.October, 20, 14, 0, 0, 0, time.Local), 1}},
+		{"20211020-00_1234.txt.gz", JournalName{HOURLY, time.Date(2021, time.October, 20, 0, 0, 0, 0, time.Local), 1234}},
+		{"2021-W42.txt", JournalName{WEEKLY, time.Date(2021, time.October, 18, 0, 0, 0, 0, time.Local), 1}},
+		{"2020-W53_010.txt", JournalName{WEEKLY, time.Date(2020, time.December, 28, 0, 0, 0, 0, time.Local), 10}},
+		{"2021-W01.txt", JournalName{WEEKLY, time.Date(2021, time.January, 4, 0, 0, 0, 0, time.Local), 1}},
+	}
+	for _, value := range values {
+		name, err := ParseJournalName(value.fileName)
+		if assert.NoError(t, err, value.fileName) {
+			assert.Equal(t, value.expected, name, value.fileName)
+			assert.Equal(t, strings.TrimSuffix(value.fileName, compressedFileExtension), name.String(),
+				"%s: the name should be formatted the same way", value.fileName)
+		}
+	}
+
+	invalid := []string{
+		"notes.txt", "20211020.csv", "20211020", "20211032.txt", "20211020-24.txt", "2021-W54.txt", "2021-W53.txt",
+		"2021-W1.txt", "20211020_001.txt", "20211020_2.txt", "20211020_+02.txt", "20211020_.txt", "_002.txt",
+		"20211020-14-15.txt", "+0211020.txt",
+	}
+	for _, fileName := range invalid {
+		_, err := ParseJournalName(fileName)
+		assert.Error(t, err, fileName)
+	}
+
+	name, err := ParseJournalName("2021-W42.txt")
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.Date(2021, time.October, 25, 0, 0, 0, 0, time.Local), name.End())
+	}
+}
+
+func TestGetJournalPath(t *testing.T) {
+	directory := t.TempDir()
+	now := time.Date(2021, time.October, 20, 14, 35, 10, 0, time.Local)
+	filePath, err := GetJournalPath(directory, RotationPolicy{}, now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, path.Join(directory, "20211020.txt"), filePath, "the default should be daily")
+	}
+	filePath, err = GetJournalPath(directory, RotationPolicy{Period: HOURLY}, now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, path.Join(directory, "20211020-14.txt"), filePath)
+	}
+
+	policy := RotationPolicy{Period: WEEKLY, MaxSize: 10}
+	require.NoError(t, os.WriteFile(path.Join(directory, "2021-W42.txt"), []byte("123456789"), 0660))
+	filePath, err = GetJournalPath(directory, policy, now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, path.Join(directory, "2021-W42.txt"), filePath, "files below the maximum size should be continued")
+	}
+	require.NoError(t, os.WriteFile(path.Join(directory, "2021-W42.txt"), []byte("1234567890"), 0660))
+	filePath, err = GetJournalPath(directory, policy, now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, path.Join(directory, "2021-W42_002.txt"), filePath, "full files should be continued in the next part")
+	}
+	require.NoError(t, os.WriteFile(path.Join(directory, "2021-W42_002.txt.gz"), []byte{}, 0660))
+	require.NoError(t, os.WriteFile(path.Join(directory, "2021-W42_003.txt"), []byte("123"), 0660))
+	filePath, err = GetJournalPath(directory, policy, now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, path.Join(directory, "2021-W42_003.txt"), filePath, "the last part should be continued")
+	}
+	filePath, err = getJournalPath(directory, policy, now, true)
+	if assert.NoError(t, err) {
+		assert.Equal(t, path.Join(directory, "2021-W42_004.txt"), filePath)
+	}
+	require.NoError(t, os.Rename(path.Join(directory, "2021-W42_003.txt"), path.Join(directory, "2021-W42_003.txt.gz")))
+	filePath, err = GetJournalPath(directory, RotationPolicy{Period: WEEKLY}, now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, path.Join(directory, "2021-W42_004.txt"), filePath, "compressed files should not be continued")
+	}
+}
+
+func TestWriter_rotationMaxSize(t *testing.T) {
+	directory := t.TempDir()
+	location := &Location{Name: "Teststadt", Code: "TST"}
+	Locations = map[string]*Location{"TST": location}
+	config := WriterConfig{ChainKey: []byte("secret"), Rotation: RotationPolicy{Period: HOURLY, MaxSize: 350}}
+	writer, err := NewWriterWithConfig(directory, config)
+	require.NoError(t, err)
+	assert.Equal(t, HOURLY.name(time.Now())+journalFileExtension, path.Base(writer.outputPath))
+
+	present := User{Name: "Present", Address: "Teststadt"}
+	require.NoError(t, writer.WriteEventUser(&present, location, LOGIN))
+	for i := 0; i < 5; i++ {
+		user := User{Name: "Tester", Address: "Teststadt"}
+		require.NoError(t, writer.WriteEventUser(&user, location, LOGIN))
+		require.NoError(t, writer.WriteEventUser(&user, location, LOGOUT))
+	}
+	require.NoError(t, writer.Close())
+
+	files, err := ListJournalFiles(directory, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Greater(t, len(files), 2, "the journal should have been rotated by size")
+	for i, file := range files {
+		name, err := ParseJournalName(path.Base(file))
+		if assert.NoError(t, err) {
+			assert.Equal(t, i+1, name.Part)
+		}
+		_, err = VerifyChain(config.ChainKey, file)
+		assert.NoError(t, err, "%s should have its own hash chain", file)
+		info, err := os.Stat(file)
+		require.NoError(t, err)
+		assert.Less(t, info.Size(), int64(2*350), "%s should be rotated soon after reaching the size", file)
+	}
+
+	journal, err := ReadJournals(files)
+	require.NoError(t, err)
+	logins := 0
+	for _, event := range journal.GetEvents() {
+		if event.EventType == LOGIN && event.Flag == NOFLAG {
+			logins++
+		}
+		if assert.NotNil(t, event.User, "every file should resolve its users") {
+			assert.Contains(t, []string{"Present", "Tester"}, event.User.Name)
+		}
+	}
+	assert.Equal(t, 6, logins)
+
+	expected, err := GetJournalPath(directory, config.Rotation, time.Now())
+	require.NoError(t, err)
+	writer, err = NewWriterWithConfig(directory, config)
+	require.NoError(t, err)
+	defer func() { _ = writer.Close() }()
+	assert.Equal(t, expected, writer.outputPath, "a restarted writer should continue the last part unless it's full")
+	location, err = writer.GetCurrentUserLocation(writer.UserID(&present))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "TST", location.Code, "the present user should be known after the restart")
+	}
+
+	_, err = NewWriterWithConfig(directory, WriterConfig{Rotation: RotationPolicy{Period: "monthly"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,91 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"context"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"time"
+)
+
+// Snapshot rebuilds the presence state at the given time by replaying the events of the iterator up to that time.
+// It returns the users that were checked in at the time, ordered by location code and check-in time,
+// and identifies them by the unkeyed hash of their identity (see User.Hash), as that is the same across journals.
+// A user is checked in by the last login before the time, unless the user checked out at its location afterwards.
+// The events are ordered by their timestamps, so the journals of several servers may be given in any order.
+// Check-ins that were carried over from journals that weren't read are dated at their original check-in time.
+// The iterator is consumed up to its end, its errors and diagnostics are left to the caller.
+func Snapshot(iterator *EventIterator, at time.Time) []PresentUser {
+	until := at.Unix()
+	logins := make(map[*User]snapshotEvent, 100)
+	logouts := make(map[*User]map[*Location]snapshotEvent, 100)
+	for sequence := 0; iterator.Next(); sequence++ {
+		event := iterator.Event()
+		if event.OccurredAt() > until || event.User == nil { // automatic logouts are written after the deadline
+			continue
+		}
+		current := snapshotEvent{event: event, sequence: sequence}
+		switch event.EventType {
+		case LOGIN:
+			if last, exists := logins[event.User]; !exists || last.before(current) {
+				logins[event.User] = current
+			}
+		case LOGOUT:
+			if logouts[event.User] == nil {
+				logouts[event.User] = make(map[*Location]snapshotEvent, 1)
+			}
+			if last, exists := logouts[event.User][event.Location]; !exists || last.before(current) {
+				logouts[event.User][event.Location] = current
+			}
+		}
+	}
+
+	users := make([]PresentUser, 0, len(logins))
+	for user, login := range logins {
+		if logout, exists := logouts[user][login.event.Location]; exists && login.before(logout) {
+			continue
+		}
+		since := login.event.Timestamp
+		if login.event.Flag == CARRIED && login.event.Since != 0 {
+			since = login.event.Since
+		}
+		users = append(users, PresentUser{
+			UserID:   util.Base64Encode(user.Hash()),
+			User:     user,
+			Location: login.event.Location,
+			Since:    time.Unix(since, 0),
+		})
+	}
+	sortPresentUsers(users)
+	return users
+}
+
+// snapshotEvent is an event with its position in the iteration, which orders events of the same second.
+type snapshotEvent struct {
+	event    Event
+	sequence int
+}
+
+// before returns true if the event happened before the other one.
+func (event snapshotEvent) before(other snapshotEvent) bool {
+	if event.event.Timestamp != other.event.Timestamp {
+		return event.event.Timestamp < other.event.Timestamp
+	}
+	return event.sequence < other.sequence
+}
+
+// ReadSnapshot reads the journal files and rebuilds the presence state at the given time, see Snapshot.
+func ReadSnapshot(filepaths []string, config ReaderConfig, at time.Time) ([]PresentUser, error) {
+	iterator, err := NewEventIterator(context.Background(), filepaths, config)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = iterator.Close() }()
+	users := Snapshot(iterator, at)
+	if err := iterator.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
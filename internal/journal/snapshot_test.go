@@ -0,0 +1,76 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestReadSnapshot(t *testing.T) {
+	teststadt := &Location{Name: "Teststadt", Code: "TST"}
+	hauptstadt := &Location{Name: "Hauptstadt", Code: "HST"}
+	Locations = map[string]*Location{"TST": teststadt, "HST": hauptstadt}
+	tempDir := t.TempDir()
+	first := path.Join(tempDir, "20211020.txt")
+	second := path.Join(tempDir, "campus.txt") // the journal of another server, with earlier events
+	require.NoError(t, ioutil.WriteFile(first, []byte(retentionTestJournal), 0660))
+	require.NoError(t, ioutil.WriteFile(second, []byte("*Klaus\tMusterdorf\n*Tester\tTeststadt\n"+
+		"+O+Dig24BxOFwjJEN1oBbk/VW/tA=\tHST\t1634705000\n"+
+		"-HjLV+aPwKzq3szuae53Zv5n4puw=\tHST\t1634700500\n"), 0660))
+	tester := User{Name: "Tester", Address: "Teststadt"}
+	klaus := User{Name: "Klaus", Address: "Musterdorf"}
+
+	type snapshotUser struct {
+		User     User
+		Location *Location
+		Since    int64
+	}
+	values := [...]struct {
+		at       int64
+		expected []snapshotUser
+	}{
+		{1634699999, []snapshotUser{}},
+		{1634700000, []snapshotUser{{tester, teststadt, 1634700000}}},
+		{1634706000, []snapshotUser{{klaus, hauptstadt, 1634705000}, {tester, teststadt, 1634700000}}},
+		{1634710500, []snapshotUser{{tester, teststadt, 1634700000}, {klaus, teststadt, 1634710000}}},
+		{1634711500, []snapshotUser{{klaus, teststadt, 1634710000}}},
+		{1634712000, []snapshotUser{}},
+	}
+	for _, value := range values {
+		users, err := ReadSnapshot([]string{first, second}, ReaderConfig{}, time.Unix(value.at, 0))
+		if !assert.NoError(t, err) {
+			continue
+		}
+		actual := make([]snapshotUser, len(users))
+		for i, user := range users {
+			actual[i] = snapshotUser{*user.User, user.Location, user.Since.Unix()}
+			assert.Equal(t, util.Base64Encode(user.User.Hash()), user.UserID)
+		}
+		assert.Equal(t, value.expected, actual, "snapshot at %d", value.at)
+	}
+
+	_, err := ReadSnapshot([]string{path.Join(tempDir, "missing.txt")}, ReaderConfig{}, time.Now())
+	assert.Error(t, err)
+}
+
+func TestReadSnapshot_carried(t *testing.T) {
+	teststadt := &Location{Name: "Teststadt", Code: "TST"}
+	Locations = map[string]*Location{"TST": teststadt}
+	journalPath := path.Join(t.TempDir(), "20211021.txt")
+	require.NoError(t, ioutil.WriteFile(journalPath, []byte("*Tester\tTeststadt\n"+
+		"+HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1634774400\tcarried\t1634700000\n"), 0660))
+
+	users, err := ReadSnapshot([]string{journalPath}, ReaderConfig{}, time.Unix(1634780000, 0))
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, teststadt, users[0].Location)
+	assert.Equal(t, int64(1634700000), users[0].Since.Unix(), "the original check-in time should be kept")
+}
@@ -0,0 +1,67 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"fmt"
+	"time"
+)
+
+// Store is a storage backend for the journal data.
+// The Writer stores the data in daily journal files, the MemoryStore keeps it in memory, e.g. for tests.
+type Store interface {
+	// WriteUserIfUnknown stores the given User data if it's not already known and returns the user hash.
+	WriteUserIfUnknown(user *User) (string, error)
+	// WriteEventUserHash stores an event with the given type for the known user with the given hash.
+	WriteEventUserHash(userHash string, location *Location, eventType EventType) error
+	// WriteEventUser stores an event with the given type for the User, storing the User data first if it's unknown.
+	WriteEventUser(user *User, location *Location, eventType EventType) error
+	// LoginIfNotPresent atomically checks the User in at the location, unless the User is already checked in somewhere.
+	// In that case, an error wrapping ErrAlreadyPresent is returned.
+	LoginIfNotPresent(user *User, location *Location) error
+	// LogoutIfPresent atomically checks the User out of the location, if the User is checked in there.
+	// Otherwise, an error wrapping ErrNotPresent is returned.
+	LogoutIfPresent(user *User, location *Location) error
+	// UserID returns the ID that identifies the User in the store, e.g. for GetCurrentUserLocation.
+	UserID(user *User) string
+	// GetCurrentUserLocation returns the location where the user with the given ID is currently checked in, if any.
+	GetCurrentUserLocation(hash string) (*Location, error)
+	// PresentUsers lists the users that are currently checked in at the location, ordered by their check-in time.
+	// A nil location lists the users of all locations, ordered by location code first.
+	PresentUsers(location *Location) []PresentUser
+	// Occupancy counts the users that are currently checked in per location, locations without users are left out.
+	Occupancy() map[*Location]int
+	// ReadEvents reads back the stored events in the inclusive time range from "from" to "to" in chronological order.
+	// Zero times leave the range open.
+	ReadEvents(from time.Time, to time.Time) ([]Event, error)
+	// Close releases the resources of the store.
+	Close() error
+}
+
+// ReadEvents reads back the events in the inclusive time range from the journal files in the writer's directory.
+// Zero times leave the range open.
+func (writer *Writer) ReadEvents(from time.Time, to time.Time) ([]Event, error) {
+	files, err := ListJournalFiles(writer.directory, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list journal files for reading events: %w", err)
+	}
+	journal, err := ReadJournalsWithConfig(files, ReaderConfig{EncryptionKey: writer.config.EncryptionKey})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
+	return filterEvents(journal.GetEvents(), from, to), nil
+}
+
+// filterEvents returns the events in the inclusive time range, zero times leave the range open.
+func filterEvents(events []Event, from time.Time, to time.Time) []Event {
+	filtered := make([]Event, 0, len(events))
+	for _, event := range events {
+		if (!from.IsZero() && event.Timestamp < from.Unix()) || (!to.IsZero() && event.Timestamp > to.Unix()) {
+			continue
+		}
+		filtered = append(filtered, event)
+	}
+	return filtered
+}
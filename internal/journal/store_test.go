@@ -0,0 +1,139 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// testStore runs the behaviour every Store has to provide against the given store.
+func testStore(t *testing.T, store Store) {
+	Locations = map[string]*Location{
+		"TST": {Code: "TST", Name: "Teststadt"},
+		"HST": {Code: "HST", Name: "Hauptstadt"},
+	}
+	tester := User{Name: "Tester", Address: "Teststadt"}
+	testerHash := store.UserID(&tester)
+	start := time.Now()
+
+	_, err := store.GetCurrentUserLocation(testerHash)
+	assert.Error(t, err, "unknown users should produce an error")
+	assert.Error(t, store.WriteEventUserHash(testerHash, Locations["TST"], LOGIN), "events of unknown users should be rejected")
+
+	hash, err := store.WriteUserIfUnknown(&tester)
+	if assert.NoError(t, err) {
+		assert.Equal(t, testerHash, hash)
+	}
+	loc, err := store.GetCurrentUserLocation(testerHash)
+	if assert.NoError(t, err, "known users should be found") {
+		assert.Nil(t, loc)
+	}
+
+	require.NoError(t, store.WriteEventUserHash(testerHash, Locations["TST"], LOGIN))
+	loc, err = store.GetCurrentUserLocation(testerHash)
+	if assert.NoError(t, err) {
+		assert.Equal(t, Locations["TST"], loc)
+	}
+	require.NoError(t, store.WriteEventUser(&tester, Locations["TST"], LOGOUT))
+	require.NoError(t, store.WriteEventUser(&User{Name: "Klaus", Address: "Musterdorf"}, Locations["HST"], LOGIN))
+	loc, err = store.GetCurrentUserLocation(testerHash)
+	if assert.NoError(t, err) {
+		assert.Nil(t, loc, "logged out users should be at no location")
+	}
+
+	events, err := store.ReadEvents(time.Time{}, time.Time{})
+	if assert.NoError(t, err) && assert.Len(t, events, 3) {
+		assert.Equal(t, LOGIN, events[0].EventType)
+		assert.Equal(t, tester, *events[0].User)
+		assert.Equal(t, Locations["TST"], events[0].Location)
+		assert.Equal(t, EventType(LOGOUT), events[1].EventType)
+		assert.Equal(t, "Klaus", events[2].User.Name)
+		assert.Equal(t, Locations["HST"], events[2].Location)
+	}
+	events, err = store.ReadEvents(start.Add(-time.Second), time.Now())
+	if assert.NoError(t, err) {
+		assert.Len(t, events, 3, "the events should be in the time range")
+	}
+	events, err = store.ReadEvents(time.Now().Add(time.Hour), time.Time{})
+	if assert.NoError(t, err) {
+		assert.Empty(t, events, "no events should be in a future time range")
+	}
+	events, err = store.ReadEvents(time.Time{}, start.Add(-time.Hour))
+	if assert.NoError(t, err) {
+		assert.Empty(t, events, "no events should be in a past time range")
+	}
+
+	klaus := User{Name: "Klaus", Address: "Musterdorf"}
+	err = store.LoginIfNotPresent(&klaus, Locations["TST"])
+	assert.ErrorIs(t, err, ErrAlreadyPresent, "present users should not be checked in again")
+	assert.ErrorIs(t, store.LogoutIfPresent(&klaus, Locations["TST"]), ErrNotPresent, "users should only be checked out of their location")
+	assert.ErrorIs(t, store.LogoutIfPresent(&tester, Locations["TST"]), ErrNotPresent, "absent users should not be checked out")
+	assert.NoError(t, store.LogoutIfPresent(&klaus, Locations["HST"]))
+	assert.NoError(t, store.LoginIfNotPresent(&klaus, Locations["TST"]))
+	loc, err = store.GetCurrentUserLocation(store.UserID(&klaus))
+	if assert.NoError(t, err) {
+		assert.Equal(t, Locations["TST"], loc)
+	}
+
+	// concurrent logins of the same user must only succeed once
+	concurrent := User{Name: "Concurrent", Address: "Teststadt"}
+	results := make(chan error, 20)
+	for i := 0; i < cap(results); i++ {
+		go func() { results <- store.LoginIfNotPresent(&concurrent, Locations["HST"]) }()
+	}
+	succeeded := 0
+	for i := 0; i < cap(results); i++ {
+		if err := <-results; err == nil {
+			succeeded++
+		} else {
+			assert.ErrorIs(t, err, ErrAlreadyPresent)
+		}
+	}
+	assert.Equal(t, 1, succeeded, "exactly one concurrent login should succeed")
+
+	present := store.PresentUsers(nil)
+	if assert.Len(t, present, 2, "all present users should be listed") {
+		assert.Equal(t, Locations["HST"], present[0].Location, "present users should be ordered by location")
+		assert.Equal(t, concurrent, *present[0].User)
+		assert.Equal(t, store.UserID(&concurrent), present[0].UserID)
+		assert.Equal(t, klaus, *present[1].User)
+		assert.Equal(t, Locations["TST"], present[1].Location)
+		assert.False(t, present[1].Since.Before(start.Truncate(time.Second)), "the check-in time should be reported")
+		assert.False(t, present[1].Since.After(time.Now()))
+	}
+	present = store.PresentUsers(Locations["TST"])
+	if assert.Len(t, present, 1) {
+		assert.Equal(t, klaus, *present[0].User)
+	}
+	assert.Equal(t, map[*Location]int{Locations["TST"]: 1, Locations["HST"]: 1}, store.Occupancy())
+	events, err = store.ReadEvents(time.Time{}, time.Time{})
+	if assert.NoError(t, err) {
+		assert.Len(t, events, 6)
+	}
+
+	assert.NoError(t, store.Close())
+}
+
+func TestWriter_Store(t *testing.T) {
+	writer, err := NewWriterWithConfig(t.TempDir(), WriterConfig{EncryptionKey: testEncryptionKey})
+	require.NoError(t, err)
+	testStore(t, writer)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFilterEvents(t *testing.T) {
+	t.Parallel()
+	events := []Event{{Timestamp: 100}, {Timestamp: 200}, {Timestamp: 300}}
+	assert.Equal(t, events, filterEvents(events, time.Time{}, time.Time{}))
+	assert.Equal(t, events[1:], filterEvents(events, time.Unix(200, 0), time.Time{}))
+	assert.Equal(t, events[:2], filterEvents(events, time.Time{}, time.Unix(200, 0)))
+	assert.Equal(t, events[1:2], filterEvents(events, time.Unix(150, 0), time.Unix(250, 0)))
+}
@@ -0,0 +1,125 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"os"
+)
+
+// IDScheme names the algorithm that derives the IDs of users in journals from their data.
+type IDScheme string
+
+const (
+	// SHA1IDS are unkeyed SHA-1 hashes of the identity of the users, see User.Hash.
+	// Journals with the LegacyHeader hash the user data as it is instead, as their IDs were never normalised.
+	// Anyone can confirm that a known person is in a journal by hashing a guess, so they're only read for old journals.
+	SHA1IDS IDScheme = "sha1"
+	// HMACIDS are HMAC-SHA256 values of the user data with a key held by the server.
+	HMACIDS IDScheme = "hmac-sha256"
+)
+
+// UserIDKeySize is the required size of the keys for keyed user IDs.
+const UserIDKeySize = 32
+
+// keyIDSize is the number of bytes of the key identifier in journal headers.
+const keyIDSize = 9
+
+// UserIDs derives the pseudonymous IDs that identify users in journals.
+// A nil UserIDs derives the unkeyed SHA1IDS of journals with the LegacyHeader.
+type UserIDs struct {
+	// key is the key of the HMAC, nil for unkeyed SHA1IDS
+	key []byte
+	// header is the header of journals with these IDs
+	header Header
+}
+
+// NewUserIDs creates UserIDs that derive HMACIDS with the given key of UserIDKeySize bytes.
+// An empty key results in the unkeyed SHA1IDS.
+func NewUserIDs(key []byte) (*UserIDs, error) {
+	if len(key) == 0 {
+		return &UserIDs{header: Header{Version: CurrentFormatVersion, IDs: SHA1IDS}}, nil
+	}
+	if len(key) != UserIDKeySize {
+		return nil, fmt.Errorf("user ID key must be %d bytes long, got %d", UserIDKeySize, len(key))
+	}
+	// The key ID tells which key the IDs were derived with, without revealing the key
+	keyID := hmac.New(sha256.New, key)
+	keyID.Write([]byte("lets-goooo user ID key"))
+	return &UserIDs{
+		key:    key,
+		header: Header{Version: CurrentFormatVersion, IDs: HMACIDS, KeyID: util.Base64Encode(keyID.Sum(nil)[:keyIDSize])},
+	}, nil
+}
+
+// NewUserIDKey generates a random key for keyed user IDs.
+func NewUserIDKey() ([]byte, error) {
+	key := make([]byte, UserIDKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate user ID key: %w", err)
+	}
+	return key, nil
+}
+
+// LoadOrCreateUserIDKey loads the key for keyed user IDs from the key file.
+// If the file doesn't exist, it's created with a new random key, so that the IDs stay the same across restarts.
+// The file is only readable by its owner, as the key allows to confirm that a known person is in a journal.
+// Empty key files are rejected instead of being replaced, as the key may have been lost.
+func LoadOrCreateUserIDKey(keyFile string) ([]byte, error) {
+	key, err := util.LoadKey("", keyFile, UserIDKeySize)
+	if err == nil && key == nil { // an empty key would silently switch to unkeyed IDs
+		return nil, fmt.Errorf("user ID key file \"%s\" is empty", keyFile)
+	}
+	if err == nil || !errors.Is(err, os.ErrNotExist) {
+		return key, err
+	}
+	if key, err = NewUserIDKey(); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(keyFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user ID key file \"%s\": %w", keyFile, err)
+	}
+	_, err = file.WriteString(util.Base64Encode(key) + "\n")
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(keyFile) // an incomplete key would be rejected on the next start
+		return nil, fmt.Errorf("failed to write user ID key file \"%s\": %w", keyFile, err)
+	}
+	return key, nil
+}
+
+// ID derives the raw ID of the user from the identity of the user, see User.Identity.
+// The IDs of journals with the LegacyHeader stay the hash of the user data to remain compatible with them.
+func (ids *UserIDs) ID(user *User) []byte {
+	if ids == nil {
+		return user.lineHash()
+	}
+	if ids.key == nil {
+		return user.Hash()
+	}
+	identity := user.Identity()
+	mac := hmac.New(sha256.New, ids.key)
+	mac.Write([]byte(identity.ToJournalLine()))
+	return mac.Sum(nil)
+}
+
+// Header returns the header of journals with these IDs.
+func (ids *UserIDs) Header() Header {
+	if ids == nil {
+		return LegacyHeader
+	}
+	return ids.header
+}
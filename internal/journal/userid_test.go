@@ -0,0 +1,164 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package journal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+var testUserIDKey = []byte("thisisthe32bytekeyofthetestusers")
+
+func TestNewUserIDs(t *testing.T) {
+	t.Parallel()
+	user := User{Name: "Tester", Address: "Teststadt"}
+
+	legacy, err := NewUserIDs(nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, Header{Version: CurrentFormatVersion, IDs: SHA1IDS}, legacy.Header())
+		assert.Equal(t, user.Hash(), legacy.ID(&user), "without key, the unkeyed hashes should be derived")
+	}
+	assert.Equal(t, user.lineHash(), (*UserIDs)(nil).ID(&user), "journals without header should keep their IDs")
+	assert.Equal(t, LegacyHeader, (*UserIDs)(nil).Header())
+
+	keyed, err := NewUserIDs(testUserIDKey)
+	require.NoError(t, err)
+	assert.Equal(t, CurrentFormatVersion, keyed.Header().Version)
+	assert.Equal(t, HMACIDS, keyed.Header().IDs)
+	assert.NotEmpty(t, keyed.Header().KeyID)
+	assert.NotContains(t, keyed.Header().KeyID, string(testUserIDKey))
+	assert.Len(t, keyed.ID(&user), 32)
+	assert.NotEqual(t, user.Hash(), keyed.ID(&user))
+	assert.Equal(t, keyed.ID(&user), keyed.ID(&User{Name: "Tester", Address: "Teststadt"}), "IDs should be deterministic")
+	assert.NotEqual(t, keyed.ID(&user), keyed.ID(&User{Name: "Tester", Address: "Musterdorf"}))
+	assert.Equal(t, keyed.ID(&user), keyed.ID(&User{Name: "tester ", Address: "TESTSTADT"}), "keyed IDs should identify the person")
+	assert.Equal(t, legacy.ID(&user), legacy.ID(&User{Name: "tester ", Address: "TESTSTADT"}), "unkeyed IDs should identify the person")
+	assert.NotEqual(t, (*UserIDs)(nil).ID(&user), (*UserIDs)(nil).ID(&User{Name: "tester ", Address: "TESTSTADT"}),
+		"the IDs of journals without header should stay compatible")
+
+	other, err := NewUserIDs([]byte("anotherkeyofthirtytwobyteslength"))
+	if assert.NoError(t, err) {
+		assert.NotEqual(t, keyed.Header(), other.Header(), "the key ID should identify the key")
+		assert.NotEqual(t, keyed.ID(&user), other.ID(&user))
+	}
+
+	_, err = NewUserIDs([]byte("short"))
+	assert.Error(t, err)
+}
+
+func TestNewUserIDKey(t *testing.T) {
+	t.Parallel()
+	key, err := NewUserIDKey()
+	if assert.NoError(t, err) {
+		assert.Len(t, key, UserIDKeySize)
+		_, err = NewUserIDs(key)
+		assert.NoError(t, err)
+	}
+}
+
+func TestLoadOrCreateUserIDKey(t *testing.T) {
+	keyFile := path.Join(t.TempDir(), "user-id.key")
+	key, err := LoadOrCreateUserIDKey(keyFile)
+	require.NoError(t, err)
+	assert.Len(t, key, UserIDKeySize)
+	info, err := os.Stat(keyFile)
+	if assert.NoError(t, err, "the key should be saved") {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "only the owner should be able to read the key")
+	}
+	loaded, err := LoadOrCreateUserIDKey(keyFile)
+	if assert.NoError(t, err) {
+		assert.Equal(t, key, loaded, "the saved key should be used after a restart")
+	}
+
+	require.NoError(t, ioutil.WriteFile(keyFile, []byte("short"), 0600))
+	_, err = LoadOrCreateUserIDKey(keyFile)
+	assert.Error(t, err, "invalid keys should not be replaced")
+	require.NoError(t, ioutil.WriteFile(keyFile, []byte("\n"), 0600))
+	_, err = LoadOrCreateUserIDKey(keyFile)
+	assert.Error(t, err, "empty keys should not be used")
+	_, err = LoadOrCreateUserIDKey(path.Join(keyFile, "missing", "user-id.key"))
+	assert.Error(t, err)
+}
+
+func TestWriter_userIDs(t *testing.T) {
+	tempDir := t.TempDir()
+	Locations = map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}}
+	user := User{Name: "Tester", Address: "Teststadt"}
+	config := WriterConfig{UserIDKey: testUserIDKey}
+	ids, err := NewUserIDs(testUserIDKey)
+	require.NoError(t, err)
+
+	_, err = NewWriterWithConfig(tempDir, WriterConfig{UserIDKey: []byte("short")})
+	assert.Error(t, err, "invalid user ID keys should fail the writer creation")
+
+	// an existing journal of the day with unkeyed IDs
+	filePath := GetCurrentJournalPath(tempDir)
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(retentionTestJournal[:strings.Index(retentionTestJournal, "*Klaus")]), 0660))
+
+	writer, err := NewWriterWithConfig(tempDir, config)
+	require.NoError(t, err, "failed to create writer with keyed user IDs")
+	assert.Equal(t, util.Base64Encode(ids.ID(&user)), writer.UserID(&user))
+	loc, err := writer.GetCurrentUserLocation(writer.UserID(&user))
+	if assert.NoError(t, err, "the migrated journal should be loaded") {
+		assert.Equal(t, Locations["TST"], loc)
+	}
+	require.NoError(t, writer.LogoutIfPresent(&user, Locations["TST"]))
+	require.NoError(t, writer.Close())
+
+	content, err := ioutil.ReadFile(filePath)
+	require.NoError(t, err)
+	header := ids.Header()
+	assert.True(t, strings.HasPrefix(string(content), "@"+header.ToJournalLine()+"\n"), "the header should be the first line")
+	assert.NotContains(t, string(content), "HjLV+aPwKzq3szuae53Zv5n4puw=", "unkeyed IDs should be migrated")
+	journal, err := ReadJournal(filePath)
+	if assert.NoError(t, err) && assert.Len(t, journal.GetEvents(), 2) {
+		assert.Equal(t, user, *journal.GetEvents()[1].User)
+		assert.Equal(t, EventType(LOGOUT), journal.GetEvents()[1].EventType)
+	}
+
+	_, err = NewWriter(tempDir)
+	assert.Error(t, err, "journals with keyed IDs can't be continued without the key")
+}
+
+func TestWriter_userIDsRotation(t *testing.T) {
+	tempDir := t.TempDir()
+	location := &Location{Name: "Teststadt", Code: "TST"}
+	Locations = map[string]*Location{"TST": location}
+	user := User{Name: "Tester", Address: "Teststadt"}
+	rotation := RotationPolicy{Period: DAILY, MaxSize: 10}
+	otherKey, err := NewUserIDKey()
+	require.NoError(t, err)
+
+	writer, err := NewWriterWithConfig(tempDir, WriterConfig{UserIDKey: otherKey, Rotation: rotation})
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteEventUser(&user, location, LOGIN))
+	require.NoError(t, writer.Close())
+
+	// the full journal with other IDs is continued in the next part
+	writer, err = NewWriterWithConfig(tempDir, WriterConfig{UserIDKey: testUserIDKey, Rotation: rotation})
+	require.NoError(t, err)
+	loc, err := writer.GetCurrentUserLocation(writer.UserID(&user))
+	if assert.NoError(t, err, "the present user should be known by the current ID") {
+		assert.Equal(t, location, loc)
+	}
+	currentPath := writer.outputPath
+	require.NoError(t, writer.Close())
+	name, err := ParseJournalName(path.Base(currentPath))
+	require.NoError(t, err)
+	assert.Equal(t, 2, name.Part)
+
+	journal, err := ReadJournal(currentPath)
+	require.NoError(t, err)
+	assert.Empty(t, journal.Diagnostics(), "the carried login should reference the carried user line")
+	if assert.Len(t, journal.GetEvents(), 1) {
+		assert.Equal(t, user, *journal.GetEvents()[0].User)
+	}
+}
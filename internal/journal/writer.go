@@ -6,12 +6,14 @@ package journal
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/util"
 	"log"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -19,29 +21,163 @@ import (
 
 var FileCreationPermissions = 0777
 
+// DirectoryCreationPermissions are the permissions of new journal directories.
+// Only the owner may open them, as the journals contain personal data whatever the permissions of the files are.
+const DirectoryCreationPermissions = 0700
+
+// privateFilePermissions are the permissions of the files besides the journals, like the quarantine and the audit trail,
+// which only the owner may read, as they may contain personal data or tell about it.
+const privateFilePermissions = 0600
+
+// journalFileExtension is the file extension used for journal files.
+const journalFileExtension = ".txt"
+
 // Writer is a write-only class to write to journal files.
 type Writer struct {
-	// knownUsers contains the hashes for the currently known users and their current location.
-	knownUsers map[string]*Location
+	// knownUsers maps the hashes of the users known in the current journal file to their presence.
+	// It must only be used while holding the outputLock.
+	knownUsers map[string]*presence
 	// directory is the base directory for the journal files
 	directory string
-	// outputLock is a mutex for using the output in a thread-safe way.
+	// outputLock is a mutex for using the output and the known users in a thread-safe way.
 	// It needs to be locked for mutation as well as writes to the output.
 	outputLock sync.Mutex
 	// output is the current output stream for the journal.
 	// It is usually a file but this should not be relied upon.
 	output io.Writer
+	// outputPath is the file path of the current output
+	outputPath string
+	// config contains the optional settings of the writer
+	config WriterConfig
+	// chain is the hash chain of the current output, nil if no chain key is configured
+	chain *Chain
+	// cipher encrypts the journal records, nil if no encryption key is configured
+	cipher *Cipher
+	// ids derives the IDs of the users
+	ids *UserIDs
+	// unsynced is true if lines were written to the output since it was last flushed to the disk
+	unsynced bool
+	// listeners are notified about the written users and events, see AddListener.
+	// It must only be used while holding the outputLock.
+	listeners map[int]Listener
+	// nextListenerID is the key of the next listener added to the listeners
+	nextListenerID int
+	// replicationWake wakes up the replication after lines were written, nil if no follower is configured
+	replicationWake chan struct{}
+	// outputSize is the size of the current output file
+	outputSize int64
+	// carriedSize is the size of the current output file after the users were carried over
+	carriedSize int64
+	// lastUser is the hash of the user whose user line was the last line written, so that its event follows it
+	lastUser string
+}
+
+// WriterConfig holds the optional settings of a Writer.
+type WriterConfig struct {
+	// ChainKey is the secret for sealing each journal line in a hash chain, an empty key disables the chain
+	ChainKey []byte
+	// EncryptionKey is the key of EncryptionKeySize bytes to encrypt the journal records with.
+	// An empty key disables the encryption.
+	EncryptionKey []byte
+	// Retention is the policy applied to old journals on every rotation, it is disabled for 0 days
+	Retention RetentionPolicy
+	// CompressJournals enables compressing the journal files after the rotation
+	CompressJournals bool
+	// Sync defines when written lines are flushed to the disk, an empty mode is the same as SYNCNONE
+	Sync SyncMode
+	// UserIDKey is the key of UserIDKeySize bytes for the keyed HMACIDS of the users.
+	// An empty key results in the unkeyed SHA1IDS.
+	UserIDKey []byte
+	// Replica is the follower that the journals are replicated to, see Writer.TrackReplication
+	Replica ReplicaConfig
+	// Rotation defines when a new journal file is started, the zero value starts one every day
+	Rotation RotationPolicy
+}
+
+// SyncMode defines when the lines written to the journal are flushed to the disk.
+type SyncMode string
+
+const (
+	// SYNCNONE leaves flushing the lines to the operating system.
+	SYNCNONE SyncMode = "none"
+	// SYNCEVENT flushes every line right after writing it.
+	SYNCEVENT SyncMode = "event"
+	// SYNCBATCH flushes the lines in batches, see Writer.TrackJournalSync.
+	SYNCBATCH SyncMode = "batch"
+)
+
+// ParseSyncMode parses the textual representation of a SyncMode.
+func ParseSyncMode(text string) (SyncMode, error) {
+	switch mode := SyncMode(text); mode {
+	case SYNCNONE, SYNCEVENT, SYNCBATCH:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown sync mode \"%s\", expected \"%s\", \"%s\" or \"%s\"", text, SYNCNONE, SYNCEVENT, SYNCBATCH)
+	}
+}
+
+// presence describes what the Writer knows about a user.
+type presence struct {
+	// user is the user's data, it may be nil if only the user's hash is known
+	user *User
+	// location is the current location of the user or nil if the user isn't checked in anywhere
+	location *Location
+	// since is the unix timestamp of the user's last check-in
+	since int64
 }
 
 // NewWriter creates a new Writer with the given base directory where journal files will be stored.
 // If a file for the current date already exists, it'll recover the data and append to that file.
 func NewWriter(directory string) (*Writer, error) {
+	return NewWriterWithConfig(directory, WriterConfig{})
+}
+
+// NewWriterWithConfig creates a new Writer like NewWriter, using the given optional settings.
+func NewWriterWithConfig(directory string, config WriterConfig) (*Writer, error) {
 	writer := Writer{
-		directory: directory,
+		directory:  directory,
+		config:     config,
+		knownUsers: createKnownUserMap(100),
+	}
+	if config.Replica.URL != "" {
+		writer.replicationWake = make(chan struct{}, 1)
+	}
+	if config.Rotation.Period == "" {
+		writer.config.Rotation.Period = DAILY
+	} else if _, err := ParseRotationPeriod(string(config.Rotation.Period)); err != nil {
+		return nil, err
+	}
+	if len(config.EncryptionKey) > 0 {
+		var err error
+		if writer.cipher, err = NewCipher(config.EncryptionKey); err != nil {
+			return nil, fmt.Errorf("failed to set up journal encryption: %w", err)
+		}
+	}
+	var err error
+	if writer.ids, err = NewUserIDs(config.UserIDKey); err != nil {
+		return nil, fmt.Errorf("failed to set up user IDs: %w", err)
 	}
 
-	err := writer.UpdateOutput()
-	filePath := GetCurrentJournalPath(writer.directory)
+	// a full journal file is continued in the next part, which needs the users that are still present
+	lastPath, err := getJournalPath(directory, RotationPolicy{Period: writer.config.Rotation.Period}, time.Now(), false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine the last journal file: %w", err)
+	}
+	if currentPath, err := GetJournalPath(directory, writer.config.Rotation, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to determine the current journal file: %w", err)
+	} else if currentPath != lastPath {
+		if exists, err := util.FileExists(lastPath); err != nil {
+			return nil, fmt.Errorf("failed trying to check for existing journal data: %w", err)
+		} else if exists {
+			if err := writer.LoadFrom(lastPath); err != nil {
+				return nil, fmt.Errorf("failed to parse existing journal data data: %w", err)
+			}
+		}
+	}
+	if err = writer.UpdateOutput(); err != nil {
+		return &writer, fmt.Errorf("failed to create new journal writer: %w", err)
+	}
+	filePath := writer.outputPath
 	if exists, err := util.FileExists(filePath); exists {
 		if err := writer.LoadFrom(filePath); err != nil {
 			return nil, fmt.Errorf("failed to parse existing journal data data: %w", err)
@@ -49,16 +185,13 @@ func NewWriter(directory string) (*Writer, error) {
 	} else if err != nil {
 		return nil, fmt.Errorf("failed trying to check for existing journal data: %w", err)
 	}
-
-	if err != nil {
-		return &writer, fmt.Errorf("failed to create new journal writer: %w", err)
-	}
 	return &writer, nil
 }
 
-// GetCurrentJournalPath determines the current journal output file path for today based on the given journal directory.
+// GetCurrentJournalPath determines the path of today's journal file in the given journal directory,
+// for writers with the default daily rotation without size limit. See GetJournalPath for other policies.
 func GetCurrentJournalPath(directory string) string {
-	return path.Join(directory, util.GetDateFilename(time.Now())+".txt")
+	return path.Join(directory, util.GetDateFilename(time.Now())+journalFileExtension)
 }
 
 // LoadFrom extracts already known users from the given journal file.
@@ -73,20 +206,34 @@ func (writer *Writer) LoadFrom(filePath string) error {
 		}
 	}()
 
+	writer.outputLock.Lock()
+	defer writer.outputLock.Unlock()
+	header := LegacyHeader
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		line := scanner.Text()
+		line, err := DecodeLine(scanner.Text(), writer.cipher)
+		if err != nil {
+			log.Printf("Failed to decode line \"%s\": %v", scanner.Text(), err)
+			continue
+		}
+		if line == "" {
+			continue
+		}
 		switch line[0] {
+		case headerRecord:
+			if header, err = ParseHeaderLine(line[1:]); err != nil {
+				return fmt.Errorf("failed to parse the header of the existing journal: %w", err)
+			}
 		case '*': // line indicating new User
-			user, err := ParseUserJournalLine(line[1:])
+			user, id, err := header.ParseUserLine(line[1:])
 			if err != nil {
 				log.Printf("Failed to parse user line \"%s\"", line[1:])
 				break
 			}
-			writer.knownUsers[util.Base64Encode(user.Hash())] = nil
-		case '+':
-			parts := strings.SplitN(line[1:], "\t", 3)
-			if parts == nil {
+			writer.getPresence(util.Base64Encode(id)).user = &user
+		case '+': // logins, including carried over ones, which keep the time of the original check-in
+			parts := strings.SplitN(line[1:], "\t", 5)
+			if len(parts) < 2 {
 				log.Printf("Failed to parse login line \"%s\"", line[1:])
 				break
 			}
@@ -95,32 +242,63 @@ func (writer *Writer) LoadFrom(filePath string) error {
 				log.Printf("Failed to resolve location \"%s\"", parts[1])
 				break
 			}
-			writer.knownUsers[parts[0]] = loc
+			userPresence := writer.getPresence(parts[0])
+			userPresence.location = loc
+			if len(parts) > 4 && EventFlag(parts[3]) == CARRIED {
+				userPresence.since, _ = strconv.ParseInt(parts[4], 10, 64)
+			} else if len(parts) > 2 {
+				userPresence.since, _ = strconv.ParseInt(parts[2], 10, 64)
+			}
 		case '-':
 			parts := strings.SplitN(line[1:], "\t", 2)
-			if parts == nil {
+			if len(parts) < 2 {
 				log.Printf("Failed to parse logout line \"%s\"", line[1:])
 				break
 			}
-			writer.knownUsers[parts[0]] = nil
+			writer.getPresence(parts[0]).location = nil
 		}
 	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read existing data for journal writer: %w", err)
+	}
 
 	return nil
 }
 
+// getPresence returns the presence for the given user hash, creating it if the user is unknown.
+// The outputLock must be held by the caller.
+func (writer *Writer) getPresence(hash string) *presence {
+	userPresence, exists := writer.knownUsers[hash]
+	if !exists {
+		userPresence = &presence{}
+		writer.knownUsers[hash] = userPresence
+	}
+	return userPresence
+}
+
+// UserID returns the ID that identifies the user in the journal.
+func (writer *Writer) UserID(user *User) string {
+	return util.Base64Encode(writer.ids.ID(user))
+}
+
+// GetCurrentUserLocation returns the location where the given user is currently checked in, if any.
 func (writer *Writer) GetCurrentUserLocation(hash string) (*Location, error) {
-	loc, exists := writer.knownUsers[hash]
+	writer.outputLock.Lock()
+	defer writer.outputLock.Unlock()
+	userPresence, exists := writer.knownUsers[hash]
 	if !exists {
 		return nil, fmt.Errorf("unkown user hash \"%s\"", hash)
 	}
-	return loc, nil
+	return userPresence.location, nil
 }
 
 // Close closes the file handle to the journal file.
 func (writer *Writer) Close() error {
 	writer.outputLock.Lock()
 	defer writer.outputLock.Unlock()
+	if err := writer.syncLocked(); err != nil {
+		return err
+	}
 	if closer, ok := writer.output.(io.Closer); ok {
 		err := closer.Close()
 		if err != nil {
@@ -130,35 +308,175 @@ func (writer *Writer) Close() error {
 	return nil
 }
 
-// UpdateOutput updates the output journal file to the current date.
+// UpdateOutput updates the output journal file to the current period of the rotation policy.
+// Users that are still checked in are carried over to the new file,
+// so that it starts with their user lines and a CARRIED login for each of them.
 func (writer *Writer) UpdateOutput() error {
 	writer.outputLock.Lock()
 	defer writer.outputLock.Unlock()
+	return writer.updateOutputLocked(false)
+}
+
+// rotateIfFullLocked starts the next journal file of the period, if the current one reached the maximum size.
+// Files that only contain the carried over users are never rotated, so that the rotation can't loop.
+// The outputLock must be held by the caller.
+func (writer *Writer) rotateIfFullLocked() error {
+	maxSize := writer.config.Rotation.MaxSize
+	if maxSize <= 0 || writer.outputSize < maxSize || writer.outputSize <= writer.carriedSize {
+		return nil
+	}
+	if err := writer.updateOutputLocked(true); err != nil {
+		return fmt.Errorf("failed to rotate full journal: %w", err)
+	}
+	return nil
+}
+
+// updateOutputLocked updates the output journal file like UpdateOutput.
+// If nextPart is true, the file following the current one of the period is started.
+// The outputLock must be held by the caller.
+func (writer *Writer) updateOutputLocked(nextPart bool) error {
+	if err := writer.syncLocked(); err != nil {
+		return err
+	}
 	if closable, ok := writer.output.(io.Closer); ok {
 		if err := closable.Close(); err != nil {
 			return fmt.Errorf("failed to close journal output: %w", err)
 		}
 	}
 	writer.output = nil
-	filePath := GetCurrentJournalPath(writer.directory)
-	err := os.MkdirAll(path.Dir(filePath), os.FileMode(FileCreationPermissions))
+	filePath, err := getJournalPath(writer.directory, writer.config.Rotation, time.Now(), nextPart)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(path.Dir(filePath), DirectoryCreationPermissions)
 	if err != nil {
 		return fmt.Errorf("failed to create directories for journal: %w", err)
 	}
+	if torn, err := RecoverJournal(filePath); err != nil { // a crash may have left an incomplete line behind
+		return fmt.Errorf("failed to recover journal file \"%s\": %w", filePath, err)
+	} else if torn > 0 {
+		log.Printf("Moved torn tail of %d bytes from journal file \"%s\" to quarantine", torn, filePath)
+	}
+	needsHeader, err := writer.prepareOutputLocked(filePath)
+	if err != nil {
+		return err
+	}
 	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, os.FileMode(FileCreationPermissions))
 	if err != nil {
 		return fmt.Errorf("failed to open journal file \"%s\": %w", filePath, err)
 	}
 	writer.output = file
-	writer.knownUsers = createKnownUserMap(100)
+	writer.outputPath = filePath
+	if info, err := file.Stat(); err == nil {
+		writer.outputSize = info.Size()
+	} else {
+		return fmt.Errorf("failed to determine the size of journal file \"%s\": %w", filePath, err)
+	}
+	writer.chain = nil
+	if len(writer.config.ChainKey) > 0 { // continue the chain if the file already contains lines
+		if writer.chain, err = ResumeChain(writer.config.ChainKey, filePath); err != nil {
+			return fmt.Errorf("failed to set up hash chain for journal file \"%s\": %w", filePath, err)
+		}
+	}
+	header := writer.ids.Header()
+	if needsHeader {
+		fileHeader := header
+		if writer.chain != nil { // new files continue the hash chain of the previous file
+			fileHeader.PreviousMAC = writer.previousChainMAC(filePath)
+		}
+		if err := writer.writeLineLocked(string(headerRecord) + fileHeader.ToJournalLine()); err != nil {
+			return fmt.Errorf("failed to write journal header: %w", err)
+		}
+	}
+
+	// Only the users that are still present are known in the new file
+	knownUsers := createKnownUserMap(100)
+	now := time.Now().UTC().Unix()
+	for hash, userPresence := range writer.knownUsers {
+		if userPresence.location == nil {
+			continue
+		}
+		if userPresence.user == nil { // without user data the new file can't resolve the hash
+			log.Printf("Failed to carry over user \"%s\": missing user data", hash)
+			continue
+		}
+		// the user is identified by the current IDs, the previous file may have used other ones
+		id := writer.ids.ID(userPresence.user)
+		err := writer.writeLineLocked("*" + header.FormatUserLine(userPresence.user, id))
+		if err == nil {
+			since := userPresence.since
+			if since == 0 { // the check-in time is unknown, e.g. in journals before it was carried over
+				since = now
+			}
+			err = writer.writeLineLocked(FormatCarriedLoginJournalLine(util.Base64Encode(id), userPresence.location, now, since))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to carry over present user: %w", err)
+		}
+		knownUsers[util.Base64Encode(id)] = userPresence
+	}
+	writer.knownUsers = knownUsers
+	writer.carriedSize = writer.outputSize
+	writer.lastUser = ""
 	return nil
 }
 
+// previousChainMAC returns the base64 encoded chain MAC of the last line of the journal file before the given one,
+// see Header.PreviousMAC. It's empty if there is no previous file or its chain can't be continued.
+func (writer *Writer) previousChainMAC(filePath string) string {
+	files, err := ListJournalFiles(writer.directory, time.Time{}, time.Time{})
+	if err != nil {
+		log.Printf("Failed to link the hash chain of journal file \"%s\": %v", filePath, err)
+		return ""
+	}
+	previous := ""
+	for _, file := range files {
+		if file == filePath {
+			break
+		}
+		previous = file
+	}
+	if previous == "" {
+		return ""
+	}
+	last, err := lastChainMAC(previous)
+	if err != nil { // e.g. journals from before the chain was enabled
+		log.Printf("Failed to link the hash chain of journal file \"%s\": %v", filePath, err)
+		return ""
+	}
+	if last == nil {
+		return ""
+	}
+	return util.Base64Encode(last)
+}
+
+// prepareOutputLocked makes sure that an existing journal file has the format of the writer before appending to it.
+// Journals in another format, e.g. of an older version or with unkeyed user IDs, are migrated.
+// It returns true if the file is new and needs a header. The outputLock must be held by the caller.
+func (writer *Writer) prepareOutputLocked(filePath string) (bool, error) {
+	header, exists, err := readJournalHeader(filePath, writer.cipher)
+	if err != nil {
+		return false, fmt.Errorf("failed to read the header of journal file \"%s\": %w", filePath, err)
+	}
+	wanted := writer.ids.Header()
+	if !exists {
+		return wanted.Version != LegacyFormatVersion, nil // the legacy format has no header
+	}
+	if header.sameFormat(wanted) {
+		return false, nil
+	}
+	if _, err := MigrateJournal(filePath, writer.config); err != nil {
+		return false, fmt.Errorf("failed to migrate journal file \"%s\": %w", filePath, err)
+	}
+	log.Printf("Migrated journal file \"%s\" to format version %d with %s user IDs", filePath, wanted.Version, wanted.IDs)
+	return false, nil
+}
+
 // writeLine writes a line to the journal.
 // It is thread-safe.
 func (writer *Writer) writeLine(line string) error {
 	writer.outputLock.Lock()
-	err := util.WriteString(writer.output, line+"\n")
+	err := writer.writeLineLocked(line)
 	writer.outputLock.Unlock()
 	if err != nil {
 		return fmt.Errorf("failed to write journal line: %w", err)
@@ -166,44 +484,154 @@ func (writer *Writer) writeLine(line string) error {
 	return nil
 }
 
-// writeUser writes the given User data to the journal.
-func (writer *Writer) writeUser(user *User) error {
-	writer.knownUsers[util.Base64Encode(user.Hash())] = nil
-	if err := writer.writeLine("*" + user.ToJournalLine()); err != nil {
-		return fmt.Errorf("failed to write User data: %w", err)
+// writeLineLocked writes a line to the journal, encrypting it and sealing it in the hash chain if configured.
+// The outputLock must be held by the caller.
+func (writer *Writer) writeLineLocked(line string) error {
+	if writer.cipher != nil {
+		var err error
+		if line, err = writer.cipher.Encrypt(line); err != nil {
+			return err
+		}
+	}
+	if writer.chain == nil {
+		if err := util.WriteString(writer.output, line+"\n"); err != nil {
+			return err
+		}
+		writer.outputSize += int64(len(line)) + 1
+		return writer.lineWrittenLocked()
+	}
+	previous := writer.chain.last
+	sealed := writer.chain.Seal(line)
+	if err := util.WriteString(writer.output, sealed+"\n"); err != nil {
+		writer.chain.last = previous // the line didn't make it into the journal
+		return err
+	}
+	writer.outputSize += int64(len(sealed)) + 1
+	return writer.lineWrittenLocked()
+}
+
+// lineWrittenLocked flushes the output after a line was written, depending on the sync mode.
+// The outputLock must be held by the caller.
+func (writer *Writer) lineWrittenLocked() error {
+	writer.unsynced = true
+	writer.replicationWrittenLocked()
+	if writer.config.Sync == SYNCEVENT {
+		return writer.syncLocked()
 	}
 	return nil
 }
 
-// WriteUserIfUnknown writes the given User data to the journal if it's not already present.
-func (writer *Writer) WriteUserIfUnknown(user *User) (string, error) {
-	hash := util.Base64Encode(user.Hash())
-	_, contains := writer.knownUsers[hash]
-	if !contains {
-		if err := writer.writeUser(user); err != nil {
-			return hash, fmt.Errorf("failed to write User data if unknown: %w", err)
+// syncLocked flushes the lines written to the output to the disk, if the output supports it.
+// The outputLock must be held by the caller.
+func (writer *Writer) syncLocked() error {
+	if !writer.unsynced {
+		return nil
+	}
+	if syncer, ok := writer.output.(interface{ Sync() error }); ok {
+		if err := syncer.Sync(); err != nil {
+			return fmt.Errorf("failed to flush journal output to disk: %w", err)
 		}
+	}
+	writer.unsynced = false
+	return nil
+}
+
+// Sync flushes the lines written to the journal to the disk.
+func (writer *Writer) Sync() error {
+	writer.outputLock.Lock()
+	defer writer.outputLock.Unlock()
+	return writer.syncLocked()
+}
+
+// ErrAlreadyPresent is returned when checking in a user that is already checked in somewhere.
+var ErrAlreadyPresent = errors.New("user is already checked in")
+
+// ErrNotPresent is returned when checking out a user that is not checked in at the location.
+var ErrNotPresent = errors.New("user is not checked in at the location")
+
+// writeUserLocked writes the given User data to the journal if it's not already present and returns the user hash.
+// The outputLock must be held by the caller.
+func (writer *Writer) writeUserLocked(user *User) (string, error) {
+	id := writer.ids.ID(user)
+	hash := util.Base64Encode(id)
+	if _, contains := writer.knownUsers[hash]; contains {
 		return hash, nil
 	}
+	if err := writer.rotateIfFullLocked(); err != nil {
+		return hash, err
+	}
+	header := writer.ids.Header()
+	if err := writer.writeLineLocked("*" + header.FormatUserLine(user, id)); err != nil {
+		return hash, fmt.Errorf("failed to write User data: %w", err)
+	}
+	writer.getPresence(hash).user = user
+	writer.lastUser = hash
+	writer.notifyLocked(WriteNotification{UserID: hash, User: user})
+	return hash, nil
+}
+
+// WriteUserIfUnknown writes the given User data to the journal if it's not already present.
+func (writer *Writer) WriteUserIfUnknown(user *User) (string, error) {
+	writer.outputLock.Lock()
+	defer writer.outputLock.Unlock()
+	hash, err := writer.writeUserLocked(user)
+	if err != nil {
+		return hash, fmt.Errorf("failed to write User data if unknown: %w", err)
+	}
 	return hash, nil
 }
 
 // WriteEventUserHash writes an event with the given type and User hash.
 func (writer *Writer) WriteEventUserHash(userHash string, location *Location, eventType EventType) error {
-	_, contains := writer.knownUsers[userHash]
+	return writer.writeEvent(userHash, location, eventType, NOFLAG)
+}
+
+// writeEvent writes an event with the given type and flag for the User hash.
+func (writer *Writer) writeEvent(userHash string, location *Location, eventType EventType, flag EventFlag) error {
+	writer.outputLock.Lock()
+	defer writer.outputLock.Unlock()
+	return writer.writeEventLocked(userHash, location, eventType, flag)
+}
+
+// writeEventLocked writes an event with the given type and flag for the User hash and updates the user's presence.
+// The outputLock must be held by the caller.
+func (writer *Writer) writeEventLocked(userHash string, location *Location, eventType EventType, flag EventFlag) error {
+	return writer.writeEventEntryLocked(userHash, Event{EventType: eventType, Location: location, Flag: flag})
+}
+
+// writeEventEntryLocked writes the event like writeEventLocked, keeping the deadline of automatic logouts.
+// The timestamp of the event is set to the current time. The outputLock must be held by the caller.
+func (writer *Writer) writeEventEntryLocked(userHash string, event Event) error {
+	location, eventType, now := event.Location, event.EventType, time.Now().UTC().Unix()
+	userPresence, contains := writer.knownUsers[userHash]
 	if !contains {
 		return fmt.Errorf("writing a user hash for an unkown user is not allowed")
 	}
-	err := writer.writeLine(fmt.Sprintf("%s%s\t%s\t%d", eventType.ToString(), userHash, location.Code, time.Now().UTC().Unix()))
+	if userPresence.user != nil && writer.lastUser != userHash { // without user data the new file couldn't resolve the hash
+		if err := writer.rotateIfFullLocked(); err != nil {
+			return err
+		}
+		if _, carried := writer.knownUsers[userHash]; !carried { // only present users are carried over
+			if _, err := writer.writeUserLocked(userPresence.user); err != nil {
+				return err
+			}
+			userPresence = writer.knownUsers[userHash]
+		}
+	}
+	event.User, event.Timestamp = userPresence.user, now
+	err := writer.writeLineLocked(formatEventJournalLine(&event, userHash))
 	if err != nil {
-		return fmt.Errorf("failed to write User event (type: %v): %w", eventType, err)
+		return fmt.Errorf("failed to write User event (type: %v): failed to write journal line: %w", eventType, err)
 	}
+	writer.lastUser = ""
 	switch eventType {
 	case LOGIN:
-		writer.knownUsers[userHash] = location
+		userPresence.location = location
+		userPresence.since = now
 	case LOGOUT:
-		writer.knownUsers[userHash] = nil
+		userPresence.location = nil
 	}
+	writer.notifyLocked(WriteNotification{UserID: userHash, User: userPresence.user, Event: &event})
 	return nil
 }
 
@@ -220,13 +648,49 @@ func (writer *Writer) WriteEventUser(user *User, location *Location, eventType E
 	return nil
 }
 
-// TrackJournalRotation takes care of daily updating the journal file.
+// LoginIfNotPresent atomically checks the User in at the location, unless the User is already checked in somewhere.
+// In that case, an error wrapping ErrAlreadyPresent is returned and nothing is written.
+func (writer *Writer) LoginIfNotPresent(user *User, location *Location) error {
+	writer.outputLock.Lock()
+	defer writer.outputLock.Unlock()
+	hash, err := writer.writeUserLocked(user)
+	if err != nil {
+		return fmt.Errorf("failed to write User login with User data: %w", err)
+	}
+	if current := writer.knownUsers[hash].location; current != nil {
+		return fmt.Errorf("%w at \"%s\"", ErrAlreadyPresent, current.Code)
+	}
+	if err := writer.writeEventLocked(hash, location, LOGIN, NOFLAG); err != nil {
+		return fmt.Errorf("failed to write User login with User data: %w", err)
+	}
+	return nil
+}
+
+// LogoutIfPresent atomically checks the User out of the location, if the User is checked in there.
+// Otherwise, an error wrapping ErrNotPresent is returned and nothing is written.
+func (writer *Writer) LogoutIfPresent(user *User, location *Location) error {
+	writer.outputLock.Lock()
+	defer writer.outputLock.Unlock()
+	hash := writer.UserID(user)
+	userPresence, exists := writer.knownUsers[hash]
+	if !exists || userPresence.location == nil || userPresence.location != location {
+		return ErrNotPresent
+	}
+	if err := writer.writeEventLocked(hash, location, LOGOUT, NOFLAG); err != nil {
+		return fmt.Errorf("failed to write User logout: %w", err)
+	}
+	return nil
+}
+
+// TrackJournalRotation takes care of updating the journal file at the start of every period of the rotation policy.
+// Closed journals are compressed and the retention policy is applied on start and after every rotation.
 // This method should be run as its own routine:
 func (writer *Writer) TrackJournalRotation() {
 	for {
-		now := time.Now().In(time.Local)
-		nextDay := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.Local)
-		time.Sleep(nextDay.Sub(now))
+		writer.archiveJournals()
+		writer.applyRetention()
+		now := time.Now()
+		time.Sleep(writer.config.Rotation.Period.Next(now).Sub(now))
 		for {
 			err := writer.UpdateOutput()
 			if err == nil {
@@ -238,6 +702,122 @@ func (writer *Writer) TrackJournalRotation() {
 	}
 }
 
-func createKnownUserMap(capacity int) map[string]*Location {
-	return make(map[string]*Location, capacity)
+// archiveJournals compresses all uncompressed journals except the current output, if enabled.
+func (writer *Writer) archiveJournals() {
+	if !writer.config.CompressJournals {
+		return
+	}
+	files, err := ListJournalFiles(writer.directory, time.Time{}, time.Time{})
+	if err != nil {
+		log.Printf("failed to list journals for compression: %#v", err)
+		return
+	}
+	writer.outputLock.Lock()
+	outputPath := writer.outputPath
+	writer.outputLock.Unlock()
+	for _, file := range files {
+		if file == outputPath || IsCompressedJournal(file) {
+			continue
+		}
+		if _, err := CompressJournal(file); err != nil {
+			log.Printf("failed to compress journal: %#v", err)
+		}
+	}
+}
+
+// applyRetention applies the configured retention policy to the journal directory, if any.
+func (writer *Writer) applyRetention() {
+	if writer.config.Retention.Days <= 0 {
+		return
+	}
+	policy := writer.config.Retention
+	policy.ChainKey = writer.config.ChainKey
+	policy.EncryptionKey = writer.config.EncryptionKey
+	records, err := ApplyRetention(writer.directory, policy, time.Now())
+	for _, record := range records {
+		log.Printf("Applied journal retention: %s", record.String())
+	}
+	if err != nil {
+		log.Printf("failed to apply journal retention: %#v", err)
+	}
+}
+
+// TrackJournalSync takes care of flushing the journal to the disk in the given interval.
+// It only has an effect if the writer uses SYNCBATCH.
+// This method should be run as its own routine:
+func (writer *Writer) TrackJournalSync(interval time.Duration) {
+	if writer.config.Sync != SYNCBATCH {
+		return
+	}
+	for {
+		time.Sleep(interval)
+		if err := writer.Sync(); err != nil {
+			log.Printf("failed to sync journal: %#v", err)
+		}
+	}
+}
+
+// TrackAutoCheckout takes care of checking out users that exceeded the maximum stay at their location
+// or that are still present when their location closes.
+// The defaultMaxStay applies to locations without their own maximum stay, 0 disables it.
+// This method should be run as its own routine:
+func (writer *Writer) TrackAutoCheckout(defaultMaxStay time.Duration, interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		if err := writer.CheckOutOverdueUsers(time.Now(), defaultMaxStay); err != nil {
+			log.Printf("failed to automatically check out users: %#v", err)
+		}
+	}
+}
+
+// CheckOutOverdueUsers writes AUTOMATIC logouts for all users whose stay has ended at the given time.
+// The logouts are written at the current time and keep the deadline, as that is when the stay ended,
+// but never before the user's check-in, see Event.OccurredAt.
+func (writer *Writer) CheckOutOverdueUsers(now time.Time, defaultMaxStay time.Duration) error {
+	writer.outputLock.Lock()
+	defer writer.outputLock.Unlock()
+	overdue := make(map[string]Event, 10) // writing may rotate the journal, which replaces the known users
+	for hash, userPresence := range writer.knownUsers {
+		if userPresence.location == nil {
+			continue
+		}
+		deadline, exists := getCheckOutDeadline(userPresence, defaultMaxStay)
+		if !exists || now.Before(deadline) {
+			continue
+		}
+		logout := Event{EventType: LOGOUT, Location: userPresence.location, Flag: AUTOMATIC, Deadline: deadline.Unix()}
+		if logout.Deadline < userPresence.since {
+			logout.Deadline = userPresence.since
+		}
+		overdue[hash] = logout
+	}
+	for hash, logout := range overdue {
+		if err := writer.writeEventEntryLocked(hash, logout); err != nil {
+			return fmt.Errorf("failed to check out user \"%s\": %w", hash, err)
+		}
+	}
+	return nil
+}
+
+// getCheckOutDeadline determines when the given present user has to be checked out.
+// The second return value is false if the user's stay is not limited.
+func getCheckOutDeadline(userPresence *presence, defaultMaxStay time.Duration) (time.Time, bool) {
+	since := time.Unix(userPresence.since, 0)
+	deadline, exists := userPresence.location.GetNextClosingTime(since)
+
+	maxStay := userPresence.location.GetMaxStay()
+	if maxStay <= 0 {
+		maxStay = defaultMaxStay
+	}
+	if maxStay > 0 {
+		if stayEnd := since.Add(maxStay); !exists || stayEnd.Before(deadline) {
+			deadline = stayEnd
+			exists = true
+		}
+	}
+	return deadline, exists
+}
+
+func createKnownUserMap(capacity int) map[string]*presence {
+	return make(map[string]*presence, capacity)
 }
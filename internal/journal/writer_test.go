@@ -15,6 +15,7 @@ import (
 	"log"
 	"os"
 	"path"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -41,6 +42,16 @@ func TestNewWriter(t *testing.T) {
 		_ = file.Close()
 	}
 
+	directory := path.Join(tempDir, "journals")
+	writer, err = NewWriter(directory)
+	if assert.NoError(t, err, "missing directories should be created") {
+		require.NoError(t, writer.Close())
+		info, err := os.Stat(directory)
+		if assert.NoError(t, err) {
+			assert.Equal(t, os.FileMode(DirectoryCreationPermissions), info.Mode().Perm(), "only the owner should open the journals")
+		}
+	}
+
 	_ = os.Remove(GetCurrentJournalPath(tempDir))
 	_ = os.Mkdir(GetCurrentJournalPath(tempDir), 0777)
 	writer, err = NewWriter(tempDir)
@@ -61,7 +72,11 @@ func TestNewWriter_existingJournal(t *testing.T) {
 	writer, err := NewWriter(tempDir)
 	defer func() { require.NoError(t, writer.Close()) }()
 	require.NoError(t, err, "failed to read existing data")
-	assert.Equal(t, map[string]*Location{"nPQeHgKWuAdyhGh6NPteN7LuDLg=": nil}, writer.knownUsers)
+	assert.Equal(
+		t,
+		map[string]*presence{"1NBkFkC6ZrXR3uq1KTVXNZKQUl8=": {user: &User{Name: "Tester", Address: "Ort"}}},
+		writer.knownUsers,
+	)
 }
 
 func TestWriter_LoadFrom(t *testing.T) {
@@ -83,10 +98,10 @@ func TestWriter_LoadFrom(t *testing.T) {
 	if assert.NoError(t, writer.LoadFrom("testdata/import_journal.txt"), "failed to load writer data from prepared file") {
 		assert.Equal(
 			t,
-			map[string]*Location{
-				"P245C5uet9ZzSc0fXoOi7/0FB4I=": Locations["HST"],
-				"ASkl/7Pm/MXnARb+f7+Fhk5GeYc=": nil,
-				"oBklljrMPMa4Db3A4xsgTlfaLRw=": nil,
+			map[string]*presence{
+				"P245C5uet9ZzSc0fXoOi7/0FB4I=": {user: &User{Name: "abc", Address: "def"}, location: Locations["HST"], since: 1000},
+				"ASkl/7Pm/MXnARb+f7+Fhk5GeYc=": {user: &User{Name: "cde", Address: "123"}, since: 1000},
+				"oBklljrMPMa4Db3A4xsgTlfaLRw=": {user: &User{Name: "", Address: "test"}},
 			}, writer.knownUsers,
 		)
 	}
@@ -108,6 +123,96 @@ func TestWriter_LoadFrom(t *testing.T) {
 	}
 }
 
+func TestWriter_LoadFrom_corrupt(t *testing.T) {
+	Locations = map[string]*Location{"TST": {Code: "TST", Name: "Teststadt"}}
+	filePath := path.Join(t.TempDir(), "corrupt")
+	content := "*Tester\tTeststadt\n\n+\n-\n+HjLV+aPwKzq3szuae53Zv5n4puw=\n+HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\n\t#" +
+		strings.Repeat("A", 43) + "=\n-HjLV+aPwKzq3szuae53Zv5n4puw=\tT"
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(content), 0777), "internal error: failed to create journal file")
+
+	writer := Writer{knownUsers: createKnownUserMap(10)}
+	buf := bytes.Buffer{}
+	reset := LogToBuffer(&buf)
+	defer reset()
+	assert.NotPanics(t, func() {
+		assert.NoError(t, writer.LoadFrom(filePath), "corrupt lines should be skipped")
+	})
+	reset()
+	userPresence := writer.knownUsers["HjLV+aPwKzq3szuae53Zv5n4puw="]
+	if assert.NotNil(t, userPresence) {
+		assert.Nil(t, userPresence.location, "the valid lines should be loaded")
+	}
+}
+
+func TestWriter_Sync(t *testing.T) {
+	t.Parallel()
+	mode, err := ParseSyncMode("batch")
+	if assert.NoError(t, err) {
+		assert.Equal(t, SYNCBATCH, mode)
+	}
+	_, err = ParseSyncMode("always")
+	assert.Error(t, err)
+
+	output := &syncWriter{}
+	writer := Writer{output: output, config: WriterConfig{Sync: SYNCEVENT}}
+	require.NoError(t, writer.writeLine("test"))
+	assert.Equal(t, 1, output.syncs, "every line should be synced")
+
+	writer.config.Sync = SYNCBATCH
+	require.NoError(t, writer.writeLine("test"))
+	require.NoError(t, writer.writeLine("test"))
+	assert.Equal(t, 1, output.syncs, "batched lines should not be synced immediately")
+	require.NoError(t, writer.Sync())
+	assert.Equal(t, 2, output.syncs, "the batch should be synced")
+	require.NoError(t, writer.Sync())
+	assert.Equal(t, 2, output.syncs, "nothing to sync without new lines")
+
+	require.NoError(t, writer.writeLine("test"))
+	require.NoError(t, writer.Close())
+	assert.Equal(t, 3, output.syncs, "closing should sync the remaining lines")
+
+	output.err = fmt.Errorf("test error")
+	writer.config.Sync = SYNCEVENT
+	assert.Error(t, writer.writeLine("test"), "sync errors should be reported")
+}
+
+func TestWriter_concurrentUse(t *testing.T) {
+	Locations = map[string]*Location{"TST": {Code: "TST", Name: "Teststadt", MaxStay: "1ns"}}
+	writer, err := NewWriter(t.TempDir())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, writer.Close()) }()
+
+	wait := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			user := User{Name: fmt.Sprintf("User %d", i%3), Address: "Teststadt"}
+			hash := util.Base64Encode(user.lineHash())
+			for j := 0; j < 20; j++ {
+				_ = writer.LoginIfNotPresent(&user, Locations["TST"])
+				_, _ = writer.GetCurrentUserLocation(hash)
+				_ = writer.LogoutIfPresent(&user, Locations["TST"])
+				_ = writer.WriteEventUser(&user, Locations["TST"], LOGIN)
+			}
+		}(i)
+	}
+	wait.Add(2)
+	go func() {
+		defer wait.Done()
+		for j := 0; j < 20; j++ {
+			assert.NoError(t, writer.CheckOutOverdueUsers(time.Now().Add(time.Hour), 0))
+		}
+	}()
+	go func() {
+		defer wait.Done()
+		for j := 0; j < 5; j++ {
+			assert.NoError(t, writer.UpdateOutput())
+		}
+	}()
+	wait.Wait()
+}
+
 func TestWriter_UpdateOutput(t *testing.T) {
 	t.Parallel()
 	tempDir := t.TempDir()
@@ -174,12 +279,75 @@ func TestUpdateOutput_complete(t *testing.T) {
 	assert.Contains(t, string(content), expectedLog, "when writing to a new file the user line should be printed again")
 }
 
+func TestWriter_UpdateOutput_carryOver(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+	buffer := bytes.Buffer{}
+	writer := Writer{
+		knownUsers: createKnownUserMap(3),
+		output:     &buffer,
+		outputLock: sync.Mutex{},
+		directory:  tempDir,
+	}
+	defer func() { require.NoError(t, writer.Close()) }()
+	present := User{Name: "Present", Address: "Here"}
+	presentHash := util.Base64Encode(present.lineHash())
+	absent := User{Name: "Absent", Address: "Elsewhere"}
+	location := Location{Name: "Hauptstadt", Code: "HST"}
+	require.NoError(t, writer.WriteEventUser(&present, &location, LOGIN), "failed to write user event")
+	require.NoError(t, writer.WriteEventUser(&absent, &location, LOGIN), "failed to write user event")
+	require.NoError(t, writer.WriteEventUser(&absent, &location, LOGOUT), "failed to write user event")
+	since := int64(1634700000) // the check-in happened long before the rotation
+	writer.knownUsers[presentHash].since = since
+
+	require.NoError(t, writer.UpdateOutput(), "failed to update the output")
+	file, ok := writer.output.(*os.File)
+	require.True(t, ok, "output was not a file")
+	content, err := ioutil.ReadFile(file.Name())
+	require.NoError(t, err, "internal error: failed to read output file")
+	assert.Equal(
+		t,
+		fmt.Sprintf("*Present\tHere\n+%s\tHST\t%d\tcarried\t%d\n", presentHash, time.Now().Unix(), since),
+		string(content),
+		"present users should be carried over to the new file",
+	)
+	if assert.Len(t, writer.knownUsers, 1, "only present users should be known after rotation") {
+		loc, err := writer.GetCurrentUserLocation(presentHash)
+		if assert.NoError(t, err) {
+			assert.Equal(t, &location, loc)
+		}
+		assert.Equal(t, since, writer.knownUsers[presentHash].since, "the check-in time should be retained")
+	}
+
+	require.NoError(t, writer.WriteEventUser(&present, &location, LOGOUT), "logging out after rotation should succeed")
+}
+
+func TestWriter_LoadFrom_carried(t *testing.T) {
+	Locations = map[string]*Location{"TST": {Name: "Teststadt", Code: "TST"}}
+	filePath := path.Join(t.TempDir(), "20211021.txt")
+	require.NoError(t, ioutil.WriteFile(filePath, []byte("*Tester\tTeststadt\n"+
+		"+HjLV+aPwKzq3szuae53Zv5n4puw=\tTST\t1634774400\tcarried\t1634700000\n"), 0660))
+	writer := Writer{knownUsers: createKnownUserMap(3)}
+	require.NoError(t, writer.LoadFrom(filePath))
+	if assert.Contains(t, writer.knownUsers, "HjLV+aPwKzq3szuae53Zv5n4puw=") {
+		assert.Equal(t, int64(1634700000), writer.knownUsers["HjLV+aPwKzq3szuae53Zv5n4puw="].since,
+			"the original check-in time should survive a restart")
+	}
+
+	journal, err := ReadJournal(filePath)
+	require.NoError(t, err)
+	if assert.Len(t, journal.GetEvents(), 1) {
+		assert.Equal(t, int64(1634774400), journal.GetEvents()[0].Timestamp)
+		assert.Equal(t, int64(1634700000), journal.GetEvents()[0].Since)
+	}
+}
+
 func TestWriter_GetCurrentUserLocation(t *testing.T) {
 	loc1 := Location{Name: "Test1"}
 	writer := Writer{
-		knownUsers: map[string]*Location{
-			"hash1": &loc1,
-			"hash2": nil,
+		knownUsers: map[string]*presence{
+			"hash1": {location: &loc1},
+			"hash2": {},
 		},
 	}
 	loc, err := writer.GetCurrentUserLocation("hash1")
@@ -222,7 +390,7 @@ func TestWriter_WriteUserIfUnknown(t *testing.T) {
 	defer func() { require.NoError(t, writer.Close()) }()
 
 	user := User{Name: "Tester", Address: "Addr"}
-	hash := util.Base64Encode(user.Hash())
+	hash := util.Base64Encode(user.lineHash())
 	retHash, err := writer.WriteUserIfUnknown(&user)
 	assert.Equal(t, hash, retHash, "the returned hash should be accurate")
 	if assert.NoError(t, err) {
@@ -231,7 +399,7 @@ func TestWriter_WriteUserIfUnknown(t *testing.T) {
 
 	buffer.Reset()
 	writer.knownUsers = createKnownUserMap(1)
-	writer.knownUsers[hash] = nil
+	writer.knownUsers[hash] = &presence{}
 	retHash, err = writer.WriteUserIfUnknown(&user)
 	assert.Equal(t, hash, retHash, "the returned hash should be accurate")
 	if assert.NoError(t, err) {
@@ -259,8 +427,8 @@ func TestWriter_WriteEventUserHash(t *testing.T) {
 		output:     buffer,
 	}
 	defer func() { require.NoError(t, writer.Close()) }()
-	writer.knownUsers["hash1"] = nil
-	writer.knownUsers["hash2"] = nil
+	writer.knownUsers["hash1"] = &presence{}
+	writer.knownUsers["hash2"] = &presence{}
 	data := []struct {
 		Hash string
 		*Location
@@ -281,8 +449,8 @@ func TestWriter_WriteEventUserHash(t *testing.T) {
 		}
 	}
 
-	assert.Equal(t, loc2, writer.knownUsers["hash1"])
-	assert.Equal(t, (*Location)(nil), writer.knownUsers["hash2"])
+	assert.Equal(t, loc2, writer.knownUsers["hash1"].location)
+	assert.Equal(t, (*Location)(nil), writer.knownUsers["hash2"].location)
 
 	assert.Error(t, writer.WriteEventUserHash("unknown_hash", loc1, LOGIN), "attempts to write unknown hashes directly should fail")
 
@@ -303,9 +471,9 @@ func TestWriter_WriteEventUser(t *testing.T) {
 	}
 	defer func() { require.NoError(t, writer.Close()) }()
 	user1 := User{Name: "Tester", Address: "TAddr"}
-	hash1 := util.Base64Encode(user1.Hash())
+	hash1 := util.Base64Encode(user1.lineHash())
 	user2 := User{Name: "", Address: ""}
-	hash2 := util.Base64Encode(user2.Hash())
+	hash2 := util.Base64Encode(user2.lineHash())
 
 	if assert.NoError(t, writer.WriteEventUser(&user1, loc1, LOGIN)) {
 		assert.Equal(
@@ -323,7 +491,7 @@ func TestWriter_WriteEventUser(t *testing.T) {
 	}
 
 	buffer.Reset()
-	writer.knownUsers[hash2] = nil
+	writer.knownUsers[hash2] = &presence{}
 	if assert.NoError(t, writer.WriteEventUser(&user2, loc2, LOGOUT)) {
 		assert.Equal(
 			t, fmt.Sprintf("-%s\tTST\t%d\n", hash2, time.Now().Unix()),
@@ -340,6 +508,81 @@ func TestWriter_WriteEventUser(t *testing.T) {
 	assert.Error(t, writer.WriteEventUser(&user1, loc1, LOGOUT))
 }
 
+func TestWriter_CheckOutOverdueUsers(t *testing.T) {
+	t.Parallel()
+	limited := &Location{Name: "Limited", Code: "LIM", MaxStay: "1h"}
+	closing := &Location{Name: "Closing", Code: "CLS", Closes: "22:00"}
+	open := &Location{Name: "Open", Code: "OPN"}
+	buffer := bytes.Buffer{}
+	writer := Writer{
+		knownUsers: createKnownUserMap(4),
+		outputLock: sync.Mutex{},
+		output:     &buffer,
+	}
+	defer func() { require.NoError(t, writer.Close()) }()
+
+	checkIn := time.Date(2021, time.October, 20, 20, 0, 0, 0, time.Local)
+	writer.knownUsers["limited"] = &presence{location: limited, since: checkIn.Unix()}
+	writer.knownUsers["closing"] = &presence{location: closing, since: checkIn.Unix()}
+	writer.knownUsers["open"] = &presence{location: open, since: checkIn.Unix()}
+	writer.knownUsers["away"] = &presence{}
+
+	require.NoError(t, writer.CheckOutOverdueUsers(checkIn.Add(30*time.Minute), 0))
+	assert.Equal(t, "", buffer.String(), "no user should be checked out before their deadline")
+
+	require.NoError(t, writer.CheckOutOverdueUsers(checkIn.Add(time.Hour), 0))
+	assert.Equal(t, fmt.Sprintf("-limited\tLIM\t%d\tauto\t%d\n", time.Now().Unix(), checkIn.Add(time.Hour).Unix()),
+		buffer.String())
+	assert.Nil(t, writer.knownUsers["limited"].location, "checked out users should not be present anymore")
+
+	buffer.Reset()
+	require.NoError(t, writer.CheckOutOverdueUsers(checkIn.Add(3*time.Hour), 0))
+	assert.Equal(t, fmt.Sprintf("-closing\tCLS\t%d\tauto\t%d\n", time.Now().Unix(), checkIn.Add(2*time.Hour).Unix()),
+		buffer.String(), "the logout should be written now and keep the deadline")
+
+	buffer.Reset()
+	require.NoError(t, writer.CheckOutOverdueUsers(checkIn.Add(48*time.Hour), 0))
+	assert.Equal(t, "", buffer.String(), "locations without limits shouldn't check out users")
+	require.NoError(t, writer.CheckOutOverdueUsers(checkIn.Add(48*time.Hour), 24*time.Hour))
+	assert.Equal(t, fmt.Sprintf("-open\tOPN\t%d\tauto\t%d\n", time.Now().Unix(), checkIn.Add(24*time.Hour).Unix()),
+		buffer.String(), "the default maximum stay should apply")
+
+	writer.knownUsers["open"].location = open
+	ew := newErrorWriter()
+	writer.output = &ew
+	assert.Error(t, writer.CheckOutOverdueUsers(checkIn.Add(48*time.Hour), time.Hour), "journal writer errors should be propagated")
+}
+
+func TestWriter_CheckOutOverdueUsers_rotation(t *testing.T) {
+	directory := t.TempDir()
+	location := &Location{Name: "Limited", Code: "LIM", MaxStay: "1h"}
+	Locations = map[string]*Location{"LIM": location}
+	writer, err := NewWriterWithConfig(directory, WriterConfig{Rotation: RotationPolicy{Period: HOURLY, MaxSize: 200}})
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, writer.WriteEventUser(&User{Name: fmt.Sprintf("Tester %d", i), Address: "Teststadt"}, location, LOGIN))
+	}
+	require.NoError(t, writer.CheckOutOverdueUsers(time.Now().Add(2*time.Hour), 0))
+	for hash, userPresence := range writer.knownUsers {
+		assert.Nil(t, userPresence.location, "%s should be checked out even if the journal was rotated meanwhile", hash)
+	}
+	require.NoError(t, writer.Close())
+
+	files, err := ListJournalFiles(directory, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Greater(t, len(files), 1, "the journal should have been rotated while checking out")
+	journal, err := ReadJournals(files)
+	require.NoError(t, err)
+	logouts := 0
+	for _, event := range journal.GetEvents() {
+		if event.EventType == LOGOUT && event.Flag == AUTOMATIC {
+			assert.InDelta(t, time.Now().Add(time.Hour).Unix(), event.OccurredAt(), 5, "the logout should take effect at the deadline")
+			logouts++
+		}
+	}
+	assert.Equal(t, 5, logouts)
+}
+
 func LogToBuffer(buffer *bytes.Buffer) func() {
 	log.SetOutput(buffer)
 	flags := log.Flags()
@@ -360,3 +603,48 @@ func newErrorWriter() errorWriter {
 func (ew *errorWriter) Write(_ []byte) (int, error) {
 	return 0, fmt.Errorf("test error")
 }
+
+// syncWriter counts the syncs of the written data.
+type syncWriter struct {
+	bytes.Buffer
+	syncs int
+	err   error
+}
+
+func (sw *syncWriter) Sync() error {
+	if sw.err != nil {
+		return sw.err
+	}
+	sw.syncs++
+	return nil
+}
+
+func TestWriter_PresentUsers(t *testing.T) {
+	Locations = map[string]*Location{
+		"TST": {Code: "TST", Name: "Teststadt"},
+		"HST": {Code: "HST", Name: "Hauptstadt"},
+	}
+	tempDir := t.TempDir()
+	tester := User{Name: "Tester", Address: "Teststadt"}
+	klaus := User{Name: "Klaus", Address: "Musterdorf"}
+	require.NoError(t, ioutil.WriteFile(GetCurrentJournalPath(tempDir), []byte(fmt.Sprintf(
+		"*%s\n+%s\tTST\t1634700000\n*%s\n+%s\tTST\t1634690000\n",
+		tester.ToJournalLine(), util.Base64Encode(tester.lineHash()), klaus.ToJournalLine(), util.Base64Encode(klaus.lineHash()),
+	)), 0660))
+
+	writer, err := NewWriter(tempDir)
+	require.NoError(t, err)
+	present := writer.PresentUsers(Locations["TST"])
+	if assert.Len(t, present, 2, "the users present before the restart should be listed") {
+		assert.Equal(t, klaus, *present[0].User, "present users should be ordered by their check-in time")
+		assert.Equal(t, time.Unix(1634690000, 0), present[0].Since)
+		assert.Equal(t, tester, *present[1].User)
+	}
+	assert.Empty(t, writer.PresentUsers(Locations["HST"]))
+	assert.Equal(t, map[*Location]int{Locations["TST"]: 2}, writer.Occupancy())
+
+	require.NoError(t, writer.WriteEventUser(&tester, Locations["TST"], LOGOUT))
+	assert.Len(t, writer.PresentUsers(nil), 1)
+	assert.Equal(t, map[*Location]int{Locations["TST"]: 1}, writer.Occupancy())
+	require.NoError(t, writer.Close())
+}
@@ -0,0 +1,34 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package util
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LoadKey loads a secret key with the given size in bytes, either from the key file or from the value itself.
+// Keys may be given as raw text of exactly that size or base64 encoded.
+// If neither a value nor a key file is given, no key is returned.
+func LoadKey(value string, keyFile string, size int) ([]byte, error) {
+	if keyFile != "" {
+		content, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file \"%s\": %w", keyFile, err)
+		}
+		value = strings.TrimSpace(string(content))
+	}
+	if value == "" {
+		return nil, nil
+	}
+	if len(value) == size {
+		return []byte(value), nil
+	}
+	if decoded, err := Base64Decode(value); err == nil && len(decoded) == size {
+		return decoded, nil
+	}
+	return nil, fmt.Errorf("key must be %d bytes long or the base64 encoding of %d bytes", size, size)
+}
@@ -0,0 +1,39 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package util
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestLoadKey(t *testing.T) {
+	key, err := LoadKey("", "", 4)
+	if assert.NoError(t, err) {
+		assert.Nil(t, key, "no key should be loaded if none is given")
+	}
+	key, err = LoadKey("abcd", "", 4)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []byte("abcd"), key)
+	}
+	key, err = LoadKey(Base64Encode([]byte{1, 2, 3, 4}), "", 4)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []byte{1, 2, 3, 4}, key)
+	}
+	_, err = LoadKey("abc", "", 4)
+	assert.Error(t, err, "keys with the wrong size should fail")
+
+	keyFile := path.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(keyFile, []byte(Base64Encode([]byte{4, 3, 2, 1})+"\n"), 0600))
+	key, err = LoadKey("abcd", keyFile, 4)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []byte{4, 3, 2, 1}, key, "the key file should take precedence")
+	}
+	_, err = LoadKey("", path.Join(t.TempDir(), "missing"), 4)
+	assert.Error(t, err, "missing key files should fail")
+}
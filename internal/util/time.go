@@ -14,3 +14,12 @@ func GetDateFilename(time time.Time) string {
 	year, month, day := time.Date()
 	return fmt.Sprintf("%04d%02d%02d", year, month, day)
 }
+
+// ParseDateFilename parses a file name created by GetDateFilename back into the local date it represents.
+func ParseDateFilename(name string) (time.Time, error) {
+	date, err := time.ParseInLocation("20060102", name, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("\"%s\" is not a valid date file name: %w", name, err)
+	}
+	return date, nil
+}
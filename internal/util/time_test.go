@@ -24,3 +24,21 @@ func TestGetDateFilename(t *testing.T) {
 		assert.Equal(t, value.expected, GetDateFilename(value.time))
 	}
 }
+
+func TestParseDateFilename(t *testing.T) {
+	date, err := ParseDateFilename("20211225")
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.Date(2021, time.December, 25, 0, 0, 0, 0, time.Local), date)
+	}
+	date, err = ParseDateFilename(GetDateFilename(time.Date(1, time.April, 5, 13, 0, 0, 0, time.Local)))
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.Date(1, time.April, 5, 0, 0, 0, 0, time.Local), date)
+	}
+
+	_, err = ParseDateFilename("2021122")
+	assert.Error(t, err)
+	_, err = ParseDateFilename("journal")
+	assert.Error(t, err)
+	_, err = ParseDateFilename("20211325")
+	assert.Error(t, err)
+}
@@ -0,0 +1,184 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// queueFileExtension is the file extension of pending deliveries
+	queueFileExtension = ".json"
+	// failedFileExtension is appended to the file name of deliveries that were given up, to keep them for inspection
+	failedFileExtension = ".failed"
+	// queueFilePermissions is the permission mask of the files of the queue, the payloads are pseudonymous only
+	queueFilePermissions = 0600
+)
+
+// delivery is a pending webhook delivery as stored in the queue.
+type delivery struct {
+	// ID identifies the delivery for the receivers, it's the same for all attempts
+	ID string `json:"id"`
+	// Attempts is the number of failed attempts so far
+	Attempts int `json:"attempts"`
+	// Payload is the request body, kept as is so that the signature never changes
+	Payload json.RawMessage `json:"payload"`
+}
+
+// queue is a persistent first-in-first-out queue of deliveries, which keeps every delivery in its own file.
+// The file names are consecutive numbers, so that the order survives restarts.
+type queue struct {
+	// directory contains the files of the queue
+	directory string
+	// lock is a mutex for using the queue in a thread-safe way
+	lock sync.Mutex
+	// pending are the file names of the pending deliveries in their order
+	pending []string
+	// next is the number of the next file name
+	next uint64
+}
+
+// openQueue opens the queue in the directory, which is created if it doesn't exist yet.
+// Deliveries that are still pending from an earlier run are kept in their order.
+func openQueue(directory string) (*queue, error) {
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create webhook queue directory \"%s\": %w", directory, err)
+	}
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook queue directory \"%s\": %w", directory, err)
+	}
+	q := queue{directory: directory, pending: make([]string, 0, len(entries))}
+	for _, entry := range entries {
+		name := entry.Name()
+		number, err := strconv.ParseUint(strings.TrimSuffix(name, queueFileExtension), 10, 64)
+		if entry.IsDir() || !strings.HasSuffix(name, queueFileExtension) || err != nil {
+			continue // e.g. failed deliveries or temporary files of interrupted writes
+		}
+		q.pending = append(q.pending, name)
+		if number >= q.next {
+			q.next = number + 1
+		}
+	}
+	sort.Strings(q.pending) // the names have a fixed width, so that they sort in their numeric order
+	return &q, nil
+}
+
+// push appends the delivery to the queue. It's written to a temporary file first, so that it's never read partially.
+func (q *queue) push(item delivery) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	name := fmt.Sprintf("%020d%s", q.next, queueFileExtension)
+	if err := q.writeLocked(name, item); err != nil {
+		return err
+	}
+	q.next++
+	q.pending = append(q.pending, name)
+	return nil
+}
+
+// writeLocked replaces the file of a delivery. The lock must be held by the caller.
+// The file is synced before it's renamed, so that a delivery in the queue survives a crash of the system.
+func (q *queue) writeLocked(name string, item delivery) error {
+	content, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook delivery: %w", err)
+	}
+	filePath := path.Join(q.directory, name)
+	if err := writeSyncedFile(filePath+".tmp", content); err != nil {
+		return fmt.Errorf("failed to write webhook delivery \"%s\": %w", filePath, err)
+	}
+	if err := os.Rename(filePath+".tmp", filePath); err != nil {
+		return fmt.Errorf("failed to write webhook delivery \"%s\": %w", filePath, err)
+	}
+	return nil
+}
+
+// writeSyncedFile writes the content to the file and syncs it to the disk.
+func writeSyncedFile(filePath string, content []byte) error {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, queueFilePermissions)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(content); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// peek reads the first delivery of the queue, the second return value is false if the queue is empty.
+func (q *queue) peek() (string, delivery, bool, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if len(q.pending) == 0 {
+		return "", delivery{}, false, nil
+	}
+	name := q.pending[0]
+	content, err := os.ReadFile(path.Join(q.directory, name))
+	if err != nil {
+		return name, delivery{}, true, fmt.Errorf("failed to read webhook delivery \"%s\": %w", name, err)
+	}
+	item := delivery{}
+	if err := json.Unmarshal(content, &item); err != nil {
+		return name, delivery{}, true, fmt.Errorf("failed to decode webhook delivery \"%s\": %w", name, err)
+	}
+	return name, item, true, nil
+}
+
+// update replaces the stored delivery, e.g. to count the attempts.
+func (q *queue) update(name string, item delivery) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.writeLocked(name, item)
+}
+
+// remove deletes the first delivery of the queue after it was delivered.
+func (q *queue) remove(name string) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.popLocked(name)
+	if err := os.Remove(path.Join(q.directory, name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove webhook delivery \"%s\": %w", name, err)
+	}
+	return nil
+}
+
+// fail removes the first delivery of the queue after it was given up, its file is kept with failedFileExtension.
+func (q *queue) fail(name string) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.popLocked(name)
+	filePath := path.Join(q.directory, name)
+	if err := os.Rename(filePath, filePath+failedFileExtension); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to keep failed webhook delivery \"%s\": %w", name, err)
+	}
+	return nil
+}
+
+// popLocked removes the delivery from the pending deliveries, if it's the first one. The lock must be held by the caller.
+func (q *queue) popLocked(name string) {
+	if len(q.pending) > 0 && q.pending[0] == name {
+		q.pending = q.pending[1:]
+	}
+}
+
+// len returns the number of pending deliveries.
+func (q *queue) len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.pending)
+}
@@ -0,0 +1,362 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+// Package webhook POSTs the check-ins and check-outs of the journal to external systems,
+// e.g. a building management system.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+)
+
+const (
+	// SignatureHeader carries the signature of the request body, see Sign.
+	SignatureHeader = "X-Lets-Goooo-Signature"
+	// DeliveryHeader carries the ID of the delivery, which is the same for all attempts of the delivery.
+	DeliveryHeader = "X-Lets-Goooo-Delivery"
+)
+
+// Event types of the Payload.
+const (
+	CHECKIN  = "check-in"
+	CHECKOUT = "check-out"
+)
+
+// Payload is the JSON body of a webhook delivery.
+type Payload struct {
+	// Type is either CHECKIN or CHECKOUT
+	Type string `json:"type"`
+	// Automatic is true for check-outs by the server, e.g. after the maximum stay
+	Automatic bool `json:"automatic,omitempty"`
+	// Location is the code of the location
+	Location string `json:"location"`
+	// Timestamp is the time of the event in unix seconds
+	Timestamp int64 `json:"timestamp"`
+	// User is a pseudonymous ID of the user, which is the same for all events of the user
+	User string `json:"user"`
+}
+
+// Config holds the settings of a Dispatcher.
+type Config struct {
+	// Targets are the HTTP(S) URLs that every check-in and check-out is POSTed to
+	Targets []string
+	// Secret signs the deliveries and derives the pseudonymous user IDs
+	Secret []byte
+	// QueueDirectory keeps the pending deliveries, so that they survive restarts
+	QueueDirectory string
+	// MaxAttempts is the number of attempts after which a delivery is given up, 0 retries forever
+	MaxAttempts int
+	// Backoff is the time to wait after the first failed attempt, it doubles with every further attempt.
+	// It defaults to DefaultBackoff.
+	Backoff time.Duration
+	// MaxBackoff limits the time to wait between two attempts, it defaults to DefaultMaxBackoff
+	MaxBackoff time.Duration
+	// Client sends the requests, a client with DefaultTimeout is used if it's nil
+	Client *http.Client
+}
+
+const (
+	// SecretSize is the size of the webhook secrets expected by the server, but any non-empty secret works.
+	SecretSize = 32
+	// DefaultBackoff is the default time to wait after the first failed attempt.
+	DefaultBackoff = time.Second
+	// DefaultMaxBackoff is the default limit of the time to wait between two attempts.
+	DefaultMaxBackoff = 5 * time.Minute
+	// DefaultTimeout is the timeout of the requests of the default client.
+	DefaultTimeout = 10 * time.Second
+)
+
+// Dispatcher delivers the events to the webhook targets.
+// Every target has its own persistent queue, so that an unreachable target doesn't delay the others.
+// The deliveries of a target are made in the order of the events and each of them is retried until it succeeds
+// or MaxAttempts is reached, so the receivers may get a delivery more than once, but never out of order.
+type Dispatcher struct {
+	// config contains the settings of the dispatcher
+	config Config
+	// targets are the queues of the webhook targets
+	targets []*target
+	// incoming are the payloads of the Listener that weren't added to the queues yet, see persist
+	incoming []Payload
+	// incomingLock is a mutex for using the incoming payloads in a thread-safe way
+	incomingLock sync.Mutex
+	// incomingWake notifies persist about new incoming payloads
+	incomingWake chan struct{}
+}
+
+// target is a webhook URL with its pending deliveries.
+type target struct {
+	url   string
+	queue *queue
+	// wake notifies the worker of the target about new deliveries
+	wake chan struct{}
+}
+
+// NewDispatcher creates a Dispatcher, loading the deliveries that are still pending from an earlier run.
+// The deliveries are only made while Run is running.
+func NewDispatcher(config Config) (*Dispatcher, error) {
+	if len(config.Secret) == 0 {
+		return nil, fmt.Errorf("webhooks require a secret to sign the deliveries")
+	}
+	if config.QueueDirectory == "" {
+		return nil, fmt.Errorf("webhooks require a queue directory")
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = DefaultBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = DefaultMaxBackoff
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	dispatcher := Dispatcher{
+		config:       config,
+		targets:      make([]*target, 0, len(config.Targets)),
+		incomingWake: make(chan struct{}, 1),
+	}
+	for _, targetURL := range config.Targets {
+		parsed, err := url.Parse(targetURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid webhook URL \"%s\", expected an HTTP(S) URL", targetURL)
+		}
+		// every target has its own directory, named after its URL, so that changed targets don't inherit deliveries
+		hash := sha256.Sum256([]byte(targetURL))
+		q, err := openQueue(path.Join(config.QueueDirectory, hex.EncodeToString(hash[:8])))
+		if err != nil {
+			return nil, err
+		}
+		dispatcher.targets = append(dispatcher.targets, &target{url: targetURL, queue: q, wake: make(chan struct{}, 1)})
+	}
+	return &dispatcher, nil
+}
+
+// Enqueue adds the payload to the queues of all targets.
+func (dispatcher *Dispatcher) Enqueue(payload Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Errorf("failed to generate webhook delivery ID: %w", err)
+	}
+	item := delivery{ID: hex.EncodeToString(id), Payload: body}
+	for _, target := range dispatcher.targets {
+		if err := target.queue.push(item); err != nil {
+			return fmt.Errorf("failed to queue webhook for \"%s\": %w", target.url, err)
+		}
+		select {
+		case target.wake <- struct{}{}:
+		default: // the worker is already notified
+		}
+	}
+	return nil
+}
+
+// Listener returns a journal.Listener that enqueues the check-ins and check-outs written to the journal.
+// The listener only buffers the payloads in memory, so that the journal writer never waits for the queue files.
+// They are added to the queues by Run, so the payloads of the last moments before a crash may be lost,
+// just like the journal lines that weren't synced yet.
+func (dispatcher *Dispatcher) Listener() journal.Listener {
+	return func(notification journal.WriteNotification) {
+		if notification.Event == nil || notification.Event.Location == nil {
+			return
+		}
+		payload := Payload{
+			Type:      CHECKIN,
+			Location:  notification.Event.Location.Code,
+			Timestamp: notification.Event.OccurredAt(),
+			User:      dispatcher.pseudonym(notification),
+		}
+		if notification.Event.EventType == journal.LOGOUT {
+			payload.Type = CHECKOUT
+			payload.Automatic = notification.Event.Flag == journal.AUTOMATIC
+		}
+		dispatcher.incomingLock.Lock()
+		dispatcher.incoming = append(dispatcher.incoming, payload)
+		dispatcher.incomingLock.Unlock()
+		select {
+		case dispatcher.incomingWake <- struct{}{}:
+		default: // persist is already notified
+		}
+	}
+}
+
+// pseudonym derives the pseudonymous user ID of the payloads from the identity of the user, see journal.User.Identity.
+// It's keyed with the secret, so that the receivers can't link it to the journals, and it doesn't depend on the
+// journal's user IDs, so that it stays the same when the journal IDs change, e.g. with a new user ID key.
+// Events of users whose data isn't known fall back to the journal user ID.
+func (dispatcher *Dispatcher) pseudonym(notification journal.WriteNotification) string {
+	mac := hmac.New(sha256.New, dispatcher.config.Secret)
+	if notification.User != nil {
+		identity := notification.User.Identity()
+		mac.Write([]byte("user\x00" + identity.ToJournalLine()))
+	} else {
+		mac.Write([]byte("id\x00" + notification.UserID))
+	}
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// persist adds the payloads of the Listener to the queues until the context is cancelled.
+// The payloads that are still buffered when it's cancelled are added before it returns.
+func (dispatcher *Dispatcher) persist(ctx context.Context) {
+	for {
+		dispatcher.incomingLock.Lock()
+		payloads := dispatcher.incoming
+		dispatcher.incoming = nil
+		dispatcher.incomingLock.Unlock()
+		for _, payload := range payloads {
+			if err := dispatcher.Enqueue(payload); err != nil {
+				log.Printf("Failed to queue webhook: %v", err)
+			}
+		}
+		if ctx.Err() != nil && len(payloads) == 0 {
+			return
+		}
+		select {
+		case <-dispatcher.incomingWake:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// Pending returns the number of deliveries that weren't made yet, summed up over all targets.
+func (dispatcher *Dispatcher) Pending() int {
+	dispatcher.incomingLock.Lock()
+	pending := len(dispatcher.incoming) * len(dispatcher.targets)
+	dispatcher.incomingLock.Unlock()
+	for _, target := range dispatcher.targets {
+		pending += target.queue.len()
+	}
+	return pending
+}
+
+// Run queues the payloads of the Listener and makes the deliveries until the context is cancelled.
+// This method should be run as its own routine:
+func (dispatcher *Dispatcher) Run(ctx context.Context) {
+	wait := sync.WaitGroup{}
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		dispatcher.persist(ctx)
+	}()
+	for _, webhookTarget := range dispatcher.targets {
+		wait.Add(1)
+		go func(webhookTarget *target) {
+			defer wait.Done()
+			dispatcher.work(ctx, webhookTarget)
+		}(webhookTarget)
+	}
+	wait.Wait()
+}
+
+// work makes the deliveries of the target one after the other until the context is cancelled.
+func (dispatcher *Dispatcher) work(ctx context.Context, target *target) {
+	for ctx.Err() == nil {
+		name, item, exists, err := target.queue.peek()
+		if err != nil { // a broken file would block the queue forever
+			log.Printf("Dropping unreadable webhook delivery: %v", err)
+			if err := target.queue.fail(name); err != nil {
+				log.Printf("%v", err)
+			}
+			continue
+		}
+		if !exists {
+			select {
+			case <-target.wake:
+			case <-ctx.Done():
+			}
+			continue
+		}
+
+		err = dispatcher.deliver(ctx, target.url, item)
+		if err == nil {
+			if err := target.queue.remove(name); err != nil {
+				log.Printf("%v", err)
+			}
+			continue
+		}
+		if ctx.Err() != nil { // cancelled attempts don't count
+			return
+		}
+		item.Attempts++
+		if dispatcher.config.MaxAttempts > 0 && item.Attempts >= dispatcher.config.MaxAttempts {
+			log.Printf("Giving up webhook delivery %s to \"%s\" after %d attempts: %v", item.ID, target.url, item.Attempts, err)
+			if err := target.queue.fail(name); err != nil {
+				log.Printf("%v", err)
+			}
+			continue
+		}
+		log.Printf("Failed webhook delivery %s to \"%s\" (attempt %d): %v", item.ID, target.url, item.Attempts, err)
+		if err := target.queue.update(name, item); err != nil {
+			log.Printf("%v", err)
+		}
+		select {
+		case <-time.After(dispatcher.backoff(item.Attempts)):
+		case <-ctx.Done():
+		}
+	}
+}
+
+// backoff returns the time to wait after the given number of failed attempts.
+func (dispatcher *Dispatcher) backoff(attempts int) time.Duration {
+	backoff := dispatcher.config.Backoff
+	for i := 1; i < attempts && backoff < dispatcher.config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > dispatcher.config.MaxBackoff {
+		return dispatcher.config.MaxBackoff
+	}
+	return backoff
+}
+
+// deliver POSTs the signed payload of the delivery to the URL, responses other than 2xx are errors.
+func (dispatcher *Dispatcher) deliver(ctx context.Context, targetURL string, item delivery) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, targetURL, bytes.NewReader(item.Payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "lets-goooo-webhook")
+	request.Header.Set(DeliveryHeader, item.ID)
+	request.Header.Set(SignatureHeader, Sign(dispatcher.config.Secret, item.Payload))
+	response, err := dispatcher.config.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024)) // allows reusing the connection
+	_ = response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("unexpected response status %s", response.Status)
+	}
+	return nil
+}
+
+// Sign creates the value of the SignatureHeader for the request body: "sha256=" and the hex encoded HMAC-SHA256.
+func Sign(secret []byte, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks the value of the SignatureHeader for the request body, e.g. for receivers written in Go.
+func VerifySignature(secret []byte, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
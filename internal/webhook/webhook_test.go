@@ -0,0 +1,288 @@
+// Part of the Let's Goooo project
+// Copyright 2021; matriculation numbers: 1103207, 3106445, 4485500
+// Let's goooo get this over together
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"lehre.mosbach.dhbw.de/lets-goooo/v2/internal/journal"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// receivedRequest is a request received by the testReceiver.
+type receivedRequest struct {
+	payload   Payload
+	body      []byte
+	delivery  string
+	signature string
+}
+
+// testReceiver is a local stand-in for a webhook receiver, which answers with the queued status codes and 200 after them.
+type testReceiver struct {
+	server   *httptest.Server
+	lock     sync.Mutex
+	statuses []int
+	requests []receivedRequest
+	received chan struct{}
+}
+
+func newTestReceiver(t *testing.T, statuses ...int) *testReceiver {
+	receiver := testReceiver{statuses: statuses, received: make(chan struct{}, 100)}
+	receiver.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		request := receivedRequest{body: body, delivery: r.Header.Get(DeliveryHeader), signature: r.Header.Get(SignatureHeader)}
+		assert.NoError(t, json.Unmarshal(body, &request.payload))
+
+		receiver.lock.Lock()
+		receiver.requests = append(receiver.requests, request)
+		status := http.StatusOK
+		if len(receiver.statuses) > 0 {
+			status, receiver.statuses = receiver.statuses[0], receiver.statuses[1:]
+		}
+		receiver.lock.Unlock()
+		w.WriteHeader(status)
+		receiver.received <- struct{}{}
+	}))
+	t.Cleanup(receiver.server.Close)
+	return &receiver
+}
+
+// await waits for the given number of requests and returns all requests received so far.
+func (receiver *testReceiver) await(t *testing.T, count int) []receivedRequest {
+	for i := 0; i < count; i++ {
+		select {
+		case <-receiver.received:
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timed out waiting for webhook requests")
+		}
+	}
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	return append([]receivedRequest{}, receiver.requests...)
+}
+
+// runDispatcher runs the dispatcher until the test ends.
+func runDispatcher(t *testing.T, dispatcher *Dispatcher) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		dispatcher.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestNewDispatcher(t *testing.T) {
+	directory := t.TempDir()
+	_, err := NewDispatcher(Config{Targets: []string{"http://localhost/"}, QueueDirectory: directory})
+	assert.Error(t, err, "a secret should be required")
+	_, err = NewDispatcher(Config{Targets: []string{"http://localhost/"}, Secret: testSecret})
+	assert.Error(t, err, "a queue directory should be required")
+	for _, target := range []string{"localhost", "ftp://localhost/", "http://", "::"} {
+		_, err = NewDispatcher(Config{Targets: []string{target}, Secret: testSecret, QueueDirectory: directory})
+		assert.Error(t, err, "%s should be rejected", target)
+	}
+
+	dispatcher, err := NewDispatcher(Config{
+		Targets:        []string{"http://localhost/a", "https://localhost/b"},
+		Secret:         testSecret,
+		QueueDirectory: directory,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultBackoff, dispatcher.config.Backoff)
+	assert.Equal(t, DefaultMaxBackoff, dispatcher.config.MaxBackoff)
+	assert.Len(t, dispatcher.targets, 2)
+	entries, err := os.ReadDir(directory)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "every target should have its own queue")
+}
+
+func TestDispatcher_Listener(t *testing.T) {
+	receiver := newTestReceiver(t)
+	dispatcher, err := NewDispatcher(Config{
+		Targets:        []string{receiver.server.URL},
+		Secret:         testSecret,
+		QueueDirectory: t.TempDir(),
+	})
+	require.NoError(t, err)
+	writer, err := journal.NewWriter(t.TempDir())
+	require.NoError(t, err)
+	defer func() { _ = writer.Close() }()
+	writer.AddListener(dispatcher.Listener())
+	runDispatcher(t, dispatcher)
+
+	location := &journal.Location{Name: "Teststadt", Code: "TST"}
+	user := journal.User{Name: "Tester", Address: "Teststadt"}
+	other := journal.User{Name: "Other", Address: "Teststadt"}
+	require.NoError(t, writer.WriteEventUser(&user, location, journal.LOGIN))
+	require.NoError(t, writer.WriteEventUser(&other, location, journal.LOGIN))
+	require.NoError(t, writer.WriteEventUser(&user, location, journal.LOGOUT))
+
+	requests := receiver.await(t, 3)
+	require.Len(t, requests, 3, "only events should be delivered, not users")
+	assert.Equal(t, CHECKIN, requests[0].payload.Type)
+	assert.Equal(t, CHECKIN, requests[1].payload.Type)
+	assert.Equal(t, CHECKOUT, requests[2].payload.Type)
+	assert.False(t, requests[2].payload.Automatic)
+	for _, request := range requests {
+		assert.Equal(t, "TST", request.payload.Location)
+		assert.InDelta(t, time.Now().Unix(), request.payload.Timestamp, 5)
+		assert.True(t, VerifySignature(testSecret, request.body, request.signature), "the signature should be valid")
+		assert.Len(t, request.delivery, 32)
+	}
+	assert.Equal(t, requests[0].payload.User, requests[2].payload.User, "the user should have the same pseudonym")
+	assert.NotEqual(t, requests[0].payload.User, requests[1].payload.User)
+	assert.NotEqual(t, writer.UserID(&user), requests[0].payload.User, "the pseudonym should differ from the journal ID")
+	assert.Equal(t, dispatcher.pseudonym(journal.WriteNotification{User: &journal.User{Name: " tester ", Address: "TESTSTADT"}}),
+		requests[0].payload.User, "the pseudonym should be derived from the identity of the user")
+	assert.NotEqual(t, requests[0].delivery, requests[2].delivery)
+	assert.Eventually(t, func() bool { return dispatcher.Pending() == 0 }, 5*time.Second, time.Millisecond)
+}
+
+func TestDispatcher_Listener_buffered(t *testing.T) {
+	receiver := newTestReceiver(t)
+	dispatcher, err := NewDispatcher(Config{
+		Targets:        []string{receiver.server.URL},
+		Secret:         testSecret,
+		QueueDirectory: t.TempDir(),
+	})
+	require.NoError(t, err)
+	keyed, err := journal.NewWriterWithConfig(t.TempDir(), journal.WriterConfig{UserIDKey: testSecret})
+	require.NoError(t, err)
+	defer func() { _ = keyed.Close() }()
+	unkeyed, err := journal.NewWriter(t.TempDir())
+	require.NoError(t, err)
+	defer func() { _ = unkeyed.Close() }()
+	keyed.AddListener(dispatcher.Listener())
+	unkeyed.AddListener(dispatcher.Listener())
+
+	location := &journal.Location{Name: "Teststadt", Code: "TST"}
+	user := journal.User{Name: "Tester", Address: "Teststadt"}
+	require.NoError(t, keyed.WriteEventUser(&user, location, journal.LOGIN))
+	require.NoError(t, unkeyed.WriteEventUser(&user, location, journal.LOGIN))
+	assert.Equal(t, 2, dispatcher.Pending())
+	entries, err := os.ReadDir(dispatcher.targets[0].queue.directory)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "the listener shouldn't write to the queue while the journal is locked")
+
+	runDispatcher(t, dispatcher)
+	requests := receiver.await(t, 2)
+	require.Len(t, requests, 2)
+	assert.NotEqual(t, keyed.UserID(&user), unkeyed.UserID(&user))
+	assert.Equal(t, requests[0].payload.User, requests[1].payload.User, "the pseudonym shouldn't depend on the journal IDs")
+	assert.Eventually(t, func() bool { return dispatcher.Pending() == 0 }, 5*time.Second, time.Millisecond)
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	receiver := newTestReceiver(t, http.StatusInternalServerError, http.StatusBadGateway)
+	directory := t.TempDir()
+	dispatcher, err := NewDispatcher(Config{
+		Targets:        []string{receiver.server.URL},
+		Secret:         testSecret,
+		QueueDirectory: directory,
+		Backoff:        time.Millisecond,
+	})
+	require.NoError(t, err)
+	require.NoError(t, dispatcher.Enqueue(Payload{Type: CHECKIN, Location: "TST", Timestamp: 1, User: "first"}))
+	require.NoError(t, dispatcher.Enqueue(Payload{Type: CHECKOUT, Location: "TST", Timestamp: 2, User: "first"}))
+	runDispatcher(t, dispatcher)
+
+	requests := receiver.await(t, 4)
+	require.Len(t, requests, 4)
+	for i, request := range requests[:3] {
+		assert.Equal(t, CHECKIN, request.payload.Type, "the first delivery should be retried before the second one")
+		assert.Equal(t, requests[0].delivery, request.delivery, "retries should keep the delivery ID")
+		assert.Equal(t, requests[0].body, request.body, "retries should send the same body, request %d", i)
+	}
+	assert.Equal(t, CHECKOUT, requests[3].payload.Type)
+	assert.Eventually(t, func() bool { return dispatcher.Pending() == 0 }, 5*time.Second, time.Millisecond)
+}
+
+func TestDispatcher_MaxAttempts(t *testing.T) {
+	receiver := newTestReceiver(t, http.StatusInternalServerError, http.StatusInternalServerError)
+	directory := t.TempDir()
+	dispatcher, err := NewDispatcher(Config{
+		Targets:        []string{receiver.server.URL},
+		Secret:         testSecret,
+		QueueDirectory: directory,
+		MaxAttempts:    2,
+		Backoff:        time.Millisecond,
+	})
+	require.NoError(t, err)
+	require.NoError(t, dispatcher.Enqueue(Payload{Type: CHECKIN, Location: "TST", Timestamp: 1, User: "first"}))
+	require.NoError(t, dispatcher.Enqueue(Payload{Type: CHECKIN, Location: "TST", Timestamp: 2, User: "second"}))
+	runDispatcher(t, dispatcher)
+
+	requests := receiver.await(t, 3)
+	assert.Equal(t, "first", requests[0].payload.User)
+	assert.Equal(t, "first", requests[1].payload.User)
+	assert.Equal(t, "second", requests[2].payload.User, "the first delivery should be given up after 2 attempts")
+	assert.Eventually(t, func() bool { return dispatcher.Pending() == 0 }, 5*time.Second, time.Millisecond)
+	failed, err := os.ReadDir(dispatcher.targets[0].queue.directory)
+	require.NoError(t, err)
+	if assert.Len(t, failed, 1) {
+		assert.Equal(t, "00000000000000000000.json"+failedFileExtension, failed[0].Name(), "given up deliveries should be kept")
+	}
+}
+
+func TestDispatcher_Restart(t *testing.T) {
+	receiver := newTestReceiver(t)
+	directory := t.TempDir()
+	config := Config{Targets: []string{receiver.server.URL}, Secret: testSecret, QueueDirectory: directory}
+	dispatcher, err := NewDispatcher(config)
+	require.NoError(t, err)
+	for i := int64(1); i <= 3; i++ {
+		require.NoError(t, dispatcher.Enqueue(Payload{Type: CHECKIN, Location: "TST", Timestamp: i, User: "user"}))
+	}
+	require.NoError(t, os.WriteFile(path.Join(dispatcher.targets[0].queue.directory, "00000000000000000003.json.tmp"),
+		[]byte("{\"id\":"), 0600), "interrupted writes should be ignored")
+
+	restarted, err := NewDispatcher(config)
+	require.NoError(t, err)
+	assert.Equal(t, 3, restarted.Pending(), "the pending deliveries should survive the restart")
+	require.NoError(t, restarted.Enqueue(Payload{Type: CHECKIN, Location: "TST", Timestamp: 4, User: "user"}))
+	runDispatcher(t, restarted)
+
+	requests := receiver.await(t, 4)
+	for i, request := range requests {
+		assert.Equal(t, int64(i+1), request.payload.Timestamp, "the deliveries should keep their order")
+	}
+}
+
+func TestDispatcher_backoff(t *testing.T) {
+	dispatcher := Dispatcher{config: Config{Backoff: time.Second, MaxBackoff: 10 * time.Second}}
+	assert.Equal(t, time.Second, dispatcher.backoff(1))
+	assert.Equal(t, 2*time.Second, dispatcher.backoff(2))
+	assert.Equal(t, 8*time.Second, dispatcher.backoff(4))
+	assert.Equal(t, 10*time.Second, dispatcher.backoff(5))
+	assert.Equal(t, 10*time.Second, dispatcher.backoff(1000))
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte("{\"type\":\"check-in\"}")
+	signature := Sign(testSecret, body)
+	assert.Regexp(t, "^sha256=[0-9a-f]{64}$", signature)
+	assert.True(t, VerifySignature(testSecret, body, signature))
+	assert.False(t, VerifySignature([]byte("other secret"), body, signature))
+	assert.False(t, VerifySignature(testSecret, []byte("{}"), signature))
+	assert.False(t, VerifySignature(testSecret, body, ""))
+}